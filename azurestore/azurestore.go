@@ -0,0 +1,309 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package azurestore stores the parquet files in Azure Blob Storage
+package azurestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// Backend is the name of the Azure Blob Storage backend in the configuration
+const Backend = "azure"
+
+// Number of blobs to delete in each batch, the maximum allowed
+const deleteMaxKeys = 256
+
+// mebibyte is the unit of the block size
+const mebibyte = 1024 * 1024
+
+// APIError is returned when a request to Azure Blob Storage fails
+type APIError struct {
+	StatusCode int
+	Err        error
+}
+
+func (apiErr *APIError) Error() string {
+	return apiErr.Err.Error()
+}
+
+func (apiErr *APIError) Unwrap() error {
+	return apiErr.Err
+}
+
+// Retryable returns true if the request was throttled or failed because of
+// a server error
+func (apiErr *APIError) Retryable() bool {
+	return apiErr.StatusCode == http.StatusRequestTimeout ||
+		apiErr.StatusCode == http.StatusTooManyRequests ||
+		apiErr.StatusCode >= http.StatusInternalServerError
+}
+
+// wrapError returns an APIError if the error is a response of the Azure API,
+// so it is classified by the retry policy, or the error as it is otherwise
+func wrapError(err error) error {
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) {
+		return &APIError{StatusCode: responseErr.StatusCode, Err: err}
+	}
+	return err
+}
+
+// Store stores the objects in an Azure Blob Storage container
+type Store struct {
+	Client *container.Client
+	// blockSize and concurrency configure the block uploads of the parquet
+	// files. The SDK defaults are used if they are 0.
+	blockSize   int64
+	concurrency int
+}
+
+// New creates a StoreWriter writing into the container named as the
+// configured bucket
+func New(s3Config conf.S3Config) (*s3writer.StoreWriter, error) {
+	if s3Config.PartSize < 0 || s3Config.UploadConcurrency < 0 {
+		return nil, errors.New("the part size and the upload concurrency can't be negative")
+	}
+	client, err := newContainerClient(s3Config)
+	if err != nil {
+		return nil, err
+	}
+
+	return s3writer.NewStoreWriter(&Store{
+		Client:      client,
+		blockSize:   int64(s3Config.PartSize) * mebibyte,
+		concurrency: s3Config.UploadConcurrency,
+	}, s3Config)
+}
+
+// newContainerClient returns the client of the configured container,
+// authenticated with the account key, the SAS token or the Azure default
+// credentials, in this order
+func newContainerClient(s3Config conf.S3Config) (*container.Client, error) {
+	azureConfig := s3Config.Azure
+
+	httpClient, err := s3writer.NewHTTPClient(s3Config)
+	if err != nil {
+		return nil, err
+	}
+	options := &container.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: httpClient}}
+
+	serviceURL := fmt.Sprintf("https://%s.blob.core.windows.net", azureConfig.AccountName)
+	if s3Config.Endpoint != "" {
+		serviceURL = s3writer.EndpointURL(s3Config)
+	} else if azureConfig.AccountName == "" {
+		return nil, errors.New("the Azure account name is needed if there is no endpoint")
+	}
+	containerURL, err := url.JoinPath(serviceURL, s3Config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Azure endpoint: %w", err)
+	}
+
+	switch {
+	case azureConfig.AccountKey != "":
+		credential, err := container.NewSharedKeyCredential(azureConfig.AccountName, azureConfig.AccountKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Azure account key: %w", err)
+		}
+		return container.NewClientWithSharedKeyCredential(containerURL, credential, options)
+	case azureConfig.SASToken != "":
+		return container.NewClientWithNoCredential(
+			containerURL+"?"+strings.TrimPrefix(azureConfig.SASToken, "?"), options)
+	}
+
+	credential, err := azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+		ClientOptions: options.ClientOptions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the Azure default credentials: %w", err)
+	}
+	return container.NewClient(containerURL, credential, options)
+}
+
+// List returns the blobs stored under the given prefix
+func (store *Store) List(ctx context.Context, prefix string) ([]s3writer.ObjectInfo, error) {
+	objects := []s3writer.ObjectInfo{}
+
+	pager := store.Client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			object := s3writer.ObjectInfo{Key: *item.Name}
+			if item.Properties != nil {
+				object.Size = valueOf(item.Properties.ContentLength)
+				object.LastModified = valueOf(item.Properties.LastModified)
+			}
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+// Stat returns the blob stored with the given key
+func (store *Store) Stat(ctx context.Context, key string) (s3writer.ObjectInfo, error) {
+	properties, err := store.Client.NewBlobClient(key).GetProperties(ctx, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return s3writer.ObjectInfo{}, s3writer.ErrObjectNotFound
+		}
+		return s3writer.ObjectInfo{}, wrapError(err)
+	}
+
+	return s3writer.ObjectInfo{
+		Key:          key,
+		Size:         valueOf(properties.ContentLength),
+		LastModified: valueOf(properties.LastModified),
+	}, nil
+}
+
+// Upload stores the content read from the reader in a block blob, uploaded
+// in blocks if it is bigger than a block
+func (store *Store) Upload(ctx context.Context, key string, content io.Reader, options s3writer.StoreUploadOptions) error {
+	uploadOptions := &blockblob.UploadStreamOptions{
+		BlockSize:   store.blockSize,
+		Concurrency: store.concurrency,
+	}
+	if len(options.Metadata) > 0 {
+		uploadOptions.Metadata = make(map[string]*string, len(options.Metadata))
+		for name, value := range options.Metadata {
+			uploadOptions.Metadata[name] = to.Ptr(value)
+		}
+	}
+	if options.IfNotExists {
+		uploadOptions.AccessConditions = &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: to.Ptr(azcore.ETagAny)},
+		}
+	}
+
+	_, err := store.Client.NewBlockBlobClient(key).UploadStream(ctx, content, uploadOptions)
+	if options.IfNotExists && bloberror.HasCode(err, bloberror.BlobAlreadyExists, bloberror.ConditionNotMet) {
+		return s3writer.ErrObjectExists
+	}
+	return wrapError(err)
+}
+
+// ReadRange returns length bytes of the blob stored with the given key,
+// starting at offset
+func (store *Store) ReadRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	response, err := store.Client.NewBlobClient(key).DownloadStream(ctx, &blob.DownloadStreamOptions{
+		Range: blob.HTTPRange{Offset: offset, Count: length},
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	return io.ReadAll(response.Body)
+}
+
+// Delete removes the blobs with the given keys in batches
+func (store *Store) Delete(ctx context.Context, keys []string) error {
+	undeleted := []string{}
+	var requestErr error
+
+	for start := 0; start < len(keys); start += deleteMaxKeys {
+		batch := keys[start:min(start+deleteMaxKeys, len(keys))]
+
+		failed, err := store.deleteBatch(ctx, batch)
+		if err != nil {
+			undeleted = append(undeleted, batch...)
+			if requestErr == nil {
+				requestErr = err
+			}
+			continue
+		}
+		undeleted = append(undeleted, failed...)
+	}
+
+	if len(undeleted) > 0 {
+		return &s3writer.DeleteError{Keys: undeleted, Err: requestErr}
+	}
+	return nil
+}
+
+// deleteBatch removes the given blobs in a single batch request, returning
+// the keys of the ones that couldn't be removed
+func (store *Store) deleteBatch(ctx context.Context, keys []string) ([]string, error) {
+	builder, err := store.Client.NewBatchBuilder()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if err := builder.Delete(key, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := store.Client.SubmitBatch(ctx, builder, nil)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	failed := []string{}
+	for _, item := range response.Responses {
+		if item.Error == nil || isNotFound(item.Error) {
+			continue
+		}
+		// the responses identify their request by its position in the batch
+		if item.ContentID == nil || *item.ContentID < 0 || *item.ContentID >= len(keys) {
+			return nil, fmt.Errorf("unexpected response in the batch delete: %w", wrapError(item.Error))
+		}
+		failed = append(failed, keys[*item.ContentID])
+	}
+	return failed, nil
+}
+
+// Ping returns an error if the container can't be reached
+func (store *Store) Ping(ctx context.Context) error {
+	pager := store.Client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{MaxResults: to.Ptr[int32](1)})
+	_, err := pager.NextPage(ctx)
+	return wrapError(err)
+}
+
+// isNotFound returns true if the error is caused by a missing blob
+func isNotFound(err error) bool {
+	var responseErr *azcore.ResponseError
+	return bloberror.HasCode(err, bloberror.BlobNotFound) ||
+		(errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusNotFound &&
+			!bloberror.HasCode(err, bloberror.ContainerNotFound))
+}
+
+func valueOf[T any](pointer *T) T {
+	var value T
+	if pointer != nil {
+		value = *pointer
+	}
+	return value
+}
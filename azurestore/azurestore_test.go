@@ -0,0 +1,367 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azurestore_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/azurestore"
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/retry"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+	"github.com/RedHatInsights/parquet-factory/utils"
+)
+
+const testContainer = "test-container"
+
+type testRow struct {
+	ID string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// fakeAzure implements the part of the Blob Storage API used by the store,
+// like Azurite does
+type fakeAzure struct {
+	mutex    sync.Mutex
+	blobs    map[string][]byte
+	metadata map[string]map[string]string
+	// blocks stores the staged blocks of every blob by their ID
+	blocks map[string]map[string][]byte
+	// failDeletes makes the deletion of the given blobs fail
+	failDeletes map[string]bool
+}
+
+func newFakeAzure(t *testing.T) (*fakeAzure, *httptest.Server) {
+	fake := &fakeAzure{
+		blobs:       map[string][]byte{},
+		metadata:    map[string]map[string]string{},
+		blocks:      map[string]map[string][]byte{},
+		failDeletes: map[string]bool{},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("x-ms-error-code", code)
+	w.WriteHeader(status)
+}
+
+func (fake *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	query := r.URL.Query()
+	if r.URL.Path == "/"+testContainer {
+		switch {
+		case r.Method == http.MethodGet && query.Get("comp") == "list":
+			fake.list(w, r)
+		case r.Method == http.MethodPost && query.Get("comp") == "batch":
+			fake.batch(w, r)
+		default:
+			writeError(w, http.StatusBadRequest, "UnsupportedOperation")
+		}
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/"+testContainer+"/")
+	switch {
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		if fake.blocks[name] == nil {
+			fake.blocks[name] = map[string][]byte{}
+		}
+		fake.blocks[name][query.Get("blockid")], _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var blockList struct {
+			Latest []string `xml:"Latest"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&blockList); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidXmlDocument")
+			return
+		}
+		content := []byte{}
+		for _, id := range blockList.Latest {
+			content = append(content, fake.blocks[name][id]...)
+		}
+		fake.put(w, r, name, content)
+	case r.Method == http.MethodPut:
+		content, _ := io.ReadAll(r.Body)
+		fake.put(w, r, name, content)
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		fake.get(w, r, name)
+	default:
+		writeError(w, http.StatusBadRequest, "UnsupportedOperation")
+	}
+}
+
+func (fake *fakeAzure) put(w http.ResponseWriter, r *http.Request, name string, content []byte) {
+	if _, ok := fake.blobs[name]; ok && r.Header.Get("If-None-Match") == "*" {
+		writeError(w, http.StatusConflict, "BlobAlreadyExists")
+		return
+	}
+	metadata := map[string]string{}
+	for header, values := range r.Header {
+		if strings.HasPrefix(strings.ToLower(header), "x-ms-meta-") {
+			metadata[strings.ToLower(strings.TrimPrefix(strings.ToLower(header), "x-ms-meta-"))] = values[0]
+		}
+	}
+	fake.blobs[name] = content
+	fake.metadata[name] = metadata
+	delete(fake.blocks, name)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (fake *fakeAzure) get(w http.ResponseWriter, r *http.Request, name string) {
+	content, ok := fake.blobs[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BlobNotFound")
+		return
+	}
+	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	w.Header().Set("x-ms-blob-type", "BlockBlob")
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		return
+	}
+
+	var begin, end int
+	if _, err := fmt.Sscanf(r.Header.Get("x-ms-range"), "bytes=%d-%d", &begin, &end); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidRange")
+		return
+	}
+	end = min(end, len(content)-1)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", begin, end, len(content)))
+	w.Header().Set("Content-Length", strconv.Itoa(end-begin+1))
+	w.WriteHeader(http.StatusPartialContent)
+	_, _ = w.Write(content[begin : end+1])
+}
+
+type listBlob struct {
+	Name       string `xml:"Name"`
+	Properties struct {
+		LastModified  string `xml:"Last-Modified"`
+		ContentLength int    `xml:"Content-Length"`
+	} `xml:"Properties"`
+}
+
+type listResult struct {
+	XMLName    xml.Name   `xml:"EnumerationResults"`
+	Blobs      []listBlob `xml:"Blobs>Blob"`
+	NextMarker string     `xml:"NextMarker"`
+}
+
+func (fake *fakeAzure) list(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for name := range fake.blobs {
+		if strings.HasPrefix(name, r.URL.Query().Get("prefix")) && name > r.URL.Query().Get("marker") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := listResult{}
+	// the pages have 2 blobs at most, so the paging is tested
+	if len(names) > 2 {
+		names = names[:2]
+		result.NextMarker = names[1]
+	}
+	for _, name := range names {
+		blob := listBlob{Name: name}
+		blob.Properties.LastModified = time.Now().UTC().Format(http.TimeFormat)
+		blob.Properties.ContentLength = len(fake.blobs[name])
+		result.Blobs = append(result.Blobs, blob)
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func (fake *fakeAzure) batch(w http.ResponseWriter, r *http.Request) {
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		request, err := http.ReadRequest(bufio.NewReader(part))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidInput")
+			return
+		}
+		name, _ := url.PathUnescape(strings.TrimPrefix(request.URL.EscapedPath(), "/"+testContainer+"/"))
+
+		status := "202 Accepted"
+		switch {
+		case fake.failDeletes[name]:
+			status = "500 Internal Server Error\r\nx-ms-error-code: InternalError"
+		case fake.blobs[name] == nil:
+			status = "404 Not Found\r\nx-ms-error-code: BlobNotFound"
+		default:
+			delete(fake.blobs, name)
+		}
+
+		responsePart, _ := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/http"},
+			"Content-Id":   {part.Header.Get("Content-Id")},
+		})
+		_, _ = fmt.Fprintf(responsePart, "HTTP/1.1 %s\r\nContent-Length: 0\r\n\r\n", status)
+	}
+	_ = writer.Close()
+
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write(body.Bytes())
+}
+
+func newTestWriter(t *testing.T, server *httptest.Server, s3Config conf.S3Config) *s3writer.StoreWriter {
+	s3Config.Endpoint = server.URL
+	s3Config.Bucket = testContainer
+	s3Config.Azure.SASToken = "?sv=2023-01-03&sig=test"
+	storeWriter, err := azurestore.New(s3Config)
+	assert.NoError(t, err)
+	return storeWriter
+}
+
+func writeTestFile(storeWriter *s3writer.StoreWriter, key string, rows int) error {
+	file, err := storeWriter.NewFile(context.Background(), key, &testRow{}, s3writer.FileOptions{})
+	if err != nil {
+		return err
+	}
+	for i := 0; i < rows; i++ {
+		if err := file.AddRow(testRow{ID: strconv.Itoa(i)}); err != nil {
+			return err
+		}
+	}
+	return file.CloseFile()
+}
+
+func TestNew(t *testing.T) {
+	for name, s3Config := range map[string]conf.S3Config{
+		"missing account name": {Bucket: testContainer},
+		"invalid account key": {Bucket: testContainer, Azure: conf.AzureConfig{
+			AccountName: "devstoreaccount1", AccountKey: "not base64!",
+		}},
+		"negative part size": {PartSize: -1, Azure: conf.AzureConfig{AccountName: "devstoreaccount1"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := azurestore.New(s3Config)
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("account key", func(t *testing.T) {
+		_, err := azurestore.New(conf.S3Config{Bucket: testContainer, Azure: conf.AzureConfig{
+			AccountName: "devstoreaccount1", AccountKey: "a2V5",
+		}})
+		assert.NoError(t, err)
+	})
+}
+
+func TestFiles(t *testing.T) {
+	fake, server := newFakeAzure(t)
+	storeWriter := newTestWriter(t, server, conf.S3Config{VerifyUploads: s3writer.VerifyFooter})
+	folder := "fleet_data/cluster_info/hourly/date=2022-01-01/hour=01/"
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, writeTestFile(storeWriter, fmt.Sprintf("%scluster_info-%d.parquet", folder, i), 10))
+	}
+	assert.ErrorIs(t, writeTestFile(storeWriter, folder+"cluster_info-0.parquet", 10), s3writer.ErrObjectExists)
+
+	indexes, err := storeWriter.GetLastIndexForParquet(context.Background(), utils.DefaultPartitionLayout(), folder)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"cluster_info": 2}, indexes)
+
+	assert.NoError(t, storeWriter.CheckSchema(context.Background(), folder, &testRow{}, s3writer.ObjectOptions{}))
+	assert.NoError(t, storeWriter.Ping(context.Background()))
+
+	fake.failDeletes[folder+"cluster_info-1.parquet"] = true
+	err = storeWriter.DeleteFiles([]string{
+		folder + "cluster_info-0.parquet", folder + "cluster_info-1.parquet", folder + "missing.parquet",
+	})
+	var deleteErr *s3writer.DeleteError
+	assert.ErrorAs(t, err, &deleteErr)
+	assert.Equal(t, []string{folder + "cluster_info-1.parquet"}, deleteErr.Keys)
+	assert.Len(t, fake.blobs, 2)
+}
+
+func TestObjects(t *testing.T) {
+	fake, server := newFakeAzure(t)
+	storeWriter := newTestWriter(t, server, conf.S3Config{
+		PartSize: 1,
+		Upload:   conf.UploadConfig{Tags: true},
+	})
+	ctx := context.Background()
+	tags := s3writer.ObjectOptions{Tags: map[string]string{s3writer.TableTag: "rule_hits"}}
+
+	// the content bigger than a block is staged in several blocks
+	content := bytes.Repeat([]byte("x"), 2*1024*1024+10)
+	assert.NoError(t, storeWriter.WriteObject(ctx, "big/object", content, tags))
+	assert.Equal(t, content, fake.blobs["big/object"])
+	assert.Equal(t, tags.Tags, fake.metadata["big/object"])
+
+	assert.NoError(t, storeWriter.CreateObject(ctx, "log/0.json", []byte("{}"), tags))
+	assert.ErrorIs(t, storeWriter.CreateObject(ctx, "log/0.json", []byte("{}"), tags), s3writer.ErrObjectExists)
+
+	keys, err := storeWriter.ListObjects(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"big/object", "log/0.json"}, keys)
+}
+
+func TestAPIError(t *testing.T) {
+	for status, retryable := range map[int]bool{
+		http.StatusTooManyRequests:     true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusForbidden:           false,
+		http.StatusPreconditionFailed:  false,
+		http.StatusInternalServerError: true,
+	} {
+		apiErr := &azurestore.APIError{StatusCode: status}
+		assert.Equal(t, retryable, apiErr.Retryable(), status)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeError(w, http.StatusForbidden, "AuthorizationFailure")
+	}))
+	t.Cleanup(server.Close)
+
+	err := newTestWriter(t, server, conf.S3Config{}).Ping(context.Background())
+	var apiErr *azurestore.APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.False(t, retry.IsRetryable(err))
+}
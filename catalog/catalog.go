@@ -0,0 +1,143 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package catalog generates the metadata needed to register the generated
+// tables in a catalog like Hive or AWS Glue, so they can be queried with
+// engines like Athena or Presto.
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+	"github.com/RedHatInsights/parquet-factory/utils"
+)
+
+// DescriptorFilename is the name of the file storing the table descriptor
+// under the prefix of each table
+const DescriptorFilename = s3writer.SchemaDescriptorFilename
+
+// partitionKeyType is the type of every partition column, as their values are
+// taken from the names of the folders
+const partitionKeyType = "string"
+
+// ColumnDescriptor describes a column of a table
+type ColumnDescriptor struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TableDescriptor describes the columns, partitions and location of a table
+type TableDescriptor struct {
+	Name          string             `json:"name"`
+	Location      string             `json:"location"`
+	Format        string             `json:"format"`
+	SchemaVersion int                `json:"schema_version"`
+	Columns       []ColumnDescriptor `json:"columns"`
+	PartitionKeys []ColumnDescriptor `json:"partition_keys"`
+	// HivePartitioning is false if the partition folders don't follow the
+	// key=value convention, so they must be registered one by one
+	HivePartitioning bool `json:"hive_partitioning"`
+	// ParquetSchema is the schema of the files, used to check the schema of
+	// the files written in the next runs is compatible
+	ParquetSchema *s3writer.FileSchema `json:"parquet_schema"`
+}
+
+// NewTableDescriptor generates the descriptor of the table stored under the
+// given prefix, from the parquet tags of the struct used for its rows
+func NewTableDescriptor(
+	name, tablePrefix string, layout *utils.PartitionLayout, row interface{},
+) (*TableDescriptor, error) {
+	fileSchema, err := s3writer.SchemaFromStruct(row)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor := &TableDescriptor{
+		Name:          name,
+		Location:      tablePrefix,
+		Format:        "parquet",
+		SchemaVersion: fileSchema.Version,
+		Columns:       []ColumnDescriptor{},
+		PartitionKeys: []ColumnDescriptor{},
+		ParquetSchema: fileSchema,
+	}
+
+	for _, columnName := range fileSchema.ColumnNames {
+		column := fileSchema.Columns[columnName]
+		columnType, err := hiveType(column)
+		if err != nil {
+			return nil, fmt.Errorf("column %s of table %s: %w", columnName, name, err)
+		}
+		descriptor.Columns = append(descriptor.Columns, ColumnDescriptor{
+			Name: columnName,
+			Type: columnType,
+		})
+	}
+
+	keys, hiveCompatible := layout.PartitionKeys()
+	for _, key := range keys {
+		descriptor.PartitionKeys = append(descriptor.PartitionKeys, ColumnDescriptor{
+			Name: key.Name,
+			Type: partitionKeyType,
+		})
+	}
+	descriptor.HivePartitioning = hiveCompatible
+
+	return descriptor, nil
+}
+
+// JSON returns the content of the descriptor file
+func (descriptor *TableDescriptor) JSON() ([]byte, error) {
+	return json.MarshalIndent(descriptor, "", "  ")
+}
+
+// hiveType returns the Hive type used to read the given parquet column
+func hiveType(column s3writer.Column) (string, error) {
+	if column.Repetition == "REPEATED" {
+		return "", fmt.Errorf("repeated columns are not supported")
+	}
+
+	switch column.Type {
+	case "BOOLEAN":
+		return "boolean", nil
+	case "INT32":
+		switch column.LogicalType {
+		case "DATE":
+			return "date", nil
+		case "INTEGER(8,true)", "INT_8":
+			return "tinyint", nil
+		case "INTEGER(16,true)", "INT_16":
+			return "smallint", nil
+		}
+		return "int", nil
+	case "INT64":
+		if strings.HasPrefix(column.LogicalType, "TIMESTAMP") {
+			return "timestamp", nil
+		}
+		return "bigint", nil
+	case "INT96":
+		return "timestamp", nil
+	case "FLOAT":
+		return "float", nil
+	case "DOUBLE":
+		return "double", nil
+	case "BYTE_ARRAY", "FIXED_LEN_BYTE_ARRAY":
+		// the tables store text in byte arrays without annotating them
+		return "string", nil
+	}
+	return "", fmt.Errorf("unsupported parquet type %s", column.Type)
+}
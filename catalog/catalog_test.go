@@ -0,0 +1,129 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/catalog"
+	"github.com/RedHatInsights/parquet-factory/utils"
+)
+
+type testTable struct {
+	ClusterID   string  `parquet:"name=cluster_id, type=BYTE_ARRAY, encoding=PLAIN_DICTIONARY"`
+	CollectedAt int64   `parquet:"name=collected_at, type=INT64, logicaltype=TIMESTAMP, logicaltype.isadjustedtoutc=true, logicaltype.unit=MILLIS"`
+	Count       int32   `parquet:"name=count, type=INT32"`
+	Total       int64   `parquet:"name=total, type=INT64"`
+	Ratio       float64 `parquet:"name=ratio, type=DOUBLE"`
+	Enabled     bool    `parquet:"name=enabled, type=BOOLEAN"`
+}
+
+func (testTable) SchemaVersion() int {
+	return 3
+}
+
+const expectedDDL = "CREATE EXTERNAL TABLE IF NOT EXISTS `test_table` (\n" +
+	"  `cluster_id` string,\n" +
+	"  `collected_at` timestamp,\n" +
+	"  `count` int,\n" +
+	"  `total` bigint,\n" +
+	"  `ratio` double,\n" +
+	"  `enabled` boolean\n" +
+	")\n" +
+	"PARTITIONED BY (\n" +
+	"  `date` string,\n" +
+	"  `hour` string\n" +
+	")\n" +
+	"STORED AS PARQUET\n" +
+	"LOCATION 's3://bucket/prefix/test_table/hourly/'\n" +
+	"TBLPROPERTIES ('parquet_factory.schema_version'='3');\n"
+
+func newTestDescriptor(t *testing.T, template string) *catalog.TableDescriptor {
+	layout, err := utils.NewPartitionLayout(template)
+	assert.NoError(t, err)
+
+	descriptor, err := catalog.NewTableDescriptor(
+		"test_table", layout.TablePrefix("prefix", "test_table"), layout, new(testTable))
+	assert.NoError(t, err)
+	return descriptor
+}
+
+func TestNewTableDescriptor(t *testing.T) {
+	descriptor := newTestDescriptor(t, utils.DefaultPartitionTemplate)
+
+	assert.Equal(t, "test_table", descriptor.Name)
+	assert.Equal(t, "prefix/test_table/hourly/", descriptor.Location)
+	assert.Equal(t, 3, descriptor.SchemaVersion)
+	assert.Equal(t, []catalog.ColumnDescriptor{
+		{Name: "cluster_id", Type: "string"},
+		{Name: "collected_at", Type: "timestamp"},
+		{Name: "count", Type: "int"},
+		{Name: "total", Type: "bigint"},
+		{Name: "ratio", Type: "double"},
+		{Name: "enabled", Type: "boolean"},
+	}, descriptor.Columns)
+	assert.Equal(t, []catalog.ColumnDescriptor{
+		{Name: "date", Type: "string"},
+		{Name: "hour", Type: "string"},
+	}, descriptor.PartitionKeys)
+	assert.True(t, descriptor.HivePartitioning)
+	// the parquet schema is stored to check the next files written
+	assert.Equal(t, 3, descriptor.ParquetSchema.Version)
+	assert.Equal(t, []string{"cluster_id", "collected_at", "count", "total", "ratio", "enabled"},
+		descriptor.ParquetSchema.ColumnNames)
+}
+
+func TestNewTableDescriptorInvalidSchema(t *testing.T) {
+	_, err := catalog.NewTableDescriptor(
+		"test_table", "prefix/test_table/", utils.DefaultPartitionLayout(), testTable{})
+	assert.Error(t, err)
+}
+
+func TestTableDescriptorJSON(t *testing.T) {
+	descriptor := newTestDescriptor(t, utils.DefaultPartitionTemplate)
+
+	content, err := descriptor.JSON()
+	assert.NoError(t, err)
+
+	decoded := catalog.TableDescriptor{}
+	assert.NoError(t, json.Unmarshal(content, &decoded))
+	assert.Equal(t, *descriptor, decoded)
+}
+
+func TestCreateTableDDL(t *testing.T) {
+	descriptor := newTestDescriptor(t, utils.DefaultPartitionTemplate)
+	assert.Equal(t, expectedDDL, descriptor.CreateTableDDL("bucket"))
+}
+
+func TestRepairTableDDL(t *testing.T) {
+	t.Run("hive partitions", func(t *testing.T) {
+		descriptor := newTestDescriptor(t, utils.DefaultPartitionTemplate)
+		assert.Equal(t, "MSCK REPAIR TABLE `test_table`;\n", descriptor.RepairTableDDL())
+	})
+
+	t.Run("partitions without key", func(t *testing.T) {
+		descriptor := newTestDescriptor(t, "{prefix}/{table}/{org_id}/date={date}")
+		assert.Contains(t, descriptor.RepairTableDDL(), "ADD PARTITION")
+	})
+
+	t.Run("table without partitions", func(t *testing.T) {
+		descriptor := newTestDescriptor(t, "{prefix}/{table}")
+		assert.Empty(t, descriptor.RepairTableDDL())
+		assert.NotContains(t, descriptor.CreateTableDDL("bucket"), "PARTITIONED BY")
+	})
+}
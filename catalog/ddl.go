@@ -0,0 +1,69 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// CreateTableDDL returns the CREATE EXTERNAL TABLE statement registering the
+// table stored in the given bucket
+func (descriptor *TableDescriptor) CreateTableDDL(bucket string) string {
+	var ddl strings.Builder
+
+	fmt.Fprintf(&ddl, "CREATE EXTERNAL TABLE IF NOT EXISTS `%s` (\n", descriptor.Name)
+	writeColumns(&ddl, descriptor.Columns)
+	ddl.WriteString(")\n")
+
+	if len(descriptor.PartitionKeys) > 0 {
+		ddl.WriteString("PARTITIONED BY (\n")
+		writeColumns(&ddl, descriptor.PartitionKeys)
+		ddl.WriteString(")\n")
+	}
+
+	ddl.WriteString("STORED AS PARQUET\n")
+	fmt.Fprintf(&ddl, "LOCATION 's3://%s/%s'\n", bucket, descriptor.Location)
+	fmt.Fprintf(&ddl, "TBLPROPERTIES ('%s'='%d');\n", s3writer.SchemaVersionKey, descriptor.SchemaVersion)
+
+	return ddl.String()
+}
+
+// RepairTableDDL returns the statement that loads the partitions of the table
+// into the catalog
+func (descriptor *TableDescriptor) RepairTableDDL() string {
+	if len(descriptor.PartitionKeys) == 0 {
+		return ""
+	}
+	if !descriptor.HivePartitioning {
+		return fmt.Sprintf(
+			"-- the partitions of `%s` don't follow the key=value convention,\n"+
+				"-- register them with ALTER TABLE `%s` ADD PARTITION ... LOCATION ...\n",
+			descriptor.Name, descriptor.Name)
+	}
+	return fmt.Sprintf("MSCK REPAIR TABLE `%s`;\n", descriptor.Name)
+}
+
+func writeColumns(ddl *strings.Builder, columns []ColumnDescriptor) {
+	for i, column := range columns {
+		separator := ","
+		if i == len(columns)-1 {
+			separator = ""
+		}
+		fmt.Fprintf(ddl, "  `%s` %s%s\n", column.Name, column.Type, separator)
+	}
+}
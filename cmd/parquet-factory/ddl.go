@@ -0,0 +1,50 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/reportaggregators/rulereportaggregator"
+)
+
+// ddlCommand is the subcommand printing the DDL statements needed to register
+// the generated tables in Hive, AWS Glue or Athena
+const ddlCommand = "ddl"
+
+// printTablesDDL writes the CREATE EXTERNAL TABLE and MSCK REPAIR TABLE
+// statements of every generated table using the given configuration. Only the
+// tables configuration and their prefixes are needed, not the inputs.
+func printTablesDDL(config conf.Config, out io.Writer) error {
+	descriptors, err := rulereportaggregator.TableDescriptors(config)
+	if err != nil {
+		log.Error().Err(err).Msg("cannot generate the table descriptors")
+		return err
+	}
+
+	for _, descriptor := range descriptors {
+		if _, err := fmt.Fprintf(out, "%s\n%s\n",
+			descriptor.CreateTableDDL(config.S3.Bucket), descriptor.RepairTableDDL()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
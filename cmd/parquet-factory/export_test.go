@@ -20,4 +20,9 @@ var (
 	CreateKafkaConsumer  = createKafkaConsumer
 	StartMetrics         = startMetrics
 	StartKafkaCollection = startKafkaCollection
+	WriteResults         = writeResults
+	ErrResultsNotStored  = errResultsNotStored
+	PrintTablesDDL       = printTablesDDL
+	NewStorageWriter     = newStorageWriter
+	NewClaimCheckFetcher = newClaimCheckFetcher
 )
@@ -0,0 +1,97 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/httpserver"
+	"github.com/RedHatInsights/parquet-factory/reportreader"
+)
+
+const (
+	// defaultHTTPServerAddress is used if the HTTP server is enabled without address
+	defaultHTTPServerAddress = ":8000"
+
+	kafkaDependency = "kafka"
+	s3Dependency    = "s3"
+)
+
+// statusServer is the embedded HTTP server, nil if it is disabled
+var statusServer *httpserver.Server
+
+// bufferedRowsReporter is implemented by the aggregators able to tell how
+// many rows are waiting to be written
+type bufferedRowsReporter interface {
+	BufferedRows() map[string]int
+}
+
+func notCreatedYet(dependency string) httpserver.ReadinessCheck {
+	return func(context.Context) error {
+		return errors.New("the " + dependency + " client is not created yet")
+	}
+}
+
+func startHTTPServer(config conf.HTTPServerConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+
+	address := config.Address
+	if address == "" {
+		address = defaultHTTPServerAddress
+	}
+
+	server := httpserver.New(address)
+	server.SetReadinessCheck(kafkaDependency, notCreatedYet(kafkaDependency))
+	server.SetReadinessCheck(s3Dependency, notCreatedYet(s3Dependency))
+	if err := server.Start(); err != nil {
+		return err
+	}
+	statusServer = server
+	return nil
+}
+
+func stopHTTPServer() {
+	if statusServer == nil {
+		return
+	}
+	if err := statusServer.Stop(); err != nil {
+		log.Error().Err(err).Msg("Unable to stop the HTTP server")
+	}
+	statusServer = nil
+}
+
+func registerS3Writer(s3Writer storageWriter) {
+	if statusServer == nil {
+		return
+	}
+	statusServer.SetReadinessCheck(s3Dependency, s3Writer.Ping)
+}
+
+func registerConsumer(consumer *reportreader.KafkaConsumer, aggregator bufferedRowsReporter) {
+	if statusServer == nil {
+		return
+	}
+	statusServer.SetReadinessCheck(kafkaDependency, consumer.Ping)
+	statusServer.SetOffsetsSource(consumer.Offsets)
+	statusServer.SetBufferedRowsSource(aggregator.BufferedRows)
+}
@@ -44,7 +44,7 @@ func startMetrics() error {
 		log.Error().Msgf("metrics cannot be loaded: %s", err)
 		return err
 	}
-	metrics.State.Set(metrics.Init)
+	metrics.SetState(metrics.Init)
 
 	metricsConf := conf.GetMetricsConfiguration()
 	go push.SendMetricsInLoop(ctx, metricsConf.Job, metricsConf.GatewayURL, metricsConf.GatewayAuthToken, time.Duration(metricsConf.TimeBetweenPush)*time.Second)
@@ -24,6 +24,8 @@ limitations under the License.
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -58,6 +60,10 @@ const (
 	topicTag = "topic"
 )
 
+// errResultsNotStored is returned when the results of the run couldn't be
+// stored, so the offsets weren't committed
+var errResultsNotStored = errors.New("the results of the run weren't stored")
+
 var (
 	// buildVersion contains the major.minor version of the CLI client
 	buildVersion = "*not set*"
@@ -82,28 +88,64 @@ func createKafkaConsumer(cfg *conf.KafkaConfig, aggregator dataaggregator.DataAg
 	return consumer, nil
 }
 
-func startKafkaCollection(config conf.Config, s3Writer *s3writer.S3Writer) error {
-	metrics.State.Set(metrics.ConnectToKafka)
-	ruleHitsAggregator := rulereportaggregator.NewRulesReportAggregator()
+func startKafkaCollection(config conf.Config, s3Writer s3writer.S3ParquetWriter) error {
+	metrics.SetState(metrics.ConnectToKafka)
+	ruleHitsAggregator, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(config)
+	if err != nil {
+		log.Error().Err(err).Msg("cannot create aggregator")
+		return err
+	}
+	if config.ClaimCheck.Enabled {
+		fetcher, err := newClaimCheckFetcher(config, s3Writer)
+		if err != nil {
+			return err
+		}
+		ruleHitsAggregator.UseClaimChecks(fetcher)
+	}
 
 	ruleConsumer, err := createKafkaConsumer(&config.RulesKafkaConsumer, ruleHitsAggregator)
 	if err != nil {
 		log.Error().Err(err).Msg("cannot create consumer")
 		return err
 	}
-	metrics.State.Set(metrics.Consume)
+	registerConsumer(ruleConsumer, ruleHitsAggregator)
+	registerRunReportConsumer(ruleConsumer)
+	metrics.SetState(metrics.Consume)
 	var consumers [1]*reportreader.KafkaConsumer
 	consumers[0] = ruleConsumer
 
-	waitForConsumers(consumers[:])
+	for {
+		waitForConsumers(consumers[:])
+
+		log.Info().Msg("Consumers ready for writing")
+		if err := writeResults(consumers[:], s3Writer); err != nil {
+			return err
+		}
+		if !ruleConsumer.FlushRequested() {
+			return nil
+		}
+
+		// a flush control message stopped the partitions, consume again
+		log.Info().Str(topicTag, ruleConsumer.Topic).Msg("Results flushed, resuming the consumer")
+		ruleHitsAggregator.Reset()
+		ruleConsumer.Resume()
+		metrics.SetState(metrics.Consume)
+	}
+}
 
-	log.Info().Msg("Consumers ready for writing")
+// writeResults stores the results of the aggregator of every consumer and
+// commits its offsets. The offsets of a consumer are only committed if its
+// results are stored. The run fails with errResultsNotStored if the results of
+// any consumer couldn't be stored.
+func writeResults(consumers []*reportreader.KafkaConsumer, s3Writer s3writer.S3ParquetWriter) error {
+	var errs []error
 	for _, consumer := range consumers {
 		log.Info().Str(topicTag, consumer.Topic).Msg("running aggregator")
 		numFilesWritten, err := consumer.Aggregator.WriteResults(s3Writer)
 		if err != nil {
 			log.Error().Str(topicTag, consumer.Topic).
 				Err(err).Msg("aggregator failure, no results were stored")
+			errs = append(errs, err)
 		} else {
 			// commit offset only if no errors occurred
 			if numFilesWritten == 0 {
@@ -117,6 +159,9 @@ func startKafkaCollection(config conf.Config, s3Writer *s3writer.S3Writer) error
 		}
 	}
 
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", errResultsNotStored, errors.Join(errs...))
+	}
 	return nil
 }
 
@@ -155,6 +200,13 @@ func main() {
 	}
 	config := conf.GetConfiguration()
 
+	if len(os.Args) > 1 && os.Args[1] == ddlCommand {
+		if err := printTablesDDL(config, os.Stdout); err != nil {
+			os.Exit(BADCONFIG)
+		}
+		os.Exit(SUCCESS)
+	}
+
 	if err := startMetrics(); err != nil {
 		endProgram(METRICSERROR)
 	}
@@ -167,16 +219,30 @@ func main() {
 		log.Warn().Err(err).Msg(`Logger configuration cannot be loaded. Using "debug=true" by default`)
 	}
 
+	if err := startHTTPServer(conf.GetHTTPServerConfiguration()); err != nil {
+		endProgram(BADCONFIG)
+	}
+
+	if err := startTracing(conf.GetTracingConfiguration()); err != nil {
+		endProgram(BADCONFIG)
+	}
+
 	log.Info().Msg("Parquet service")
 	printVersionInfo()
-	s3Writer, err := s3writer.New(conf.GetS3Configuration())
+	startRunReport(config)
+	s3Writer, err := newStorageWriter(conf.GetS3Configuration())
 	if err != nil {
 		endProgram(S3ERROR)
 	}
+	registerS3Writer(s3Writer)
+	registerRunReportWriter(s3Writer)
 
-	metrics.State.Set(metrics.Consume)
+	metrics.SetState(metrics.Consume)
 
 	if err = startKafkaCollection(config, s3Writer); err != nil {
+		if errors.Is(err, errResultsNotStored) {
+			endProgram(S3ERROR)
+		}
 		endProgram(CONSUMERERROR)
 	}
 
@@ -188,7 +254,8 @@ func endProgram(status int) {
 	if status != SUCCESS && status != BADCONFIG {
 		metrics.ErrorCount.Inc()
 	}
-	metrics.State.Set(metrics.Idle)
+	metrics.SetState(metrics.Idle)
+	writeRunReport(status)
 
 	metricsConf := conf.GetMetricsConfiguration()
 	err := push.SendMetrics(metricsConf.Job, metricsConf.GatewayURL, metricsConf.GatewayAuthToken)
@@ -196,6 +263,8 @@ func endProgram(status int) {
 		log.Error().Err(err).Msg("Cannot push metrics")
 	}
 
+	stopTracing(status)
+	stopHTTPServer()
 	logger.CloseZerolog()
 	os.Exit(status)
 }
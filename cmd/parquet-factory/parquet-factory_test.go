@@ -17,6 +17,7 @@ package main_test
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -171,3 +172,122 @@ func TestCommitOffset(t *testing.T) {
 	assert.Equal(t, errorCount, 1)
 	assert.Equal(t, commitCount, 1)
 }
+
+func TestWriteResultsError(t *testing.T) {
+	mockBroker := testhelpers.NewBrokerWith2Topics(t, "t1", "t2")
+	defer mockBroker.Close()
+
+	consumer, err := main.CreateKafkaConsumer(&conf.KafkaConfig{
+		Addresses: []string{mockBroker.Addr()},
+		Topic:     "t1",
+	}, &mock.FaultyAggregator{})
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, consumer.Close())
+	}()
+
+	err = main.WriteResults([]*reportreader.KafkaConsumer{consumer}, nil)
+	assert.ErrorIs(t, err, main.ErrResultsNotStored)
+}
+
+func TestPrintTablesDDL(t *testing.T) {
+	cfg := conf.Config{
+		S3: conf.S3Config{
+			Bucket:         "bucket",
+			FilePathPrefix: "prefix",
+		},
+	}
+
+	output := strings.Builder{}
+	assert.NoError(t, main.PrintTablesDDL(cfg, &output))
+	assert.Contains(t, output.String(), "CREATE EXTERNAL TABLE IF NOT EXISTS `rule_hits`")
+	assert.Contains(t, output.String(), "LOCATION 's3://bucket/prefix/rule_hits/hourly/'")
+	assert.Contains(t, output.String(), "MSCK REPAIR TABLE `rule_hits`;")
+	assert.Contains(t, output.String(), "CREATE EXTERNAL TABLE IF NOT EXISTS `archives`")
+	assert.Contains(t, output.String(), "MSCK REPAIR TABLE `archives`;")
+}
+
+// TestPrintTablesDDLOutputs checks that the tables written under every prefix
+// are printed without reading the files used to generate them
+func TestPrintTablesDDLOutputs(t *testing.T) {
+	cfg := conf.Config{
+		S3: conf.S3Config{
+			Bucket:         "bucket",
+			FilePathPrefix: "prefix",
+		},
+		RulesKafkaConsumer: conf.KafkaConfig{SchemaFile: "missing.json"},
+		Tables: map[string]conf.TableConfig{
+			"rule_hits": {Pseudonymise: []string{"rule_id"}},
+		},
+		Filters: conf.FiltersConfig{
+			ExcludeClustersFile: "missing.txt",
+			FilteredPrefix:      "filtered",
+		},
+		Pseudonymisation: conf.PseudonymisationConfig{
+			KeyFile:      "missing.key",
+			MaskedPrefix: "masked",
+		},
+	}
+
+	output := strings.Builder{}
+	assert.NoError(t, main.PrintTablesDDL(cfg, &output))
+	for _, table := range []string{"rule_hits", "archives"} {
+		assert.Contains(t, output.String(), "CREATE EXTERNAL TABLE IF NOT EXISTS `"+table+"`")
+		assert.Contains(t, output.String(), "LOCATION 's3://bucket/prefix/"+table+"/hourly/'")
+		assert.Contains(t, output.String(), "CREATE EXTERNAL TABLE IF NOT EXISTS `"+table+"_masked`")
+		assert.Contains(t, output.String(), "LOCATION 's3://bucket/masked/"+table+"/hourly/'")
+		assert.Contains(t, output.String(), "CREATE EXTERNAL TABLE IF NOT EXISTS `"+table+"_filtered`")
+		assert.Contains(t, output.String(), "LOCATION 's3://bucket/filtered/"+table+"/hourly/'")
+	}
+}
+
+func TestPrintTablesDDLInvalidConfig(t *testing.T) {
+	cfg := conf.Config{
+		Tables: map[string]conf.TableConfig{
+			"rule_hits": {Partitioning: "{prefix}/{unknown}"},
+		},
+	}
+
+	output := strings.Builder{}
+	assert.Error(t, main.PrintTablesDDL(cfg, &output))
+	assert.Empty(t, output.String())
+}
+
+func TestNewStorageWriter(t *testing.T) {
+	for _, backend := range []string{"", "s3", "azure", "gcs"} {
+		writer, err := main.NewStorageWriter(conf.S3Config{
+			Backend:  backend,
+			Endpoint: "localhost:9000",
+			Bucket:   "test-bucket",
+			Azure:    conf.AzureConfig{SASToken: "sig=test"},
+			GCS:      conf.GCSConfig{Anonymous: true},
+		})
+		assert.NoError(t, err, backend)
+		assert.NotNil(t, writer, backend)
+	}
+
+	_, err := main.NewStorageWriter(conf.S3Config{Backend: "ftp"})
+	assert.Error(t, err)
+}
+
+func TestNewClaimCheckFetcher(t *testing.T) {
+	config := conf.Config{
+		S3: conf.S3Config{
+			Endpoint: "localhost:9000",
+			Bucket:   "test-bucket",
+			Azure:    conf.AzureConfig{SASToken: "sig=test"},
+		},
+		ClaimCheck: conf.ClaimCheckConfig{Enabled: true, CacheDir: t.TempDir()},
+	}
+	writer, err := main.NewStorageWriter(config.S3)
+	assert.NoError(t, err)
+	fetcher, err := main.NewClaimCheckFetcher(config, writer)
+	assert.NoError(t, err)
+	assert.NotNil(t, fetcher)
+
+	config.S3.Backend = "azure"
+	writer, err = main.NewStorageWriter(config.S3)
+	assert.NoError(t, err)
+	_, err = main.NewClaimCheckFetcher(config, writer)
+	assert.ErrorContains(t, err, "only supported")
+}
@@ -0,0 +1,109 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/metrics"
+	"github.com/RedHatInsights/parquet-factory/reportreader"
+	"github.com/RedHatInsights/parquet-factory/runreport"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// runReportTimeout bounds the time spent writing the run report
+const runReportTimeout = 30 * time.Second
+
+var (
+	// runReportWriter stores the run report, nil until the storage writer is
+	// created
+	runReportWriter s3writer.S3ParquetWriter
+	// runReportConsumers are the consumers whose offsets are reported
+	runReportConsumers []*reportreader.KafkaConsumer
+)
+
+func buildInfo() runreport.BuildInfo {
+	return runreport.BuildInfo{
+		Version: buildVersion,
+		Time:    buildTime,
+		Branch:  buildBranch,
+		Commit:  buildCommit,
+	}
+}
+
+func startRunReport(config conf.Config) *runreport.Recorder {
+	recorder := runreport.Start(runreport.NewRunID(), buildInfo(), runreport.ConfigHash(config))
+	log.Info().Str("run_id", recorder.RunID()).Msg("Run started")
+	return recorder
+}
+
+func registerRunReportWriter(writer s3writer.S3ParquetWriter) {
+	runReportWriter = writer
+}
+
+func registerRunReportConsumer(consumer *reportreader.KafkaConsumer) {
+	runReportConsumers = append(runReportConsumers, consumer)
+	if recorder := runreport.Current(); recorder != nil {
+		recorder.RecordStartOffsets(consumer.Offsets())
+	}
+}
+
+func messageCounts() runreport.MessageCounts {
+	rejected := map[string]int64{}
+	for reason, count := range metrics.CounterValues(metrics.MessagesRejected, "reason") {
+		rejected[reason] = int64(count)
+	}
+	control := map[string]int64{}
+	for action, count := range metrics.CounterValues(metrics.ControlMessages, "action") {
+		control[action] = int64(count)
+	}
+	return runreport.MessageCounts{
+		Consumed:  int64(metrics.GaugeValue(metrics.OffsetConsummed)),
+		Processed: int64(metrics.GaugeValue(metrics.OffsetProcessed)),
+		Rejected:  rejected,
+		Control:   control,
+	}
+}
+
+// writeRunReport stores the report of the current run, if it started. It is
+// called when the program finishes, whatever the exit code is.
+func writeRunReport(status int) {
+	recorder := runreport.Current()
+	if recorder == nil {
+		return
+	}
+
+	for _, consumer := range runReportConsumers {
+		recorder.RecordEndOffsets(consumer.Offsets())
+	}
+	report := recorder.Finish(status, time.Now().UTC(), messageCounts(), metrics.PhaseDurations())
+
+	if runReportWriter == nil {
+		log.Warn().Str("run_id", report.RunID).Int("exit_code", status).
+			Msg("The run report can't be stored because the S3 writer wasn't created")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), runReportTimeout)
+	defer cancel()
+	// the error is already logged and the exit code must not change
+	_ = report.Write(ctx, runReportWriter, runReportWriter.Prefix())
+}
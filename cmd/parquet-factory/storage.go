@@ -0,0 +1,75 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/azurestore"
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/gcsstore"
+	"github.com/RedHatInsights/parquet-factory/reportaggregators"
+	"github.com/RedHatInsights/parquet-factory/retry"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// storageWriter writes the parquet files and the run reports into the
+// object storage
+type storageWriter interface {
+	s3writer.S3ParquetWriter
+	Ping(context.Context) error
+}
+
+// newStorageWriter returns the writer of the configured storage backend
+func newStorageWriter(s3Config conf.S3Config) (storageWriter, error) {
+	var (
+		writer storageWriter
+		err    error
+	)
+
+	switch s3Config.Backend {
+	case "", s3writer.Backend:
+		writer, err = s3writer.New(s3Config)
+	case azurestore.Backend:
+		writer, err = azurestore.New(s3Config)
+	case gcsstore.Backend:
+		writer, err = gcsstore.New(s3Config)
+	default:
+		err = fmt.Errorf("unknown storage backend %q, it must be %q, %q or %q",
+			s3Config.Backend, s3writer.Backend, azurestore.Backend, gcsstore.Backend)
+	}
+
+	if err != nil {
+		log.Error().Err(err).Str("backend", s3Config.Backend).Msg("Unable to create the storage writer")
+		return nil, err
+	}
+	return writer, nil
+}
+
+// newClaimCheckFetcher returns the fetcher of the reports referenced by claim
+// checks, which are read with the S3 client of the writer
+func newClaimCheckFetcher(config conf.Config, writer s3writer.S3ParquetWriter) (*reportaggregators.ClaimCheckFetcher, error) {
+	s3Writer, ok := writer.(*s3writer.S3Writer)
+	if !ok {
+		err := fmt.Errorf("the claim checks are only supported by the %q storage backend", s3writer.Backend)
+		log.Error().Err(err).Str("backend", config.S3.Backend).Msg("Unable to fetch the claim checks")
+		return nil, err
+	}
+	return reportaggregators.NewClaimCheckFetcher(
+		config.ClaimCheck, s3Writer.Bucket, s3Writer.S3Client, retry.NewPolicy(config.Retry, config.S3.MaxRetries))
+}
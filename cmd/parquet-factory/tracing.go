@@ -0,0 +1,72 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/tracing"
+)
+
+// tracingShutdownTimeout bounds the time spent flushing the pending spans
+const tracingShutdownTimeout = 10 * time.Second
+
+var (
+	// runSpan is the root span of the current run, nil if it didn't start
+	runSpan trace.Span
+	// shutdownTracing flushes the pending spans before exiting
+	shutdownTracing tracing.ShutdownFunc
+)
+
+func startTracing(config conf.TracingConfig) error {
+	shutdown, err := tracing.Init(config)
+	if err != nil {
+		return err
+	}
+	shutdownTracing = shutdown
+	_, runSpan = tracing.StartRun(context.Background())
+	return nil
+}
+
+func stopTracing(status int) {
+	if runSpan != nil {
+		var err error
+		if status != SUCCESS {
+			err = fmt.Errorf("finished with exit code %d", status)
+		}
+		runSpan.SetAttributes(tracing.ExitCodeKey.Int(status))
+		tracing.EndSpan(runSpan, err)
+		runSpan = nil
+	}
+
+	if shutdownTracing == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		log.Error().Err(err).Msg("Unable to flush the pending spans")
+	}
+	shutdownTracing = nil
+}
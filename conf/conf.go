@@ -46,10 +46,31 @@ type KafkaConfig struct {
 	MaxRecords       int      `mapstructure:"max_consumed_records" toml:"max_consumed_records"`
 	MaxRetries       int      `mapstructure:"max_retries" toml:"max_retries"`
 	ConsumerTimeout  int      `mapstructure:"consumer_timeout" toml:"consumer_timeout"` // Seconds
+	// SchemaFile is the JSON Schema the messages of the topic are validated
+	// against. They aren't validated if it is empty.
+	SchemaFile string `mapstructure:"schema_file" toml:"schema_file"`
+	// Decoder is the format of the messages of the topic, JSON by default
+	Decoder DecoderConfig `mapstructure:"decoder" toml:"decoder"`
+}
+
+// DecoderConfig represents the format of the messages of a topic and where
+// their schemas are taken from
+type DecoderConfig struct {
+	Format string `mapstructure:"format" toml:"format"`
+	// settings of the schema registry the Avro schemas are fetched from
+	RegistryURL      string `mapstructure:"registry_url" toml:"registry_url"`
+	RegistryUsername string `mapstructure:"registry_username" toml:"registry_username"`
+	RegistryPassword string `mapstructure:"registry_password" toml:"registry_password"` // #nosec G117 -- Configuration field, not a hardcoded secret
+	// DescriptorFile is the FileDescriptorSet with the Protobuf MessageType
+	DescriptorFile string `mapstructure:"descriptor_file" toml:"descriptor_file"`
+	MessageType    string `mapstructure:"message_type" toml:"message_type"`
 }
 
 // S3Config represents the configuration for the S3 client
 type S3Config struct {
+	// Backend is the object storage the files are written into: S3 by
+	// default, Azure Blob Storage or Google Cloud Storage
+	Backend        string `mapstructure:"backend" toml:"backend"`
 	Endpoint       string `mapstructure:"endpoint" toml:"endpoint"`
 	Bucket         string `mapstructure:"bucket" toml:"bucket"`
 	FilePathPrefix string `mapstructure:"prefix" toml:"prefix"`
@@ -57,6 +78,140 @@ type S3Config struct {
 	AccessKey      string `mapstructure:"access_key" toml:"access_key"` // #nosec G117 -- Configuration field, not a hardcoded secret
 	SecretKey      string `mapstructure:"secret_key" toml:"secret_key"` // #nosec G117 -- Configuration field, not a hardcoded secret
 	UseSSL         bool   `mapstructure:"use_ssl" toml:"use_ssl"`
+	WriteWorkers   int    `mapstructure:"write_workers" toml:"write_workers"`
+	MaxRetries     int    `mapstructure:"max_retries" toml:"max_retries"`
+	AllowOverwrite bool   `mapstructure:"allow_overwrite" toml:"allow_overwrite"`
+	VerifyUploads  string `mapstructure:"verify_uploads" toml:"verify_uploads"`
+	// transport settings
+	CABundle          string `mapstructure:"ca_bundle" toml:"ca_bundle"`
+	ClientCert        string `mapstructure:"client_cert" toml:"client_cert"`
+	ClientKey         string `mapstructure:"client_key" toml:"client_key"`
+	ProxyURL          string `mapstructure:"proxy_url" toml:"proxy_url"`
+	Addressing        string `mapstructure:"addressing" toml:"addressing"`
+	RequestTimeout    int    `mapstructure:"request_timeout" toml:"request_timeout"` // Seconds
+	PartSize          int    `mapstructure:"part_size" toml:"part_size"`             // MiB
+	UploadConcurrency int    `mapstructure:"upload_concurrency" toml:"upload_concurrency"`
+	// Credentials selects where the credentials are taken from. AccessKey and
+	// SecretKey are used by default.
+	Credentials CredentialsConfig `mapstructure:"credentials" toml:"credentials"`
+	// Upload are the default options of the uploaded objects, replaced by
+	// the ones in TableUploads for the objects of each table
+	Upload       UploadConfig            `mapstructure:"upload" toml:"upload"`
+	TableUploads map[string]UploadConfig `mapstructure:"table_uploads" toml:"table_uploads"`
+	// Azure and GCS are the settings of the Azure Blob Storage and Google
+	// Cloud Storage backends
+	Azure AzureConfig `mapstructure:"azure" toml:"azure"`
+	GCS   GCSConfig   `mapstructure:"gcs" toml:"gcs"`
+}
+
+// AzureConfig represents the credentials used to access Azure Blob Storage.
+// The Azure default credentials are used if neither the account key nor the
+// SAS token are set.
+type AzureConfig struct {
+	AccountName string `mapstructure:"account_name" toml:"account_name"`
+	AccountKey  string `mapstructure:"account_key" toml:"account_key"` // #nosec G117 -- Configuration field, not a hardcoded secret
+	SASToken    string `mapstructure:"sas_token" toml:"sas_token"`     // #nosec G117 -- Configuration field, not a hardcoded secret
+}
+
+// GCSConfig represents the credentials used to access Google Cloud Storage.
+// The Google application default credentials are used if the credentials
+// file is not set.
+type GCSConfig struct {
+	CredentialsFile string `mapstructure:"credentials_file" toml:"credentials_file"`
+	Anonymous       bool   `mapstructure:"anonymous" toml:"anonymous"`
+}
+
+// CredentialsConfig represents the source of the credentials used to access S3
+type CredentialsConfig struct {
+	Source               string `mapstructure:"source" toml:"source"`
+	RoleARN              string `mapstructure:"role_arn" toml:"role_arn"`
+	RoleSessionName      string `mapstructure:"role_session_name" toml:"role_session_name"`
+	ExternalID           string `mapstructure:"external_id" toml:"external_id"`
+	WebIdentityTokenFile string `mapstructure:"web_identity_token_file" toml:"web_identity_token_file"`
+	File                 string `mapstructure:"file" toml:"file"`
+	Profile              string `mapstructure:"profile" toml:"profile"`
+	STSEndpoint          string `mapstructure:"sts_endpoint" toml:"sts_endpoint"`
+}
+
+// UploadConfig represents the options of the objects uploaded to S3
+type UploadConfig struct {
+	ServerSideEncryption string `mapstructure:"server_side_encryption" toml:"server_side_encryption"`
+	KMSKeyID             string `mapstructure:"kms_key_id" toml:"kms_key_id"`
+	SSECustomerKey       string `mapstructure:"sse_customer_key" toml:"sse_customer_key"` // #nosec G117 -- Configuration field, not a hardcoded secret
+	StorageClass         string `mapstructure:"storage_class" toml:"storage_class"`
+	Tags                 bool   `mapstructure:"tags" toml:"tags"`
+}
+
+// TableConfig represents the configuration for each of the generated tables
+type TableConfig struct {
+	Partitioning string `mapstructure:"partitioning" toml:"partitioning"`
+	FileNaming   string `mapstructure:"file_naming" toml:"file_naming"`
+	Format       string `mapstructure:"format" toml:"format"`
+	// Pseudonymise are the columns whose values are replaced by their HMAC
+	Pseudonymise []string `mapstructure:"pseudonymise" toml:"pseudonymise"`
+}
+
+// HTTPServerConfig represents the configuration for the embedded HTTP server
+type HTTPServerConfig struct {
+	Enabled bool   `mapstructure:"enabled" toml:"enabled"`
+	Address string `mapstructure:"address" toml:"address"`
+}
+
+// TracingConfig represents the configuration for the OpenTelemetry tracing
+type TracingConfig struct {
+	Enabled  bool   `mapstructure:"enabled" toml:"enabled"`
+	Exporter string `mapstructure:"exporter" toml:"exporter"`
+	Endpoint string `mapstructure:"endpoint" toml:"endpoint"`
+	Insecure bool   `mapstructure:"insecure" toml:"insecure"`
+}
+
+// RetryConfig represents the backoff between the retries of the failed
+// S3 and Kafka operations
+type RetryConfig struct {
+	InitialBackoff int     `mapstructure:"initial_backoff" toml:"initial_backoff"` // Milliseconds
+	MaxBackoff     int     `mapstructure:"max_backoff" toml:"max_backoff"`         // Milliseconds
+	Multiplier     float64 `mapstructure:"multiplier" toml:"multiplier"`
+	Jitter         float64 `mapstructure:"jitter" toml:"jitter"`
+}
+
+// ClaimCheckConfig represents how the reports stored in the bucket, instead of
+// being sent in the messages, are fetched
+type ClaimCheckConfig struct {
+	Enabled bool `mapstructure:"enabled" toml:"enabled"`
+	// Buckets the reports can be fetched from, the S3 bucket by default
+	Buckets     []string `mapstructure:"buckets" toml:"buckets"`
+	Concurrency int      `mapstructure:"concurrency" toml:"concurrency"`
+	MaxSize     int      `mapstructure:"max_size" toml:"max_size"` // MiB
+	CacheDir    string   `mapstructure:"cache_dir" toml:"cache_dir"`
+	CacheSize   int      `mapstructure:"cache_size" toml:"cache_size"` // MiB
+}
+
+// FiltersConfig represents the clusters, organizations and rules whose rows
+// are generated. Every row is generated if it is empty.
+type FiltersConfig struct {
+	IncludeClusters     []string `mapstructure:"include_clusters" toml:"include_clusters"`
+	IncludeClustersFile string   `mapstructure:"include_clusters_file" toml:"include_clusters_file"`
+	ExcludeClusters     []string `mapstructure:"exclude_clusters" toml:"exclude_clusters"`
+	ExcludeClustersFile string   `mapstructure:"exclude_clusters_file" toml:"exclude_clusters_file"`
+	IncludeOrgs         []string `mapstructure:"include_orgs" toml:"include_orgs"`
+	ExcludeOrgs         []string `mapstructure:"exclude_orgs" toml:"exclude_orgs"`
+	// IncludeRules and ExcludeRules are glob patterns of the rule IDs
+	IncludeRules []string `mapstructure:"include_rules" toml:"include_rules"`
+	ExcludeRules []string `mapstructure:"exclude_rules" toml:"exclude_rules"`
+	// FilteredPrefix is where the filtered rows are written. They are dropped
+	// if it is empty.
+	FilteredPrefix string `mapstructure:"filtered_prefix" toml:"filtered_prefix"`
+}
+
+// PseudonymisationConfig represents how the columns configured for every
+// table are pseudonymised
+type PseudonymisationConfig struct {
+	// KeyFile stores the secret key of the HMAC
+	KeyFile string `mapstructure:"key_file" toml:"key_file"`
+	// MaskedPrefix is where the pseudonymised copy of the tables is written,
+	// along with the raw tables. Only the pseudonymised tables are written if
+	// it is empty.
+	MaskedPrefix string `mapstructure:"masked_prefix" toml:"masked_prefix"`
 }
 
 // Config represents the configuration for the parquet-factory
@@ -68,6 +223,13 @@ type Config struct {
 	Sentry             logger.SentryLoggingConfiguration `mapstructure:"sentry" toml:"sentry"`
 	TimeShift          int                               `mapstructure:"time_shift" toml:"time_shift"` // Minutes
 	Metrics            types.MetricsConfiguration        `mapstructure:"metrics" toml:"metrics"`
+	Tables             map[string]TableConfig            `mapstructure:"tables" toml:"tables"`
+	HTTPServer         HTTPServerConfig                  `mapstructure:"http_server" toml:"http_server"`
+	Tracing            TracingConfig                     `mapstructure:"tracing" toml:"tracing"`
+	Retry              RetryConfig                       `mapstructure:"retry" toml:"retry"`
+	ClaimCheck         ClaimCheckConfig                  `mapstructure:"claim_check" toml:"claim_check"`
+	Filters            FiltersConfig                     `mapstructure:"filters" toml:"filters"`
+	Pseudonymisation   PseudonymisationConfig            `mapstructure:"pseudonymisation" toml:"pseudonymisation"`
 }
 
 // config holds the loaded configuration
@@ -228,6 +390,26 @@ func GetS3Configuration() S3Config {
 	return config.S3
 }
 
+// GetTableConfiguration returns the configuration for the given table
+func GetTableConfiguration(table string) TableConfig {
+	return config.Tables[table]
+}
+
+// GetHTTPServerConfiguration returns the embedded HTTP server configuration
+func GetHTTPServerConfiguration() HTTPServerConfig {
+	return config.HTTPServer
+}
+
+// GetTracingConfiguration returns the OpenTelemetry tracing configuration
+func GetTracingConfiguration() TracingConfig {
+	return config.Tracing
+}
+
+// GetRetryConfiguration returns the backoff used to retry the failed operations
+func GetRetryConfiguration() RetryConfig {
+	return config.Retry
+}
+
 // GetMetricsConfiguration returns metrics configuration
 func GetMetricsConfiguration() types.MetricsConfiguration {
 	return config.Metrics
@@ -104,6 +104,13 @@ func TestGetS3Configuration(t *testing.T) {
 			Region:         "us-east-1",
 			AccessKey:      "minio",
 			SecretKey:      "minio123",
+			Upload: conf.UploadConfig{
+				ServerSideEncryption: "aws:kms",
+				KMSKeyID:             "test_key",
+			},
+			TableUploads: map[string]conf.UploadConfig{
+				"archives": {StorageClass: "STANDARD_IA", Tags: true},
+			},
 		},
 		cfg,
 	)
@@ -126,6 +133,20 @@ func TestGetMetricsConfiguration(t *testing.T) {
 	)
 }
 
+func TestGetTableConfiguration(t *testing.T) {
+	os.Clearenv()
+	mustLoadConfiguration(t, "../testdata/config1")
+
+	assert.Equal(
+		t,
+		conf.TableConfig{
+			Partitioning: "{prefix}/{table}/year={year}/month={month}/day={day}/hour={hour}",
+		},
+		conf.GetTableConfiguration("rule_hits"),
+	)
+	assert.Equal(t, conf.TableConfig{}, conf.GetTableConfiguration("archives"))
+}
+
 type testCase struct {
 	name           string
 	clowderFile    string
@@ -191,3 +212,47 @@ func TestCheckUpdateClowder(t *testing.T) {
 		})
 	}
 }
+
+func TestGetHTTPServerConfiguration(t *testing.T) {
+	os.Clearenv()
+	mustLoadConfiguration(t, "../testdata/config1")
+
+	assert.Equal(
+		t,
+		conf.HTTPServerConfig{
+			Enabled: true,
+			Address: ":9000",
+		},
+		conf.GetHTTPServerConfiguration(),
+	)
+}
+
+func TestGetTracingConfiguration(t *testing.T) {
+	os.Clearenv()
+	mustLoadConfiguration(t, "../testdata/config1")
+
+	assert.Equal(
+		t,
+		conf.TracingConfig{
+			Enabled:  true,
+			Exporter: "stdout",
+		},
+		conf.GetTracingConfiguration(),
+	)
+}
+
+func TestGetRetryConfiguration(t *testing.T) {
+	os.Clearenv()
+	mustLoadConfiguration(t, "../testdata/config1")
+
+	assert.Equal(
+		t,
+		conf.RetryConfig{
+			InitialBackoff: 100,
+			MaxBackoff:     5000,
+			Multiplier:     3,
+			Jitter:         0.1,
+		},
+		conf.GetRetryConfiguration(),
+	)
+}
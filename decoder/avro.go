@@ -0,0 +1,108 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/retry"
+)
+
+// AvroDecoder decodes the Avro messages framed in the Confluent wire format,
+// whose schemas are fetched from the registry by their ID
+type AvroDecoder struct {
+	Registry *Registry
+	// codecs caches the codecs of the schemas already fetched by their ID
+	codecs map[uint32]*goavro.Codec
+	mutex  sync.Mutex
+}
+
+// NewAvroDecoder returns an AvroDecoder fetching the schemas from the
+// configured registry
+func NewAvroDecoder(config conf.DecoderConfig, retryPolicy retry.Policy) (*AvroDecoder, error) {
+	if config.RegistryURL == "" {
+		return nil, errors.New("the schema registry URL is needed to decode Avro messages")
+	}
+
+	return &AvroDecoder{
+		Registry: &Registry{
+			URL:         config.RegistryURL,
+			Username:    config.RegistryUsername,
+			Password:    config.RegistryPassword,
+			Client:      &http.Client{Timeout: registryTimeout},
+			RetryPolicy: retryPolicy,
+		},
+		codecs: map[uint32]*goavro.Codec{},
+	}, nil
+}
+
+// Decode returns the Avro message as JSON. The unions are converted into
+// their value, as in any other JSON document.
+func (decoder *AvroDecoder) Decode(value []byte) ([]byte, error) {
+	id, payload, err := splitWireFormat(value)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := decoder.codec(id)
+	if err != nil {
+		return nil, err
+	}
+
+	native, remaining, err := codec.NativeFromBinary(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro message for the schema %d: %w", id, err)
+	}
+	if len(remaining) > 0 {
+		return nil, fmt.Errorf("invalid Avro message for the schema %d: %d trailing bytes", id, len(remaining))
+	}
+	return codec.TextualFromNative(nil, native)
+}
+
+// codec returns the codec of the schema with the given ID, fetching it from
+// the registry the first time
+func (decoder *AvroDecoder) codec(id uint32) (*goavro.Codec, error) {
+	decoder.mutex.Lock()
+	defer decoder.mutex.Unlock()
+
+	if codec, ok := decoder.codecs[id]; ok {
+		return codec, nil
+	}
+
+	schema, err := decoder.Registry.Schema(context.Background(), id)
+	if isUnknownSchema(err) {
+		return nil, fmt.Errorf("unknown Avro schema %d: %w", id, err)
+	}
+	if err != nil {
+		log.Error().Err(err).Uint32("schema_id", id).Msg("Unable to fetch the Avro schema from the registry")
+		return nil, &SchemaError{ID: id, Err: err}
+	}
+	codec, err := goavro.NewCodecForStandardJSONFull(schema)
+	if err != nil {
+		// the messages using an invalid schema can't be decoded later either
+		return nil, fmt.Errorf("invalid Avro schema %d: %w", id, err)
+	}
+
+	log.Info().Uint32("schema_id", id).Msg("Avro schema fetched from the registry")
+	decoder.codecs[id] = codec
+	return codec, nil
+}
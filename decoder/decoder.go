@@ -0,0 +1,106 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package decoder converts the messages consumed from Kafka into the JSON
+// documents handled by the aggregators, whatever format they are produced in.
+package decoder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/retry"
+)
+
+// Formats of the messages
+const (
+	JSONFormat     = "json"
+	AvroFormat     = "avro"
+	ProtobufFormat = "protobuf"
+)
+
+// magicByte starts the messages framed in the Confluent wire format, followed
+// by the ID of their schema in the registry
+const magicByte = 0
+
+// Decoder converts the value of a message into JSON, so it is parsed the same
+// way whatever its format is. A SchemaError is returned if the schema of the
+// message can't be fetched, and any other error if the message can't be
+// decoded.
+type Decoder interface {
+	Decode(value []byte) ([]byte, error)
+}
+
+// SchemaError is returned when the schema needed to decode a message can't be
+// fetched. Unlike the invalid messages, the message may be decoded later.
+type SchemaError struct {
+	ID  uint32
+	Err error
+}
+
+func (err *SchemaError) Error() string {
+	return fmt.Sprintf("unable to fetch the schema %d: %v", err.ID, err.Err)
+}
+
+func (err *SchemaError) Unwrap() error {
+	return err.Err
+}
+
+// New returns the decoder of the configured format. The requests to the schema
+// registry are retried with the given policy.
+func New(config conf.DecoderConfig, retryPolicy retry.Policy) (Decoder, error) {
+	var (
+		decoder Decoder
+		err     error
+	)
+
+	switch config.Format {
+	case "", JSONFormat:
+		decoder = JSONDecoder{}
+	case AvroFormat:
+		decoder, err = NewAvroDecoder(config, retryPolicy)
+	case ProtobufFormat:
+		decoder, err = NewProtobufDecoder(config)
+	default:
+		err = fmt.Errorf("unknown message format %q, it must be %q, %q or %q",
+			config.Format, JSONFormat, AvroFormat, ProtobufFormat)
+	}
+
+	if err != nil {
+		log.Error().Err(err).Str("format", config.Format).Msg("Unable to create the message decoder")
+		return nil, err
+	}
+	return decoder, nil
+}
+
+// JSONDecoder returns the messages as they are
+type JSONDecoder struct{}
+
+// Decode returns the value of the message unchanged
+func (JSONDecoder) Decode(value []byte) ([]byte, error) {
+	return value, nil
+}
+
+// splitWireFormat returns the schema ID and the payload of a message framed
+// in the Confluent wire format
+func splitWireFormat(value []byte) (uint32, []byte, error) {
+	if len(value) < 5 || value[0] != magicByte {
+		return 0, nil, errors.New("the message isn't framed in the schema registry wire format")
+	}
+	return binary.BigEndian.Uint32(value[1:5]), value[5:], nil
+}
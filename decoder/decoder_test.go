@@ -0,0 +1,303 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decoder_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/decoder"
+	"github.com/RedHatInsights/parquet-factory/retry"
+)
+
+const avroSchema = `{
+	"type": "record",
+	"name": "RulesResults",
+	"fields": [
+		{"name": "path", "type": "string"},
+		{"name": "metadata", "type": {
+			"type": "record",
+			"name": "Metadata",
+			"fields": [{"name": "cluster_id", "type": "string"}]
+		}},
+		{"name": "request_id", "type": ["null", "string"], "default": null}
+	]
+}`
+
+const expectedReport = `{
+	"path": "archives/compressed/00/00000000-0000-0000-0000-000000000000/202101/20/031044.tar.gz",
+	"metadata": {"cluster_id": "00000000-0000-0000-0000-000000000000"},
+	"request_id": "req"
+}`
+
+func fastPolicy() retry.Policy {
+	return retry.Policy{MaxRetries: 2, InitialBackoff: time.Microsecond, Multiplier: 2}
+}
+
+// registry serves the schema with ID 1 and counts the requests received
+type registry struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newRegistry(t *testing.T, status int) *registry {
+	r := &registry{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.requests.Add(1)
+		user, password, _ := req.BasicAuth()
+		switch {
+		case status != http.StatusOK:
+			w.WriteHeader(status)
+		case user != "user" || password != "secret":
+			w.WriteHeader(http.StatusUnauthorized)
+		case req.URL.Path == "/schemas/ids/1":
+			_ = json.NewEncoder(w).Encode(map[string]string{"schema": avroSchema})
+		case req.URL.Path == "/schemas/ids/2":
+			_ = json.NewEncoder(w).Encode(map[string]string{"schema": "syntax = \"proto3\";", "schemaType": "PROTOBUF"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func avroDecoder(t *testing.T, url string) decoder.Decoder {
+	d, err := decoder.New(conf.DecoderConfig{
+		Format:           decoder.AvroFormat,
+		RegistryURL:      url,
+		RegistryUsername: "user",
+		RegistryPassword: "secret",
+	}, fastPolicy())
+	assert.NoError(t, err)
+	return d
+}
+
+func avroMessage(t *testing.T, id uint32) []byte {
+	codec, err := goavro.NewCodecForStandardJSONFull(avroSchema)
+	assert.NoError(t, err)
+	native, _, err := codec.NativeFromTextual([]byte(expectedReport))
+	assert.NoError(t, err)
+
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[1:], id)
+	message, err := codec.BinaryFromNative(header, native)
+	assert.NoError(t, err)
+	return message
+}
+
+func TestNew(t *testing.T) {
+	d, err := decoder.New(conf.DecoderConfig{}, fastPolicy())
+	assert.NoError(t, err)
+	assert.IsType(t, decoder.JSONDecoder{}, d)
+
+	_, err = decoder.New(conf.DecoderConfig{Format: "xml"}, fastPolicy())
+	assert.ErrorContains(t, err, `unknown message format "xml"`)
+
+	_, err = decoder.New(conf.DecoderConfig{Format: decoder.AvroFormat}, fastPolicy())
+	assert.Error(t, err)
+
+	_, err = decoder.New(conf.DecoderConfig{Format: decoder.ProtobufFormat}, fastPolicy())
+	assert.Error(t, err)
+
+	_, err = decoder.New(conf.DecoderConfig{
+		Format: decoder.ProtobufFormat, DescriptorFile: "missing.pb", MessageType: "test.RulesResults",
+	}, fastPolicy())
+	assert.Error(t, err)
+}
+
+func TestJSONDecoder(t *testing.T) {
+	value := []byte("not even json")
+	decoded, err := decoder.JSONDecoder{}.Decode(value)
+	assert.NoError(t, err)
+	assert.Equal(t, value, decoded)
+}
+
+func TestAvroDecoder(t *testing.T) {
+	server := newRegistry(t, http.StatusOK)
+	d := avroDecoder(t, server.URL)
+
+	for i := 0; i < 3; i++ {
+		decoded, err := d.Decode(avroMessage(t, 1))
+		assert.NoError(t, err)
+		assert.JSONEq(t, expectedReport, string(decoded))
+	}
+	// the schema is cached after the first message
+	assert.EqualValues(t, 1, server.requests.Load())
+
+	// an unknown schema can't be decoded later either
+	var schemaErr *decoder.SchemaError
+	_, err := d.Decode(avroMessage(t, 3))
+	assert.ErrorContains(t, err, "unknown Avro schema 3")
+	assert.NotErrorAs(t, err, &schemaErr)
+
+	_, err = d.Decode(avroMessage(t, 2))
+	assert.ErrorContains(t, err, "isn't an Avro schema")
+	assert.NotErrorAs(t, err, &schemaErr)
+
+	_, err = d.Decode([]byte(expectedReport))
+	assert.ErrorContains(t, err, "wire format")
+
+	message := avroMessage(t, 1)
+	_, err = d.Decode(message[:len(message)-3])
+	assert.ErrorContains(t, err, "invalid Avro message")
+
+	_, err = d.Decode(append(message, 0))
+	assert.ErrorContains(t, err, "trailing bytes")
+}
+
+func TestAvroDecoderRegistryError(t *testing.T) {
+	server := newRegistry(t, http.StatusServiceUnavailable)
+	d := avroDecoder(t, server.URL)
+
+	_, err := d.Decode(avroMessage(t, 1))
+	var schemaErr *decoder.SchemaError
+	assert.ErrorAs(t, err, &schemaErr)
+	assert.EqualValues(t, 1, schemaErr.ID)
+	// the request is retried
+	assert.EqualValues(t, 3, server.requests.Load())
+
+	var registryErr *decoder.RegistryError
+	assert.ErrorAs(t, err, &registryErr)
+	assert.Equal(t, http.StatusServiceUnavailable, registryErr.StatusCode)
+
+	// the failed schemas aren't cached
+	_, err = d.Decode(avroMessage(t, 1))
+	assert.ErrorAs(t, err, &schemaErr)
+	assert.EqualValues(t, 6, server.requests.Load())
+}
+
+func TestAvroDecoderUnauthorized(t *testing.T) {
+	server := newRegistry(t, http.StatusOK)
+	d, err := decoder.New(conf.DecoderConfig{Format: decoder.AvroFormat, RegistryURL: server.URL}, fastPolicy())
+	assert.NoError(t, err)
+
+	_, err = d.Decode(avroMessage(t, 1))
+	var schemaErr *decoder.SchemaError
+	assert.ErrorAs(t, err, &schemaErr)
+	// the client errors aren't retried
+	assert.EqualValues(t, 1, server.requests.Load())
+}
+
+// descriptorFile writes the FileDescriptorSet of the test.RulesResults message
+func descriptorFile(t *testing.T) (string, *descriptorpb.FileDescriptorProto) {
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	msg := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("rules_results.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Metadata"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{Name: proto.String("cluster_id"), JsonName: proto.String("clusterId"), Number: proto.Int32(1), Type: str, Label: optional},
+				},
+			},
+			{
+				Name: proto.String("RulesResults"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{Name: proto.String("path"), JsonName: proto.String("path"), Number: proto.Int32(1), Type: str, Label: optional},
+					{Name: proto.String("metadata"), JsonName: proto.String("metadata"), Number: proto.Int32(2), Type: msg, Label: optional, TypeName: proto.String(".test.Metadata")},
+					{Name: proto.String("request_id"), JsonName: proto.String("requestId"), Number: proto.Int32(3), Type: str, Label: optional},
+				},
+			},
+		},
+	}
+	content, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "rules_results.pb")
+	assert.NoError(t, os.WriteFile(path, content, 0o600))
+	return path, file
+}
+
+func protobufMessage(t *testing.T, file *descriptorpb.FileDescriptorProto) []byte {
+	fd, err := protodesc.NewFile(file, nil)
+	assert.NoError(t, err)
+	message := dynamicpb.NewMessage(fd.Messages().ByName("RulesResults"))
+	assert.NoError(t, protojson.Unmarshal([]byte(expectedReport), message))
+
+	value, err := proto.Marshal(message)
+	assert.NoError(t, err)
+	return value
+}
+
+func TestProtobufDecoder(t *testing.T) {
+	path, file := descriptorFile(t)
+	d, err := decoder.New(conf.DecoderConfig{
+		Format: decoder.ProtobufFormat, DescriptorFile: path, MessageType: "test.RulesResults",
+	}, fastPolicy())
+	assert.NoError(t, err)
+
+	message := protobufMessage(t, file)
+	decoded, err := d.Decode(message)
+	assert.NoError(t, err)
+	assert.JSONEq(t, expectedReport, string(decoded))
+
+	// framed in the wire format with the indexes of the second message type
+	framed := append([]byte{0, 0, 0, 0, 7, 2, 2}, message...)
+	decoded, err = d.Decode(framed)
+	assert.NoError(t, err)
+	assert.JSONEq(t, expectedReport, string(decoded))
+
+	// framed with the shortcut index of the first message type
+	_, err = d.Decode(append([]byte{0, 0, 0, 0, 7, 0}, message...))
+	assert.NoError(t, err)
+
+	_, err = d.Decode([]byte{0, 0, 0})
+	assert.ErrorContains(t, err, "wire format")
+
+	_, err = d.Decode([]byte{0, 0, 0, 0, 7, 4, 2})
+	assert.ErrorContains(t, err, "message indexes")
+
+	_, err = d.Decode(message[:len(message)-3])
+	assert.ErrorContains(t, err, "invalid Protobuf message")
+}
+
+func TestProtobufDecoderMessageType(t *testing.T) {
+	path, _ := descriptorFile(t)
+	for _, messageType := range []string{"test.Unknown", "test.RulesResults.path"} {
+		_, err := decoder.New(conf.DecoderConfig{
+			Format: decoder.ProtobufFormat, DescriptorFile: path, MessageType: messageType,
+		}, fastPolicy())
+		assert.Error(t, err, messageType)
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.pb")
+	assert.NoError(t, os.WriteFile(invalid, []byte("not a descriptor"), 0o600))
+	_, err := decoder.New(conf.DecoderConfig{
+		Format: decoder.ProtobufFormat, DescriptorFile: invalid, MessageType: "test.RulesResults",
+	}, fastPolicy())
+	assert.ErrorContains(t, err, "invalid descriptor file")
+}
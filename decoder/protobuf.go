@@ -0,0 +1,135 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decoder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+)
+
+// ProtobufDecoder decodes the Protobuf messages of the configured message
+// type. The messages may be framed in the Confluent wire format, but their
+// type is always taken from the descriptor file.
+type ProtobufDecoder struct {
+	MessageType protoreflect.MessageType
+	marshal     protojson.MarshalOptions
+}
+
+// NewProtobufDecoder returns a ProtobufDecoder of the message type found in
+// the configured FileDescriptorSet, as generated by protoc --descriptor_set_out
+// with --include_imports
+func NewProtobufDecoder(config conf.DecoderConfig) (*ProtobufDecoder, error) {
+	if config.DescriptorFile == "" || config.MessageType == "" {
+		return nil, errors.New("the descriptor file and the message type are needed to decode Protobuf messages")
+	}
+
+	content, err := os.ReadFile(config.DescriptorFile)
+	if err != nil {
+		return nil, err
+	}
+	descriptorSet := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(content, descriptorSet); err != nil {
+		return nil, fmt.Errorf("invalid descriptor file %s: %w", config.DescriptorFile, err)
+	}
+	files, err := protodesc.NewFiles(descriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor file %s: %w", config.DescriptorFile, err)
+	}
+
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(config.MessageType))
+	if err != nil {
+		return nil, fmt.Errorf("message type %s: %w", config.MessageType, err)
+	}
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message type", config.MessageType)
+	}
+
+	return &ProtobufDecoder{
+		MessageType: dynamicpb.NewMessageType(messageDescriptor),
+		marshal: protojson.MarshalOptions{
+			// the fields are named as in the JSON messages
+			UseProtoNames: true,
+			Resolver:      typeResolver(files),
+		},
+	}, nil
+}
+
+// typeResolver resolves the types of the descriptor file, like the ones
+// stored in Any fields, and the well-known types
+func typeResolver(files *protoregistry.Files) *protoregistry.Types {
+	types := &protoregistry.Types{}
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		messages := file.Messages()
+		for i := 0; i < messages.Len(); i++ {
+			_ = types.RegisterMessage(dynamicpb.NewMessageType(messages.Get(i)))
+		}
+		return true
+	})
+	return types
+}
+
+// Decode returns the Protobuf message as JSON
+func (decoder *ProtobufDecoder) Decode(value []byte) ([]byte, error) {
+	payload, err := stripProtobufFraming(value)
+	if err != nil {
+		return nil, err
+	}
+
+	message := decoder.MessageType.New().Interface()
+	if err := proto.Unmarshal(payload, message); err != nil {
+		return nil, fmt.Errorf("invalid Protobuf message: %w", err)
+	}
+	return decoder.marshal.Marshal(message)
+}
+
+// stripProtobufFraming returns the payload of the messages framed in the
+// Confluent wire format, which are followed by the indexes of their message
+// type. A raw Protobuf message can't start with the magic byte, as 0 is not
+// a valid field number.
+func stripProtobufFraming(value []byte) ([]byte, error) {
+	if len(value) == 0 || value[0] != magicByte {
+		return value, nil
+	}
+
+	_, payload, err := splitWireFormat(value)
+	if err != nil {
+		return nil, err
+	}
+	count, n := binary.Varint(payload)
+	if n <= 0 || count < 0 {
+		return nil, errors.New("invalid message indexes in the Protobuf message")
+	}
+	payload = payload[n:]
+	for i := int64(0); i < count; i++ {
+		if _, n = binary.Varint(payload); n <= 0 {
+			return nil, errors.New("invalid message indexes in the Protobuf message")
+		}
+		payload = payload[n:]
+	}
+	return payload, nil
+}
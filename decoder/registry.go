@@ -0,0 +1,121 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decoder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/parquet-factory/retry"
+)
+
+// registryTimeout is the maximum time of every request sent to the registry
+const registryTimeout = 10 * time.Second
+
+// RegistryError is returned when the registry answers a request with an error
+type RegistryError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *RegistryError) Error() string {
+	return fmt.Sprintf("schema registry error %d: %s", err.StatusCode, err.Message)
+}
+
+// Retryable returns true if the request failed because of a transient error
+func (err *RegistryError) Retryable() bool {
+	return err.StatusCode == http.StatusTooManyRequests || err.StatusCode >= http.StatusInternalServerError
+}
+
+// errNotAvroSchema is returned when the schema fetched isn't an Avro schema
+var errNotAvroSchema = errors.New("the schema isn't an Avro schema")
+
+// Registry fetches the Avro schemas from a Confluent compatible schema
+// registry
+type Registry struct {
+	URL      string
+	Username string
+	Password string
+	Client   *http.Client
+	// RetryPolicy retries the requests failed because of a transient error
+	RetryPolicy retry.Policy
+}
+
+// registrySchema is the response of the registry to a schema request
+type registrySchema struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType"`
+}
+
+// isUnknownSchema returns true if the error is caused by a schema ID that
+// isn't in the registry or that isn't an Avro schema, so the messages using it
+// can't ever be decoded
+func isUnknownSchema(err error) bool {
+	var registryErr *RegistryError
+	return errors.Is(err, errNotAvroSchema) ||
+		(errors.As(err, &registryErr) && registryErr.StatusCode == http.StatusNotFound)
+}
+
+// Schema returns the schema stored in the registry with the given ID
+func (registry *Registry) Schema(ctx context.Context, id uint32) (string, error) {
+	var schema registrySchema
+	err := registry.RetryPolicy.Do(ctx, "fetch_schema", func() error {
+		var err error
+		schema, err = registry.fetchSchema(ctx, id)
+		return err
+	})
+	return schema.Schema, err
+}
+
+func (registry *Registry) fetchSchema(ctx context.Context, id uint32) (registrySchema, error) {
+	url := fmt.Sprintf("%s/schemas/ids/%d", strings.TrimSuffix(registry.URL, "/"), id)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return registrySchema{}, err
+	}
+	request.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if registry.Username != "" {
+		request.SetBasicAuth(registry.Username, registry.Password)
+	}
+
+	response, err := registry.Client.Do(request)
+	if err != nil {
+		return registrySchema{}, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return registrySchema{}, &RegistryError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	var schema registrySchema
+	if err := json.NewDecoder(response.Body).Decode(&schema); err != nil {
+		return registrySchema{}, fmt.Errorf("invalid schema registry response: %w", err)
+	}
+	// the registry only returns the type of the schemas that aren't Avro
+	if schema.SchemaType != "" && schema.SchemaType != "AVRO" {
+		return registrySchema{}, fmt.Errorf("%w: %s", errNotAvroSchema, schema.SchemaType)
+	}
+	return schema, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deltalog
+
+import (
+	"encoding/json"
+
+	"github.com/RedHatInsights/parquet-factory/catalog"
+)
+
+// Actions stored in the commit files, as described in
+// https://github.com/delta-io/delta/blob/master/PROTOCOL.md#actions
+
+type action struct {
+	CommitInfo *commitInfo `json:"commitInfo,omitempty"`
+	Protocol   *protocol   `json:"protocol,omitempty"`
+	MetaData   *metaData   `json:"metaData,omitempty"`
+	Add        *add        `json:"add,omitempty"`
+	Remove     *remove     `json:"remove,omitempty"`
+}
+
+type commitInfo struct {
+	Timestamp           int64             `json:"timestamp"`
+	Operation           string            `json:"operation"`
+	OperationParameters map[string]string `json:"operationParameters"`
+	EngineInfo          string            `json:"engineInfo"`
+	TxnID               string            `json:"txnId,omitempty"`
+}
+
+type protocol struct {
+	MinReaderVersion int `json:"minReaderVersion"`
+	MinWriterVersion int `json:"minWriterVersion"`
+}
+
+type format struct {
+	Provider string            `json:"provider"`
+	Options  map[string]string `json:"options"`
+}
+
+type metaData struct {
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Format           format            `json:"format"`
+	SchemaString     string            `json:"schemaString"`
+	PartitionColumns []string          `json:"partitionColumns"`
+	Configuration    map[string]string `json:"configuration"`
+	CreatedTime      int64             `json:"createdTime"`
+}
+
+type add struct {
+	Path             string            `json:"path"`
+	PartitionValues  map[string]string `json:"partitionValues"`
+	Size             int64             `json:"size"`
+	ModificationTime int64             `json:"modificationTime"`
+	DataChange       bool              `json:"dataChange"`
+	Stats            string            `json:"stats,omitempty"`
+}
+
+type remove struct {
+	Path                 string            `json:"path"`
+	DeletionTimestamp    int64             `json:"deletionTimestamp"`
+	DataChange           bool              `json:"dataChange"`
+	ExtendedFileMetadata bool              `json:"extendedFileMetadata"`
+	PartitionValues      map[string]string `json:"partitionValues"`
+	Size                 int64             `json:"size"`
+}
+
+type stats struct {
+	NumRecords int64 `json:"numRecords"`
+}
+
+// structField and structType describe the schema of the table using the
+// Spark JSON representation expected in schemaString
+type structField struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	Nullable bool              `json:"nullable"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+type structType struct {
+	Type   string        `json:"type"`
+	Fields []structField `json:"fields"`
+}
+
+// sparkTypes maps the Hive types used by the catalog into the Spark ones
+var sparkTypes = map[string]string{
+	"tinyint":  "byte",
+	"smallint": "short",
+	"int":      "integer",
+	"bigint":   "long",
+}
+
+// schemaString returns the schema of the table described by the descriptor,
+// including its partition columns
+func schemaString(descriptor *catalog.TableDescriptor) (string, error) {
+	schema := structType{Type: "struct", Fields: []structField{}}
+
+	columns := append([]catalog.ColumnDescriptor{}, descriptor.Columns...)
+	columns = append(columns, descriptor.PartitionKeys...)
+	for _, column := range columns {
+		columnType, ok := sparkTypes[column.Type]
+		if !ok {
+			columnType = column.Type
+		}
+		schema.Fields = append(schema.Fields, structField{
+			Name:     column.Name,
+			Type:     columnType,
+			Nullable: true,
+			Metadata: map[string]string{},
+		})
+	}
+
+	content, err := json.Marshal(schema)
+	return string(content), err
+}
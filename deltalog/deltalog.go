@@ -0,0 +1,297 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package deltalog commits the files generated for a table into a Delta Lake
+// transaction log stored under the table prefix, so readers using the log see
+// all the files of a run or none of them.
+package deltalog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/catalog"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+const (
+	// LogFolder is the folder storing the transaction log under the table prefix
+	LogFolder = "_delta_log/"
+
+	// commitFilenameTemplate is the name of every commit file: the version
+	// padded with zeroes to 20 digits
+	commitFilenameTemplate = "%020d.json"
+
+	// maxCommitAttempts is the number of times a commit is retried when
+	// another writer stores the same version first
+	maxCommitAttempts = 5
+
+	engineInfo = "parquet-factory"
+)
+
+// ObjectStore is the storage where the transaction log is kept
+type ObjectStore interface {
+	ListObjects(context.Context, string) ([]string, error)
+	CreateObject(context.Context, string, []byte, s3writer.ObjectOptions) error
+}
+
+// DataFile describes a parquet file to be added to the table
+type DataFile struct {
+	Key             string
+	PartitionValues map[string]string
+	Size            int64
+	Rows            int64
+}
+
+// Log is the transaction log of a table
+type Log struct {
+	// Tags describing the commit files, stored if the upload options of the
+	// table enable them
+	Tags       map[string]string
+	store      ObjectStore
+	descriptor *catalog.TableDescriptor
+}
+
+// New returns the transaction log of the table described by the descriptor.
+// It is stored under the location of the table.
+func New(store ObjectStore, descriptor *catalog.TableDescriptor) *Log {
+	return &Log{
+		store:      store,
+		descriptor: descriptor,
+	}
+}
+
+// Prefix returns the prefix of the commit files
+func (deltaLog *Log) Prefix() string {
+	return deltaLog.descriptor.Location + LogFolder
+}
+
+// LatestVersion returns the version of the latest commit, or -1 if the log
+// is empty
+func (deltaLog *Log) LatestVersion(ctx context.Context) (int64, error) {
+	keys, err := deltaLog.store.ListObjects(ctx, deltaLog.Prefix())
+	if err != nil {
+		return -1, err
+	}
+
+	latest := int64(-1)
+	for _, key := range keys {
+		name := path.Base(key)
+		if !strings.HasSuffix(name, ".json") {
+			// checkpoints and other files stored in the log
+			continue
+		}
+		version, err := strconv.ParseInt(strings.TrimSuffix(name, ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// Commit adds the given files to the table as a single new version, returned
+// on success. Nothing is committed if the list of files is empty.
+func (deltaLog *Log) Commit(ctx context.Context, runID string, files []DataFile) (int64, error) {
+	return deltaLog.commit(ctx, runID, files, false)
+}
+
+// Revert removes the given files, added by a previous commit, from the table
+// as a single new version, returned on success. It is used to undo a commit
+// when the run fails after it. Nothing is committed if the list of files is
+// empty.
+func (deltaLog *Log) Revert(ctx context.Context, runID string, files []DataFile) (int64, error) {
+	return deltaLog.commit(ctx, runID, files, true)
+}
+
+// commit stores a new version adding the given files to the table, or
+// removing them from it
+func (deltaLog *Log) commit(ctx context.Context, runID string, files []DataFile, revert bool) (int64, error) {
+	if len(files) == 0 {
+		return -1, nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		latest, err := deltaLog.LatestVersion(ctx)
+		if err != nil {
+			return -1, err
+		}
+		version := latest + 1
+
+		content, err := deltaLog.commitContent(version, runID, files, revert)
+		if err != nil {
+			return -1, err
+		}
+
+		key := deltaLog.Prefix() + fmt.Sprintf(commitFilenameTemplate, version)
+		err = deltaLog.store.CreateObject(ctx, key, content, s3writer.ObjectOptions{
+			Table: deltaLog.descriptor.Name,
+			Tags:  deltaLog.Tags,
+		})
+		if err == nil {
+			message := "Files committed to the transaction log"
+			if revert {
+				message = "Files removed from the transaction log"
+			}
+			log.Info().
+				Str("table", deltaLog.descriptor.Name).
+				Int64("version", version).
+				Int("files", len(files)).
+				Msg(message)
+			return version, nil
+		}
+		if !errors.Is(err, s3writer.ErrObjectExists) || attempt == maxCommitAttempts {
+			return -1, err
+		}
+		log.Warn().
+			Str("table", deltaLog.descriptor.Name).
+			Int64("version", version).
+			Msg("Version already committed by another writer, retrying")
+	}
+}
+
+// commitContent generates the actions of the given version, one per line
+func (deltaLog *Log) commitContent(version int64, runID string, files []DataFile, revert bool) ([]byte, error) {
+	now := time.Now().UnixMilli()
+
+	if revert {
+		return encodeActions(deltaLog.removeActions(now, runID, files))
+	}
+
+	actions := []action{{
+		CommitInfo: &commitInfo{
+			Timestamp:           now,
+			Operation:           "WRITE",
+			OperationParameters: map[string]string{"mode": "Append"},
+			EngineInfo:          engineInfo,
+			TxnID:               runID,
+		},
+	}}
+
+	if version == 0 {
+		actions = append(actions, action{
+			Protocol: &protocol{MinReaderVersion: 1, MinWriterVersion: 2},
+		})
+	}
+
+	// the metadata is stored on every commit, so new columns are added to
+	// the schema as soon as they are written
+	metadata, err := deltaLog.metaData(now)
+	if err != nil {
+		return nil, err
+	}
+	actions = append(actions, action{MetaData: metadata})
+
+	for _, file := range files {
+		fileStats, err := json.Marshal(stats{NumRecords: file.Rows})
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action{
+			Add: &add{
+				Path:             strings.TrimPrefix(file.Key, deltaLog.descriptor.Location),
+				PartitionValues:  file.PartitionValues,
+				Size:             file.Size,
+				ModificationTime: now,
+				DataChange:       true,
+				Stats:            string(fileStats),
+			},
+		})
+	}
+
+	return encodeActions(actions)
+}
+
+// removeActions generates the actions removing the given files from the
+// table. The schema isn't changed, so no metadata is stored.
+func (deltaLog *Log) removeActions(now int64, runID string, files []DataFile) []action {
+	actions := []action{{
+		CommitInfo: &commitInfo{
+			Timestamp:           now,
+			Operation:           "DELETE",
+			OperationParameters: map[string]string{},
+			EngineInfo:          engineInfo,
+			TxnID:               runID,
+		},
+	}}
+
+	for _, file := range files {
+		actions = append(actions, action{
+			Remove: &remove{
+				Path:                 strings.TrimPrefix(file.Key, deltaLog.descriptor.Location),
+				DeletionTimestamp:    now,
+				DataChange:           true,
+				ExtendedFileMetadata: true,
+				PartitionValues:      file.PartitionValues,
+				Size:                 file.Size,
+			},
+		})
+	}
+	return actions
+}
+
+// encodeActions stores the actions one per line
+func encodeActions(actions []action) ([]byte, error) {
+	var content bytes.Buffer
+	encoder := json.NewEncoder(&content)
+	for i := range actions {
+		if err := encoder.Encode(actions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return content.Bytes(), nil
+}
+
+func (deltaLog *Log) metaData(createdTime int64) (*metaData, error) {
+	schema, err := schemaString(deltaLog.descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionColumns := []string{}
+	for _, key := range deltaLog.descriptor.PartitionKeys {
+		partitionColumns = append(partitionColumns, key.Name)
+	}
+
+	return &metaData{
+		ID:               tableID(deltaLog.descriptor.Location),
+		Name:             deltaLog.descriptor.Name,
+		Format:           format{Provider: "parquet", Options: map[string]string{}},
+		SchemaString:     schema,
+		PartitionColumns: partitionColumns,
+		Configuration:    map[string]string{},
+		CreatedTime:      createdTime,
+	}, nil
+}
+
+// tableID returns a UUID formatted identifier for the table stored at the
+// given location. It must never change for the same table.
+func tableID(location string) string {
+	sum := sha256.Sum256([]byte(location))
+	id := hex.EncodeToString(sum[:16])
+	return strings.Join([]string{id[0:8], id[8:12], id[12:16], id[16:20], id[20:32]}, "-")
+}
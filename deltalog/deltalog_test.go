@@ -0,0 +1,222 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deltalog_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/catalog"
+	"github.com/RedHatInsights/parquet-factory/deltalog"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// memoryStore keeps the objects in memory. The keys in conflicts are
+// reported as already existing once, like if another writer stored them.
+type memoryStore struct {
+	objects   map[string][]byte
+	conflicts map[string]bool
+	err       error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{objects: map[string][]byte{}, conflicts: map[string]bool{}}
+}
+
+func (store *memoryStore) ListObjects(_ context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	for key := range store.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, store.err
+}
+
+func (store *memoryStore) CreateObject(_ context.Context, key string, content []byte, _ s3writer.ObjectOptions) error {
+	if store.err != nil {
+		return store.err
+	}
+	if store.conflicts[key] {
+		delete(store.conflicts, key)
+		store.objects[key] = []byte("{}")
+		return s3writer.ErrObjectExists
+	}
+	if _, ok := store.objects[key]; ok {
+		return s3writer.ErrObjectExists
+	}
+	store.objects[key] = content
+	return nil
+}
+
+var testDescriptor = &catalog.TableDescriptor{
+	Name:     "rule_hits",
+	Location: "prefix/rule_hits/hourly/",
+	Columns: []catalog.ColumnDescriptor{
+		{Name: "cluster_id", Type: "string"},
+		{Name: "collected_at", Type: "timestamp"},
+		{Name: "count", Type: "int"},
+	},
+	PartitionKeys: []catalog.ColumnDescriptor{
+		{Name: "date", Type: "string"},
+		{Name: "hour", Type: "string"},
+	},
+	HivePartitioning: true,
+}
+
+var testFiles = []deltalog.DataFile{
+	{
+		Key:             "prefix/rule_hits/hourly/date=2022-01-02/hour=03/rule_hits-0.parquet",
+		PartitionValues: map[string]string{"date": "2022-01-02", "hour": "03"},
+		Size:            1234,
+		Rows:            10,
+	},
+	{
+		Key:             "prefix/rule_hits/hourly/date=2022-01-02/hour=04/rule_hits-0.parquet",
+		PartitionValues: map[string]string{"date": "2022-01-02", "hour": "04"},
+		Size:            567,
+		Rows:            5,
+	},
+}
+
+func readActions(t *testing.T, content []byte) []map[string]map[string]interface{} {
+	actions := []map[string]map[string]interface{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		action := map[string]map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &action))
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+func TestCommit(t *testing.T) {
+	store := newMemoryStore()
+	deltaLog := deltalog.New(store, testDescriptor)
+	assert.Equal(t, "prefix/rule_hits/hourly/_delta_log/", deltaLog.Prefix())
+
+	latest, err := deltaLog.LatestVersion(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), latest)
+
+	t.Run("first commit creates the table", func(t *testing.T) {
+		version, err := deltaLog.Commit(context.Background(), "run-1", testFiles)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), version)
+
+		actions := readActions(t, store.objects["prefix/rule_hits/hourly/_delta_log/00000000000000000000.json"])
+		assert.Len(t, actions, 5)
+		assert.Equal(t, "run-1", actions[0]["commitInfo"]["txnId"])
+		assert.Contains(t, actions[1], "protocol")
+
+		metadata := actions[2]["metaData"]
+		assert.Equal(t, []interface{}{"date", "hour"}, metadata["partitionColumns"])
+		schema := metadata["schemaString"].(string)
+		assert.Contains(t, schema, `{"name":"count","type":"integer","nullable":true,"metadata":{}}`)
+		assert.Contains(t, schema, `{"name":"date","type":"string","nullable":true,"metadata":{}}`)
+
+		added := actions[3]["add"]
+		assert.Equal(t, "date=2022-01-02/hour=03/rule_hits-0.parquet", added["path"])
+		assert.Equal(t, map[string]interface{}{"date": "2022-01-02", "hour": "03"}, added["partitionValues"])
+		assert.Equal(t, float64(1234), added["size"])
+		assert.Equal(t, true, added["dataChange"])
+		assert.Equal(t, `{"numRecords":10}`, added["stats"])
+	})
+
+	t.Run("next commits keep the table ID", func(t *testing.T) {
+		version, err := deltaLog.Commit(context.Background(), "run-2", testFiles[:1])
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), version)
+
+		first := readActions(t, store.objects["prefix/rule_hits/hourly/_delta_log/00000000000000000000.json"])
+		second := readActions(t, store.objects["prefix/rule_hits/hourly/_delta_log/00000000000000000001.json"])
+		assert.Len(t, second, 3)
+		assert.NotContains(t, second[1], "protocol")
+		assert.Equal(t, first[2]["metaData"]["id"], second[1]["metaData"]["id"])
+	})
+
+	t.Run("nothing is committed without files", func(t *testing.T) {
+		version, err := deltaLog.Commit(context.Background(), "run-3", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(-1), version)
+		assert.Len(t, store.objects, 2)
+	})
+}
+
+func TestRevert(t *testing.T) {
+	store := newMemoryStore()
+	deltaLog := deltalog.New(store, testDescriptor)
+
+	_, err := deltaLog.Commit(context.Background(), "run-1", testFiles)
+	assert.NoError(t, err)
+
+	version, err := deltaLog.Revert(context.Background(), "run-1", testFiles)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	actions := readActions(t, store.objects["prefix/rule_hits/hourly/_delta_log/00000000000000000001.json"])
+	assert.Len(t, actions, 3)
+	assert.Equal(t, "DELETE", actions[0]["commitInfo"]["operation"])
+	assert.Equal(t, "run-1", actions[0]["commitInfo"]["txnId"])
+
+	removed := actions[1]["remove"]
+	assert.Equal(t, "date=2022-01-02/hour=03/rule_hits-0.parquet", removed["path"])
+	assert.Equal(t, map[string]interface{}{"date": "2022-01-02", "hour": "03"}, removed["partitionValues"])
+	assert.Equal(t, float64(1234), removed["size"])
+	assert.Equal(t, true, removed["dataChange"])
+
+	version, err = deltaLog.Revert(context.Background(), "run-2", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), version)
+	assert.Len(t, store.objects, 2)
+}
+
+func TestCommitConflict(t *testing.T) {
+	store := newMemoryStore()
+	store.conflicts["prefix/rule_hits/hourly/_delta_log/00000000000000000000.json"] = true
+	deltaLog := deltalog.New(store, testDescriptor)
+
+	version, err := deltaLog.Commit(context.Background(), "run-1", testFiles)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+}
+
+func TestCommitError(t *testing.T) {
+	store := newMemoryStore()
+	store.err = errors.New("an error")
+	deltaLog := deltalog.New(store, testDescriptor)
+
+	_, err := deltaLog.Commit(context.Background(), "run-1", testFiles)
+	assert.Error(t, err)
+}
+
+func TestLatestVersionIgnoresOtherFiles(t *testing.T) {
+	store := newMemoryStore()
+	store.objects["prefix/rule_hits/hourly/_delta_log/00000000000000000003.json"] = []byte("{}")
+	store.objects["prefix/rule_hits/hourly/_delta_log/00000000000000000010.checkpoint.parquet"] = []byte("")
+	store.objects["prefix/rule_hits/hourly/_delta_log/_last_checkpoint"] = []byte("{}")
+	deltaLog := deltalog.New(store, testDescriptor)
+
+	latest, err := deltaLog.LatestVersion(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), latest)
+}
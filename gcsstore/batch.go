@@ -0,0 +1,152 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// Delete removes the objects with the given keys in batches
+func (store *Store) Delete(ctx context.Context, keys []string) error {
+	undeleted := []string{}
+	var requestErr error
+
+	for start := 0; start < len(keys); start += deleteMaxKeys {
+		batch := keys[start:min(start+deleteMaxKeys, len(keys))]
+
+		failed, err := store.deleteBatch(ctx, batch)
+		if err != nil {
+			undeleted = append(undeleted, batch...)
+			if requestErr == nil {
+				requestErr = err
+			}
+			continue
+		}
+		undeleted = append(undeleted, failed...)
+	}
+
+	if len(undeleted) > 0 {
+		return &s3writer.DeleteError{Keys: undeleted, Err: requestErr}
+	}
+	return nil
+}
+
+// deleteBatch removes the given objects in a single batch request, returning
+// the keys of the ones that couldn't be removed
+func (store *Store) deleteBatch(ctx context.Context, keys []string) ([]string, error) {
+	endpoint, err := url.Parse(store.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for i, key := range keys {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/http"},
+			"Content-Id":   {fmt.Sprintf("<%d>", i)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		path := strings.TrimSuffix(endpoint.Path, "/") + "/storage/v1/b/" +
+			url.PathEscape(store.Bucket) + "/o/" + url.PathEscape(key)
+		if _, err := fmt.Fprintf(part, "DELETE %s HTTP/1.1\r\n\r\n", path); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, store.Endpoint+"/batch/storage/v1", body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+
+	response, err := store.do(request, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(response)
+
+	return failedDeletes(response, keys)
+}
+
+// failedDeletes returns the keys whose deletion failed in the response of a
+// batch. The missing objects are considered deleted.
+func failedDeletes(response *http.Response, keys []string) ([]string, error) {
+	_, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid batch response: %w", err)
+	}
+
+	deleted := make([]bool, len(keys))
+	reader := multipart.NewReader(response.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch response: %w", err)
+		}
+
+		index, err := responseIndex(part.Header.Get("Content-Id"))
+		if err != nil || index >= len(keys) {
+			return nil, fmt.Errorf("invalid batch response: unknown part %q", part.Header.Get("Content-Id"))
+		}
+		partResponse, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch response: %w", err)
+		}
+		_ = partResponse.Body.Close()
+
+		switch partResponse.StatusCode {
+		case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+			deleted[index] = true
+		}
+	}
+
+	failed := []string{}
+	for i, key := range keys {
+		if !deleted[i] {
+			failed = append(failed, key)
+		}
+	}
+	return failed, nil
+}
+
+// responseIndex returns the index of the request answered by a part of a
+// batch response, identified as <response-index>
+func responseIndex(contentID string) (int, error) {
+	contentID = strings.TrimSuffix(strings.TrimPrefix(contentID, "<"), ">")
+	return strconv.Atoi(strings.TrimPrefix(contentID, "response-"))
+}
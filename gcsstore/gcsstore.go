@@ -0,0 +1,476 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gcsstore stores the parquet files in Google Cloud Storage, using
+// its JSON API. The few requests needed are sent with the HTTP client shared by
+// the other stores instead of the Cloud Storage client library, which doesn't
+// send batch requests and would pull gRPC and its dependencies into the
+// binary. The same requests are served by fake-gcs-server in the tests.
+package gcsstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// Backend is the name of the Google Cloud Storage backend in the configuration
+const Backend = "gcs"
+
+// DefaultEndpoint is the endpoint of Google Cloud Storage
+const DefaultEndpoint = "https://storage.googleapis.com"
+
+// storageScope is the OAuth2 scope needed to read, write and delete objects
+const storageScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// Number of objects to list in each request
+const listMaxKeys = 1000
+
+// Number of objects to delete in each batch, the maximum allowed
+const deleteMaxKeys = 100
+
+// mebibyte is the unit of the chunk size
+const mebibyte = 1024 * 1024
+
+// defaultChunkSize is the size of the chunks the objects are uploaded in
+const defaultChunkSize = 16 * mebibyte
+
+// maxErrorBody is the maximum number of bytes read from an error response
+const maxErrorBody = 64 * 1024
+
+// APIError is returned when a request to Google Cloud Storage fails
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (apiErr *APIError) Error() string {
+	return fmt.Sprintf("GCS request failed with status %d: %s", apiErr.StatusCode, apiErr.Message)
+}
+
+// Retryable returns true if the request was throttled or failed because of
+// a server error
+func (apiErr *APIError) Retryable() bool {
+	return apiErr.StatusCode == http.StatusRequestTimeout ||
+		apiErr.StatusCode == http.StatusTooManyRequests ||
+		apiErr.StatusCode >= http.StatusInternalServerError
+}
+
+// Store stores the objects in a Google Cloud Storage bucket
+type Store struct {
+	Client   *http.Client
+	Endpoint string
+	Bucket   string
+	// chunkSize is the size of the chunks of the resumable uploads
+	chunkSize int
+}
+
+// object is the part of the GCS object resource used by the store
+type object struct {
+	Name    string    `json:"name"`
+	Size    string    `json:"size"`
+	Updated time.Time `json:"updated"`
+	CRC32C  string    `json:"crc32c"`
+}
+
+// New creates a StoreWriter writing into the configured bucket
+func New(s3Config conf.S3Config) (*s3writer.StoreWriter, error) {
+	if s3Config.PartSize < 0 {
+		return nil, errors.New("the part size can't be negative")
+	}
+	client, err := newHTTPClient(s3Config)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := DefaultEndpoint
+	if s3Config.Endpoint != "" {
+		endpoint = s3writer.EndpointURL(s3Config)
+	}
+	chunkSize := defaultChunkSize
+	if s3Config.PartSize > 0 {
+		chunkSize = s3Config.PartSize * mebibyte
+	}
+
+	return s3writer.NewStoreWriter(&Store{
+		Client:    client,
+		Endpoint:  endpoint,
+		Bucket:    s3Config.Bucket,
+		chunkSize: chunkSize,
+	}, s3Config)
+}
+
+// newHTTPClient returns the HTTP client authenticated with the credentials
+// file or the Google application default credentials, unless the anonymous
+// access is enabled
+func newHTTPClient(s3Config conf.S3Config) (*http.Client, error) {
+	client, err := s3writer.NewHTTPClient(s3Config)
+	if err != nil || s3Config.GCS.Anonymous {
+		return client, err
+	}
+
+	// the tokens are requested with the same client
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+	var credentials *google.Credentials
+	if s3Config.GCS.CredentialsFile != "" {
+		credentials, err = credentialsFromFile(ctx, s3Config.GCS.CredentialsFile)
+	} else {
+		credentials, err = google.FindDefaultCredentials(ctx, storageScope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the GCS credentials: %w", err)
+	}
+
+	return &http.Client{
+		Transport: &oauth2.Transport{Source: credentials.TokenSource, Base: client.Transport},
+		Timeout:   client.Timeout,
+	}, nil
+}
+
+// credentialsFromFile returns the credentials stored in the given file, of
+// any of the types supported by the Google libraries
+func credentialsFromFile(ctx context.Context, path string) (*google.Credentials, error) {
+	content, err := os.ReadFile(path) // #nosec G304 -- the path comes from the configuration
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %w", path, err)
+	}
+	return google.CredentialsFromJSONWithType(ctx, content, google.CredentialsType(file.Type), storageScope)
+}
+
+// objectsURL returns the URL of the objects of the bucket, or of the object
+// with the given key
+func (store *Store) objectsURL(key string, query url.Values) string {
+	path := "/storage/v1/b/" + url.PathEscape(store.Bucket) + "/o"
+	if key != "" {
+		path += "/" + url.PathEscape(key)
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return store.Endpoint + path
+}
+
+// do sends the request, returning an APIError if its response doesn't have
+// any of the expected statuses. The body of the response must be closed.
+func (store *Store) do(request *http.Request, expected ...int) (*http.Response, error) {
+	response, err := store.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expected {
+		if response.StatusCode == status {
+			return response, nil
+		}
+	}
+
+	defer closeBody(response)
+	message, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+	return nil, &APIError{StatusCode: response.StatusCode, Message: string(bytes.TrimSpace(message))}
+}
+
+// getJSON decodes the response of a GET request into the given value
+func (store *Store) getJSON(ctx context.Context, requestURL string, value interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, http.NoBody)
+	if err != nil {
+		return err
+	}
+	response, err := store.do(request, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer closeBody(response)
+	return json.NewDecoder(response.Body).Decode(value)
+}
+
+// List returns the objects stored under the given prefix
+func (store *Store) List(ctx context.Context, prefix string) ([]s3writer.ObjectInfo, error) {
+	objects := []s3writer.ObjectInfo{}
+	pageToken := ""
+
+	for {
+		query := url.Values{"prefix": {prefix}, "maxResults": {strconv.Itoa(listMaxKeys)}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		var page struct {
+			Items         []object `json:"items"`
+			NextPageToken string   `json:"nextPageToken"`
+		}
+		if err := store.getJSON(ctx, store.objectsURL("", query), &page); err != nil {
+			return nil, err
+		}
+
+		for _, item := range page.Items {
+			info, err := item.info()
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, info)
+		}
+		if page.NextPageToken == "" {
+			return objects, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// Stat returns the object stored with the given key
+func (store *Store) Stat(ctx context.Context, key string) (s3writer.ObjectInfo, error) {
+	var item object
+	err := store.getJSON(ctx, store.objectsURL(key, nil), &item)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return s3writer.ObjectInfo{}, s3writer.ErrObjectNotFound
+	}
+	if err != nil {
+		return s3writer.ObjectInfo{}, err
+	}
+	return item.info()
+}
+
+// info returns the description of the object, with its CRC32C checksum
+func (item object) info() (s3writer.ObjectInfo, error) {
+	info := s3writer.ObjectInfo{Key: item.Name, LastModified: item.Updated}
+
+	var err error
+	if info.Size, err = strconv.ParseInt(item.Size, 10, 64); err != nil {
+		return info, fmt.Errorf("invalid size of %s: %w", item.Name, err)
+	}
+	if item.CRC32C != "" {
+		if info.CRC32C, err = base64.StdEncoding.DecodeString(item.CRC32C); err != nil {
+			return info, fmt.Errorf("invalid checksum of %s: %w", item.Name, err)
+		}
+	}
+	return info, nil
+}
+
+// Upload stores the content read from the reader in a resumable upload,
+// sending a chunk at a time
+func (store *Store) Upload(ctx context.Context, key string, content io.Reader, options s3writer.StoreUploadOptions) error {
+	session, err := store.startUpload(ctx, key, options)
+	if err != nil {
+		if options.IfNotExists && isPreconditionFailed(err) {
+			return s3writer.ErrObjectExists
+		}
+		return err
+	}
+
+	err = store.uploadChunks(ctx, session, content)
+	if err != nil {
+		store.cancelUpload(session)
+		if options.IfNotExists && isPreconditionFailed(err) {
+			return s3writer.ErrObjectExists
+		}
+	}
+	return err
+}
+
+// startUpload starts a resumable upload of the object with the given key,
+// returning the URL its content is sent to
+func (store *Store) startUpload(ctx context.Context, key string, options s3writer.StoreUploadOptions) (string, error) {
+	query := url.Values{"uploadType": {"resumable"}, "name": {key}}
+	if options.IfNotExists {
+		// the generation of a missing object is 0
+		query.Set("ifGenerationMatch", "0")
+	}
+	metadata, err := json.Marshal(map[string]interface{}{"name": key, "metadata": options.Metadata})
+	if err != nil {
+		return "", err
+	}
+
+	requestURL := store.Endpoint + "/upload/storage/v1/b/" + url.PathEscape(store.Bucket) + "/o?" + query.Encode()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, bytes.NewReader(metadata))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	response, err := store.do(request, http.StatusOK, http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+	closeBody(response)
+
+	session := response.Header.Get("Location")
+	if session == "" {
+		return "", errors.New("the resumable upload didn't return its location")
+	}
+	return session, nil
+}
+
+// uploadChunks sends the content to the resumable upload. Every chunk but the
+// last one is full, so its size must be a multiple of 256 KiB.
+func (store *Store) uploadChunks(ctx context.Context, session string, content io.Reader) error {
+	buffer := make([]byte, store.chunkSize)
+	var offset int64
+
+	for {
+		n, err := io.ReadFull(content, buffer)
+		last := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !last {
+			return err
+		}
+
+		total := int64(-1)
+		if last {
+			total = offset + int64(n)
+		}
+		if err := store.sendChunk(ctx, session, buffer[:n], offset, total); err != nil {
+			return err
+		}
+
+		offset += int64(n)
+		if last {
+			return nil
+		}
+	}
+}
+
+// sendChunk sends the chunk starting at offset, sending again the part of it
+// that wasn't stored until all of it is. The total size of the object is
+// given with the last chunk, and is -1 otherwise.
+func (store *Store) sendChunk(ctx context.Context, session string, chunk []byte, offset, total int64) error {
+	for {
+		size := "*"
+		if total >= 0 {
+			size = strconv.FormatInt(total, 10)
+		}
+		contentRange := fmt.Sprintf("bytes */%s", size)
+		if len(chunk) > 0 {
+			contentRange = fmt.Sprintf("bytes %d-%d/%s", offset, offset+int64(len(chunk))-1, size)
+		}
+
+		request, err := http.NewRequestWithContext(ctx, http.MethodPut, session, bytes.NewReader(chunk))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Range", contentRange)
+
+		response, err := store.do(request, http.StatusOK, http.StatusCreated, http.StatusPermanentRedirect)
+		if err != nil {
+			return err
+		}
+		closeBody(response)
+
+		if response.StatusCode != http.StatusPermanentRedirect {
+			if total < 0 {
+				return fmt.Errorf("the upload finished with the chunk at %d, before the last one", offset)
+			}
+			return nil
+		}
+
+		// the upload is incomplete, continue after the stored bytes
+		persisted, err := persistedBytes(response.Header.Get("Range"))
+		if err != nil {
+			return err
+		}
+		end := offset + int64(len(chunk))
+		switch {
+		case persisted < offset || persisted > end || (persisted == offset && len(chunk) > 0):
+			return fmt.Errorf("%d bytes were stored after sending the bytes %d-%d", persisted, offset, end-1)
+		case persisted == end && total < 0:
+			return nil
+		case persisted == end && len(chunk) == 0:
+			return fmt.Errorf("the upload wasn't finished after sending its %d bytes", total)
+		}
+		chunk = chunk[persisted-offset:]
+		offset = persisted
+	}
+}
+
+// persistedBytes returns the number of bytes stored by a resumable upload,
+// given the Range header of its response, bytes=0-<last byte>
+func persistedBytes(header string) (int64, error) {
+	if header == "" {
+		return 0, nil
+	}
+	last, err := strconv.ParseInt(strings.TrimPrefix(header, "bytes=0-"), 10, 64)
+	if err != nil || !strings.HasPrefix(header, "bytes=0-") {
+		return 0, fmt.Errorf("invalid range %q stored by the resumable upload", header)
+	}
+	return last + 1, nil
+}
+
+// cancelUpload discards the content sent to the resumable upload
+func (store *Store) cancelUpload(session string) {
+	request, err := http.NewRequest(http.MethodDelete, session, http.NoBody)
+	if err != nil {
+		return
+	}
+	if response, err := store.Client.Do(request); err == nil {
+		closeBody(response)
+	}
+}
+
+// ReadRange returns length bytes of the object stored with the given key,
+// starting at offset
+func (store *Store) ReadRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, store.objectsURL(key, url.Values{"alt": {"media"}}), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	response, err := store.do(request, http.StatusPartialContent, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(response)
+
+	if response.StatusCode == http.StatusOK {
+		// the whole object is returned if the range is not supported
+		if _, err := io.CopyN(io.Discard, response.Body, offset); err != nil {
+			return nil, err
+		}
+	}
+	return io.ReadAll(io.LimitReader(response.Body, length))
+}
+
+// Ping returns an error if the objects of the bucket can't be listed
+func (store *Store) Ping(ctx context.Context) error {
+	var page struct{}
+	return store.getJSON(ctx, store.objectsURL("", url.Values{"maxResults": {"1"}}), &page)
+}
+
+func isPreconditionFailed(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusPreconditionFailed
+}
+
+func closeBody(response *http.Response) {
+	_ = response.Body.Close()
+}
@@ -0,0 +1,425 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsstore_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/gcsstore"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+	"github.com/RedHatInsights/parquet-factory/utils"
+)
+
+const testBucket = "test-bucket"
+
+type testRow struct {
+	ID string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// fakeGCS implements the part of the GCS JSON API used by the store,
+// like fake-gcs-server does
+type fakeGCS struct {
+	mutex    sync.Mutex
+	objects  map[string][]byte
+	metadata map[string]map[string]string
+	sessions map[string]*bytes.Buffer
+	// chunks counts the chunks received by the resumable uploads
+	chunks int
+	// failDeletes makes the deletion of the given keys fail
+	failDeletes map[string]bool
+	// partialChunks is the number of chunks only stored by halves, as GCS
+	// may do with the resumable uploads
+	partialChunks int
+	// batchResponse replaces the response of the batch requests if it is set
+	batchResponse func(w http.ResponseWriter)
+}
+
+func newFakeGCS(t *testing.T) (*fakeGCS, *httptest.Server) {
+	fake := &fakeGCS{
+		objects:     map[string][]byte{},
+		metadata:    map[string]map[string]string{},
+		sessions:    map[string]*bytes.Buffer{},
+		failDeletes: map[string]bool{},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (fake *fakeGCS) resource(name string) map[string]string {
+	content := fake.objects[name]
+	checksum := binary.BigEndian.AppendUint32(nil, crc32.Checksum(content, crc32.MakeTable(crc32.Castagnoli)))
+	return map[string]string{
+		"name":    name,
+		"size":    strconv.Itoa(len(content)),
+		"updated": time.Now().UTC().Format(time.RFC3339Nano),
+		"crc32c":  base64.StdEncoding.EncodeToString(checksum),
+	}
+}
+
+func (fake *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	objectsPath := "/storage/v1/b/" + testBucket + "/o"
+	path := r.URL.EscapedPath()
+	switch {
+	case r.Method == http.MethodGet && path == objectsPath:
+		fake.list(w, r)
+	case r.Method == http.MethodGet && strings.HasPrefix(path, objectsPath+"/"):
+		name, _ := url.PathUnescape(strings.TrimPrefix(path, objectsPath+"/"))
+		fake.get(w, r, name)
+	case r.Method == http.MethodPost && path == "/upload"+objectsPath:
+		fake.startUpload(w, r)
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/session/"):
+		fake.uploadChunk(w, r, strings.TrimPrefix(path, "/session/"))
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/session/"):
+		delete(fake.sessions, strings.TrimPrefix(path, "/session/"))
+		w.WriteHeader(499)
+	case r.Method == http.MethodPost && path == "/batch/storage/v1":
+		fake.batch(w, r)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func (fake *fakeGCS) list(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for name := range fake.objects {
+		if strings.HasPrefix(name, r.URL.Query().Get("prefix")) && name > r.URL.Query().Get("pageToken") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	response := map[string]interface{}{}
+	// the pages have 2 objects at most, so the paging is tested
+	if len(names) > 2 {
+		names = names[:2]
+		response["nextPageToken"] = names[1]
+	}
+	items := []map[string]string{}
+	for _, name := range names {
+		items = append(items, fake.resource(name))
+	}
+	response["items"] = items
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (fake *fakeGCS) get(w http.ResponseWriter, r *http.Request, name string) {
+	content, ok := fake.objects[name]
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if r.URL.Query().Get("alt") != "media" {
+		_ = json.NewEncoder(w).Encode(fake.resource(name))
+		return
+	}
+
+	var begin, end int
+	if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &begin, &end); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	end = min(end, len(content)-1)
+	w.WriteHeader(http.StatusPartialContent)
+	_, _ = w.Write(content[begin : end+1])
+}
+
+func (fake *fakeGCS) startUpload(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if _, ok := fake.objects[name]; ok && r.URL.Query().Get("ifGenerationMatch") == "0" {
+		http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+	var resource struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := strconv.Itoa(len(fake.sessions)) + "-" + url.PathEscape(name)
+	fake.sessions[id] = &bytes.Buffer{}
+	fake.metadata[name] = resource.Metadata
+	w.Header().Set("Location", "http://"+r.Host+"/session/"+id)
+}
+
+func (fake *fakeGCS) uploadChunk(w http.ResponseWriter, r *http.Request, id string) {
+	session, ok := fake.sessions[id]
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	content, _ := io.ReadAll(r.Body)
+
+	// the chunk must start after the bytes already stored
+	var first, last int
+	contentRange := r.Header.Get("Content-Range")
+	size := contentRange[strings.LastIndex(contentRange, "/")+1:]
+	if !strings.HasPrefix(contentRange, "bytes */") {
+		_, err := fmt.Sscanf(contentRange, "bytes %d-%d/", &first, &last)
+		if err != nil || first != session.Len() || last-first+1 != len(content) {
+			http.Error(w, "unexpected range "+contentRange, http.StatusBadRequest)
+			return
+		}
+	}
+	if fake.partialChunks > 0 && len(content) > 1 {
+		fake.partialChunks--
+		content = content[:len(content)/2]
+		size = "*"
+	}
+	session.Write(content)
+	fake.chunks++
+
+	if size == "*" || size != strconv.Itoa(session.Len()) {
+		if session.Len() > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", session.Len()-1))
+		}
+		w.WriteHeader(http.StatusPermanentRedirect)
+		return
+	}
+	name, _ := url.PathUnescape(id[strings.Index(id, "-")+1:])
+	fake.objects[name] = session.Bytes()
+	delete(fake.sessions, id)
+	_ = json.NewEncoder(w).Encode(fake.resource(name))
+}
+
+func (fake *fakeGCS) batch(w http.ResponseWriter, r *http.Request) {
+	if fake.batchResponse != nil {
+		fake.batchResponse(w)
+		return
+	}
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	writer := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		request, err := http.ReadRequest(bufio.NewReader(part))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name, _ := url.PathUnescape(strings.TrimPrefix(request.URL.EscapedPath(), "/storage/v1/b/"+testBucket+"/o/"))
+
+		status := "204 No Content"
+		switch {
+		case fake.failDeletes[name]:
+			status = "503 Service Unavailable"
+		case fake.objects[name] == nil:
+			status = "404 Not Found"
+		default:
+			delete(fake.objects, name)
+		}
+
+		contentID := strings.Trim(part.Header.Get("Content-Id"), "<>")
+		responsePart, _ := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/http"},
+			"Content-Id":   {"<response-" + contentID + ">"},
+		})
+		_, _ = fmt.Fprintf(responsePart, "HTTP/1.1 %s\r\nContent-Length: 0\r\n\r\n", status)
+	}
+	_ = writer.Close()
+}
+
+func newTestWriter(t *testing.T, server *httptest.Server, s3Config conf.S3Config) *s3writer.StoreWriter {
+	s3Config.Endpoint = server.URL
+	s3Config.Bucket = testBucket
+	s3Config.GCS.Anonymous = true
+	storeWriter, err := gcsstore.New(s3Config)
+	assert.NoError(t, err)
+	return storeWriter
+}
+
+func writeTestFile(storeWriter *s3writer.StoreWriter, key string, rows int) error {
+	file, err := storeWriter.NewFile(context.Background(), key, &testRow{}, s3writer.FileOptions{})
+	if err != nil {
+		return err
+	}
+	for i := 0; i < rows; i++ {
+		if err := file.AddRow(testRow{ID: strconv.Itoa(i)}); err != nil {
+			return err
+		}
+	}
+	return file.CloseFile()
+}
+
+func TestNew(t *testing.T) {
+	t.Run("missing credentials file", func(t *testing.T) {
+		_, err := gcsstore.New(conf.S3Config{GCS: conf.GCSConfig{CredentialsFile: "missing.json"}})
+		assert.Error(t, err)
+	})
+
+	t.Run("negative part size", func(t *testing.T) {
+		_, err := gcsstore.New(conf.S3Config{PartSize: -1, GCS: conf.GCSConfig{Anonymous: true}})
+		assert.Error(t, err)
+	})
+}
+
+func TestFiles(t *testing.T) {
+	fake, server := newFakeGCS(t)
+	storeWriter := newTestWriter(t, server, conf.S3Config{VerifyUploads: s3writer.VerifyFooter})
+	folder := "fleet_data/cluster_info/hourly/date=2022-01-01/hour=01/"
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, writeTestFile(storeWriter, fmt.Sprintf("%scluster_info-%d.parquet", folder, i), 10))
+	}
+	assert.ErrorIs(t, writeTestFile(storeWriter, folder+"cluster_info-0.parquet", 10), s3writer.ErrObjectExists)
+
+	indexes, err := storeWriter.GetLastIndexForParquet(context.Background(), utils.DefaultPartitionLayout(), folder)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"cluster_info": 2}, indexes)
+
+	assert.NoError(t, storeWriter.CheckSchema(context.Background(), folder, &testRow{}, s3writer.ObjectOptions{}))
+	assert.NoError(t, storeWriter.Ping(context.Background()))
+
+	fake.failDeletes[folder+"cluster_info-1.parquet"] = true
+	err = storeWriter.DeleteFiles([]string{
+		folder + "cluster_info-0.parquet", folder + "cluster_info-1.parquet", folder + "missing.parquet",
+	})
+	var deleteErr *s3writer.DeleteError
+	assert.ErrorAs(t, err, &deleteErr)
+	assert.Equal(t, []string{folder + "cluster_info-1.parquet"}, deleteErr.Keys)
+	assert.Len(t, fake.objects, 2)
+}
+
+func TestObjects(t *testing.T) {
+	fake, server := newFakeGCS(t)
+	storeWriter := newTestWriter(t, server, conf.S3Config{
+		PartSize: 1,
+		Upload:   conf.UploadConfig{Tags: true},
+	})
+	ctx := context.Background()
+	tags := s3writer.ObjectOptions{Tags: map[string]string{s3writer.TableTag: "rule_hits"}}
+
+	// the content bigger than a chunk is uploaded in several chunks
+	content := bytes.Repeat([]byte("x"), 2*1024*1024+10)
+	assert.NoError(t, storeWriter.WriteObject(ctx, "big/object", content, tags))
+	assert.Equal(t, content, fake.objects["big/object"])
+	assert.Equal(t, 3, fake.chunks)
+	assert.Equal(t, tags.Tags, fake.metadata["big/object"])
+
+	// the content of the size of a chunk is finished with an empty chunk
+	assert.NoError(t, storeWriter.WriteObject(ctx, "chunk", content[:1024*1024], tags))
+	assert.Len(t, fake.objects["chunk"], 1024*1024)
+
+	assert.NoError(t, storeWriter.CreateObject(ctx, "log/0.json", []byte("{}"), tags))
+	assert.ErrorIs(t, storeWriter.CreateObject(ctx, "log/0.json", []byte("{}"), tags), s3writer.ErrObjectExists)
+
+	keys, err := storeWriter.ListObjects(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"big/object", "chunk", "log/0.json"}, keys)
+}
+
+func TestPartialChunks(t *testing.T) {
+	fake, server := newFakeGCS(t)
+	storeWriter := newTestWriter(t, server, conf.S3Config{PartSize: 1})
+	fake.partialChunks = 3
+
+	// the bytes of every chunk not stored are sent again, the last chunk too
+	content := bytes.Repeat([]byte("x"), 2*1024*1024+10)
+	assert.NoError(t, storeWriter.WriteObject(context.Background(), "object", content, s3writer.ObjectOptions{}))
+	assert.Equal(t, content, fake.objects["object"])
+	assert.Equal(t, 6, fake.chunks)
+}
+
+func TestMalformedBatchResponse(t *testing.T) {
+	folder := "fleet_data/rule_hits/"
+	keys := []string{folder + "rule_hits-0.parquet", folder + "rule_hits-1.parquet"}
+
+	for name, response := range map[string]func(w http.ResponseWriter){
+		"no boundary": func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("deleted"))
+		},
+		"unknown part": func(w http.ResponseWriter) {
+			writer := multipart.NewWriter(w)
+			w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+			part, _ := writer.CreatePart(textproto.MIMEHeader{"Content-Id": {"<response-7>"}})
+			_, _ = part.Write([]byte("HTTP/1.1 204 No Content\r\n\r\n"))
+			_ = writer.Close()
+		},
+		"invalid part": func(w http.ResponseWriter) {
+			writer := multipart.NewWriter(w)
+			w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+			part, _ := writer.CreatePart(textproto.MIMEHeader{"Content-Id": {"<response-0>"}})
+			_, _ = part.Write([]byte("not an HTTP response"))
+			_ = writer.Close()
+		},
+		"truncated body": func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "multipart/mixed; boundary=batch")
+			_, _ = w.Write([]byte("--batch\r\nContent-Id: <response-0>\r\n\r\nHTTP/1.1 204"))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fake, server := newFakeGCS(t)
+			storeWriter := newTestWriter(t, server, conf.S3Config{})
+			for _, key := range keys {
+				fake.objects[key] = []byte("content")
+			}
+			fake.batchResponse = response
+
+			// the objects of the batch are considered undeleted
+			err := storeWriter.DeleteFiles(keys)
+			var deleteErr *s3writer.DeleteError
+			assert.ErrorAs(t, err, &deleteErr)
+			assert.Equal(t, keys, deleteErr.Keys)
+			assert.ErrorContains(t, deleteErr.Err, "invalid batch response")
+		})
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	for status, retryable := range map[int]bool{
+		http.StatusTooManyRequests:     true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusForbidden:           false,
+		http.StatusPreconditionFailed:  false,
+		http.StatusInternalServerError: true,
+	} {
+		apiErr := &gcsstore.APIError{StatusCode: status}
+		assert.Equal(t, retryable, apiErr.Retryable(), status)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpserver implements the optional embedded HTTP server that allows
+// scraping the metrics and probing the state of the service.
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/metrics"
+)
+
+const (
+	// MetricsEndpoint exposes the registered Prometheus collectors
+	MetricsEndpoint = "/metrics"
+	// HealthEndpoint answers while the process is up
+	HealthEndpoint = "/healthz"
+	// ReadinessEndpoint answers successfully if the dependencies are reachable
+	ReadinessEndpoint = "/readyz"
+	// StatusEndpoint returns the progress of the current run
+	StatusEndpoint = "/status"
+
+	readinessTimeout = 5 * time.Second
+	shutdownTimeout  = 5 * time.Second
+)
+
+// ReadinessCheck returns an error if a dependency of the service can't be
+// reached
+type ReadinessCheck func(context.Context) error
+
+// OffsetsSource returns the last offset processed in every topic and partition
+type OffsetsSource func() map[string]map[int32]int64
+
+// BufferedRowsSource returns the number of rows waiting to be written in every
+// table
+type BufferedRowsSource func() map[string]int
+
+// PartitionStatus is the progress of the consumption of a partition
+type PartitionStatus struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// Status is the content returned by the status endpoint
+type Status struct {
+	State        string            `json:"state"`
+	Partitions   []PartitionStatus `json:"partitions"`
+	BufferedRows map[string]int    `json:"buffered_rows"`
+}
+
+// Server is the embedded HTTP server
+type Server struct {
+	server       *http.Server
+	mutex        sync.RWMutex
+	checks       map[string]ReadinessCheck
+	offsets      OffsetsSource
+	bufferedRows BufferedRowsSource
+}
+
+// New creates a Server listening on the given address
+func New(address string) *Server {
+	server := &Server{
+		checks: map[string]ReadinessCheck{},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(MetricsEndpoint, promhttp.Handler())
+	mux.HandleFunc(HealthEndpoint, server.health)
+	mux.HandleFunc(ReadinessEndpoint, server.readiness)
+	mux.HandleFunc(StatusEndpoint, server.status)
+
+	server.server = &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: readinessTimeout,
+	}
+	return server
+}
+
+// Start starts listening in background. An error is returned if the address
+// can't be used.
+func (server *Server) Start() error {
+	listener, err := net.Listen("tcp", server.server.Addr)
+	if err != nil {
+		log.Error().Err(err).Str("address", server.server.Addr).Msg("Unable to start the HTTP server")
+		return err
+	}
+
+	log.Info().Str("address", listener.Addr().String()).Msg("Starting the HTTP server")
+	go func() {
+		if err := server.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("HTTP server failure")
+		}
+	}()
+	return nil
+}
+
+// Stop stops the server, waiting for the requests in progress
+func (server *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.server.Shutdown(ctx)
+}
+
+// Handler returns the handler serving all the endpoints
+func (server *Server) Handler() http.Handler {
+	return server.server.Handler
+}
+
+// SetReadinessCheck adds the check for the given dependency, replacing the
+// previous one with the same name
+func (server *Server) SetReadinessCheck(name string, check ReadinessCheck) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.checks[name] = check
+}
+
+// SetOffsetsSource sets where the offsets shown in the status come from
+func (server *Server) SetOffsetsSource(source OffsetsSource) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.offsets = source
+}
+
+// SetBufferedRowsSource sets where the buffered rows shown in the status come from
+func (server *Server) SetBufferedRowsSource(source BufferedRowsSource) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.bufferedRows = source
+}
+
+func (server *Server) health(writer http.ResponseWriter, _ *http.Request) {
+	writeJSON(writer, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (server *Server) readiness(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.RLock()
+	checks := make(map[string]ReadinessCheck, len(server.checks))
+	for name, check := range server.checks {
+		checks[name] = check
+	}
+	server.mutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(request.Context(), readinessTimeout)
+	defer cancel()
+
+	code := http.StatusOK
+	results := map[string]string{}
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			log.Warn().Err(err).Str("dependency", name).Msg("Readiness check failed")
+			results[name] = err.Error()
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		results[name] = "ok"
+	}
+	writeJSON(writer, code, results)
+}
+
+func (server *Server) status(writer http.ResponseWriter, _ *http.Request) {
+	server.mutex.RLock()
+	offsets, bufferedRows := server.offsets, server.bufferedRows
+	server.mutex.RUnlock()
+
+	status := Status{
+		State:        metrics.CurrentState(),
+		Partitions:   []PartitionStatus{},
+		BufferedRows: map[string]int{},
+	}
+	if offsets != nil {
+		for topic, partitions := range offsets() {
+			for partition, offset := range partitions {
+				status.Partitions = append(status.Partitions, PartitionStatus{
+					Topic:     topic,
+					Partition: partition,
+					Offset:    offset,
+				})
+			}
+		}
+		sort.Slice(status.Partitions, func(i, j int) bool {
+			if status.Partitions[i].Topic != status.Partitions[j].Topic {
+				return status.Partitions[i].Topic < status.Partitions[j].Topic
+			}
+			return status.Partitions[i].Partition < status.Partitions[j].Partition
+		})
+	}
+	if bufferedRows != nil {
+		status.BufferedRows = bufferedRows()
+	}
+	writeJSON(writer, http.StatusOK, status)
+}
+
+func writeJSON(writer http.ResponseWriter, code int, content interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(code)
+	if err := json.NewEncoder(writer).Encode(content); err != nil {
+		log.Error().Err(err).Msg("Unable to write the HTTP response")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/httpserver"
+	"github.com/RedHatInsights/parquet-factory/metrics"
+)
+
+func get(t *testing.T, server *httpserver.Server, endpoint string) (int, []byte) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, endpoint, http.NoBody)
+	server.Handler().ServeHTTP(recorder, request)
+
+	body, err := io.ReadAll(recorder.Result().Body)
+	assert.NoError(t, err)
+	return recorder.Code, body
+}
+
+func TestHealth(t *testing.T) {
+	server := httpserver.New(":0")
+	code, body := get(t, server, httpserver.HealthEndpoint)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"status": "ok"}`, string(body))
+}
+
+func TestMetrics(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	metrics.FilesGenerated.With(metrics.WithTableLabel("rule_hits")).Inc()
+
+	server := httpserver.New(":0")
+	code, body := get(t, server, httpserver.MetricsEndpoint)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, string(body), `files_generated{environment="testEnv",table="rule_hits"}`)
+}
+
+func TestReadiness(t *testing.T) {
+	server := httpserver.New(":0")
+
+	t.Run("without checks", func(t *testing.T) {
+		code, _ := get(t, server, httpserver.ReadinessEndpoint)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("all dependencies reachable", func(t *testing.T) {
+		server.SetReadinessCheck("kafka", func(context.Context) error { return nil })
+		server.SetReadinessCheck("s3", func(context.Context) error { return nil })
+
+		code, body := get(t, server, httpserver.ReadinessEndpoint)
+		assert.Equal(t, http.StatusOK, code)
+		assert.JSONEq(t, `{"kafka": "ok", "s3": "ok"}`, string(body))
+	})
+
+	t.Run("some dependency unreachable", func(t *testing.T) {
+		server.SetReadinessCheck("s3", func(context.Context) error { return errors.New("unreachable") })
+
+		code, body := get(t, server, httpserver.ReadinessEndpoint)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.JSONEq(t, `{"kafka": "ok", "s3": "unreachable"}`, string(body))
+	})
+}
+
+func TestStatus(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	metrics.State.Set(metrics.Consume)
+	server := httpserver.New(":0")
+
+	t.Run("without sources", func(t *testing.T) {
+		code, body := get(t, server, httpserver.StatusEndpoint)
+		assert.Equal(t, http.StatusOK, code)
+		assert.JSONEq(t, `{"state": "consume", "partitions": [], "buffered_rows": {}}`, string(body))
+	})
+
+	t.Run("with sources", func(t *testing.T) {
+		server.SetOffsetsSource(func() map[string]map[int32]int64 {
+			return map[string]map[int32]int64{"topic": {1: 20, 0: 10}}
+		})
+		server.SetBufferedRowsSource(func() map[string]int {
+			return map[string]int{"rule_hits": 3}
+		})
+
+		code, body := get(t, server, httpserver.StatusEndpoint)
+		assert.Equal(t, http.StatusOK, code)
+
+		status := httpserver.Status{}
+		assert.NoError(t, json.Unmarshal(body, &status))
+		assert.Equal(t, httpserver.Status{
+			State: "consume",
+			Partitions: []httpserver.PartitionStatus{
+				{Topic: "topic", Partition: 0, Offset: 10},
+				{Topic: "topic", Partition: 1, Offset: 20},
+			},
+			BufferedRows: map[string]int{"rule_hits": 3},
+		}, status)
+	})
+}
+
+func TestStartStop(t *testing.T) {
+	server := httpserver.New("127.0.0.1:0")
+	assert.NoError(t, server.Start())
+	assert.NoError(t, server.Stop())
+
+	t.Run("invalid address", func(t *testing.T) {
+		server := httpserver.New("invalid address")
+		assert.Error(t, server.Start())
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// newGaugeVecWithError runs promauto.NewGaugeVec() catching the panic and
+// returning an error, the same way the push package does for other collectors
+func newGaugeVecWithError(opts prometheus.GaugeOpts, labelNames []string) (gauge *prometheus.GaugeVec, err error) {
+	defer func() {
+		if panicErr := recover(); panicErr != nil {
+			err = fmt.Errorf("got error while registering the gauge vector, %v", panicErr)
+		}
+	}()
+	gauge = promauto.NewGaugeVec(opts, labelNames)
+	return
+}
+
+// newHistogramVecWithError runs promauto.NewHistogramVec() catching the panic
+// and returning an error
+func newHistogramVecWithError(opts prometheus.HistogramOpts, labelNames []string) (histogram *prometheus.HistogramVec, err error) {
+	defer func() {
+		if panicErr := recover(); panicErr != nil {
+			err = fmt.Errorf("got error while registering the histogram vector, %v", panicErr)
+		}
+	}()
+	histogram = promauto.NewHistogramVec(opts, labelNames)
+	return
+}
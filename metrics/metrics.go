@@ -15,8 +15,11 @@
 package metrics
 
 import (
+	"fmt"
+
 	"github.com/RedHatInsights/insights-operator-utils/metrics/push"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 const environmentLabel = "environment"
@@ -30,6 +33,30 @@ var (
 	tableLabels = []string{
 		"table",
 	}
+	partitionLabels = []string{
+		"topic",
+		"partition",
+	}
+	phaseLabels = []string{
+		"phase",
+	}
+	reasonLabels = []string{
+		"reason",
+	}
+	tableReasonLabels = []string{
+		"table",
+		"reason",
+	}
+	actionLabels = []string{
+		"action",
+	}
+	resultLabels = []string{
+		"result",
+	}
+	tableFilterLabels = []string{
+		"table",
+		"filter",
+	}
 
 	// OffsetMarked number of messages which offset has been marked.
 	OffsetMarked prometheus.Gauge
@@ -41,6 +68,32 @@ var (
 	FilesGenerated *prometheus.CounterVec
 	// InsertedRows number of rows written, partitioned by table.
 	InsertedRows *prometheus.CounterVec
+	// MessagesRejected number of messages discarded, partitioned by reason.
+	MessagesRejected *prometheus.CounterVec
+	// ControlMessages number of control messages consumed, partitioned by action.
+	ControlMessages *prometheus.CounterVec
+	// ClaimChecks number of reports referenced by claim checks, partitioned by result.
+	ClaimChecks *prometheus.CounterVec
+	// RowsSkipped number of rows not written, partitioned by table and reason.
+	RowsSkipped *prometheus.CounterVec
+	// RowsFiltered number of rows excluded by the filters, partitioned by table and filter.
+	RowsFiltered *prometheus.CounterVec
+	// UndeletedFiles number of files that couldn't be deleted after a failed run.
+	UndeletedFiles prometheus.Counter
+	// FailedVerifications number of uploaded files that didn't match their content, partitioned by table.
+	FailedVerifications *prometheus.CounterVec
+	// PartitionCommittedOffset last offset committed, partitioned by topic and partition.
+	PartitionCommittedOffset *prometheus.GaugeVec
+	// PartitionHighWaterMark offset of the next message that will be produced, partitioned by topic and partition.
+	PartitionHighWaterMark *prometheus.GaugeVec
+	// PartitionLag number of messages not consumed yet, partitioned by topic and partition.
+	PartitionLag *prometheus.GaugeVec
+	// PartitionNewestMessageTimestamp timestamp of the newest message consumed, partitioned by topic and partition.
+	PartitionNewestMessageTimestamp *prometheus.GaugeVec
+	// MessageAge time elapsed since a message was produced until it is consumed.
+	MessageAge prometheus.Histogram
+	// PhaseDuration time spent in every phase of a run, partitioned by the State phases.
+	PhaseDuration *prometheus.HistogramVec
 	// ErrorCount is a metric that saves the number of errors
 	ErrorCount prometheus.Counter
 	// State stores the state of the cronjob job
@@ -57,6 +110,70 @@ var (
 	GenerateTables float64 = 4
 )
 
+// Reasons used to label MessagesRejected and RowsSkipped
+const (
+	// ReasonInvalidJSON the message is not a valid report
+	ReasonInvalidJSON = "invalid_json"
+	// ReasonInvalidSchema the message doesn't match the JSON Schema of its topic
+	ReasonInvalidSchema = "invalid_schema"
+	// ReasonMissingField a field needed to generate the rows is missing or empty
+	ReasonMissingField = "missing_field"
+	// ReasonUndecodable the message can't be decoded in the format of its topic
+	ReasonUndecodable = "undecodable"
+	// ReasonInvalidClaimCheck the report referenced by the message can't be fetched or verified
+	ReasonInvalidClaimCheck = "invalid_claim_check"
+	// ReasonMissingPath the archive path can't be read from the message
+	ReasonMissingPath = "missing_path"
+	// ReasonDuplicate the archive was already consumed in the current run
+	ReasonDuplicate = "duplicate"
+	// ReasonOffsetBehind the offset is lower than the stored one
+	ReasonOffsetBehind = "offset_behind"
+	// ReasonInvalidDate the collection date can't be extracted from the archive path
+	ReasonInvalidDate = "invalid_date"
+	// ReasonWriteError the row couldn't be added to the parquet file
+	ReasonWriteError = "write_error"
+)
+
+// Actions used to label ControlMessages
+const (
+	// ControlStop the message stops consuming all the partitions
+	ControlStop = "stop"
+	// ControlFlush the message forces writing the files and committing the offsets before consuming again
+	ControlFlush = "flush"
+	// ControlSkip the message is dropped
+	ControlSkip = "skip"
+	// ControlReprocessUntil the message changes the limit timestamp
+	ControlReprocessUntil = "reprocess_until"
+	// ControlInvalid the message has control headers that can't be parsed, which are ignored
+	ControlInvalid = "invalid"
+)
+
+// Filters used to label RowsFiltered
+const (
+	// FilterIncludeClusters the cluster isn't in the included clusters
+	FilterIncludeClusters = "include_clusters"
+	// FilterExcludeClusters the cluster is in the excluded clusters
+	FilterExcludeClusters = "exclude_clusters"
+	// FilterIncludeOrgs the organization isn't in the included organizations
+	FilterIncludeOrgs = "include_orgs"
+	// FilterExcludeOrgs the organization is in the excluded organizations
+	FilterExcludeOrgs = "exclude_orgs"
+	// FilterIncludeRules the rule doesn't match any of the included rules
+	FilterIncludeRules = "include_rules"
+	// FilterExcludeRules the rule matches one of the excluded rules
+	FilterExcludeRules = "exclude_rules"
+)
+
+// Results used to label ClaimChecks
+const (
+	// ClaimCheckCached the report was read from the local cache
+	ClaimCheckCached = "cached"
+	// ClaimCheckFetched the report was fetched from the bucket
+	ClaimCheckFetched = "fetched"
+	// ClaimCheckFailed the report couldn't be fetched or verified
+	ClaimCheckFailed = "failed"
+)
+
 func (envInit envInitializer) getOffsetMarked() (prometheus.Collector, error) {
 	OffsetMarked, err = push.NewGaugeWithError(prometheus.GaugeOpts{
 		Name:        "offset_marked",
@@ -107,6 +224,138 @@ func (envInit envInitializer) getInsertedRows() (prometheus.Collector, error) {
 	return InsertedRows, err
 }
 
+func (envInit envInitializer) getMessagesRejected() (prometheus.Collector, error) {
+	MessagesRejected, err = push.NewCounterVecWithError(prometheus.CounterOpts{
+		Name:        "messages_rejected",
+		Help:        "number of messages discarded",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+	}, reasonLabels)
+
+	return MessagesRejected, err
+}
+
+func (envInit envInitializer) getControlMessages() (prometheus.Collector, error) {
+	ControlMessages, err = push.NewCounterVecWithError(prometheus.CounterOpts{
+		Name:        "control_messages",
+		Help:        "number of control messages consumed",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+	}, actionLabels)
+
+	return ControlMessages, err
+}
+
+func (envInit envInitializer) getClaimChecks() (prometheus.Collector, error) {
+	ClaimChecks, err = push.NewCounterVecWithError(prometheus.CounterOpts{
+		Name:        "claim_checks",
+		Help:        "number of reports referenced by claim checks",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+	}, resultLabels)
+
+	return ClaimChecks, err
+}
+
+func (envInit envInitializer) getRowsSkipped() (prometheus.Collector, error) {
+	RowsSkipped, err = push.NewCounterVecWithError(prometheus.CounterOpts{
+		Name:        "rows_skipped",
+		Help:        "number of rows not written",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+	}, tableReasonLabels)
+
+	return RowsSkipped, err
+}
+
+func (envInit envInitializer) getRowsFiltered() (prometheus.Collector, error) {
+	RowsFiltered, err = push.NewCounterVecWithError(prometheus.CounterOpts{
+		Name:        "rows_filtered",
+		Help:        "number of rows excluded by the filters",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+	}, tableFilterLabels)
+
+	return RowsFiltered, err
+}
+
+func (envInit envInitializer) getUndeletedFiles() (prometheus.Collector, error) {
+	UndeletedFiles, err = push.NewCounterWithError(prometheus.CounterOpts{
+		Name:        "undeleted_files",
+		Help:        "number of files that couldn't be deleted after a failed run",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+	})
+
+	return UndeletedFiles, err
+}
+
+func (envInit envInitializer) getFailedVerifications() (prometheus.Collector, error) {
+	FailedVerifications, err = push.NewCounterVecWithError(prometheus.CounterOpts{
+		Name:        "failed_verifications",
+		Help:        "number of uploaded files that didn't match their content",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+	}, tableLabels)
+
+	return FailedVerifications, err
+}
+
+func (envInit envInitializer) getPartitionCommittedOffset() (prometheus.Collector, error) {
+	PartitionCommittedOffset, err = newGaugeVecWithError(prometheus.GaugeOpts{
+		Name:        "partition_committed_offset",
+		Help:        "last offset committed in every partition",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+	}, partitionLabels)
+
+	return PartitionCommittedOffset, err
+}
+
+func (envInit envInitializer) getPartitionHighWaterMark() (prometheus.Collector, error) {
+	PartitionHighWaterMark, err = newGaugeVecWithError(prometheus.GaugeOpts{
+		Name:        "partition_high_water_mark",
+		Help:        "offset of the next message that will be produced in every partition",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+	}, partitionLabels)
+
+	return PartitionHighWaterMark, err
+}
+
+func (envInit envInitializer) getPartitionLag() (prometheus.Collector, error) {
+	PartitionLag, err = newGaugeVecWithError(prometheus.GaugeOpts{
+		Name:        "partition_lag",
+		Help:        "number of messages not consumed yet in every partition",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+	}, partitionLabels)
+
+	return PartitionLag, err
+}
+
+func (envInit envInitializer) getPartitionNewestMessageTimestamp() (prometheus.Collector, error) {
+	PartitionNewestMessageTimestamp, err = newGaugeVecWithError(prometheus.GaugeOpts{
+		Name:        "partition_newest_message_timestamp_seconds",
+		Help:        "timestamp of the newest message consumed in every partition",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+	}, partitionLabels)
+
+	return PartitionNewestMessageTimestamp, err
+}
+
+func (envInit envInitializer) getMessageAge() (prometheus.Collector, error) {
+	MessageAge, err = push.NewHistogramWithError(prometheus.HistogramOpts{
+		Name:        "message_age_seconds",
+		Help:        "time elapsed since a message was produced until it is consumed",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+		Buckets:     prometheus.ExponentialBuckets(60, 2, 12),
+	})
+
+	return MessageAge, err
+}
+
+func (envInit envInitializer) getPhaseDuration() (prometheus.Collector, error) {
+	PhaseDuration, err = newHistogramVecWithError(prometheus.HistogramOpts{
+		Name:        "phase_duration_seconds",
+		Help:        "time spent in every phase of a run",
+		ConstLabels: prometheus.Labels{environmentLabel: envInit.environment},
+		Buckets:     prometheus.ExponentialBuckets(0.5, 2, 14),
+	}, phaseLabels)
+
+	return PhaseDuration, err
+}
+
 func (envInit envInitializer) getErrorCount() (prometheus.Collector, error) {
 	ErrorCount, err = push.NewCounterWithError(prometheus.CounterOpts{
 		Name:        "error_count",
@@ -127,11 +376,104 @@ func (envInit envInitializer) getState() (prometheus.Collector, error) {
 	return State, err
 }
 
+// stateNames stores a readable name for every value of State
+var stateNames = map[float64]string{
+	Idle:           "idle",
+	Init:           "init",
+	ConnectToKafka: "connect_to_kafka",
+	Consume:        "consume",
+	GenerateTables: "generate_tables",
+}
+
+// CurrentState returns the name of the current value of State
+func CurrentState() string {
+	if State == nil {
+		return "unknown"
+	}
+	metric := &dto.Metric{}
+	if err := State.Write(metric); err != nil {
+		return "unknown"
+	}
+	if name, ok := stateNames[metric.GetGauge().GetValue()]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// GaugeValue returns the current value of the gauge, 0 if it can't be read
+func GaugeValue(gauge prometheus.Gauge) float64 {
+	if gauge == nil {
+		return 0
+	}
+	metric := &dto.Metric{}
+	if err := gauge.Write(metric); err != nil {
+		return 0
+	}
+	return metric.GetGauge().GetValue()
+}
+
+// CounterValues returns the current value of every counter of the vector,
+// indexed by the value of the given label
+func CounterValues(counter *prometheus.CounterVec, label string) map[string]float64 {
+	values := map[string]float64{}
+	if counter == nil {
+		return values
+	}
+
+	collected := make(chan prometheus.Metric)
+	go func() {
+		counter.Collect(collected)
+		close(collected)
+	}()
+	for collectedMetric := range collected {
+		metric := &dto.Metric{}
+		if err := collectedMetric.Write(metric); err != nil {
+			continue
+		}
+		for _, pair := range metric.GetLabel() {
+			if pair.GetName() == label {
+				values[pair.GetValue()] += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return values
+}
+
 // WithTableLabel returns the prometheus label for that table metric
 func WithTableLabel(table string) prometheus.Labels {
 	return prometheus.Labels{"table": table}
 }
 
+// WithReasonLabel returns the prometheus label for that rejection reason metric
+func WithReasonLabel(reason string) prometheus.Labels {
+	return prometheus.Labels{"reason": reason}
+}
+
+// WithActionLabel returns the prometheus label for that control action metric
+func WithActionLabel(action string) prometheus.Labels {
+	return prometheus.Labels{"action": action}
+}
+
+// WithTableFilterLabels returns the prometheus labels for that table and filter metric
+func WithTableFilterLabels(table, filter string) prometheus.Labels {
+	return prometheus.Labels{"table": table, "filter": filter}
+}
+
+// WithResultLabel returns the prometheus label for that claim check result metric
+func WithResultLabel(result string) prometheus.Labels {
+	return prometheus.Labels{"result": result}
+}
+
+// WithTableReasonLabels returns the prometheus labels for that table and skip reason metric
+func WithTableReasonLabels(table, reason string) prometheus.Labels {
+	return prometheus.Labels{"table": table, "reason": reason}
+}
+
+// WithPartitionLabels returns the prometheus labels for that topic and partition metric
+func WithPartitionLabels(topic string, partition int32) prometheus.Labels {
+	return prometheus.Labels{"topic": topic, "partition": fmt.Sprint(partition)}
+}
+
 // InitMetrics fills the collector variables with some Prometheus metrics and automatically registers them.
 func InitMetrics(environment string) error {
 	// set the environment
@@ -144,6 +486,19 @@ func InitMetrics(environment string) error {
 		envInit.getOffsetProcessed,
 		envInit.getFilesGenerated,
 		envInit.getInsertedRows,
+		envInit.getMessagesRejected,
+		envInit.getControlMessages,
+		envInit.getClaimChecks,
+		envInit.getRowsSkipped,
+		envInit.getRowsFiltered,
+		envInit.getUndeletedFiles,
+		envInit.getFailedVerifications,
+		envInit.getPartitionCommittedOffset,
+		envInit.getPartitionHighWaterMark,
+		envInit.getPartitionLag,
+		envInit.getPartitionNewestMessageTimestamp,
+		envInit.getMessageAge,
+		envInit.getPhaseDuration,
 		envInit.getErrorCount,
 		envInit.getState,
 	}
@@ -19,6 +19,8 @@ import (
 
 	"github.com/RedHatInsights/parquet-factory/metrics"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -41,3 +43,63 @@ func TestWithTableLabel(t *testing.T) {
 		metrics.WithTableLabel(testTable),
 		prometheus.Labels{"table": testTable})
 }
+
+func TestCurrentState(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics(testEnv))
+
+	metrics.State.Set(metrics.Consume)
+	assert.Equal(t, "consume", metrics.CurrentState())
+
+	metrics.State.Set(metrics.Idle)
+	assert.Equal(t, "idle", metrics.CurrentState())
+
+	metrics.State.Set(42)
+	assert.Equal(t, "unknown", metrics.CurrentState())
+}
+
+func TestWithPartitionLabels(t *testing.T) {
+	assert.Equal(t,
+		metrics.WithPartitionLabels("my_topic", 2),
+		prometheus.Labels{"topic": "my_topic", "partition": "2"})
+}
+
+func TestSetState(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics(testEnv))
+
+	metrics.SetState(metrics.Consume)
+	assert.Equal(t, "consume", metrics.CurrentState())
+	// setting the same phase again doesn't close it
+	metrics.SetState(metrics.Consume)
+	metrics.SetState(metrics.GenerateTables)
+	metrics.SetState(metrics.Idle)
+	assert.Equal(t, "idle", metrics.CurrentState())
+
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.PhaseDuration))
+	consume, err := metrics.PhaseDuration.GetMetricWithLabelValues("consume")
+	assert.NoError(t, err)
+	metric := &dto.Metric{}
+	assert.NoError(t, consume.(prometheus.Histogram).Write(metric))
+	assert.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+}
+
+func TestMetricValues(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics(testEnv))
+
+	metrics.OffsetConsummed.Add(3)
+	assert.Equal(t, float64(3), metrics.GaugeValue(metrics.OffsetConsummed))
+	assert.Equal(t, float64(0), metrics.GaugeValue(nil))
+
+	metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonDuplicate)).Add(2)
+	metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonInvalidJSON)).Inc()
+	assert.Equal(t,
+		map[string]float64{metrics.ReasonDuplicate: 2, metrics.ReasonInvalidJSON: 1},
+		metrics.CounterValues(metrics.MessagesRejected, "reason"))
+}
+
+func TestPhaseDurations(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics(testEnv))
+
+	metrics.SetState(metrics.GenerateTables)
+	metrics.SetState(metrics.Idle)
+	assert.Contains(t, metrics.PhaseDurations(), "generate_tables")
+}
@@ -0,0 +1,64 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+var phaseTracker = struct {
+	sync.Mutex
+	state  float64
+	start  time.Time
+	totals map[string]float64
+}{totals: map[string]float64{}}
+
+// SetState moves State to the given phase and observes in PhaseDuration the
+// time spent in the previous one. The time spent being idle is not observed.
+// Setting the current phase again does nothing.
+func SetState(state float64) {
+	phaseTracker.Lock()
+	defer phaseTracker.Unlock()
+
+	now := time.Now()
+	if state == phaseTracker.state && !phaseTracker.start.IsZero() {
+		return
+	}
+	if phaseTracker.state != Idle && !phaseTracker.start.IsZero() && PhaseDuration != nil {
+		elapsed := now.Sub(phaseTracker.start).Seconds()
+		PhaseDuration.WithLabelValues(stateNames[phaseTracker.state]).Observe(elapsed)
+		phaseTracker.totals[stateNames[phaseTracker.state]] += elapsed
+	}
+	phaseTracker.state = state
+	phaseTracker.start = now
+
+	if State != nil {
+		State.Set(state)
+	}
+}
+
+// PhaseDurations returns the total time, in seconds, spent in every phase
+// that was already left
+func PhaseDurations() map[string]float64 {
+	phaseTracker.Lock()
+	defer phaseTracker.Unlock()
+
+	durations := make(map[string]float64, len(phaseTracker.totals))
+	for phase, seconds := range phaseTracker.totals {
+		durations[phase] = seconds
+	}
+	return durations
+}
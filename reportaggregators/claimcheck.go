@@ -0,0 +1,380 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportaggregators
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/metrics"
+	"github.com/RedHatInsights/parquet-factory/retry"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// Defaults of the claim check configuration
+const (
+	DefaultClaimCheckConcurrency = 4
+	DefaultClaimCheckMaxSize     = 64  // MiB
+	DefaultClaimCheckCacheSize   = 256 // MiB
+)
+
+const (
+	mebibyte = 1 << 20
+	// claimCheckScheme is the scheme of the URLs of the claim checks
+	claimCheckScheme = "s3"
+	// cacheFileExtension is the extension of the reports stored in the cache
+	cacheFileExtension = ".json"
+)
+
+// errReportTooLarge is returned when the referenced report exceeds the
+// maximum size configured
+var errReportTooLarge = errors.New("the report exceeds the maximum size")
+
+// ClaimCheck references a report stored in a bucket instead of being sent in
+// the message, along with its SHA-256 checksum and, optionally, its size
+type ClaimCheck struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// location returns the bucket and key of the URL of the claim check, which
+// must be s3://bucket/key
+func (claim ClaimCheck) location() (bucket, key string, err error) {
+	parsed, err := url.Parse(claim.URL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid claim check URL: %w", err)
+	}
+	key = strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Scheme != claimCheckScheme || parsed.Host == "" || key == "" {
+		return "", "", fmt.Errorf("invalid claim check URL %q, it must be %s://bucket/key", claim.URL, claimCheckScheme)
+	}
+	return parsed.Host, key, nil
+}
+
+// checksum returns the decoded SHA-256 checksum of the claim check
+func (claim ClaimCheck) checksum() ([]byte, error) {
+	checksum, err := hex.DecodeString(claim.SHA256)
+	if err != nil || len(checksum) != sha256.Size {
+		return nil, fmt.Errorf("invalid claim check SHA-256 checksum %q", claim.SHA256)
+	}
+	return checksum, nil
+}
+
+// FetchError is returned when the report referenced by a claim check can't be
+// fetched because of an error not caused by the claim check, like the bucket
+// not being reachable. Unlike the invalid claim checks, the message may be
+// handled later.
+type FetchError struct {
+	URL string
+	Err error
+}
+
+func (err *FetchError) Error() string {
+	return fmt.Sprintf("unable to fetch the report %s: %v", err.URL, err.Err)
+}
+
+func (err *FetchError) Unwrap() error {
+	return err.Err
+}
+
+// Retryable returns true, as the report may be fetched later
+func (err *FetchError) Retryable() bool {
+	return true
+}
+
+// ClaimCheckFetcher fetches the reports referenced by claim checks and
+// verifies their checksum. The number of reports fetched at the same time is
+// bounded, and the verified reports are kept in a local cache so they aren't
+// fetched again, even in later runs.
+type ClaimCheckFetcher struct {
+	Client      s3writer.S3ClientAPI
+	RetryPolicy retry.Policy
+	buckets     map[string]bool
+	slots       chan struct{}
+	maxSize     int64
+	cache       *reportCache
+}
+
+// NewClaimCheckFetcher returns a ClaimCheckFetcher reading the reports with
+// the given client. The reports can only be fetched from the configured
+// buckets, or the given one if there are none.
+func NewClaimCheckFetcher(
+	config conf.ClaimCheckConfig, bucket string, client s3writer.S3ClientAPI, retryPolicy retry.Policy,
+) (*ClaimCheckFetcher, error) {
+	fetcher, err := newClaimCheckFetcher(config, bucket, client, retryPolicy)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid claim check configuration")
+		return nil, err
+	}
+	return fetcher, nil
+}
+
+func newClaimCheckFetcher(
+	config conf.ClaimCheckConfig, bucket string, client s3writer.S3ClientAPI, retryPolicy retry.Policy,
+) (*ClaimCheckFetcher, error) {
+	if config.Concurrency < 0 || config.MaxSize < 0 || config.CacheSize < 0 {
+		return nil, errors.New("the concurrency and the sizes can't be negative")
+	}
+	concurrency := config.Concurrency
+	if concurrency == 0 {
+		concurrency = DefaultClaimCheckConcurrency
+	}
+	maxSize := config.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultClaimCheckMaxSize
+	}
+	cacheSize := config.CacheSize
+	if cacheSize == 0 {
+		cacheSize = DefaultClaimCheckCacheSize
+	}
+
+	buckets := map[string]bool{}
+	for _, allowed := range config.Buckets {
+		buckets[allowed] = true
+	}
+	if len(buckets) == 0 && bucket != "" {
+		buckets[bucket] = true
+	}
+	if len(buckets) == 0 {
+		return nil, errors.New("no bucket the reports can be fetched from")
+	}
+
+	cacheDir := config.CacheDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "parquet-factory-claim-checks")
+	}
+	if err := os.MkdirAll(cacheDir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create the claim check cache: %w", err)
+	}
+
+	return &ClaimCheckFetcher{
+		Client:      client,
+		RetryPolicy: retryPolicy,
+		buckets:     buckets,
+		slots:       make(chan struct{}, concurrency),
+		maxSize:     int64(maxSize) * mebibyte,
+		cache:       &reportCache{dir: cacheDir, maxSize: int64(cacheSize) * mebibyte},
+	}, nil
+}
+
+// Fetch returns the report referenced by the claim check once its checksum is
+// verified. A FetchError is returned if it can't be fetched because of an
+// error not caused by the claim check, and any other error if the claim check
+// is invalid or doesn't match the report.
+func (fetcher *ClaimCheckFetcher) Fetch(ctx context.Context, claim ClaimCheck) ([]byte, error) {
+	report, result, err := fetcher.fetch(ctx, claim)
+	if err != nil {
+		result = metrics.ClaimCheckFailed
+	}
+	metrics.ClaimChecks.With(metrics.WithResultLabel(result)).Inc()
+	return report, err
+}
+
+func (fetcher *ClaimCheckFetcher) fetch(ctx context.Context, claim ClaimCheck) ([]byte, string, error) {
+	bucket, key, err := claim.location()
+	if err != nil {
+		return nil, "", err
+	}
+	if !fetcher.buckets[bucket] {
+		return nil, "", fmt.Errorf("the reports can't be fetched from the bucket %s", bucket)
+	}
+	checksum, err := claim.checksum()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if report, ok := fetcher.cache.get(checksum); ok {
+		return report, metrics.ClaimCheckCached, nil
+	}
+
+	select {
+	case fetcher.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, "", &FetchError{URL: claim.URL, Err: ctx.Err()}
+	}
+	report, err := fetcher.download(ctx, bucket, key)
+	<-fetcher.slots
+
+	var noSuchKey *types.NoSuchKey
+	switch {
+	case errors.Is(err, errReportTooLarge):
+		return nil, "", fmt.Errorf("%w of %d MiB", err, fetcher.maxSize/mebibyte)
+	case errors.As(err, &noSuchKey):
+		return nil, "", fmt.Errorf("the report %s doesn't exist", claim.URL)
+	case err != nil:
+		log.Error().Err(err).Str("url", claim.URL).Msg("Unable to fetch the report of the claim check")
+		return nil, "", &FetchError{URL: claim.URL, Err: err}
+	}
+
+	if claim.Size > 0 && int64(len(report)) != claim.Size {
+		return nil, "", fmt.Errorf("the report has %d bytes instead of %d", len(report), claim.Size)
+	}
+	if sum := sha256.Sum256(report); !bytes.Equal(sum[:], checksum) {
+		return nil, "", fmt.Errorf("the SHA-256 checksum of the report is %x instead of %s", sum, claim.SHA256)
+	}
+
+	fetcher.cache.put(checksum, report)
+	return report, metrics.ClaimCheckFetched, nil
+}
+
+// download reads the object, retrying the transient errors
+func (fetcher *ClaimCheckFetcher) download(ctx context.Context, bucket, key string) ([]byte, error) {
+	var report []byte
+	err := fetcher.RetryPolicy.Do(ctx, "fetch_claim_check", func() error {
+		output, err := fetcher.Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = output.Body.Close()
+		}()
+
+		if aws.ToInt64(output.ContentLength) > fetcher.maxSize {
+			return errReportTooLarge
+		}
+		report, err = io.ReadAll(io.LimitReader(output.Body, fetcher.maxSize+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(report)) > fetcher.maxSize {
+			return errReportTooLarge
+		}
+		return nil
+	})
+	return report, err
+}
+
+// reportCache stores the verified reports in a local directory, named after
+// their checksum. The least recently used reports are removed once the
+// directory exceeds its maximum size.
+type reportCache struct {
+	dir     string
+	maxSize int64
+	mutex   sync.Mutex
+}
+
+func (cache *reportCache) path(checksum []byte) string {
+	return filepath.Join(cache.dir, hex.EncodeToString(checksum)+cacheFileExtension)
+}
+
+// get returns the cached report with the given checksum, if it is stored and
+// it wasn't modified
+func (cache *reportCache) get(checksum []byte) ([]byte, bool) {
+	path := cache.path(checksum)
+	report, err := os.ReadFile(path) // #nosec G304 -- the file is named after the checksum
+	if err != nil {
+		return nil, false
+	}
+	if sum := sha256.Sum256(report); !bytes.Equal(sum[:], checksum) {
+		log.Warn().Str("file", path).Msg("Corrupted report in the claim check cache, removing it")
+		_ = os.Remove(path)
+		return nil, false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return report, true
+}
+
+// put stores the report with the given checksum. The errors are only logged,
+// as the report can always be fetched again.
+func (cache *reportCache) put(checksum []byte, report []byte) {
+	if int64(len(report)) > cache.maxSize {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	file, err := os.CreateTemp(cache.dir, "report-*.tmp")
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to store the report in the claim check cache")
+		return
+	}
+	_, err = file.Write(report)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), cache.path(checksum))
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to store the report in the claim check cache")
+		_ = os.Remove(file.Name())
+		return
+	}
+
+	cache.prune()
+}
+
+// prune removes the least recently used reports until the cache fits in its
+// maximum size
+func (cache *reportCache) prune() {
+	entries, err := os.ReadDir(cache.dir)
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to list the claim check cache")
+		return
+	}
+
+	files := []os.FileInfo{}
+	var size int64
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != cacheFileExtension {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+		size += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, info := range files {
+		if size <= cache.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(cache.dir, info.Name())); err != nil {
+			log.Warn().Err(err).Str("file", info.Name()).Msg("Unable to remove the report from the claim check cache")
+			continue
+		}
+		size -= info.Size()
+	}
+}
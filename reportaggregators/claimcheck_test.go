@@ -0,0 +1,231 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportaggregators_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/metrics"
+	"github.com/RedHatInsights/parquet-factory/reportaggregators"
+	"github.com/RedHatInsights/parquet-factory/retry"
+	"github.com/RedHatInsights/parquet-factory/testdata"
+	"github.com/RedHatInsights/parquet-factory/testhelpers"
+)
+
+const claimCheckBucket = "reports"
+
+func claimCheckFor(key string, report []byte) reportaggregators.ClaimCheck {
+	sum := sha256.Sum256(report)
+	return reportaggregators.ClaimCheck{
+		URL:    fmt.Sprintf("s3://%s/%s", claimCheckBucket, key),
+		SHA256: hex.EncodeToString(sum[:]),
+		Size:   int64(len(report)),
+	}
+}
+
+func newFetcher(t *testing.T, config conf.ClaimCheckConfig, store *testhelpers.ObjectStore) *reportaggregators.ClaimCheckFetcher {
+	if config.CacheDir == "" {
+		config.CacheDir = t.TempDir()
+	}
+	fetcher, err := reportaggregators.NewClaimCheckFetcher(config, claimCheckBucket, store,
+		retry.Policy{MaxRetries: 2, InitialBackoff: time.Microsecond, Multiplier: 2})
+	assert.NoError(t, err)
+	return fetcher
+}
+
+func TestNewClaimCheckFetcher(t *testing.T) {
+	store := testhelpers.NewObjectStore(claimCheckBucket, nil)
+
+	_, err := reportaggregators.NewClaimCheckFetcher(
+		conf.ClaimCheckConfig{CacheDir: t.TempDir()}, "", store, retry.Policy{})
+	assert.ErrorContains(t, err, "no bucket")
+
+	_, err = reportaggregators.NewClaimCheckFetcher(
+		conf.ClaimCheckConfig{CacheDir: t.TempDir(), Concurrency: -1}, claimCheckBucket, store, retry.Policy{})
+	assert.Error(t, err)
+
+	file := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(file, nil, 0o600))
+	_, err = reportaggregators.NewClaimCheckFetcher(
+		conf.ClaimCheckConfig{CacheDir: filepath.Join(file, "cache")}, claimCheckBucket, store, retry.Policy{})
+	assert.ErrorContains(t, err, "cache")
+}
+
+func TestClaimCheckFetch(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	store := testhelpers.NewObjectStore(claimCheckBucket, map[string][]byte{"a/report.json": testdata.RuleHitReport})
+	cacheDir := t.TempDir()
+	fetcher := newFetcher(t, conf.ClaimCheckConfig{CacheDir: cacheDir}, store)
+	claim := claimCheckFor("a/report.json", testdata.RuleHitReport)
+
+	for i := 0; i < 2; i++ {
+		report, err := fetcher.Fetch(context.Background(), claim)
+		assert.NoError(t, err)
+		assert.Equal(t, testdata.RuleHitReport, report)
+	}
+	// the second report is read from the cache
+	assert.Equal(t, 1, store.Gets())
+
+	// the cache is kept for the next runs
+	report, err := newFetcher(t, conf.ClaimCheckConfig{CacheDir: cacheDir}, store).Fetch(context.Background(), claim)
+	assert.NoError(t, err)
+	assert.Equal(t, testdata.RuleHitReport, report)
+	assert.Equal(t, 1, store.Gets())
+
+	assert.Equal(t,
+		map[string]float64{metrics.ClaimCheckFetched: 1, metrics.ClaimCheckCached: 2},
+		metrics.CounterValues(metrics.ClaimChecks, "result"))
+}
+
+func TestClaimCheckFetchCorruptedCache(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	store := testhelpers.NewObjectStore(claimCheckBucket, map[string][]byte{"report.json": testdata.RuleHitReport})
+	cacheDir := t.TempDir()
+	fetcher := newFetcher(t, conf.ClaimCheckConfig{CacheDir: cacheDir}, store)
+	claim := claimCheckFor("report.json", testdata.RuleHitReport)
+
+	_, err := fetcher.Fetch(context.Background(), claim)
+	assert.NoError(t, err)
+	cached := filepath.Join(cacheDir, claim.SHA256+".json")
+	assert.NoError(t, os.WriteFile(cached, []byte("{}"), 0o600))
+
+	report, err := fetcher.Fetch(context.Background(), claim)
+	assert.NoError(t, err)
+	assert.Equal(t, testdata.RuleHitReport, report)
+	assert.Equal(t, 2, store.Gets())
+}
+
+func TestClaimCheckFetchInvalid(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	large := bytes.Repeat([]byte("a"), 2<<20)
+	store := testhelpers.NewObjectStore(claimCheckBucket, map[string][]byte{
+		"report.json": testdata.RuleHitReport,
+		"large.json":  large,
+	})
+	store.Objects["other"] = map[string][]byte{"report.json": testdata.RuleHitReport}
+	fetcher := newFetcher(t, conf.ClaimCheckConfig{MaxSize: 1}, store)
+
+	valid := claimCheckFor("report.json", testdata.RuleHitReport)
+	otherBucket := valid
+	otherBucket.URL = "s3://other/report.json"
+	wrongChecksum := claimCheckFor("report.json", []byte("{}"))
+	wrongChecksum.Size = 0
+	wrongSize := valid
+	wrongSize.Size++
+	invalidChecksum := valid
+	invalidChecksum.SHA256 = "abc"
+
+	tests := []struct {
+		claim reportaggregators.ClaimCheck
+		err   string
+	}{
+		{reportaggregators.ClaimCheck{URL: "https://host/report.json", SHA256: valid.SHA256}, "invalid claim check URL"},
+		{reportaggregators.ClaimCheck{URL: "s3://reports/", SHA256: valid.SHA256}, "invalid claim check URL"},
+		{otherBucket, "bucket other"},
+		{invalidChecksum, "invalid claim check SHA-256 checksum"},
+		{claimCheckFor("missing.json", nil), "doesn't exist"},
+		{claimCheckFor("large.json", large), "maximum size of 1 MiB"},
+		{wrongChecksum, "SHA-256 checksum of the report"},
+		{wrongSize, "bytes instead of"},
+	}
+	for _, test := range tests {
+		_, err := fetcher.Fetch(context.Background(), test.claim)
+		assert.ErrorContains(t, err, test.err, test.claim.URL)
+		var fetchErr *reportaggregators.FetchError
+		assert.NotErrorAs(t, err, &fetchErr, test.claim.URL)
+	}
+	assert.Equal(t, float64(len(tests)), metrics.CounterValues(metrics.ClaimChecks, "result")[metrics.ClaimCheckFailed])
+}
+
+func TestClaimCheckFetchError(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	store := testhelpers.NewObjectStore(claimCheckBucket, map[string][]byte{"report.json": testdata.RuleHitReport})
+	store.Err = &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	fetcher := newFetcher(t, conf.ClaimCheckConfig{}, store)
+
+	_, err := fetcher.Fetch(context.Background(), claimCheckFor("report.json", testdata.RuleHitReport))
+	var fetchErr *reportaggregators.FetchError
+	assert.ErrorAs(t, err, &fetchErr)
+	assert.True(t, retry.IsRetryable(err))
+	// the transient errors are retried
+	assert.Equal(t, 3, store.Gets())
+}
+
+func TestClaimCheckFetchConcurrency(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	objects := map[string][]byte{}
+	claims := []reportaggregators.ClaimCheck{}
+	for i := 0; i < 6; i++ {
+		key := fmt.Sprintf("report%d.json", i)
+		objects[key] = []byte(fmt.Sprintf(`{"path": "%d"}`, i))
+		claims = append(claims, claimCheckFor(key, objects[key]))
+	}
+	store := testhelpers.NewObjectStore(claimCheckBucket, objects)
+	store.Wait = make(chan struct{})
+	fetcher := newFetcher(t, conf.ClaimCheckConfig{Concurrency: 2}, store)
+
+	var wg sync.WaitGroup
+	for _, claim := range claims {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := fetcher.Fetch(context.Background(), claim)
+			assert.NoError(t, err)
+		}()
+	}
+	assert.Eventually(t, func() bool { return store.Gets() == 2 }, time.Second, time.Millisecond)
+	close(store.Wait)
+	wg.Wait()
+
+	assert.Equal(t, 6, store.Gets())
+	assert.Equal(t, 2, store.MaxConcurrentGets())
+}
+
+func TestClaimCheckCacheSize(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	first := bytes.Repeat([]byte("1"), 600<<10)
+	second := bytes.Repeat([]byte("2"), 600<<10)
+	store := testhelpers.NewObjectStore(claimCheckBucket, map[string][]byte{"1": first, "2": second})
+	cacheDir := t.TempDir()
+	fetcher := newFetcher(t, conf.ClaimCheckConfig{CacheDir: cacheDir, CacheSize: 1}, store)
+
+	_, err := fetcher.Fetch(context.Background(), claimCheckFor("1", first))
+	assert.NoError(t, err)
+	// the first report is the least recently used one
+	past := time.Now().Add(-time.Hour)
+	firstClaim := claimCheckFor("1", first)
+	assert.NoError(t, os.Chtimes(filepath.Join(cacheDir, firstClaim.SHA256+".json"), past, past))
+	_, err = fetcher.Fetch(context.Background(), claimCheckFor("2", second))
+	assert.NoError(t, err)
+
+	entries, err := os.ReadDir(cacheDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, claimCheckFor("2", second).SHA256+".json", entries[0].Name())
+}
@@ -0,0 +1,166 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportaggregators
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/metrics"
+)
+
+// idSet is a set of cluster or organization IDs. An empty set matches
+// nothing.
+type idSet map[string]struct{}
+
+func newIDSet(ids []string) idSet {
+	set := idSet{}
+	for _, id := range ids {
+		if id = strings.ToLower(strings.TrimSpace(id)); id != "" {
+			set[id] = struct{}{}
+		}
+	}
+	return set
+}
+
+func (set idSet) contains(id string) bool {
+	_, ok := set[strings.ToLower(id)]
+	return ok
+}
+
+// Filter decides which clusters, organizations and rules the rows are
+// generated for. A nil filter keeps every row.
+type Filter struct {
+	includeClusters idSet
+	excludeClusters idSet
+	includeOrgs     idSet
+	excludeOrgs     idSet
+	includeRules    []string
+	excludeRules    []string
+}
+
+// NewFilter returns the filter configured. The cluster IDs in the files are
+// added to the ones configured inline.
+func NewFilter(config conf.FiltersConfig) (*Filter, error) {
+	includeClusters, err := readIDs(config.IncludeClusters, config.IncludeClustersFile)
+	if err != nil {
+		return nil, err
+	}
+	excludeClusters, err := readIDs(config.ExcludeClusters, config.ExcludeClustersFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range append(append([]string{}, config.IncludeRules...), config.ExcludeRules...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			err = fmt.Errorf("invalid rule pattern %q: %w", pattern, err)
+			log.Error().Err(err).Msg("Invalid filters configuration")
+			return nil, err
+		}
+	}
+
+	return &Filter{
+		includeClusters: newIDSet(includeClusters),
+		excludeClusters: newIDSet(excludeClusters),
+		includeOrgs:     newIDSet(config.IncludeOrgs),
+		excludeOrgs:     newIDSet(config.ExcludeOrgs),
+		includeRules:    config.IncludeRules,
+		excludeRules:    config.ExcludeRules,
+	}, nil
+}
+
+// readIDs returns the given IDs along with the ones listed in the file, one
+// per line. The empty lines and the ones starting with # are ignored.
+func readIDs(ids []string, filename string) ([]string, error) {
+	ids = append([]string{}, ids...)
+	if filename == "" {
+		return ids, nil
+	}
+
+	file, err := os.Open(filename) // #nosec G304 -- the file is set in the configuration
+	if err != nil {
+		log.Error().Err(err).Str("file", filename).Msg("Unable to read the cluster IDs of the filters")
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ids = append(ids, line)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Error().Err(err).Str("file", filename).Msg("Unable to read the cluster IDs of the filters")
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Report returns the filter excluding the rows of the report with the given
+// metadata, or an empty string if they are kept
+func (filter *Filter) Report(metadata Metadata) string {
+	if filter == nil {
+		return ""
+	}
+
+	switch {
+	case len(filter.includeClusters) > 0 && !filter.includeClusters.contains(metadata.ClusterID):
+		return metrics.FilterIncludeClusters
+	case filter.excludeClusters.contains(metadata.ClusterID):
+		return metrics.FilterExcludeClusters
+	case len(filter.includeOrgs) > 0 && !filter.includeOrgs.contains(metadata.OrgID):
+		return metrics.FilterIncludeOrgs
+	case filter.excludeOrgs.contains(metadata.OrgID):
+		return metrics.FilterExcludeOrgs
+	}
+	return ""
+}
+
+// Rule returns the filter excluding the rows of the given rule, or an empty
+// string if they are kept
+func (filter *Filter) Rule(ruleID string) string {
+	if filter == nil {
+		return ""
+	}
+
+	switch {
+	case len(filter.includeRules) > 0 && !matchesAny(filter.includeRules, ruleID):
+		return metrics.FilterIncludeRules
+	case matchesAny(filter.excludeRules, ruleID):
+		return metrics.FilterExcludeRules
+	}
+	return ""
+}
+
+// matchesAny returns true if the value matches any of the glob patterns
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		// the patterns are checked when the filter is created
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportaggregators_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/metrics"
+	"github.com/RedHatInsights/parquet-factory/reportaggregators"
+)
+
+func TestNewFilter(t *testing.T) {
+	_, err := reportaggregators.NewFilter(conf.FiltersConfig{IncludeClustersFile: "missing.txt"})
+	assert.Error(t, err)
+
+	_, err = reportaggregators.NewFilter(conf.FiltersConfig{ExcludeRules: []string{"rule["}})
+	assert.ErrorContains(t, err, "invalid rule pattern")
+}
+
+func TestFilterReport(t *testing.T) {
+	clustersFile := filepath.Join(t.TempDir(), "clusters.txt")
+	assert.NoError(t, os.WriteFile(clustersFile, []byte("# test clusters\n\ncluster-1\n  CLUSTER-2  \n"), 0o600))
+
+	filter, err := reportaggregators.NewFilter(conf.FiltersConfig{
+		IncludeClusters:     []string{"cluster-3"},
+		IncludeClustersFile: clustersFile,
+		ExcludeClusters:     []string{"cluster-3"},
+		IncludeOrgs:         []string{"1", "2"},
+		ExcludeOrgs:         []string{"2"},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		metadata reportaggregators.Metadata
+		filter   string
+	}{
+		{reportaggregators.Metadata{ClusterID: "cluster-1", OrgID: "1"}, ""},
+		{reportaggregators.Metadata{ClusterID: "cluster-2", OrgID: "1"}, ""},
+		{reportaggregators.Metadata{ClusterID: "# test clusters", OrgID: "1"}, metrics.FilterIncludeClusters},
+		{reportaggregators.Metadata{ClusterID: "cluster-4", OrgID: "1"}, metrics.FilterIncludeClusters},
+		{reportaggregators.Metadata{ClusterID: "cluster-3", OrgID: "1"}, metrics.FilterExcludeClusters},
+		{reportaggregators.Metadata{ClusterID: "cluster-1", OrgID: "3"}, metrics.FilterIncludeOrgs},
+		{reportaggregators.Metadata{ClusterID: "cluster-1", OrgID: "2"}, metrics.FilterExcludeOrgs},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.filter, filter.Report(test.metadata), test.metadata)
+	}
+}
+
+func TestFilterRule(t *testing.T) {
+	filter, err := reportaggregators.NewFilter(conf.FiltersConfig{
+		IncludeRules: []string{"ccx_rules_ocp.*", "nodes_*|*"},
+		ExcludeRules: []string{"*|TEST_*"},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "", filter.Rule("ccx_rules_ocp.external.rules.nodes.report|NODES"))
+	assert.Equal(t, "", filter.Rule("nodes_kubelet_version_check|NODE_KUBELET_VERSION"))
+	assert.Equal(t, metrics.FilterIncludeRules, filter.Rule("pods_check_containers|POD_CONTAINER_ISSUE"))
+	assert.Equal(t, metrics.FilterExcludeRules, filter.Rule("nodes_kubelet_version_check|TEST_KEY"))
+
+	// every rule is kept without filters
+	filter, err = reportaggregators.NewFilter(conf.FiltersConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", filter.Rule("pods_check_containers|POD_CONTAINER_ISSUE"))
+	assert.Equal(t, "", filter.Report(reportaggregators.Metadata{ClusterID: "cluster-1"}))
+
+	var noFilter *reportaggregators.Filter
+	assert.Equal(t, "", noFilter.Rule("rule"))
+	assert.Equal(t, "", noFilter.Report(reportaggregators.Metadata{}))
+}
@@ -0,0 +1,93 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportaggregators
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+// MinPseudonymisationKeySize is the minimum size in bytes of the HMAC key
+const MinPseudonymisationKeySize = 16
+
+// Pseudonymiser replaces the values of the columns configured for every table
+// by their HMAC-SHA256 with a secret key. The same value gets the same
+// pseudonym in every table and column, so the tables can still be joined. A
+// nil Pseudonymiser keeps every value.
+type Pseudonymiser struct {
+	key []byte
+	// columns are the pseudonymised columns of every table
+	columns map[string]map[string]bool
+}
+
+// NewPseudonymiser returns a Pseudonymiser of the given columns of every
+// table, using the key stored in the given file. The trailing line breaks of
+// the file aren't part of the key.
+func NewPseudonymiser(keyFile string, columns map[string][]string) (*Pseudonymiser, error) {
+	key, err := readPseudonymisationKey(keyFile)
+	if err != nil {
+		log.Error().Err(err).Str("key_file", keyFile).Msg("Unable to read the pseudonymisation key")
+		return nil, err
+	}
+
+	pseudonymiser := &Pseudonymiser{key: key, columns: map[string]map[string]bool{}}
+	for table, tableColumns := range columns {
+		pseudonymiser.columns[table] = map[string]bool{}
+		for _, column := range tableColumns {
+			pseudonymiser.columns[table][column] = true
+		}
+	}
+	return pseudonymiser, nil
+}
+
+func readPseudonymisationKey(keyFile string) ([]byte, error) {
+	if keyFile == "" {
+		return nil, errors.New("the key file is needed to pseudonymise the columns")
+	}
+	key, err := os.ReadFile(keyFile) // #nosec G304 -- the file is set in the configuration
+	if err != nil {
+		return nil, err
+	}
+	key = bytes.TrimRight(key, "\r\n")
+	if len(key) < MinPseudonymisationKeySize {
+		return nil, fmt.Errorf("the key must have at least %d bytes", MinPseudonymisationKeySize)
+	}
+	return key, nil
+}
+
+// Pseudonymises returns true if the values of the column of the table are
+// pseudonymised
+func (pseudonymiser *Pseudonymiser) Pseudonymises(table, column string) bool {
+	return pseudonymiser != nil && pseudonymiser.columns[table][column]
+}
+
+// Value returns the pseudonym of the value, as a hexadecimal string, if the
+// column of the table is pseudonymised. The value is returned as it is
+// otherwise, or if it is empty.
+func (pseudonymiser *Pseudonymiser) Value(table, column, value string) string {
+	if value == "" || !pseudonymiser.Pseudonymises(table, column) {
+		return value
+	}
+	mac := hmac.New(sha256.New, pseudonymiser.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,74 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportaggregators_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/reportaggregators"
+)
+
+const pseudonymisationKey = "0123456789abcdef"
+
+func keyFile(t *testing.T, key string) string {
+	file := filepath.Join(t.TempDir(), "key")
+	assert.NoError(t, os.WriteFile(file, []byte(key), 0o600))
+	return file
+}
+
+func TestNewPseudonymiser(t *testing.T) {
+	_, err := reportaggregators.NewPseudonymiser("", nil)
+	assert.ErrorContains(t, err, "key file")
+
+	_, err = reportaggregators.NewPseudonymiser(filepath.Join(t.TempDir(), "missing"), nil)
+	assert.Error(t, err)
+
+	// the trailing line break isn't part of the key
+	_, err = reportaggregators.NewPseudonymiser(keyFile(t, "0123456789abcde\n"), nil)
+	assert.ErrorContains(t, err, "at least 16 bytes")
+}
+
+func TestPseudonymiserValue(t *testing.T) {
+	pseudonymiser, err := reportaggregators.NewPseudonymiser(keyFile(t, pseudonymisationKey+"\r\n"), map[string][]string{
+		"rule_hits": {"cluster_id", "rule_id"},
+		"archives":  {"cluster_id"},
+	})
+	assert.NoError(t, err)
+
+	mac := hmac.New(sha256.New, []byte(pseudonymisationKey))
+	mac.Write([]byte("cluster-1"))
+	pseudonym := hex.EncodeToString(mac.Sum(nil))
+
+	// the same value gets the same pseudonym in every table
+	assert.Equal(t, pseudonym, pseudonymiser.Value("rule_hits", "cluster_id", "cluster-1"))
+	assert.Equal(t, pseudonym, pseudonymiser.Value("archives", "cluster_id", "cluster-1"))
+	assert.NotEqual(t, pseudonym, pseudonymiser.Value("rule_hits", "rule_id", "cluster-2"))
+
+	assert.True(t, pseudonymiser.Pseudonymises("rule_hits", "rule_id"))
+	assert.False(t, pseudonymiser.Pseudonymises("archives", "rule_id"))
+	assert.Equal(t, "path", pseudonymiser.Value("archives", "archive_path", "path"))
+	assert.Equal(t, "", pseudonymiser.Value("rule_hits", "cluster_id", ""))
+
+	var noPseudonymiser *reportaggregators.Pseudonymiser
+	assert.False(t, noPseudonymiser.Pseudonymises("rule_hits", "cluster_id"))
+	assert.Equal(t, "cluster-1", noPseudonymiser.Value("rule_hits", "cluster_id", "cluster-1"))
+}
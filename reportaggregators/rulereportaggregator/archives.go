@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/RedHatInsights/parquet-factory/deltalog"
 	"github.com/RedHatInsights/parquet-factory/metrics"
 	"github.com/RedHatInsights/parquet-factory/reportaggregators"
 	"github.com/RedHatInsights/parquet-factory/s3writer"
@@ -26,7 +27,11 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-const archivesTableName = "archives"
+const (
+	archivesTableName = "archives"
+	// archivesSchemaVersion must be increased on every change of ArchivesTable
+	archivesSchemaVersion = 1
+)
 
 // ArchivesTable is Go representation of single row of archives table
 type ArchivesTable struct {
@@ -35,64 +40,32 @@ type ArchivesTable struct {
 	ArchivePath string `parquet:"name=archive_path, type=BYTE_ARRAY, encoding=PLAIN"`
 }
 
-func (aggregator *RulesResultsReportAggregator) createArchivesTable(writer s3writer.S3ParquetWriter) ([]string, error) {
-	log.Info().Msgf(reportaggregators.StartGenerateFileStr, archivesTableName)
+// SchemaVersion returns the version of the archives schema
+func (ArchivesTable) SchemaVersion() int {
+	return archivesSchemaVersion
+}
 
-	ctx := context.Background()
-	savedFiles := []string{}
+func (row ArchivesTable) archivePath() string {
+	return row.ArchivePath
+}
 
-	table, err := aggregator.generateArchivesRows()
+func (aggregator *RulesResultsReportAggregator) createArchivesTable(
+	ctx context.Context, writer s3writer.S3ParquetWriter, slots chan struct{}, files *fileSet, output tableOutput,
+) ([]deltalog.DataFile, error) {
+	layout := aggregator.layout(archivesTableName)
+	table, err := aggregator.generateArchivesRows(layout, output)
 	if err != nil {
 		log.Error().Err(err).Msgf(reportaggregators.UnableGenerateTableStr, archivesTableName)
-		return savedFiles, err
-	}
-
-	for timestamp, rows := range table {
-		// generate filepath without index first
-		archivesPrefix := utils.GenerateHourPrefix(timestamp, writer.Prefix(), archivesTableName)
-		indexes := writer.GetLastIndexForParquet(ctx, archivesPrefix)
-		fileID, ok := indexes[archivesTableName]
-		if !ok {
-			fileID = 0
-		} else {
-			fileID++
-		}
-
-		parquetFilePath := utils.GenerateParquetFilepath(
-			timestamp, writer.Prefix(), archivesTableName, fileID)
-		log.Info().Msgf(reportaggregators.FileStoredStr, parquetFilePath)
-
-		// Init writers directly to bucket
-		file, err := writer.NewFile(ctx, parquetFilePath, new(ArchivesTable))
-		if err != nil {
-			log.Error().Err(err).Msg(reportaggregators.UnableCreateFileStr)
-			return savedFiles, err
-		}
-
-		for _, row := range rows {
-			if err = file.AddRow(row); err != nil {
-				log.Error().Err(err).Msgf(reportaggregators.UnableSaveRowStr, ruleHitsTableName)
-				continue
-			}
-			reportaggregators.LogInsertedRow(row.ArchivePath, ruleHitsTableName)
-		}
-
-		if err := file.CloseFile(); err != nil {
-			log.Error().Err(err).Msg(reportaggregators.UnableCloseFileStr)
-			if closingErr := writer.DeleteFiles(savedFiles); closingErr != nil {
-				log.Error().Err(closingErr).Msg(reportaggregators.UnableDeleteFileStr)
-			}
-			return savedFiles, err
-		}
-		log.Info().Msgf(reportaggregators.GenerateFileSuccess, archivesTableName, fileID)
-		savedFiles = append(savedFiles, parquetFilePath)
-		metrics.FilesGenerated.With(metrics.WithTableLabel(archivesTableName)).Inc()
+		return []deltalog.DataFile{}, err
 	}
 
-	return savedFiles, nil
+	return writeTable(ctx, aggregator, writer, slots, files, archivesTableName, output, table)
 }
-func (aggregator *RulesResultsReportAggregator) generateArchivesRows() (map[time.Time][]ArchivesTable, error) {
-	tableRows := map[time.Time][]ArchivesTable{}
+
+func (aggregator *RulesResultsReportAggregator) generateArchivesRows(
+	layout *utils.PartitionLayout, output tableOutput,
+) (map[utils.Partition][]ArchivesTable, error) {
+	tableRows := map[utils.Partition][]ArchivesTable{}
 	clusterSet := make(map[string]struct{})
 
 	aggregator.mutex.RLock()
@@ -101,6 +74,9 @@ func (aggregator *RulesResultsReportAggregator) generateArchivesRows() (map[time
 	for _, report := range aggregator.ReceivedReports {
 		collectedAt, err := reportaggregators.ExtractCollectedDate(report.Path)
 		if err != nil {
+			if !output.primary {
+				continue
+			}
 			log.Error().
 				Err(err).
 				Str("archive_path", report.Path).
@@ -109,22 +85,30 @@ func (aggregator *RulesResultsReportAggregator) generateArchivesRows() (map[time
 				Int("reports_count", len(report.Report.Reports)).
 				Interface("full_report", report).
 				Msgf("Unable to find collected at date for report")
+			metrics.RowsSkipped.With(metrics.WithTableReasonLabels(archivesTableName, metrics.ReasonInvalidDate)).Inc()
 			continue
 		}
-		collectedHour := utils.GetHourOnly(collectedAt)
+		partition := aggregator.partitionFor(layout, output, archivesTableName, collectedAt, report.Metadata.OrgID)
 
 		// Push new data to parquet table
-		key := fmt.Sprintf("%s%d%s", report.Metadata.ClusterID,
-			collectedAt.Unix()*1000,
-			report.Path)
+		key := archiveKey(report.Metadata.ClusterID, report.Path, collectedAt)
 		if _, ok := clusterSet[key]; !ok {
-			tableRows[collectedHour] = append(tableRows[collectedHour], ArchivesTable{
-				ClusterID:   report.Metadata.ClusterID,
+			clusterSet[key] = struct{}{}
+			if !aggregator.keepRow(archivesTableName, aggregator.filter.Report(report.Metadata), output) {
+				continue
+			}
+			tableRows[partition] = append(tableRows[partition], ArchivesTable{
+				ClusterID:   aggregator.value(output, archivesTableName, clusterIDColumn, report.Metadata.ClusterID),
 				CollectedAt: collectedAt.Unix() * 1000,
-				ArchivePath: report.Path,
+				ArchivePath: aggregator.value(output, archivesTableName, archivePathColumn, report.Path),
 			})
-			clusterSet[key] = struct{}{}
 		}
 	}
 	return tableRows, nil
 }
+
+// archiveKey identifies the row of the archives table of a report, so every
+// archive is written once
+func archiveKey(clusterID, path string, collectedAt time.Time) string {
+	return fmt.Sprintf("%s%d%s", clusterID, collectedAt.Unix()*1000, path)
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rulereportaggregator
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/catalog"
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/reportaggregators"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+	"github.com/RedHatInsights/parquet-factory/utils"
+)
+
+// tableNames lists the tables generated by this aggregator in the order they
+// are written
+var tableNames = []string{ruleHitsTableName, archivesTableName}
+
+// tableRow returns an empty row of the given table
+func tableRow(table string) interface{} {
+	switch table {
+	case ruleHitsTableName:
+		return new(RuleHitTable)
+	case archivesTableName:
+		return new(ArchivesTable)
+	}
+	return nil
+}
+
+// tableDescriptor returns the descriptor of the given table
+func (aggregator *RulesResultsReportAggregator) tableDescriptor(
+	prefix, table string,
+) (*catalog.TableDescriptor, error) {
+	layout := aggregator.layout(table)
+	return catalog.NewTableDescriptor(table, layout.TablePrefix(prefix, table), layout, tableRow(table))
+}
+
+// Suffixes of the names of the tables written under the masked and the
+// filtered prefixes, so they can be registered along with the main ones
+const (
+	maskedTableSuffix   = "_masked"
+	filteredTableSuffix = "_filtered"
+)
+
+// TableDescriptors returns the descriptors of all the tables generated with
+// the given configuration, under the main prefix and, if they are configured,
+// the masked and the filtered prefixes. Only the partitioning of the tables
+// is used, so neither the pseudonymisation key nor the filters or the schema
+// of the messages are needed.
+func TableDescriptors(config conf.Config) ([]*catalog.TableDescriptor, error) {
+	type output struct {
+		prefix, suffix string
+	}
+	outputs := []output{{prefix: config.S3.FilePathPrefix}}
+	if prefix := config.Pseudonymisation.MaskedPrefix; prefix != "" {
+		outputs = append(outputs, output{prefix, maskedTableSuffix})
+	}
+	if prefix := config.Filters.FilteredPrefix; prefix != "" {
+		outputs = append(outputs, output{prefix, filteredTableSuffix})
+	}
+
+	descriptors := []*catalog.TableDescriptor{}
+	for _, output := range outputs {
+		for _, table := range tableNames {
+			layout, err := utils.NewPartitionLayout(config.Tables[table].Partitioning)
+			if err != nil {
+				log.Error().Err(err).Str("table", table).Msg("Invalid partitioning configuration")
+				return nil, err
+			}
+			descriptor, err := catalog.NewTableDescriptor(table, layout.TablePrefix(output.prefix, table), layout, tableRow(table))
+			if err != nil {
+				return nil, err
+			}
+			descriptor.Name += output.suffix
+			descriptors = append(descriptors, descriptor)
+		}
+	}
+	return descriptors, nil
+}
+
+// writeTableDescriptor stores the descriptor of the given table under its
+// prefix, so the catalog can be kept in sync with the stored files
+func (aggregator *RulesResultsReportAggregator) writeTableDescriptor(
+	ctx context.Context, writer s3writer.S3ParquetWriter, table string,
+) error {
+	descriptor, err := aggregator.tableDescriptor(writer.Prefix(), table)
+	if err != nil {
+		log.Error().Err(err).Msgf(reportaggregators.UnableWriteDescriptorStr, table)
+		return err
+	}
+
+	content, err := descriptor.JSON()
+	if err != nil {
+		log.Error().Err(err).Msgf(reportaggregators.UnableWriteDescriptorStr, table)
+		return err
+	}
+
+	key := descriptor.Location + catalog.DescriptorFilename
+	if err := writer.WriteObject(ctx, key, content, objectOptions(table)); err != nil {
+		log.Error().Err(err).Msgf(reportaggregators.UnableWriteDescriptorStr, table)
+		return err
+	}
+	log.Debug().Str("key", key).Msgf("Descriptor of the \"%s\" table stored", table)
+	return nil
+}
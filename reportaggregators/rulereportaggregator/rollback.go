@@ -0,0 +1,110 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rulereportaggregator
+
+import (
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/metrics"
+	"github.com/RedHatInsights/parquet-factory/runreport"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// fileSet tracks the keys of the files written in a run across all the tables
+type fileSet struct {
+	mutex sync.Mutex
+	keys  []string
+}
+
+func newFileSet() *fileSet {
+	return &fileSet{keys: []string{}}
+}
+
+// Add adds a file to the set, if it isn't already in it
+func (files *fileSet) Add(key string) {
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+	if !slices.Contains(files.keys, key) {
+		files.keys = append(files.keys, key)
+	}
+}
+
+// Remove removes the given files from the set
+func (files *fileSet) Remove(keys []string) {
+	removed := map[string]bool{}
+	for _, key := range keys {
+		removed[key] = true
+	}
+
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+	kept := []string{}
+	for _, key := range files.keys {
+		if !removed[key] {
+			kept = append(kept, key)
+		}
+	}
+	files.keys = kept
+}
+
+// Contains returns true if the file is in the set
+func (files *fileSet) Contains(key string) bool {
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+	return slices.Contains(files.keys, key)
+}
+
+// Keys returns the keys of the files in the set
+func (files *fileSet) Keys() []string {
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+	return append([]string{}, files.keys...)
+}
+
+// Len returns the number of files in the set
+func (files *fileSet) Len() int {
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+	return len(files.keys)
+}
+
+// rollback deletes the given files. The writer retries the ones that can't be
+// deleted, and the files still stored after that are logged, counted in the
+// metrics and recorded in the run report as undeleted files. None of them is
+// listed as a written file of the run anymore.
+func rollback(writer s3writer.S3ParquetWriter, keys []string) {
+	runreport.RemoveFiles(keys)
+	err := writer.DeleteFiles(keys)
+	if err == nil {
+		return
+	}
+
+	undeleted := keys
+	var deleteErr *s3writer.DeleteError
+	if errors.As(err, &deleteErr) {
+		undeleted = deleteErr.Keys
+	}
+	log.Error().Err(err).Int("files", len(undeleted)).Msg("Unable to delete the files written in the run")
+
+	for _, key := range undeleted {
+		log.Error().Str("key", key).Msg("File not deleted, it must be removed manually")
+	}
+	metrics.UndeletedFiles.Add(float64(len(undeleted)))
+	runreport.RecordUndeletedFiles(undeleted)
+}
@@ -16,17 +16,21 @@ package rulereportaggregator
 
 import (
 	"context"
-	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/RedHatInsights/parquet-factory/deltalog"
 	"github.com/RedHatInsights/parquet-factory/metrics"
 	"github.com/RedHatInsights/parquet-factory/reportaggregators"
 	"github.com/RedHatInsights/parquet-factory/s3writer"
 	"github.com/RedHatInsights/parquet-factory/utils"
 )
 
-const ruleHitsTableName = "rule_hits"
+const (
+	ruleHitsTableName = "rule_hits"
+	// ruleHitsSchemaVersion must be increased on every change of RuleHitTable
+	ruleHitsSchemaVersion = 1
+)
 
 // RuleHitTable is Go representation of single row of rule_hits table
 type RuleHitTable struct {
@@ -36,69 +40,32 @@ type RuleHitTable struct {
 	ArchivePath string `parquet:"name=archive_path, type=BYTE_ARRAY, encoding=PLAIN"`
 }
 
-func (aggregator *RulesResultsReportAggregator) createRuleHitTable(writer s3writer.S3ParquetWriter) ([]string, error) {
-	log.Info().Msgf(reportaggregators.StartGenerateFileStr, ruleHitsTableName)
+// SchemaVersion returns the version of the rule_hits schema
+func (RuleHitTable) SchemaVersion() int {
+	return ruleHitsSchemaVersion
+}
 
-	ctx := context.Background()
-	savedFiles := []string{}
+func (row RuleHitTable) archivePath() string {
+	return row.ArchivePath
+}
 
-	table, err := aggregator.generateRuleHitRows()
+func (aggregator *RulesResultsReportAggregator) createRuleHitTable(
+	ctx context.Context, writer s3writer.S3ParquetWriter, slots chan struct{}, files *fileSet, output tableOutput,
+) ([]deltalog.DataFile, error) {
+	layout := aggregator.layout(ruleHitsTableName)
+	table, err := aggregator.generateRuleHitRows(layout, output)
 	if err != nil {
 		log.Error().Err(err).Msgf(reportaggregators.UnableGenerateTableStr, ruleHitsTableName)
-		return savedFiles, err
-	}
-
-	for timestamp, rows := range table {
-		// generate filepath without index first
-		ruleHitsPrefix := utils.GenerateHourPrefix(timestamp, writer.Prefix(), ruleHitsTableName)
-		indexes := writer.GetLastIndexForParquet(ctx, ruleHitsPrefix)
-		fileID, ok := indexes[ruleHitsTableName]
-		if !ok {
-			fileID = 0
-		} else {
-			fileID++
-		}
-
-		parquetFilePath := aggregator.generateRuleHitsFilePath(timestamp, writer.Prefix(), fileID)
-		log.Info().Msgf(reportaggregators.FileStoredStr, parquetFilePath)
-
-		// Init writers directly to bucket
-		file, err := writer.NewFile(ctx, parquetFilePath, new(RuleHitTable))
-		if err != nil {
-			log.Error().Err(err).Msg(reportaggregators.UnableCreateFileStr)
-			return savedFiles, err
-		}
-
-		for _, row := range rows {
-			if err = file.AddRow(row); err != nil {
-				log.Error().Err(err).Msgf(reportaggregators.UnableSaveRowStr, ruleHitsTableName)
-				continue
-			}
-			reportaggregators.LogInsertedRow(row.ArchivePath, ruleHitsTableName)
-		}
-
-		if err := file.CloseFile(); err != nil {
-			log.Error().Err(err).Msg(reportaggregators.UnableCloseFileStr)
-			if closingErr := writer.DeleteFiles(savedFiles); closingErr != nil {
-				log.Error().Err(closingErr).Msg(reportaggregators.UnableDeleteFileStr)
-			}
-			return savedFiles, err
-		}
-		log.Info().Msgf(reportaggregators.GenerateFileSuccess, ruleHitsTableName, fileID)
-		savedFiles = append(savedFiles, parquetFilePath)
-		metrics.FilesGenerated.With(metrics.WithTableLabel(ruleHitsTableName)).Inc()
+		return []deltalog.DataFile{}, err
 	}
 
-	return savedFiles, nil
-}
-
-// generateRuleHitsFilePath generates full path of rule_hits parquet file
-func (aggregator *RulesResultsReportAggregator) generateRuleHitsFilePath(timestamp time.Time, prefix string, index int) string {
-	return utils.GenerateParquetFilepath(timestamp, prefix, ruleHitsTableName, index)
+	return writeTable(ctx, aggregator, writer, slots, files, ruleHitsTableName, output, table)
 }
 
-func (aggregator *RulesResultsReportAggregator) generateRuleHitRows() (map[time.Time][]RuleHitTable, error) {
-	tableRows := map[time.Time][]RuleHitTable{}
+func (aggregator *RulesResultsReportAggregator) generateRuleHitRows(
+	layout *utils.PartitionLayout, output tableOutput,
+) (map[utils.Partition][]RuleHitTable, error) {
+	tableRows := map[utils.Partition][]RuleHitTable{}
 
 	aggregator.mutex.RLock()
 	defer aggregator.mutex.RUnlock()
@@ -106,6 +73,9 @@ func (aggregator *RulesResultsReportAggregator) generateRuleHitRows() (map[time.
 	for _, report := range aggregator.ReceivedReports {
 		collectedAt, err := reportaggregators.ExtractCollectedDate(report.Path)
 		if err != nil {
+			if !output.primary {
+				continue
+			}
 			log.Error().
 				Err(err).
 				Str("archive_path", report.Path).
@@ -114,17 +84,26 @@ func (aggregator *RulesResultsReportAggregator) generateRuleHitRows() (map[time.
 				Int("reports_count", len(report.Report.Reports)).
 				Interface("full_report", report).
 				Msgf("Unable to find collected at date for report")
+			metrics.RowsSkipped.With(metrics.WithTableReasonLabels(ruleHitsTableName, metrics.ReasonInvalidDate)).Inc()
 			continue
 		}
-		collectedHour := utils.GetHourOnly(collectedAt)
+		partition := aggregator.partitionFor(layout, output, ruleHitsTableName, collectedAt, report.Metadata.OrgID)
+		reportFilter := aggregator.filter.Report(report.Metadata)
 
 		// Push new data to parquet table
 		for _, ruleReport := range report.Report.Reports {
-			tableRows[collectedHour] = append(tableRows[collectedHour], RuleHitTable{
-				ClusterID:   report.Metadata.ClusterID,
-				RuleID:      ruleReport.RuleID,
+			filter := reportFilter
+			if filter == "" {
+				filter = aggregator.filter.Rule(ruleReport.RuleID)
+			}
+			if !aggregator.keepRow(ruleHitsTableName, filter, output) {
+				continue
+			}
+			tableRows[partition] = append(tableRows[partition], RuleHitTable{
+				ClusterID:   aggregator.value(output, ruleHitsTableName, clusterIDColumn, report.Metadata.ClusterID),
+				RuleID:      aggregator.value(output, ruleHitsTableName, ruleIDColumn, ruleReport.RuleID),
 				CollectedAt: collectedAt.Unix() * 1000,
-				ArchivePath: report.Path,
+				ArchivePath: aggregator.value(output, ruleHitsTableName, archivePathColumn, report.Path),
 			})
 		}
 	}
@@ -15,13 +15,26 @@
 package rulereportaggregator
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/IBM/sarama"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/deltalog"
 	"github.com/RedHatInsights/parquet-factory/metrics"
 	"github.com/RedHatInsights/parquet-factory/reportaggregators"
+	"github.com/RedHatInsights/parquet-factory/retry"
+	"github.com/RedHatInsights/parquet-factory/runreport"
 	"github.com/RedHatInsights/parquet-factory/s3writer"
+	"github.com/RedHatInsights/parquet-factory/tracing"
+	"github.com/RedHatInsights/parquet-factory/utils"
 	"github.com/rs/zerolog/log"
 )
 
@@ -49,25 +62,296 @@ type RulesResultsReport struct {
 	Path     string                     `json:"path"`
 	Metadata reportaggregators.Metadata `json:"metadata"`
 	Report   RuleReport                 `json:"report"`
+	// ClaimCheck references the report when it isn't sent in the message
+	ClaimCheck *reportaggregators.ClaimCheck `json:"claim_check,omitempty"`
+
+	source reportaggregators.MessageSource
+}
+
+// missingFields returns the fields needed to generate the rows of the report
+// that are empty
+func (report *RulesResultsReport) missingFields() []string {
+	missing := []string{}
+	if report.Path == "" {
+		missing = append(missing, "path")
+	}
+	if report.Metadata.ClusterID == "" {
+		missing = append(missing, "metadata.cluster_id")
+	}
+	return missing
 }
 
 // RulesResultsReportAggregator stores an array of RulesResultsReport
 type RulesResultsReportAggregator struct {
 	ReceivedReports []RulesResultsReport
 	mutex           sync.RWMutex
+	layouts         map[string]*utils.PartitionLayout
+	fileNamings     map[string]string
+	formats         map[string]string
+	writeWorkers    int
+	retryPolicy     retry.Policy
+	// schema validates the received messages, if it is set
+	schema *reportaggregators.MessageSchema
+	// claimChecks fetches the reports referenced by the messages, if it is set
+	claimChecks *reportaggregators.ClaimCheckFetcher
+	// claimCheckPaths are the paths of the reports fetched from claim checks,
+	// so every report is aggregated once
+	claimCheckPaths map[string]struct{}
+	// filter excludes the rows of some clusters, organizations and rules,
+	// which are written under filteredPrefix if it is set
+	filter         *reportaggregators.Filter
+	filteredPrefix string
+	// pseudonymiser masks the columns configured, in every table if
+	// maskedPrefix is empty, or in a copy of them written under it
+	pseudonymiser *reportaggregators.Pseudonymiser
+	maskedPrefix  string
 }
 
 // NewRulesReportAggregator initialize a RulesResultsReportAggregator variable
+// using the default configuration for every table
 func NewRulesReportAggregator() *RulesResultsReportAggregator {
 	return &RulesResultsReportAggregator{
 		ReceivedReports: []RulesResultsReport{},
+		layouts:         map[string]*utils.PartitionLayout{},
+		fileNamings:     map[string]string{},
+		formats:         map[string]string{},
+		writeWorkers:    defaultWriteWorkers,
+		claimCheckPaths: map[string]struct{}{},
 	}
 }
 
-// Handle parses an incoming message from Kafka and store it in the aggregation
-func (aggregator *RulesResultsReportAggregator) Handle(data interface{}) error {
-	message, ok := data.([]byte)
+// NewRulesReportAggregatorFromConfig initialize a RulesResultsReportAggregator
+// variable using the tables configuration
+func NewRulesReportAggregatorFromConfig(config conf.Config) (*RulesResultsReportAggregator, error) {
+	aggregator := NewRulesReportAggregator()
+
+	if config.S3.WriteWorkers < 0 {
+		err := fmt.Errorf("invalid number of write workers %d", config.S3.WriteWorkers)
+		log.Error().Err(err).Msg("Invalid S3 configuration")
+		return nil, err
+	}
+	if config.S3.WriteWorkers > 0 {
+		aggregator.writeWorkers = config.S3.WriteWorkers
+	}
+	aggregator.retryPolicy = retry.NewPolicy(config.Retry, config.S3.MaxRetries)
+
+	if schemaFile := config.RulesKafkaConsumer.SchemaFile; schemaFile != "" {
+		schema, err := reportaggregators.LoadMessageSchema(schemaFile)
+		if err != nil {
+			return nil, err
+		}
+		aggregator.schema = schema
+	}
+
+	filter, err := reportaggregators.NewFilter(config.Filters)
+	if err != nil {
+		return nil, err
+	}
+	aggregator.filter = filter
+	if prefix := config.Filters.FilteredPrefix; prefix != "" && prefix == config.S3.FilePathPrefix {
+		err := fmt.Errorf("the filtered rows can't be written under the prefix %q of the tables", prefix)
+		log.Error().Err(err).Msg("Invalid filters configuration")
+		return nil, err
+	}
+	aggregator.filteredPrefix = config.Filters.FilteredPrefix
+
+	if err := aggregator.configurePseudonymisation(config); err != nil {
+		return nil, err
+	}
+
+	for _, table := range tableNames {
+		layout, err := utils.NewPartitionLayout(config.Tables[table].Partitioning)
+		if err != nil {
+			log.Error().Err(err).Str("table", table).Msg("Invalid partitioning configuration")
+			return nil, err
+		}
+		aggregator.layouts[table] = layout
+
+		switch naming := config.Tables[table].FileNaming; naming {
+		case "", utils.IndexFileNaming, utils.UniqueFileNaming:
+			aggregator.fileNamings[table] = naming
+		default:
+			err := fmt.Errorf("unknown file naming %q", naming)
+			log.Error().Err(err).Str("table", table).Msg("Invalid file naming configuration")
+			return nil, err
+		}
+
+		switch format := config.Tables[table].Format; format {
+		case "", utils.FilesTableFormat, utils.DeltaTableFormat:
+			aggregator.formats[table] = format
+		default:
+			err := fmt.Errorf("unknown table format %q", format)
+			log.Error().Err(err).Str("table", table).Msg("Invalid table format configuration")
+			return nil, err
+		}
+	}
+
+	return aggregator, nil
+}
+
+// UseClaimChecks lets the aggregator fetch the reports referenced by claim
+// checks with the given fetcher. The claim checks are rejected otherwise.
+func (aggregator *RulesResultsReportAggregator) UseClaimChecks(fetcher *reportaggregators.ClaimCheckFetcher) {
+	aggregator.claimChecks = fetcher
+}
+
+// configurePseudonymisation checks the pseudonymised columns of every table
+// and where the pseudonymised tables are written
+func (aggregator *RulesResultsReportAggregator) configurePseudonymisation(config conf.Config) error {
+	columns := map[string][]string{}
+	for _, table := range tableNames {
+		for _, column := range config.Tables[table].Pseudonymise {
+			if !slices.Contains(pseudonymisableColumns[table], column) {
+				err := fmt.Errorf("the column %q can't be pseudonymised, it must be one of %s",
+					column, strings.Join(pseudonymisableColumns[table], ", "))
+				log.Error().Err(err).Str("table", table).Msg("Invalid pseudonymisation configuration")
+				return err
+			}
+			columns[table] = append(columns[table], column)
+		}
+		// the archive path includes the cluster ID, so it would leak it
+		if slices.Contains(columns[table], clusterIDColumn) && !slices.Contains(columns[table], archivePathColumn) {
+			err := fmt.Errorf("the column %q must be pseudonymised along with %q, as it includes the cluster ID",
+				archivePathColumn, clusterIDColumn)
+			log.Error().Err(err).Str("table", table).Msg("Invalid pseudonymisation configuration")
+			return err
+		}
+	}
+
+	maskedPrefix := config.Pseudonymisation.MaskedPrefix
+	if len(columns) == 0 {
+		if maskedPrefix != "" {
+			err := errors.New("no column of the masked tables is pseudonymised")
+			log.Error().Err(err).Msg("Invalid pseudonymisation configuration")
+			return err
+		}
+		return nil
+	}
+	if maskedPrefix != "" && (maskedPrefix == config.S3.FilePathPrefix || maskedPrefix == aggregator.filteredPrefix) {
+		err := fmt.Errorf("the masked tables can't be written under the prefix %q of other tables", maskedPrefix)
+		log.Error().Err(err).Msg("Invalid pseudonymisation configuration")
+		return err
+	}
+
+	pseudonymiser, err := reportaggregators.NewPseudonymiser(config.Pseudonymisation.KeyFile, columns)
+	if err != nil {
+		return err
+	}
+	aggregator.pseudonymiser = pseudonymiser
+	aggregator.maskedPrefix = maskedPrefix
+	return nil
+}
+
+// layout returns the partitioning layout configured for the given table
+func (aggregator *RulesResultsReportAggregator) layout(table string) *utils.PartitionLayout {
+	if layout, ok := aggregator.layouts[table]; ok {
+		return layout
+	}
+	return utils.DefaultPartitionLayout()
+}
+
+// parquetFilepath returns the key of the next parquet file to be stored for the
+// table in the given partition, following the file naming configured for it.
+// An error is returned if the last index used in the partition is unknown.
+func (aggregator *RulesResultsReportAggregator) parquetFilepath(
+	ctx context.Context,
+	writer s3writer.S3ParquetWriter,
+	table string,
+	partition utils.Partition,
+	sources reportaggregators.SourceRanges,
+) (string, error) {
+	layout := aggregator.layout(table)
+
+	if aggregator.fileNamings[table] == utils.UniqueFileNaming {
+		return layout.UniqueParquetFilepath(partition, writer.Prefix(), table, sources.ID()), nil
+	}
+
+	// generate filepath without index first
+	hourPrefix := layout.HourPrefix(partition, writer.Prefix(), table)
+	indexes, err := writer.GetLastIndexForParquet(ctx, layout, hourPrefix)
+	if err != nil {
+		log.Error().Err(err).Str("table", table).Msg("Unable to find the next index for the parquet file")
+		return "", err
+	}
+	fileID, ok := indexes[table]
 	if !ok {
+		fileID = 0
+	} else {
+		fileID++
+	}
+
+	return layout.ParquetFilepath(partition, writer.Prefix(), table, fileID), nil
+}
+
+// overwritesFiles returns true if the files of the given table may replace
+// the ones already stored, as they are named after the messages they contain
+func (aggregator *RulesResultsReportAggregator) overwritesFiles(table string) bool {
+	return aggregator.fileNamings[table] == utils.UniqueFileNaming
+}
+
+// objectOptions returns the options of the objects stored for the given
+// table, tagged with the table and the current run
+func objectOptions(table string) s3writer.ObjectOptions {
+	tags := map[string]string{s3writer.TableTag: table}
+	if runID := runreport.CurrentRunID(); runID != "" {
+		tags[s3writer.RunIDTag] = runID
+	}
+	return s3writer.ObjectOptions{Table: table, Tags: tags}
+}
+
+// fileOptions returns the options of the parquet file storing the rows of the
+// given table and hour
+func (aggregator *RulesResultsReportAggregator) fileOptions(table string, hour time.Time) s3writer.FileOptions {
+	options := s3writer.FileOptions{
+		ObjectOptions: objectOptions(table),
+		Overwrite:     aggregator.overwritesFiles(table),
+	}
+	options.Tags[s3writer.HourTag] = hour.UTC().Format(time.RFC3339)
+	return options
+}
+
+// partitionSources returns the offset ranges of the reports received for each
+// partition of the table in the given output
+func (aggregator *RulesResultsReportAggregator) partitionSources(
+	table string, output tableOutput,
+) map[utils.Partition]reportaggregators.SourceRanges {
+	layout := aggregator.layout(table)
+	sources := map[utils.Partition]reportaggregators.SourceRanges{}
+
+	aggregator.mutex.RLock()
+	defer aggregator.mutex.RUnlock()
+
+	for _, report := range aggregator.ReceivedReports {
+		collectedAt, err := reportaggregators.ExtractCollectedDate(report.Path)
+		if err != nil {
+			continue
+		}
+		partition := aggregator.partitionFor(layout, output, table, collectedAt, report.Metadata.OrgID)
+		if _, ok := sources[partition]; !ok {
+			sources[partition] = reportaggregators.SourceRanges{}
+		}
+		sources[partition].Add(report.source)
+	}
+	return sources
+}
+
+// Handle parses an incoming message from Kafka and store it in the aggregation.
+// It accepts either the Kafka message or just its value.
+func (aggregator *RulesResultsReportAggregator) Handle(data interface{}) error {
+	var message []byte
+	source := reportaggregators.MessageSource{Partition: -1, Offset: -1}
+
+	switch msg := data.(type) {
+	case *sarama.ConsumerMessage:
+		message = msg.Value
+		source = reportaggregators.MessageSource{
+			Topic:     msg.Topic,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+		}
+	case []byte:
+		message = msg
+	default:
 		return errors.New("the argument doesn't match the expected type")
 	}
 
@@ -75,43 +359,197 @@ func (aggregator *RulesResultsReportAggregator) Handle(data interface{}) error {
 	if err := json.Unmarshal(message, &parsed); err != nil {
 		log.Info().Err(err).Msgf("Unable to parse message: %v", message)
 		log.Error().Err(err).Msg("Unable to parse message")
+		metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonInvalidJSON)).Inc()
 		return err
 	}
 
+	claimCheck := parsed.ClaimCheck != nil
+	if claimCheck {
+		var err error
+		if message, err = aggregator.resolveClaimCheck(*parsed.ClaimCheck, source); err != nil {
+			return err
+		}
+		parsed = RulesResultsReport{}
+		if err := json.Unmarshal(message, &parsed); err != nil {
+			log.Error().Err(err).Interface("source", source).Msg("Unable to parse the report of the claim check")
+			return reportaggregators.Reject(metrics.ReasonInvalidClaimCheck, err)
+		}
+		if parsed.ClaimCheck != nil {
+			err := errors.New("the report of the claim check is another claim check")
+			log.Error().Err(err).Interface("source", source).Msg("Invalid claim check")
+			return reportaggregators.Reject(metrics.ReasonInvalidClaimCheck, err)
+		}
+	}
+
+	if err := aggregator.schema.Validate(message); err != nil {
+		log.Error().Err(err).Str("archive_path", parsed.Path).Interface("source", source).
+			Msg("The message doesn't match the JSON Schema of the topic")
+		return reportaggregators.Reject(metrics.ReasonInvalidSchema, err)
+	}
+	if missing := parsed.missingFields(); len(missing) > 0 {
+		err := fmt.Errorf("missing required fields: %s", strings.Join(missing, ", "))
+		log.Error().Err(err).Str("archive_path", parsed.Path).Interface("source", source).
+			Msg("The message can't generate any row")
+		return reportaggregators.Reject(metrics.ReasonMissingField, err)
+	}
+
 	aggregator.mutex.Lock()
 	defer aggregator.mutex.Unlock()
+	if claimCheck {
+		if _, ok := aggregator.claimCheckPaths[parsed.Path]; ok {
+			err := fmt.Errorf("the report %s was already consumed in the current run", parsed.Path)
+			log.Warn().Err(err).Interface("source", source).Msg("The claim check references a duplicated report, skipping")
+			return reportaggregators.Reject(metrics.ReasonDuplicate, err)
+		}
+		aggregator.claimCheckPaths[parsed.Path] = struct{}{}
+	}
+	if source.Offset == -1 {
+		// not read from Kafka, use the arrival order to identify it
+		source.Offset = int64(len(aggregator.ReceivedReports))
+	}
+	parsed.source = source
 	aggregator.ReceivedReports = append(aggregator.ReceivedReports, parsed)
 	return nil
 }
 
-// WriteResults writes the aggregated results into the  provided S3ParquetWriter
-func (aggregator *RulesResultsReportAggregator) WriteResults(writer s3writer.S3ParquetWriter) (int, error) {
-	metrics.State.Set(metrics.GenerateTables)
-	var writtenResults int
+// resolveClaimCheck returns the report referenced by the claim check. A
+// reportaggregators.FetchError is returned if it can't be fetched yet, so the
+// message isn't rejected.
+func (aggregator *RulesResultsReportAggregator) resolveClaimCheck(
+	claim reportaggregators.ClaimCheck, source reportaggregators.MessageSource,
+) ([]byte, error) {
+	if aggregator.claimChecks == nil {
+		err := errors.New("the claim checks are disabled")
+		log.Error().Err(err).Str("url", claim.URL).Interface("source", source).Msg("Invalid claim check")
+		return nil, reportaggregators.Reject(metrics.ReasonInvalidClaimCheck, err)
+	}
 
-	ruleHitsFiles, err := aggregator.createRuleHitTable(writer)
+	report, err := aggregator.claimChecks.Fetch(tracing.RunContext(), claim)
+	var fetchErr *reportaggregators.FetchError
+	if errors.As(err, &fetchErr) {
+		return nil, err
+	}
 	if err != nil {
-		log.Error().Err(err).Msg("error saving rule hit tables")
-		deleteErr := writer.DeleteFiles(ruleHitsFiles)
-		if deleteErr != nil {
-			log.Error().Err(deleteErr).Msg("error deleting incomplete rule report!")
+		log.Error().Err(err).Str("url", claim.URL).Interface("source", source).Msg("Invalid claim check")
+		return nil, reportaggregators.Reject(metrics.ReasonInvalidClaimCheck, err)
+	}
+	return report, nil
+}
+
+// Reset drops the received reports once they are written, so the aggregator
+// is used again after a flush. The paths of the claim checks are kept, as the
+// duplicates are checked in the whole run.
+func (aggregator *RulesResultsReportAggregator) Reset() {
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+	aggregator.ReceivedReports = []RulesResultsReport{}
+}
+
+// BufferedRows returns the number of rows waiting to be written in every table
+func (aggregator *RulesResultsReportAggregator) BufferedRows() map[string]int {
+	aggregator.mutex.RLock()
+	defer aggregator.mutex.RUnlock()
+
+	ruleHits := 0
+	archives := map[string]struct{}{}
+	for _, report := range aggregator.ReceivedReports {
+		// the reports without a collection date aren't written in any table
+		collectedAt, err := reportaggregators.ExtractCollectedDate(report.Path)
+		if err != nil {
+			continue
 		}
-		return 0, err
+		ruleHits += len(report.Report.Reports)
+		archives[archiveKey(report.Metadata.ClusterID, report.Path, collectedAt)] = struct{}{}
+	}
+	return map[string]int{
+		ruleHitsTableName: ruleHits,
+		archivesTableName: len(archives),
 	}
+}
 
-	writtenResults += len(ruleHitsFiles)
+// WriteResults writes the aggregated results into the  provided S3ParquetWriter.
+// The tables, and the files of every table, are written concurrently by the
+// configured number of workers. The tables using a transaction log are only
+// committed once all of them are written. If anything fails, all the files
+// written in the run are deleted, after reverting the tables already
+// committed, unless they are still referenced by a log, and the descriptors
+// of the tables are only stored if nothing failed. Every copy of the
+// tables, like the rows excluded by the filters, is written under its own
+// prefix.
+func (aggregator *RulesResultsReportAggregator) WriteResults(writer s3writer.S3ParquetWriter) (int, error) {
+	metrics.SetState(metrics.GenerateTables)
 
-	archivesFiles, err := aggregator.createArchivesTable(writer)
-	if err != nil {
-		log.Error().Err(err).Msg("error saving archives tables")
-		deleteErr := writer.DeleteFiles(archivesFiles)
-		if deleteErr != nil {
-			log.Error().Err(deleteErr).Msg("error deleting incomplete rule report!")
+	type tableTask struct {
+		name   string
+		create func(context.Context, s3writer.S3ParquetWriter, chan struct{}, *fileSet, tableOutput) ([]deltalog.DataFile, error)
+		output tableOutput
+	}
+	tables := []tableTask{}
+	for _, output := range aggregator.tableOutputs() {
+		tables = append(tables,
+			tableTask{ruleHitsTableName, aggregator.createRuleHitTable, output},
+			tableTask{archivesTableName, aggregator.createArchivesTable, output})
+	}
+
+	files := newFileSet()
+	fileSlots := newSlots(aggregator.writeWorkers)
+	dataFiles := make([][]deltalog.DataFile, len(tables))
+
+	pool := newWritePool(tracing.RunContext(), newSlots(aggregator.writeWorkers))
+	defer pool.Close()
+	for i, table := range tables {
+		started := pool.Go(func(ctx context.Context) error {
+			var err error
+			dataFiles[i], err = table.create(ctx, table.output.writer(writer), fileSlots, files, table.output)
+			return err
+		})
+		if !started {
+			break
 		}
+	}
+
+	if err := pool.Wait(); err != nil {
+		log.Error().Err(err).Msg("error saving the tables")
+		rollback(writer, files.Keys())
 		return 0, err
 	}
 
-	writtenResults += len(archivesFiles)
+	written := files.Len()
+	for i, table := range tables {
+		if err := aggregator.commitTable(tracing.RunContext(), table.output.writer(writer), table.name, dataFiles[i]); err != nil {
+			// the tables committed before are reverted, so none of the files
+			// of the run are visible through the logs before deleting them
+			for j, committed := range tables[:i] {
+				if err := aggregator.revertTable(
+					tracing.RunContext(), committed.output.writer(writer), committed.name, dataFiles[j],
+				); err != nil {
+					// the files are still referenced by the log, keep them
+					files.Remove(dataFileKeys(dataFiles[j]))
+				}
+			}
+			rollback(writer, files.Keys())
+			return 0, err
+		}
+	}
+
+	// the descriptors are only stored once the files of every table are
+	// published, so a failed run never changes the schema recorded for them.
+	// The run isn't failed if they can't be stored, as the files are already
+	// visible, and they are stored again by the next run writing the table.
+	for i, table := range tables {
+		if len(dataFiles[i]) > 0 {
+			_ = aggregator.writeTableDescriptor(tracing.RunContext(), table.output.writer(writer), table.name)
+		}
+	}
 
-	return writtenResults, nil
+	return written, nil
+}
+
+// dataFileKeys returns the keys of the given files
+func dataFileKeys(dataFiles []deltalog.DataFile) []string {
+	keys := make([]string, 0, len(dataFiles))
+	for _, dataFile := range dataFiles {
+		keys = append(keys, dataFile.Key)
+	}
+	return keys
 }
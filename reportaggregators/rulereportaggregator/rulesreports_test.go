@@ -15,15 +15,35 @@
 package rulereportaggregator_test
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/RedHatInsights/parquet-factory/conf"
 	"github.com/RedHatInsights/parquet-factory/metrics"
+	"github.com/RedHatInsights/parquet-factory/reportaggregators"
 	"github.com/RedHatInsights/parquet-factory/reportaggregators/rulereportaggregator"
+	"github.com/RedHatInsights/parquet-factory/retry"
+	"github.com/RedHatInsights/parquet-factory/runreport"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
 	"github.com/RedHatInsights/parquet-factory/s3writer/mock"
 	"github.com/RedHatInsights/parquet-factory/testdata"
+	"github.com/RedHatInsights/parquet-factory/testhelpers"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -40,10 +60,14 @@ func TestHandle(t *testing.T) {
 }
 
 func TestHandleBadData(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
 	sut := rulereportaggregator.NewRulesReportAggregator()
 	err := sut.Handle([]byte("Hello world"))
 	assert.Error(t, err)
 	assert.Equal(t, 0, len(sut.ReceivedReports))
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonInvalidJSON))))
 }
 
 // TestWriteResults checks that the files are generated as expected
@@ -80,11 +104,13 @@ func TestWriteResultsError(t *testing.T) {
 	anyMatcher := gomock.Any()
 
 	mockWriter.EXPECT().
-		NewFile(anyMatcher, anyMatcher, anyMatcher).
+		NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).
 		Return(nil, errors.New("test new file error"))
 	mockWriter.EXPECT().DeleteFiles(anyMatcher).Times(1)
 	mockWriter.EXPECT().Prefix().AnyTimes()
-	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher).AnyTimes()
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).AnyTimes()
+	mockWriter.EXPECT().CheckSchema(anyMatcher, anyMatcher, anyMatcher, anyMatcher).AnyTimes()
+	mockWriter.EXPECT().WriteObject(anyMatcher, anyMatcher, anyMatcher, anyMatcher).AnyTimes()
 
 	// Init metrics to avoid errors
 	err = metrics.InitMetrics("testEnv")
@@ -93,3 +119,1036 @@ func TestWriteResultsError(t *testing.T) {
 	_, err = sut.WriteResults(mockWriter)
 	assert.Error(t, err)
 }
+
+func TestHandleMissingFields(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	sut := rulereportaggregator.NewRulesReportAggregator()
+	err := sut.Handle([]byte(`{"path": "", "metadata": {"external_organization": "1"}, "report": {}}`))
+	assert.ErrorContains(t, err, "path, metadata.cluster_id")
+	var rejected *reportaggregators.RejectedMessageError
+	assert.ErrorAs(t, err, &rejected)
+	assert.Equal(t, 0, len(sut.ReceivedReports))
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonMissingField))))
+}
+
+func TestHandleSchemaValidation(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	config := conf.Config{}
+	config.RulesKafkaConsumer.SchemaFile = "../../testdata/rules_results.schema.json"
+	sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(config)
+	assert.NoError(t, err)
+
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+	err = sut.Handle([]byte(
+		`{"path": "a.tar.gz", "metadata": {"cluster_id": "c1"}, "report": {"reports": [{"rule": "r1"}]}}`))
+	assert.ErrorContains(t, err, "rule_id")
+	assert.Equal(t, 1, len(sut.ReceivedReports))
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonInvalidSchema))))
+}
+
+func TestNewFromConfig(t *testing.T) {
+	t.Run("default configuration", func(t *testing.T) {
+		sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{})
+		assert.NoError(t, err)
+		assert.NotNil(t, sut)
+	})
+
+	t.Run("invalid file naming", func(t *testing.T) {
+		sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+			Tables: map[string]conf.TableConfig{
+				"archives": {FileNaming: "random"},
+			},
+		})
+		assert.Error(t, err)
+		assert.Nil(t, sut)
+	})
+
+	t.Run("invalid table format", func(t *testing.T) {
+		sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+			Tables: map[string]conf.TableConfig{
+				"rule_hits": {Format: "iceberg"},
+			},
+		})
+		assert.Error(t, err)
+		assert.Nil(t, sut)
+	})
+
+	t.Run("missing schema file", func(t *testing.T) {
+		config := conf.Config{}
+		config.RulesKafkaConsumer.SchemaFile = "missing.json"
+		sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(config)
+		assert.Error(t, err)
+		assert.Nil(t, sut)
+	})
+
+	t.Run("invalid partitioning template", func(t *testing.T) {
+		sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+			Tables: map[string]conf.TableConfig{
+				"rule_hits": {Partitioning: "{prefix}/{table}/{unknown}"},
+			},
+		})
+		assert.Error(t, err)
+		assert.Nil(t, sut)
+	})
+}
+
+// TestWriteResultsPartitioning checks that the configured partitioning is used for the files
+func TestWriteResultsPartitioning(t *testing.T) {
+	sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		Tables: map[string]conf.TableConfig{
+			"rule_hits": {Partitioning: "{prefix}/{table}/org_id={org_id}/year={year}/month={month}/day={day}/hour={hour}"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockWriter := mock.NewMockS3ParquetWriter(mockCtrl)
+	mockFile := mock.NewMockS3ParquetFile(mockCtrl)
+	anyMatcher := gomock.Any()
+
+	mockWriter.EXPECT().Prefix().Return("prefix").AnyTimes()
+	mockWriter.EXPECT().CheckSchema(anyMatcher, "prefix/rule_hits/", anyMatcher, anyMatcher).Return(nil)
+	mockWriter.EXPECT().CheckSchema(anyMatcher, "prefix/archives/hourly/", anyMatcher, anyMatcher).Return(nil)
+	mockWriter.EXPECT().WriteObject(anyMatcher, "prefix/rule_hits/_schema.json", anyMatcher, anyMatcher).Return(nil)
+	mockWriter.EXPECT().WriteObject(anyMatcher, "prefix/archives/hourly/_schema.json", anyMatcher, anyMatcher).Return(nil)
+	mockWriter.EXPECT().
+		GetLastIndexForParquet(anyMatcher, anyMatcher, "prefix/rule_hits/org_id=1234567/year=2021/month=01/day=20/hour=03/").
+		Return(map[string]int{"rule_hits": 2}, nil)
+	mockWriter.EXPECT().
+		GetLastIndexForParquet(anyMatcher, anyMatcher, "prefix/archives/hourly/date=2021-01-20/hour=03/").
+		Return(map[string]int{}, nil)
+	mockWriter.EXPECT().
+		NewFile(anyMatcher, "prefix/rule_hits/org_id=1234567/year=2021/month=01/day=20/hour=03/rule_hits-3.parquet", anyMatcher, anyMatcher).
+		Return(mockFile, nil)
+	mockWriter.EXPECT().
+		NewFile(anyMatcher, "prefix/archives/hourly/date=2021-01-20/hour=03/archives-0.parquet", anyMatcher, anyMatcher).
+		Return(mockFile, nil)
+	mockFile.EXPECT().AddRow(anyMatcher).Return(nil).Times(2)
+	mockFile.EXPECT().CloseFile().Return(nil).Times(2)
+
+	err = metrics.InitMetrics("testEnv")
+	assert.NoError(t, err)
+
+	written, err := sut.WriteResults(mockWriter)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, written)
+}
+
+func TestHandleKafkaMessage(t *testing.T) {
+	sut := rulereportaggregator.NewRulesReportAggregator()
+	err := sut.Handle(&sarama.ConsumerMessage{
+		Topic:     "topic",
+		Partition: 1,
+		Offset:    10,
+		Value:     testdata.RuleHitReport,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(sut.ReceivedReports))
+
+	err = sut.Handle("not a message")
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(sut.ReceivedReports))
+}
+
+// TestWriteResultsUniqueFileNaming checks that no listing is needed with unique file
+// names and that the same messages produce the same file names
+func TestWriteResultsUniqueFileNaming(t *testing.T) {
+	config := conf.Config{
+		Tables: map[string]conf.TableConfig{
+			"rule_hits": {FileNaming: "unique"},
+			"archives":  {FileNaming: "unique"},
+		},
+	}
+	message := &sarama.ConsumerMessage{
+		Topic:     "topic",
+		Partition: 1,
+		Offset:    10,
+		Value:     testdata.RuleHitReport,
+	}
+
+	err := metrics.InitMetrics("testEnv")
+	assert.NoError(t, err)
+
+	writeResults := func() []string {
+		sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(config)
+		assert.NoError(t, err)
+		assert.NoError(t, sut.Handle(message))
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		mockWriter := mock.NewMockS3ParquetWriter(mockCtrl)
+		mockFile := mock.NewMockS3ParquetFile(mockCtrl)
+		anyMatcher := gomock.Any()
+
+		paths := []string{}
+		mockWriter.EXPECT().Prefix().Return("prefix").AnyTimes()
+		mockWriter.EXPECT().CheckSchema(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).Times(2)
+		mockWriter.EXPECT().WriteObject(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).Times(2)
+		mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Times(0)
+		mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).
+			DoAndReturn(func(_ context.Context, path string, _ interface{}, options s3writer.FileOptions) (s3writer.S3ParquetFile, error) {
+				// running again over the same messages replaces the files
+				assert.True(t, options.Overwrite)
+				assert.Equal(t, options.Table, options.Tags[s3writer.TableTag])
+				assert.Equal(t, "2021-01-20T03:00:00Z", options.Tags[s3writer.HourTag])
+				paths = append(paths, path)
+				return mockFile, nil
+			}).Times(2)
+		mockFile.EXPECT().AddRow(anyMatcher).Return(nil).Times(2)
+		mockFile.EXPECT().CloseFile().Return(nil).Times(2)
+
+		written, err := sut.WriteResults(mockWriter)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, written)
+		return paths
+	}
+
+	firstRun := writeResults()
+	assert.Regexp(t, `^prefix/rule_hits/hourly/date=2021-01-20/hour=03/rule_hits-offsets-[0-9a-f]{16}\.parquet$`, firstRun[0])
+	assert.Regexp(t, `^prefix/archives/hourly/date=2021-01-20/hour=03/archives-offsets-[0-9a-f]{16}\.parquet$`, firstRun[1])
+	assert.Equal(t, firstRun, writeResults())
+}
+
+func TestWriteResultsIncompatibleSchema(t *testing.T) {
+	sut := rulereportaggregator.NewRulesReportAggregator()
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockWriter := mock.NewMockS3ParquetWriter(mockCtrl)
+	anyMatcher := gomock.Any()
+
+	mockWriter.EXPECT().Prefix().Return("prefix").AnyTimes()
+	mockWriter.EXPECT().
+		CheckSchema(anyMatcher, "prefix/rule_hits/hourly/", &rulereportaggregator.RuleHitTable{}, anyMatcher).
+		Return(errors.New("column rule_id was dropped"))
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Times(0)
+	mockWriter.EXPECT().DeleteFiles(anyMatcher).Return(nil)
+
+	err := metrics.InitMetrics("testEnv")
+	assert.NoError(t, err)
+
+	_, err = sut.WriteResults(mockWriter)
+	assert.Error(t, err)
+}
+
+func TestSchemaVersion(t *testing.T) {
+	assert.Equal(t, 1, rulereportaggregator.RuleHitTable{}.SchemaVersion())
+	assert.Equal(t, 1, rulereportaggregator.ArchivesTable{}.SchemaVersion())
+}
+
+// TestWriteResultsDeltaFormat checks that the files of the tables using the
+// delta format are committed to their transaction logs
+func TestWriteResultsDeltaFormat(t *testing.T) {
+	sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		Tables: map[string]conf.TableConfig{
+			"rule_hits": {Format: "delta"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockWriter := mock.NewMockS3ParquetWriter(mockCtrl)
+	mockFile := mock.NewMockS3ParquetFile(mockCtrl)
+	anyMatcher := gomock.Any()
+
+	var commit []byte
+	mockWriter.EXPECT().Prefix().Return("prefix").AnyTimes()
+	mockWriter.EXPECT().CheckSchema(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).Times(2)
+	mockWriter.EXPECT().WriteObject(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).Times(2)
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Return(map[string]int{}, nil).Times(2)
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(mockFile, nil).Times(2)
+	mockFile.EXPECT().AddRow(anyMatcher).Return(nil).Times(2)
+	mockFile.EXPECT().CloseFile().Return(nil).Times(2)
+	mockFile.EXPECT().Size().Return(int64(100))
+	mockWriter.EXPECT().ListObjects(anyMatcher, "prefix/rule_hits/hourly/_delta_log/").
+		Return([]string{"prefix/rule_hits/hourly/_delta_log/00000000000000000000.json"}, nil)
+	mockWriter.EXPECT().
+		CreateObject(anyMatcher, "prefix/rule_hits/hourly/_delta_log/00000000000000000001.json", anyMatcher, anyMatcher).
+		DoAndReturn(func(_ context.Context, _ string, content []byte, options s3writer.ObjectOptions) error {
+			commit = content
+			assert.Equal(t, "rule_hits", options.Table)
+			assert.Equal(t, "rule_hits", options.Tags[s3writer.TableTag])
+			return nil
+		})
+
+	err = metrics.InitMetrics("testEnv")
+	assert.NoError(t, err)
+
+	written, err := sut.WriteResults(mockWriter)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, written)
+	assert.Contains(t, string(commit), `"path":"date=2021-01-20/hour=03/rule_hits-0.parquet"`)
+	assert.Contains(t, string(commit), `"partitionValues":{"date":"2021-01-20","hour":"03"}`)
+	assert.Contains(t, string(commit), `"stats":"{\"numRecords\":1}"`)
+}
+
+// TestWriteResultsDeltaCommitError checks that the files of every table are
+// deleted if one of them can't be committed
+func TestWriteResultsDeltaCommitError(t *testing.T) {
+	sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		Tables: map[string]conf.TableConfig{
+			"rule_hits": {Format: "delta"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockWriter := mock.NewMockS3ParquetWriter(mockCtrl)
+	mockFile := mock.NewMockS3ParquetFile(mockCtrl)
+	anyMatcher := gomock.Any()
+
+	mockWriter.EXPECT().Prefix().Return("prefix").AnyTimes()
+	mockWriter.EXPECT().CheckSchema(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).Times(2)
+	mockWriter.EXPECT().WriteObject(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Times(0)
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Return(map[string]int{}, nil).Times(2)
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(mockFile, nil).Times(2)
+	mockFile.EXPECT().AddRow(anyMatcher).Return(nil).Times(2)
+	mockFile.EXPECT().CloseFile().Return(nil).Times(2)
+	mockFile.EXPECT().Size().Return(int64(100))
+	mockWriter.EXPECT().ListObjects(anyMatcher, anyMatcher).Return(nil, errors.New("an error"))
+	mockWriter.EXPECT().
+		DeleteFiles([]string{
+			"prefix/rule_hits/hourly/date=2021-01-20/hour=03/rule_hits-0.parquet",
+			"prefix/archives/hourly/date=2021-01-20/hour=03/archives-0.parquet",
+		}).
+		Return(nil)
+
+	err = metrics.InitMetrics("testEnv")
+	assert.NoError(t, err)
+
+	_, err = sut.WriteResults(mockWriter)
+	assert.Error(t, err)
+}
+
+// TestWriteResultsDeltaRevert checks that the tables already committed are
+// reverted when a later one can't be committed, and that their files are only
+// deleted once they aren't referenced by the log
+func TestWriteResultsDeltaRevert(t *testing.T) {
+	const ruleHitsKey = "prefix/rule_hits/hourly/date=2021-01-20/hour=03/rule_hits-0.parquet"
+	const archivesKey = "prefix/archives/hourly/date=2021-01-20/hour=03/archives-0.parquet"
+
+	for _, tc := range []struct {
+		name      string
+		revertErr error
+		deleted   []string
+	}{
+		{"reverted", nil, []string{ruleHitsKey, archivesKey}},
+		{"revert error", errors.New("an error"), []string{archivesKey}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+				Tables: map[string]conf.TableConfig{
+					"rule_hits": {Format: "delta"},
+					"archives":  {Format: "delta"},
+				},
+			})
+			assert.NoError(t, err)
+			assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockWriter := mock.NewMockS3ParquetWriter(mockCtrl)
+			mockFile := mock.NewMockS3ParquetFile(mockCtrl)
+			anyMatcher := gomock.Any()
+
+			var revert []byte
+			mockWriter.EXPECT().Prefix().Return("prefix").AnyTimes()
+			mockWriter.EXPECT().CheckSchema(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).Times(2)
+			mockWriter.EXPECT().WriteObject(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Times(0)
+			mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Return(map[string]int{}, nil).Times(2)
+			mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(mockFile, nil).Times(2)
+			mockFile.EXPECT().AddRow(anyMatcher).Return(nil).Times(2)
+			mockFile.EXPECT().CloseFile().Return(nil).Times(2)
+			mockFile.EXPECT().Size().Return(int64(100)).Times(2)
+			gomock.InOrder(
+				mockWriter.EXPECT().ListObjects(anyMatcher, "prefix/rule_hits/hourly/_delta_log/").Return(nil, nil),
+				mockWriter.EXPECT().
+					CreateObject(anyMatcher, "prefix/rule_hits/hourly/_delta_log/00000000000000000000.json", anyMatcher, anyMatcher).
+					Return(nil),
+				mockWriter.EXPECT().ListObjects(anyMatcher, "prefix/archives/hourly/_delta_log/").
+					Return(nil, errors.New("an error")),
+				mockWriter.EXPECT().ListObjects(anyMatcher, "prefix/rule_hits/hourly/_delta_log/").
+					Return([]string{"prefix/rule_hits/hourly/_delta_log/00000000000000000000.json"}, nil),
+				mockWriter.EXPECT().
+					CreateObject(anyMatcher, "prefix/rule_hits/hourly/_delta_log/00000000000000000001.json", anyMatcher, anyMatcher).
+					DoAndReturn(func(_ context.Context, _ string, content []byte, _ s3writer.ObjectOptions) error {
+						revert = content
+						return tc.revertErr
+					}),
+				mockWriter.EXPECT().DeleteFiles(tc.deleted).Return(nil),
+			)
+
+			err = metrics.InitMetrics("testEnv")
+			assert.NoError(t, err)
+
+			_, err = sut.WriteResults(mockWriter)
+			assert.Error(t, err)
+			assert.Contains(t, string(revert), `"remove":{"path":"date=2021-01-20/hour=03/rule_hits-0.parquet"`)
+		})
+	}
+}
+
+// TestWriteResultsDescriptorError checks that the run doesn't fail if the
+// descriptors can't be stored once the files are published
+func TestWriteResultsDescriptorError(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	sut := rulereportaggregator.NewRulesReportAggregator()
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockWriter := mock.NewMockS3ParquetWriter(mockCtrl)
+	mockFile := mock.NewMockS3ParquetFile(mockCtrl)
+	anyMatcher := gomock.Any()
+
+	mockWriter.EXPECT().Prefix().Return("prefix").AnyTimes()
+	mockWriter.EXPECT().CheckSchema(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).Times(2)
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Return(map[string]int{}, nil).Times(2)
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(mockFile, nil).Times(2)
+	mockFile.EXPECT().AddRow(anyMatcher).Return(nil).Times(2)
+	mockFile.EXPECT().CloseFile().Return(nil).Times(2)
+	mockWriter.EXPECT().WriteObject(anyMatcher, "prefix/rule_hits/hourly/_schema.json", anyMatcher, anyMatcher).
+		Return(errors.New("an error"))
+	mockWriter.EXPECT().WriteObject(anyMatcher, "prefix/archives/hourly/_schema.json", anyMatcher, anyMatcher).
+		Return(nil)
+	mockWriter.EXPECT().DeleteFiles(anyMatcher).Times(0)
+
+	written, err := sut.WriteResults(mockWriter)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, written)
+}
+
+func TestBufferedRows(t *testing.T) {
+	sut := rulereportaggregator.NewRulesReportAggregator()
+	assert.Equal(t, map[string]int{"rule_hits": 0, "archives": 0}, sut.BufferedRows())
+
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+	assert.Equal(t, map[string]int{"rule_hits": 2, "archives": 1}, sut.BufferedRows())
+
+	// the reports without a collection date aren't written
+	assert.NoError(t, sut.Handle([]byte(
+		`{"path": "archives/without/date.tar.gz", "metadata": {"cluster_id": "c1"}, "report": {"reports": [{"rule_id": "r1"}]}}`)))
+	assert.Equal(t, map[string]int{"rule_hits": 2, "archives": 1}, sut.BufferedRows())
+
+	// the reports written before a flush are dropped
+	sut.Reset()
+	assert.Equal(t, map[string]int{"rule_hits": 0, "archives": 0}, sut.BufferedRows())
+}
+
+// TestWriteResultsInvalidDate checks that the reports without a collection
+// date are skipped in every table
+func TestWriteResultsInvalidDate(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	sut := rulereportaggregator.NewRulesReportAggregator()
+	assert.NoError(t, sut.Handle([]byte(
+		`{"path": "archives/without/date.tar.gz", "metadata": {"cluster_id": "c1"}, "report": {"reports": [{"rule_id": "r1"}]}}`)))
+
+	mockWriter, controller := mock.PrepareMocks(t, []uint{})
+	defer controller.Finish()
+
+	filesWritten, err := sut.WriteResults(mockWriter)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, filesWritten)
+	for _, table := range []string{"rule_hits", "archives"} {
+		assert.Equal(t, float64(1), testutil.ToFloat64(
+			metrics.RowsSkipped.With(metrics.WithTableReasonLabels(table, metrics.ReasonInvalidDate))), table)
+	}
+}
+
+// hourlyReport returns a report collected in the given hour of 2021-01-20
+func hourlyReport(hour int) []byte {
+	return []byte(fmt.Sprintf(`{
+		"path": "archives/compressed/aa/aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee/202101/20/%02d1044.tar.gz",
+		"metadata": {"cluster_id": "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"},
+		"report": {"reports": [{"rule_id": "rule"}]}
+	}`, hour))
+}
+
+// TestWriteResultsConcurrently checks that the files of every table and hour
+// are written by the configured number of workers
+func TestWriteResultsConcurrently(t *testing.T) {
+	const hours = 8
+
+	sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		S3: conf.S3Config{WriteWorkers: 4},
+	})
+	assert.NoError(t, err)
+	for hour := 0; hour < hours; hour++ {
+		assert.NoError(t, sut.Handle(hourlyReport(hour)))
+	}
+
+	mockWriter, controller := mock.PrepareMocks(t, []uint{})
+	defer controller.Finish()
+	mockFile := mock.NewMockS3ParquetFile(controller)
+	anyMatcher := gomock.Any()
+
+	var mutex sync.Mutex
+	paths := []string{}
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).
+		Return(map[string]int{}, nil).Times(2 * hours)
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).
+		DoAndReturn(func(_ context.Context, path string, _ interface{}, _ s3writer.FileOptions) (s3writer.S3ParquetFile, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			paths = append(paths, path)
+			return mockFile, nil
+		}).Times(2 * hours)
+	mockFile.EXPECT().AddRow(anyMatcher).Return(nil).Times(2 * hours)
+	mockFile.EXPECT().CloseFile().Return(nil).Times(2 * hours)
+
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	written, err := sut.WriteResults(mockWriter)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*hours, written)
+	assert.Contains(t, paths, "/rule_hits/hourly/date=2021-01-20/hour=07/rule_hits-0.parquet")
+	assert.Contains(t, paths, "/archives/hourly/date=2021-01-20/hour=00/archives-0.parquet")
+}
+
+// TestWriteResultsConcurrentlyError checks that the files written for every
+// table are deleted if any of them fails
+func TestWriteResultsConcurrentlyError(t *testing.T) {
+	const hours = 4
+
+	sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		S3: conf.S3Config{WriteWorkers: 2},
+	})
+	assert.NoError(t, err)
+	for hour := 0; hour < hours; hour++ {
+		assert.NoError(t, sut.Handle(hourlyReport(hour)))
+	}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockWriter := mock.NewMockS3ParquetWriter(mockCtrl)
+	mockFile := mock.NewMockS3ParquetFile(mockCtrl)
+	anyMatcher := gomock.Any()
+
+	var mutex sync.Mutex
+	written := []string{}
+	failingPath := "/archives/hourly/date=2021-01-20/hour=02/archives-0.parquet"
+	mockWriter.EXPECT().Prefix().AnyTimes()
+	mockWriter.EXPECT().CheckSchema(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).AnyTimes()
+	mockWriter.EXPECT().WriteObject(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).AnyTimes()
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Return(map[string]int{}, nil).AnyTimes()
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).
+		DoAndReturn(func(_ context.Context, path string, _ interface{}, _ s3writer.FileOptions) (s3writer.S3ParquetFile, error) {
+			if path == failingPath {
+				return nil, errors.New("test new file error")
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			written = append(written, path)
+			return mockFile, nil
+		}).AnyTimes()
+	mockFile.EXPECT().AddRow(anyMatcher).Return(nil).AnyTimes()
+	mockFile.EXPECT().CloseFile().Return(nil).AnyTimes()
+	mockWriter.EXPECT().DeleteFiles(anyMatcher).
+		DoAndReturn(func(files []string) error {
+			assert.ElementsMatch(t, written, files)
+			return nil
+		})
+
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	_, err = sut.WriteResults(mockWriter)
+	assert.Error(t, err)
+}
+
+func TestNewFromConfigInvalidWriteWorkers(t *testing.T) {
+	sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		S3: conf.S3Config{WriteWorkers: -1},
+	})
+	assert.Error(t, err)
+	assert.Nil(t, sut)
+}
+
+// TestWriteResultsUndeletedFiles checks that the files of a failed run that
+// couldn't be deleted are reported
+func TestWriteResultsUndeletedFiles(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	recorder := runreport.Start("run", runreport.BuildInfo{}, "hash")
+
+	sut := rulereportaggregator.NewRulesReportAggregator()
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockWriter := mock.NewMockS3ParquetWriter(mockCtrl)
+	mockFile := mock.NewMockS3ParquetFile(mockCtrl)
+	anyMatcher := gomock.Any()
+
+	ruleHitsFile := "/rule_hits/hourly/date=2021-01-20/hour=03/rule_hits-0.parquet"
+	archivesFile := "/archives/hourly/date=2021-01-20/hour=03/archives-0.parquet"
+	mockWriter.EXPECT().Prefix().AnyTimes()
+	mockWriter.EXPECT().CheckSchema(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).Times(2)
+	mockWriter.EXPECT().WriteObject(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Times(0)
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Return(map[string]int{}, nil).Times(2)
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(mockFile, nil).Times(2)
+	mockFile.EXPECT().AddRow(anyMatcher).Return(nil).Times(2)
+	// the archives file fails after being created, so part of it may be stored
+	mockFile.EXPECT().CloseFile().Return(nil)
+	mockFile.EXPECT().CloseFile().Return(errors.New("test close error"))
+	mockWriter.EXPECT().DeleteFiles([]string{ruleHitsFile, archivesFile}).
+		Return(&s3writer.DeleteError{Keys: []string{archivesFile}})
+
+	_, err := sut.WriteResults(mockWriter)
+	assert.Error(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.UndeletedFiles))
+	report := recorder.Finish(1, time.Now(), runreport.MessageCounts{}, nil)
+	assert.Equal(t, []string{archivesFile}, report.UndeletedFiles)
+	// the rolled back files aren't listed as written
+	assert.Empty(t, report.Files)
+}
+
+// TestWriteResultsUploadRetries checks that a file is uploaded again if it
+// fails because of a transient error
+func TestWriteResultsUploadRetries(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		S3:    conf.S3Config{MaxRetries: 1},
+		Retry: conf.RetryConfig{InitialBackoff: 1},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+
+	mockWriter, controller := mock.PrepareMocks(t, []uint{})
+	defer controller.Finish()
+	mockFile := mock.NewMockS3ParquetFile(controller)
+	anyMatcher := gomock.Any()
+
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Return(map[string]int{}, nil).Times(2)
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(mockFile, nil).Times(3)
+	mockFile.EXPECT().AddRow(anyMatcher).Return(nil).Times(3)
+	gomock.InOrder(
+		mockFile.EXPECT().CloseFile().Return(&net.OpError{Op: "write", Err: errors.New("connection reset")}),
+		mockFile.EXPECT().CloseFile().Return(nil).Times(2),
+	)
+
+	written, err := sut.WriteResults(mockWriter)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, written)
+}
+
+// TestWriteResultsRetryNoOverwrite checks that a file that failed before
+// being created is still protected against overwriting when it is retried
+func TestWriteResultsRetryNoOverwrite(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		S3:    conf.S3Config{MaxRetries: 1},
+		Retry: conf.RetryConfig{InitialBackoff: 1},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+
+	mockWriter, controller := mock.PrepareMocks(t, []uint{})
+	defer controller.Finish()
+	mockFile := mock.NewMockS3ParquetFile(controller)
+	anyMatcher := gomock.Any()
+
+	var mutex sync.Mutex
+	attempts := map[string]int{}
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Return(map[string]int{}, nil).Times(2)
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).
+		DoAndReturn(func(_ context.Context, key string, _ interface{}, options s3writer.FileOptions) (s3writer.S3ParquetFile, error) {
+			assert.False(t, options.Overwrite, key)
+			mutex.Lock()
+			defer mutex.Unlock()
+			attempts[key]++
+			if attempts[key] == 1 {
+				// the existence check fails before anything is written
+				return nil, &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+			}
+			return mockFile, nil
+		}).Times(4)
+	mockFile.EXPECT().AddRow(anyMatcher).Return(nil).Times(2)
+	mockFile.EXPECT().CloseFile().Return(nil).Times(2)
+
+	written, err := sut.WriteResults(mockWriter)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, written)
+}
+
+// TestWriteResultsListingError checks that the run is aborted if the last
+// index used in a folder can't be known, instead of overwriting its files
+func TestWriteResultsListingError(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	sut := rulereportaggregator.NewRulesReportAggregator()
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockWriter := mock.NewMockS3ParquetWriter(mockCtrl)
+	anyMatcher := gomock.Any()
+
+	mockWriter.EXPECT().Prefix().AnyTimes()
+	mockWriter.EXPECT().CheckSchema(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil)
+	mockWriter.EXPECT().WriteObject(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Times(0)
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).
+		Return(nil, errors.New("test listing error"))
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Times(0)
+	mockWriter.EXPECT().DeleteFiles([]string{}).Return(nil)
+
+	_, err := sut.WriteResults(mockWriter)
+	assert.Error(t, err)
+}
+
+// TestWriteResultsNoOverwrite checks that the files named after an index
+// never replace the existing ones
+func TestWriteResultsNoOverwrite(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	sut := rulereportaggregator.NewRulesReportAggregator()
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+
+	mockWriter, controller := mock.PrepareMocks(t, []uint{})
+	defer controller.Finish()
+	anyMatcher := gomock.Any()
+
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Return(map[string]int{}, nil)
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).
+		DoAndReturn(func(_ context.Context, _ string, _ interface{}, options s3writer.FileOptions) (s3writer.S3ParquetFile, error) {
+			assert.False(t, options.Overwrite)
+			return nil, s3writer.ErrObjectExists
+		})
+	mockWriter.EXPECT().DeleteFiles([]string{}).Return(nil)
+
+	_, err := sut.WriteResults(mockWriter)
+	assert.ErrorIs(t, err, s3writer.ErrObjectExists)
+}
+
+// TestWriteResultsVerificationError checks that a file that doesn't match
+// its content once uploaded fails the run and is counted
+func TestWriteResultsVerificationError(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	sut := rulereportaggregator.NewRulesReportAggregator()
+	assert.NoError(t, sut.Handle(testdata.RuleHitReport))
+
+	mockWriter, controller := mock.PrepareMocks(t, []uint{})
+	defer controller.Finish()
+	mockFile := mock.NewMockS3ParquetFile(controller)
+	anyMatcher := gomock.Any()
+	verifyErr := &s3writer.VerificationError{Key: "my_file", Reason: "checksum mismatch"}
+
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Return(map[string]int{}, nil).AnyTimes()
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(mockFile, nil).AnyTimes()
+	mockFile.EXPECT().AddRow(anyMatcher).Return(nil).AnyTimes()
+	mockFile.EXPECT().CloseFile().Return(verifyErr).MinTimes(1)
+	mockWriter.EXPECT().DeleteFiles(anyMatcher).Return(nil)
+
+	_, err := sut.WriteResults(mockWriter)
+	assert.ErrorIs(t, err, verifyErr)
+	failed := testutil.ToFloat64(metrics.FailedVerifications.With(metrics.WithTableLabel("rule_hits"))) +
+		testutil.ToFloat64(metrics.FailedVerifications.With(metrics.WithTableLabel("archives")))
+	assert.LessOrEqual(t, float64(1), failed)
+}
+
+func claimCheckMessage(t *testing.T, bucket, key string, report []byte) []byte {
+	sum := sha256.Sum256(report)
+	message, err := json.Marshal(map[string]interface{}{
+		"claim_check": reportaggregators.ClaimCheck{
+			URL:    fmt.Sprintf("s3://%s/%s", bucket, key),
+			SHA256: hex.EncodeToString(sum[:]),
+		},
+	})
+	assert.NoError(t, err)
+	return message
+}
+
+func TestHandleClaimCheck(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	config := conf.Config{}
+	config.RulesKafkaConsumer.SchemaFile = "../../testdata/rules_results.schema.json"
+	sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(config)
+	assert.NoError(t, err)
+
+	store := testhelpers.NewObjectStore("reports", map[string][]byte{
+		"report.json": testdata.RuleHitReport,
+		"nested.json": claimCheckMessage(t, "reports", "report.json", testdata.RuleHitReport),
+	})
+	fetcher, err := reportaggregators.NewClaimCheckFetcher(
+		conf.ClaimCheckConfig{CacheDir: t.TempDir()}, "reports", store, retry.Policy{})
+	assert.NoError(t, err)
+	sut.UseClaimChecks(fetcher)
+
+	// the fetched report is validated like the ones sent in the messages
+	assert.NoError(t, sut.Handle(claimCheckMessage(t, "reports", "report.json", testdata.RuleHitReport)))
+	assert.Equal(t, 1, len(sut.ReceivedReports))
+	assert.Equal(t, 1, len(sut.ReceivedReports[0].Report.Reports))
+	assert.Nil(t, sut.ReceivedReports[0].ClaimCheck)
+
+	// the same report referenced again is a duplicate
+	var rejected *reportaggregators.RejectedMessageError
+	err = sut.Handle(claimCheckMessage(t, "reports", "report.json", testdata.RuleHitReport))
+	assert.ErrorAs(t, err, &rejected)
+	assert.Equal(t, metrics.ReasonDuplicate, rejected.Reason)
+	assert.Equal(t, 1, len(sut.ReceivedReports))
+
+	err = sut.Handle(claimCheckMessage(t, "reports", "report.json", []byte("{}")))
+	assert.ErrorAs(t, err, &rejected)
+	err = sut.Handle(claimCheckMessage(t, "reports", "nested.json",
+		claimCheckMessage(t, "reports", "report.json", testdata.RuleHitReport)))
+	assert.ErrorContains(t, err, "another claim check")
+	assert.Equal(t, 1, len(sut.ReceivedReports))
+	assert.Equal(t, float64(2), testutil.ToFloat64(
+		metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonInvalidClaimCheck))))
+
+	// the message isn't rejected if the report can't be fetched yet
+	store.Err = &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	err = sut.Handle(claimCheckMessage(t, "reports", "other.json", []byte(`{"path": "other"}`)))
+	var fetchErr *reportaggregators.FetchError
+	assert.ErrorAs(t, err, &fetchErr)
+	assert.True(t, retry.IsRetryable(err))
+	assert.Equal(t, float64(2), testutil.ToFloat64(
+		metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonInvalidClaimCheck))))
+}
+
+func TestHandleClaimCheckDisabled(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	sut := rulereportaggregator.NewRulesReportAggregator()
+	err := sut.Handle(claimCheckMessage(t, "reports", "report.json", testdata.RuleHitReport))
+	assert.ErrorContains(t, err, "claim checks are disabled")
+	assert.False(t, retry.IsRetryable(err))
+	assert.Equal(t, 0, len(sut.ReceivedReports))
+}
+
+// recordingFile stores the rows added to it
+type recordingFile struct {
+	rows []interface{}
+}
+
+func (file *recordingFile) AddRow(row interface{}) error {
+	file.rows = append(file.rows, row)
+	return nil
+}
+
+func (file *recordingFile) CloseFile() error { return nil }
+
+func (file *recordingFile) Size() int64 { return 0 }
+
+// recordingWriter returns a writer storing the rows of the files by their key
+func recordingWriter(t *testing.T, files map[string]*recordingFile) s3writer.S3ParquetWriter {
+	mockCtrl := gomock.NewController(t)
+	mockWriter := mock.NewMockS3ParquetWriter(mockCtrl)
+	anyMatcher := gomock.Any()
+
+	var mutex sync.Mutex
+	mockWriter.EXPECT().Prefix().Return("prefix").AnyTimes()
+	mockWriter.EXPECT().CheckSchema(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).AnyTimes()
+	mockWriter.EXPECT().WriteObject(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).AnyTimes()
+	mockWriter.EXPECT().GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Return(map[string]int{}, nil).AnyTimes()
+	mockWriter.EXPECT().NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).DoAndReturn(
+		func(_ context.Context, key string, _ interface{}, _ s3writer.FileOptions) (s3writer.S3ParquetFile, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			files[key] = &recordingFile{}
+			return files[key], nil
+		}).AnyTimes()
+	return mockWriter
+}
+
+// filteredReport returns a report of the given cluster and organization
+// hitting the given rules
+func filteredReport(clusterID, orgID string, rules ...string) []byte {
+	hits := []string{}
+	for _, rule := range rules {
+		hits = append(hits, fmt.Sprintf(`{"rule_id": %q}`, rule))
+	}
+	return []byte(fmt.Sprintf(`{
+		"path": "archives/compressed/aa/%s/202101/20/031044.tar.gz",
+		"metadata": {"cluster_id": %q, "external_organization": %q},
+		"report": {"reports": [%s]}
+	}`, clusterID, clusterID, orgID, strings.Join(hits, ",")))
+}
+
+// tableRows returns the rows written into the files of the table under the prefix
+func tableRows(files map[string]*recordingFile, prefix, table string) []interface{} {
+	rows := []interface{}{}
+	for key, file := range files {
+		if strings.HasPrefix(key, prefix+"/"+table+"/") {
+			rows = append(rows, file.rows...)
+		}
+	}
+	return rows
+}
+
+func TestWriteResultsFilters(t *testing.T) {
+	for _, filteredPrefix := range []string{"", "filtered"} {
+		t.Run("filtered prefix "+filteredPrefix, func(t *testing.T) {
+			assert.NoError(t, metrics.InitMetrics("testEnv"))
+			sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+				Filters: conf.FiltersConfig{
+					ExcludeClusters: []string{"BBBBBBBB-0000-0000-0000-000000000000"},
+					ExcludeOrgs:     []string{"ci"},
+					ExcludeRules:    []string{"test_*|*"},
+					FilteredPrefix:  filteredPrefix,
+				},
+			})
+			assert.NoError(t, err)
+
+			assert.NoError(t, sut.Handle(filteredReport("aaaaaaaa-0000-0000-0000-000000000000", "1", "rule|A", "test_rule|B")))
+			assert.NoError(t, sut.Handle(filteredReport("bbbbbbbb-0000-0000-0000-000000000000", "1", "rule|A")))
+			assert.NoError(t, sut.Handle(filteredReport("cccccccc-0000-0000-0000-000000000000", "ci", "rule|A")))
+
+			files := map[string]*recordingFile{}
+			_, err = sut.WriteResults(recordingWriter(t, files))
+			assert.NoError(t, err)
+
+			ruleHits := tableRows(files, "prefix", "rule_hits")
+			assert.Equal(t, []interface{}{rulereportaggregator.RuleHitTable{
+				ClusterID:   "aaaaaaaa-0000-0000-0000-000000000000",
+				RuleID:      "rule|A",
+				CollectedAt: time.Date(2021, time.January, 20, 3, 10, 44, 0, time.UTC).UnixMilli(),
+				ArchivePath: "archives/compressed/aa/aaaaaaaa-0000-0000-0000-000000000000/202101/20/031044.tar.gz",
+			}}, ruleHits)
+			assert.Len(t, tableRows(files, "prefix", "archives"), 1)
+
+			if filteredPrefix == "" {
+				assert.Len(t, files, 2)
+			} else {
+				assert.Len(t, tableRows(files, filteredPrefix, "rule_hits"), 3)
+				assert.Len(t, tableRows(files, filteredPrefix, "archives"), 2)
+			}
+
+			assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RowsFiltered.With(
+				metrics.WithTableFilterLabels("rule_hits", metrics.FilterExcludeRules))))
+			assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RowsFiltered.With(
+				metrics.WithTableFilterLabels("rule_hits", metrics.FilterExcludeClusters))))
+			assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RowsFiltered.With(
+				metrics.WithTableFilterLabels("archives", metrics.FilterExcludeClusters))))
+			assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RowsFiltered.With(
+				metrics.WithTableFilterLabels("archives", metrics.FilterExcludeOrgs))))
+		})
+	}
+}
+
+func TestNewFromConfigInvalidFilters(t *testing.T) {
+	_, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		Filters: conf.FiltersConfig{IncludeRules: []string{"["}},
+	})
+	assert.Error(t, err)
+
+	config := conf.Config{Filters: conf.FiltersConfig{FilteredPrefix: "prefix"}}
+	config.S3.FilePathPrefix = "prefix"
+	_, err = rulereportaggregator.NewRulesReportAggregatorFromConfig(config)
+	assert.ErrorContains(t, err, "filtered rows")
+}
+
+// pseudonym returns the HMAC of the value with the given key
+func pseudonym(key, value string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWriteResultsPseudonymisation(t *testing.T) {
+	const key = "0123456789abcdef"
+	keyFile := filepath.Join(t.TempDir(), "key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte(key+"\n"), 0o600))
+	clusterID := "aaaaaaaa-0000-0000-0000-000000000000"
+	archivePath := "archives/compressed/aa/aaaaaaaa-0000-0000-0000-000000000000/202101/20/031044.tar.gz"
+	collectedAt := time.Date(2021, time.January, 20, 3, 10, 44, 0, time.UTC).UnixMilli()
+
+	for _, maskedPrefix := range []string{"", "masked"} {
+		t.Run("masked prefix "+maskedPrefix, func(t *testing.T) {
+			assert.NoError(t, metrics.InitMetrics("testEnv"))
+			sut, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+				Tables: map[string]conf.TableConfig{
+					"rule_hits": {
+						Partitioning: "{prefix}/{table}/org_id={org_id}/date={date}",
+						Pseudonymise: []string{"cluster_id", "archive_path", "org_id"},
+					},
+					"archives": {Pseudonymise: []string{"cluster_id", "archive_path"}},
+				},
+				Pseudonymisation: conf.PseudonymisationConfig{KeyFile: keyFile, MaskedPrefix: maskedPrefix},
+			})
+			assert.NoError(t, err)
+			assert.NoError(t, sut.Handle(filteredReport(clusterID, "1", "rule|A")))
+
+			files := map[string]*recordingFile{}
+			_, err = sut.WriteResults(recordingWriter(t, files))
+			assert.NoError(t, err)
+
+			maskedRoot := "prefix"
+			if maskedPrefix != "" {
+				maskedRoot = maskedPrefix
+				assert.Equal(t, []interface{}{rulereportaggregator.RuleHitTable{
+					ClusterID: clusterID, RuleID: "rule|A", CollectedAt: collectedAt, ArchivePath: archivePath,
+				}}, tableRows(files, "prefix", "rule_hits"))
+				assert.Equal(t, []interface{}{rulereportaggregator.ArchivesTable{
+					ClusterID: clusterID, CollectedAt: collectedAt, ArchivePath: archivePath,
+				}}, tableRows(files, "prefix", "archives"))
+				assert.Contains(t, files, "prefix/rule_hits/org_id=1/date=2021-01-20/rule_hits-0.parquet")
+			}
+
+			// the tables can still be joined by the pseudonymised cluster
+			assert.Equal(t, []interface{}{rulereportaggregator.RuleHitTable{
+				ClusterID:   pseudonym(key, clusterID),
+				RuleID:      "rule|A",
+				CollectedAt: collectedAt,
+				ArchivePath: pseudonym(key, archivePath),
+			}}, tableRows(files, maskedRoot, "rule_hits"))
+			assert.Equal(t, []interface{}{rulereportaggregator.ArchivesTable{
+				ClusterID: pseudonym(key, clusterID), CollectedAt: collectedAt, ArchivePath: pseudonym(key, archivePath),
+			}}, tableRows(files, maskedRoot, "archives"))
+			assert.Contains(t, files, fmt.Sprintf("%s/rule_hits/org_id=%s/date=2021-01-20/rule_hits-0.parquet",
+				maskedRoot, pseudonym(key, "1")))
+		})
+	}
+}
+
+func TestNewFromConfigInvalidPseudonymisation(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte("0123456789abcdef"), 0o600))
+
+	_, err := rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		Tables:           map[string]conf.TableConfig{"archives": {Pseudonymise: []string{"rule_id"}}},
+		Pseudonymisation: conf.PseudonymisationConfig{KeyFile: keyFile},
+	})
+	assert.ErrorContains(t, err, "can't be pseudonymised")
+
+	_, err = rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		Tables: map[string]conf.TableConfig{"archives": {Pseudonymise: []string{"cluster_id", "archive_path"}}},
+	})
+	assert.ErrorContains(t, err, "key file")
+
+	// the archive path would leak the cluster ID
+	_, err = rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		Tables:           map[string]conf.TableConfig{"rule_hits": {Pseudonymise: []string{"cluster_id", "rule_id"}}},
+		Pseudonymisation: conf.PseudonymisationConfig{KeyFile: keyFile},
+	})
+	assert.ErrorContains(t, err, "includes the cluster ID")
+
+	_, err = rulereportaggregator.NewRulesReportAggregatorFromConfig(conf.Config{
+		Pseudonymisation: conf.PseudonymisationConfig{KeyFile: keyFile, MaskedPrefix: "masked"},
+	})
+	assert.ErrorContains(t, err, "no column")
+
+	config := conf.Config{
+		Tables:           map[string]conf.TableConfig{"archives": {Pseudonymise: []string{"cluster_id", "archive_path"}}},
+		Filters:          conf.FiltersConfig{FilteredPrefix: "filtered"},
+		Pseudonymisation: conf.PseudonymisationConfig{KeyFile: keyFile, MaskedPrefix: "filtered"},
+	}
+	_, err = rulereportaggregator.NewRulesReportAggregatorFromConfig(config)
+	assert.ErrorContains(t, err, "masked tables")
+}
@@ -0,0 +1,93 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rulereportaggregator
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/deltalog"
+	"github.com/RedHatInsights/parquet-factory/reportaggregators"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+	"github.com/RedHatInsights/parquet-factory/utils"
+)
+
+// usesDeltaLog returns true if the files of the given table must be committed
+// to its transaction log
+func (aggregator *RulesResultsReportAggregator) usesDeltaLog(table string) bool {
+	return aggregator.formats[table] == utils.DeltaTableFormat
+}
+
+// commitTable adds the files written for the given table in this run to its
+// transaction log as a single version, if the table uses one
+func (aggregator *RulesResultsReportAggregator) commitTable(
+	ctx context.Context, writer s3writer.S3ParquetWriter, table string, files []deltalog.DataFile,
+) error {
+	if !aggregator.usesDeltaLog(table) {
+		return nil
+	}
+
+	descriptor, err := aggregator.tableDescriptor(writer.Prefix(), table)
+	if err != nil {
+		log.Error().Err(err).Msgf(reportaggregators.UnableCommitTableStr, table)
+		return err
+	}
+
+	deltaLog := deltalog.New(writer, descriptor)
+	deltaLog.Tags = objectOptions(table).Tags
+	if _, err := deltaLog.Commit(ctx, aggregator.runID(), files); err != nil {
+		log.Error().Err(err).Msgf(reportaggregators.UnableCommitTableStr, table)
+		return err
+	}
+	return nil
+}
+
+// revertTable removes the files committed by commitTable from the transaction
+// log of the given table with a new version, so they can be deleted when a
+// later table can't be committed
+func (aggregator *RulesResultsReportAggregator) revertTable(
+	ctx context.Context, writer s3writer.S3ParquetWriter, table string, files []deltalog.DataFile,
+) error {
+	if !aggregator.usesDeltaLog(table) {
+		return nil
+	}
+
+	descriptor, err := aggregator.tableDescriptor(writer.Prefix(), table)
+	if err != nil {
+		log.Error().Err(err).Msgf(reportaggregators.UnableRevertTableStr, table)
+		return err
+	}
+
+	deltaLog := deltalog.New(writer, descriptor)
+	deltaLog.Tags = objectOptions(table).Tags
+	if _, err := deltaLog.Revert(ctx, aggregator.runID(), files); err != nil {
+		log.Error().Err(err).Msgf(reportaggregators.UnableRevertTableStr, table)
+		return err
+	}
+	return nil
+}
+
+// runID identifies the messages aggregated in this run
+func (aggregator *RulesResultsReportAggregator) runID() string {
+	aggregator.mutex.RLock()
+	defer aggregator.mutex.RUnlock()
+
+	sources := reportaggregators.SourceRanges{}
+	for _, report := range aggregator.ReceivedReports {
+		sources.Add(report.source)
+	}
+	return sources.ID()
+}
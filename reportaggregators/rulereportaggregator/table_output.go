@@ -0,0 +1,121 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rulereportaggregator
+
+import (
+	"time"
+
+	"github.com/RedHatInsights/parquet-factory/metrics"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+	"github.com/RedHatInsights/parquet-factory/utils"
+)
+
+// Columns that can be pseudonymised
+const (
+	clusterIDColumn   = "cluster_id"
+	ruleIDColumn      = "rule_id"
+	archivePathColumn = "archive_path"
+	// orgIDColumn is the partition column of the organization, used if the
+	// partitioning of the table includes it
+	orgIDColumn = "org_id"
+)
+
+// pseudonymisableColumns lists the string columns of every table
+var pseudonymisableColumns = map[string][]string{
+	ruleHitsTableName: {clusterIDColumn, ruleIDColumn, archivePathColumn, orgIDColumn},
+	archivesTableName: {clusterIDColumn, archivePathColumn, orgIDColumn},
+}
+
+// tableOutput is one of the copies of the tables written in a run
+type tableOutput struct {
+	// prefix the tables are written under, the one of the writer if empty
+	prefix string
+	// filtered generates the rows excluded by the filters instead of the
+	// other ones
+	filtered bool
+	// masked pseudonymises the columns configured for every table
+	masked bool
+	// primary is the copy the skipped and filtered rows are counted in
+	primary bool
+}
+
+// tableOutputs returns the copies of the tables written in a run: the rows
+// kept by the filters, pseudonymised or not, their pseudonymised copy if the
+// masked prefix is configured, and the rows excluded by the filters if the
+// filtered prefix is configured
+func (aggregator *RulesResultsReportAggregator) tableOutputs() []tableOutput {
+	main := tableOutput{
+		masked:  aggregator.pseudonymiser != nil && aggregator.maskedPrefix == "",
+		primary: true,
+	}
+	outputs := []tableOutput{main}
+	if aggregator.maskedPrefix != "" {
+		outputs = append(outputs, tableOutput{prefix: aggregator.maskedPrefix, masked: true})
+	}
+	if aggregator.filteredPrefix != "" {
+		outputs = append(outputs, tableOutput{prefix: aggregator.filteredPrefix, filtered: true, masked: main.masked})
+	}
+	return outputs
+}
+
+// writer returns the writer of the tables of the output
+func (output tableOutput) writer(writer s3writer.S3ParquetWriter) s3writer.S3ParquetWriter {
+	if output.prefix == "" {
+		return writer
+	}
+	return prefixedWriter{S3ParquetWriter: writer, prefix: output.prefix}
+}
+
+// prefixedWriter writes the tables under another prefix
+type prefixedWriter struct {
+	s3writer.S3ParquetWriter
+	prefix string
+}
+
+// Prefix returns the prefix the tables are written under
+func (writer prefixedWriter) Prefix() string {
+	return writer.prefix
+}
+
+// keepRow returns true if the row excluded by the given filter, if any, is
+// one of the rows of the output: the ones not excluded, or the excluded ones
+// if the output is filtered. The excluded rows are counted in the primary
+// output.
+func (aggregator *RulesResultsReportAggregator) keepRow(table, filter string, output tableOutput) bool {
+	if filter == "" {
+		return !output.filtered
+	}
+	if output.primary {
+		metrics.RowsFiltered.With(metrics.WithTableFilterLabels(table, filter)).Inc()
+	}
+	return output.filtered
+}
+
+// value returns the value of the column of the table in the output,
+// pseudonymised if needed
+func (aggregator *RulesResultsReportAggregator) value(output tableOutput, table, column, value string) string {
+	if !output.masked {
+		return value
+	}
+	return aggregator.pseudonymiser.Value(table, column, value)
+}
+
+// partitionFor returns the partition of the table in the output where the
+// rows of the report are stored, with its organization pseudonymised if needed
+func (aggregator *RulesResultsReportAggregator) partitionFor(
+	layout *utils.PartitionLayout, output tableOutput, table string, collectedAt time.Time, orgID string,
+) utils.Partition {
+	return layout.PartitionFor(collectedAt, aggregator.value(output, table, orgIDColumn, orgID))
+}
@@ -0,0 +1,195 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rulereportaggregator
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/deltalog"
+	"github.com/RedHatInsights/parquet-factory/metrics"
+	"github.com/RedHatInsights/parquet-factory/reportaggregators"
+	"github.com/RedHatInsights/parquet-factory/runreport"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+	"github.com/RedHatInsights/parquet-factory/tracing"
+	"github.com/RedHatInsights/parquet-factory/utils"
+)
+
+// parquetRow is implemented by the rows of every generated table
+type parquetRow interface {
+	SchemaVersion() int
+	archivePath() string
+}
+
+// writeTable stores the rows of a table, one parquet file per partition. The
+// files are written concurrently, each of them taking one of the given slots,
+// and added to the given set as soon as they are created. The files stored
+// successfully are returned, so they can be committed once every table is
+// written.
+func writeTable[T parquetRow](
+	ctx context.Context,
+	aggregator *RulesResultsReportAggregator,
+	writer s3writer.S3ParquetWriter,
+	slots chan struct{},
+	files *fileSet,
+	table string,
+	output tableOutput,
+	rows map[utils.Partition][]T,
+) (dataFiles []deltalog.DataFile, err error) {
+	log.Info().Msgf(reportaggregators.StartGenerateFileStr, table)
+
+	ctx, span := tracing.StartChildSpan(ctx, "write_table", tracing.TableKey.String(table))
+	defer func() { tracing.EndSpan(span, err) }()
+	dataFiles = []deltalog.DataFile{}
+
+	layout := aggregator.layout(table)
+	if len(rows) > 0 {
+		tablePrefix := layout.TablePrefix(writer.Prefix(), table)
+		if err := writer.CheckSchema(ctx, tablePrefix, new(T), objectOptions(table)); err != nil {
+			log.Error().Err(err).Msgf(reportaggregators.IncompatibleSchemaStr, table)
+			return dataFiles, err
+		}
+	}
+
+	sources := aggregator.partitionSources(table, output)
+	var mutex sync.Mutex
+
+	pool := newWritePool(ctx, slots)
+	defer pool.Close()
+	for partition, partitionRows := range rows {
+		started := pool.Go(func(ctx context.Context) error {
+			dataFile, err := writeTableFile(ctx, aggregator, writer, files, table, partition, sources[partition], partitionRows)
+			if err != nil {
+				return err
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			dataFiles = append(dataFiles, dataFile)
+			return nil
+		})
+		if !started {
+			break
+		}
+	}
+	if err := pool.Wait(); err != nil {
+		return dataFiles, err
+	}
+	// another table may have failed in the meantime
+	return dataFiles, ctx.Err()
+}
+
+// writeTableFile stores the rows of a partition of a table in a new parquet
+// file. The upload is retried following the retry policy of the aggregator.
+func writeTableFile[T parquetRow](
+	ctx context.Context,
+	aggregator *RulesResultsReportAggregator,
+	writer s3writer.S3ParquetWriter,
+	files *fileSet,
+	table string,
+	partition utils.Partition,
+	sources reportaggregators.SourceRanges,
+	rows []T,
+) (dataFile deltalog.DataFile, err error) {
+	layout := aggregator.layout(table)
+	parquetFilePath, err := aggregator.parquetFilepath(ctx, writer, table, partition, sources)
+	if err != nil {
+		return dataFile, err
+	}
+	log.Info().Msgf(reportaggregators.FileStoredStr, parquetFilePath)
+
+	ctx, span := tracing.StartChildSpan(ctx, "upload_file",
+		tracing.TableKey.String(table), tracing.Hour(partition.Hour), tracing.FileKey.String(parquetFilePath))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	var (
+		file                     s3writer.S3ParquetFile
+		writtenRows, skippedRows int64
+	)
+	options := aggregator.fileOptions(table, partition.Hour)
+	err = aggregator.retryPolicy.Do(ctx, "upload_file", func() (err error) {
+		file, writtenRows, skippedRows, err = uploadTableFile(ctx, writer, files, table, parquetFilePath, options, rows)
+		// a failed attempt may have stored part of the file once it was
+		// created, but nothing is stored if it failed before that
+		if err != nil && files.Contains(parquetFilePath) {
+			options.Overwrite = true
+		}
+		return err
+	})
+	if err != nil {
+		return dataFile, err
+	}
+	span.SetAttributes(tracing.RowsKey.Int64(writtenRows))
+
+	log.Info().Msgf(reportaggregators.GenerateFileSuccess, table, parquetFilePath)
+	metrics.FilesGenerated.With(metrics.WithTableLabel(table)).Inc()
+	if skippedRows > 0 {
+		metrics.RowsSkipped.With(metrics.WithTableReasonLabels(table, metrics.ReasonWriteError)).Add(float64(skippedRows))
+	}
+	runreport.RecordFile(table, partition.Hour, parquetFilePath, writtenRows)
+
+	dataFile = deltalog.DataFile{
+		Key:             parquetFilePath,
+		PartitionValues: layout.PartitionValues(partition),
+		Rows:            writtenRows,
+	}
+	if aggregator.usesDeltaLog(table) {
+		dataFile.Size = file.Size()
+	}
+	return dataFile, nil
+}
+
+// uploadTableFile creates a parquet file with the given rows, skipping the
+// ones that can't be added to it. The file is added to the given set as soon
+// as it is created, as part of it may be stored even if it fails later.
+func uploadTableFile[T parquetRow](
+	ctx context.Context,
+	writer s3writer.S3ParquetWriter,
+	files *fileSet,
+	table string,
+	parquetFilePath string,
+	options s3writer.FileOptions,
+	rows []T,
+) (file s3writer.S3ParquetFile, writtenRows, skippedRows int64, err error) {
+	// Init writers directly to bucket
+	file, err = writer.NewFile(ctx, parquetFilePath, new(T), options)
+	if err != nil {
+		log.Error().Err(err).Msg(reportaggregators.UnableCreateFileStr)
+		return nil, 0, 0, err
+	}
+	files.Add(parquetFilePath)
+
+	for _, row := range rows {
+		if err := file.AddRow(row); err != nil {
+			log.Error().Err(err).Msgf(reportaggregators.UnableSaveRowStr, table)
+			skippedRows++
+			continue
+		}
+		writtenRows++
+		reportaggregators.LogInsertedRow(row.archivePath(), table)
+	}
+
+	if err := file.CloseFile(); err != nil {
+		log.Error().Err(err).Msg(reportaggregators.UnableCloseFileStr)
+		var verifyErr *s3writer.VerificationError
+		if errors.As(err, &verifyErr) {
+			metrics.FailedVerifications.With(metrics.WithTableLabel(table)).Inc()
+		}
+		return nil, 0, 0, err
+	}
+	return file, writtenRows, skippedRows, nil
+}
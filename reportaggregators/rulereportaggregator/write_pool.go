@@ -0,0 +1,103 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rulereportaggregator
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultWriteWorkers keeps the tables and their files written one by one
+const defaultWriteWorkers = 1
+
+// writePool runs tasks taking a slot from a set of slots, which can be shared
+// with other pools to bound the number of tasks run at the same time across
+// all of them. As soon as one of the tasks fails, the context of the pool is
+// cancelled and no more tasks are started.
+type writePool struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	slots  chan struct{}
+	wg     sync.WaitGroup
+
+	mutex sync.Mutex
+	err   error
+}
+
+// newSlots returns the slots for running the given number of tasks at the same time
+func newSlots(workers int) chan struct{} {
+	if workers < 1 {
+		workers = defaultWriteWorkers
+	}
+	return make(chan struct{}, workers)
+}
+
+func newWritePool(ctx context.Context, slots chan struct{}) *writePool {
+	ctx, cancel := context.WithCancel(ctx)
+	return &writePool{
+		ctx:    ctx,
+		cancel: cancel,
+		slots:  slots,
+	}
+}
+
+// Go runs the task as soon as a slot is free. It returns false, without
+// running it, if a previous task failed.
+func (pool *writePool) Go(task func(context.Context) error) bool {
+	select {
+	case pool.slots <- struct{}{}:
+	case <-pool.ctx.Done():
+		return false
+	}
+	// the failed task cancels the context before releasing its slot
+	if pool.ctx.Err() != nil {
+		<-pool.slots
+		return false
+	}
+
+	pool.wg.Add(1)
+	go func() {
+		defer pool.wg.Done()
+		defer func() { <-pool.slots }()
+		if err := task(pool.ctx); err != nil {
+			pool.fail(err)
+		}
+	}()
+	return true
+}
+
+// Wait waits for the started tasks and returns the error of the first one
+// that failed, if any
+func (pool *writePool) Wait() error {
+	pool.wg.Wait()
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return pool.err
+}
+
+// Close releases the context of the pool
+func (pool *writePool) Close() {
+	pool.cancel()
+}
+
+func (pool *writePool) fail(err error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if pool.err == nil {
+		pool.err = err
+		pool.cancel()
+	}
+}
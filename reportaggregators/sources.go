@@ -0,0 +1,74 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportaggregators
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// MessageSource identifies the Kafka message a report was read from
+type MessageSource struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+// SourceRanges stores the range of offsets read from each topic and partition
+// for generating the rows of a file
+type SourceRanges map[string]map[int32][2]int64
+
+// Add extends the ranges in order to include the given message
+func (ranges SourceRanges) Add(source MessageSource) {
+	partitions, ok := ranges[source.Topic]
+	if !ok {
+		partitions = map[int32][2]int64{}
+		ranges[source.Topic] = partitions
+	}
+
+	offsets, ok := partitions[source.Partition]
+	if !ok {
+		partitions[source.Partition] = [2]int64{source.Offset, source.Offset}
+		return
+	}
+	if source.Offset < offsets[0] {
+		offsets[0] = source.Offset
+	}
+	if source.Offset > offsets[1] {
+		offsets[1] = source.Offset
+	}
+	partitions[source.Partition] = offsets
+}
+
+// ID returns an identifier for the stored ranges. The same ranges always
+// produce the same identifier, so it can be used to name the generated files
+// without colliding with the ones generated from different messages.
+func (ranges SourceRanges) ID() string {
+	lines := []string{}
+	for topic, partitions := range ranges {
+		for partition, offsets := range partitions {
+			lines = append(lines, fmt.Sprintf("%s/%d/%d-%d", topic, partition, offsets[0], offsets[1]))
+		}
+	}
+	sort.Strings(lines)
+
+	hash := sha256.New()
+	for _, line := range lines {
+		hash.Write([]byte(line + "\n"))
+	}
+	return "offsets-" + hex.EncodeToString(hash.Sum(nil)[:8])
+}
@@ -0,0 +1,58 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportaggregators_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/RedHatInsights/parquet-factory/reportaggregators"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceRangesAdd(t *testing.T) {
+	ranges := reportaggregators.SourceRanges{}
+	ranges.Add(reportaggregators.MessageSource{Topic: "t", Partition: 0, Offset: 10})
+	ranges.Add(reportaggregators.MessageSource{Topic: "t", Partition: 0, Offset: 5})
+	ranges.Add(reportaggregators.MessageSource{Topic: "t", Partition: 0, Offset: 7})
+	ranges.Add(reportaggregators.MessageSource{Topic: "t", Partition: 1, Offset: 3})
+
+	assert.Equal(t, reportaggregators.SourceRanges{
+		"t": {
+			0: {5, 10},
+			1: {3, 3},
+		},
+	}, ranges)
+}
+
+func TestSourceRangesID(t *testing.T) {
+	first := reportaggregators.SourceRanges{}
+	first.Add(reportaggregators.MessageSource{Topic: "t", Partition: 0, Offset: 10})
+	first.Add(reportaggregators.MessageSource{Topic: "t", Partition: 1, Offset: 3})
+
+	// same messages in a different order
+	second := reportaggregators.SourceRanges{}
+	second.Add(reportaggregators.MessageSource{Topic: "t", Partition: 1, Offset: 3})
+	second.Add(reportaggregators.MessageSource{Topic: "t", Partition: 0, Offset: 10})
+
+	// different messages
+	third := reportaggregators.SourceRanges{}
+	third.Add(reportaggregators.MessageSource{Topic: "t", Partition: 0, Offset: 11})
+	third.Add(reportaggregators.MessageSource{Topic: "t", Partition: 1, Offset: 3})
+
+	assert.True(t, strings.HasPrefix(first.ID(), "offsets-"))
+	assert.Equal(t, first.ID(), second.ID())
+	assert.NotEqual(t, first.ID(), third.ID())
+}
@@ -31,7 +31,15 @@ const (
 	// UnableDeleteFileStr message when it is not possible to delete a file
 	UnableDeleteFileStr = "Unable to delete file"
 	// GenerateFileSuccess message when a new table is generated
-	GenerateFileSuccess = "\"%s-%d\" table was generated"
+	GenerateFileSuccess = "\"%s\" table was generated in %s"
+	// IncompatibleSchemaStr message when the schema can't be used with the stored files
+	IncompatibleSchemaStr = "Unable to use the current \"%s\" schema with the stored files"
+	// UnableWriteDescriptorStr message when the descriptor of a table can't be stored
+	UnableWriteDescriptorStr = "Unable to store the descriptor of the \"%s\" table"
+	// UnableCommitTableStr message when the files of a table can't be committed to its log
+	UnableCommitTableStr = "Unable to commit the files of the \"%s\" table"
+	// UnableRevertTableStr message when the files committed to the log of a table can't be removed from it
+	UnableRevertTableStr = "Unable to revert the commit of the \"%s\" table"
 	// UnableSaveRowStr message when a row can not be written
 	UnableSaveRowStr = "Unable to save row \"%s\""
 )
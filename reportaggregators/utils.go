@@ -28,6 +28,7 @@ var timestampRe = regexp.MustCompile(`archives/compressed/[0-9a-f]+/[0-9a-f]{8}-
 // Metadata represents the key "metadata" of the received reports
 type Metadata struct {
 	ClusterID string `json:"cluster_id"`
+	OrgID     string `json:"external_organization"`
 }
 
 // LogInsertedRow is a helper to print an appropriate log when a row is inserted
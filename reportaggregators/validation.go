@@ -0,0 +1,96 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportaggregators
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"github.com/RedHatInsights/parquet-factory/metrics"
+)
+
+// RejectedMessageError is returned when a message is rejected before any row
+// is generated from it
+type RejectedMessageError struct {
+	// Reason is the label the message is counted with in the
+	// MessagesRejected metric
+	Reason string
+	Err    error
+}
+
+func (err *RejectedMessageError) Error() string {
+	return fmt.Sprintf("message rejected (%s): %v", err.Reason, err.Err)
+}
+
+func (err *RejectedMessageError) Unwrap() error {
+	return err.Err
+}
+
+// Retryable returns false, as the message is rejected whatever caused it
+func (err *RejectedMessageError) Retryable() bool {
+	return false
+}
+
+// Reject counts the rejection of a message in the MessagesRejected metric by
+// its reason and returns it as a RejectedMessageError
+func Reject(reason string, err error) error {
+	metrics.MessagesRejected.With(metrics.WithReasonLabel(reason)).Inc()
+	return &RejectedMessageError{Reason: reason, Err: err}
+}
+
+// MessageSchema validates the messages of a topic against a JSON Schema
+type MessageSchema struct {
+	schema *jsonschema.Schema
+}
+
+// LoadMessageSchema compiles the JSON Schema stored in the given file. The
+// draft is taken from its $schema keyword, 2020-12 by default.
+func LoadMessageSchema(path string) (*MessageSchema, error) {
+	schema, err := jsonschema.Compile(path)
+	if err != nil {
+		log.Error().Err(err).Str("schema_file", path).Msg("Unable to load the JSON Schema of the messages")
+		return nil, err
+	}
+	return &MessageSchema{schema: schema}, nil
+}
+
+// Validate returns an error describing the first violation of the schema
+// found in the message. A nil schema accepts every message.
+func (schema *MessageSchema) Validate(message []byte) error {
+	if schema == nil {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	// the schema keywords of the numbers are checked with their exact value
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+
+	err := schema.schema.Validate(value)
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		return errors.New(strings.TrimPrefix(validationErr.Error(), "jsonschema: "))
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportaggregators_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/metrics"
+	"github.com/RedHatInsights/parquet-factory/reportaggregators"
+	"github.com/RedHatInsights/parquet-factory/testdata"
+)
+
+const schemaFile = "../testdata/rules_results.schema.json"
+
+func TestLoadMessageSchema(t *testing.T) {
+	_, err := reportaggregators.LoadMessageSchema("missing.json")
+	assert.Error(t, err)
+
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	assert.NoError(t, os.WriteFile(invalid, []byte(`{"type": 3}`), 0o600))
+	_, err = reportaggregators.LoadMessageSchema(invalid)
+	assert.Error(t, err)
+}
+
+func TestMessageSchemaValidate(t *testing.T) {
+	schema, err := reportaggregators.LoadMessageSchema(schemaFile)
+	assert.NoError(t, err)
+
+	assert.NoError(t, schema.Validate(testdata.RuleHitReport))
+
+	err = schema.Validate([]byte(`{"path": "a.tar.gz", "metadata": {}, "report": {}}`))
+	assert.ErrorContains(t, err, "missing properties: 'cluster_id'")
+
+	err = schema.Validate([]byte(`{"path": "a.tar.gz", "metadata": {"cluster_id": "c1"}, "report": {"reports": [{"rule_id": 1}]}}`))
+	assert.ErrorContains(t, err, "/report/reports/0/rule_id")
+
+	assert.Error(t, schema.Validate([]byte("not json")))
+
+	// a nil schema accepts every message
+	var noSchema *reportaggregators.MessageSchema
+	assert.NoError(t, noSchema.Validate([]byte("not json")))
+}
+
+func TestReject(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	cause := errors.New("test error")
+	err := reportaggregators.Reject(metrics.ReasonMissingField, cause)
+
+	var rejected *reportaggregators.RejectedMessageError
+	assert.ErrorAs(t, err, &rejected)
+	assert.Equal(t, metrics.ReasonMissingField, rejected.Reason)
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonMissingField))))
+}
@@ -15,18 +15,24 @@
 package reportreader_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/RedHatInsights/parquet-factory/dataaggregator/mock"
+	"github.com/RedHatInsights/parquet-factory/decoder"
 	"github.com/RedHatInsights/parquet-factory/metrics"
+	"github.com/RedHatInsights/parquet-factory/reportaggregators"
 	"github.com/RedHatInsights/parquet-factory/reportreader"
+	"github.com/RedHatInsights/parquet-factory/retry"
 )
 
 func TestConsumePartition(t *testing.T) {
@@ -223,6 +229,263 @@ func TestConsumePartition(t *testing.T) {
 	}
 }
 
+// TestConsumePartitionRestarts checks that a partition consumer that keeps
+// stopping without consuming any message is restarted up to the maximum
+// number of retries, or until it's stopped if there is no maximum
+func TestConsumePartitionRestarts(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		maxRetries int
+		fails      bool
+	}{
+		{"maximum retries", 2, true},
+		{"no maximum", 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sut := newRestartTestConsumer(t, tc.maxRetries)
+
+			done := make(chan error)
+			go func() { done <- sut.ConsumePartition(0) }()
+			if !tc.fails {
+				select {
+				case <-done:
+					t.Fatal("the partition consumer wasn't restarted")
+				case <-time.After(100 * time.Millisecond):
+				}
+				sut.RequestStop()
+			}
+			select {
+			case err := <-done:
+				if tc.fails {
+					assert.EqualError(t, err, "the partition consumer stopped 3 times in a row without consuming any message")
+				} else {
+					assert.NoError(t, err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("the partition consumer wasn't stopped")
+			}
+		})
+	}
+}
+
+func newRestartTestConsumer(t *testing.T, maxRetries int) *reportreader.KafkaConsumer {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	testMockConsumer := NewMockConsumer()
+	messageChan := make(chan *sarama.ConsumerMessage)
+	close(messageChan)
+	testMockConsumer.partitionConsumer = mockPartitionConsumer{messageChan: messageChan}
+
+	sut, err := reportreader.NewMockKafkaConsumer(reportreader.MockConfiguration{
+		Topic:          "test_topic",
+		GroupID:        "test_group",
+		MaxRecords:     10,
+		LimitTimestamp: time.Now(),
+		Aggregator:     &mock.Aggregator{},
+		OffsetManager: &mockOffsetManager{
+			partitionOffsetManager: &mockPartitionOffsetManager{},
+		},
+		Consumer: &testMockConsumer,
+		PartitionTracker: reportreader.NewMockPartitionTracker(
+			map[string]map[int32]int64{"test_topic": {0: 0}},
+			map[string]map[int32]bool{"test_topic": {0: false}},
+		),
+		RetryPolicy: retry.Policy{
+			MaxRetries: maxRetries, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, Multiplier: 2,
+		},
+	})
+	assert.NoError(t, err)
+	testMockConsumer.partitions = []int32{0}
+	return sut
+}
+
+// recordingAggregator stores the messages it handles, unless handleErr
+// returns an error for them
+type recordingAggregator struct {
+	mock.Aggregator
+	mutex     sync.Mutex
+	handled   []*sarama.ConsumerMessage
+	handleErr func(*sarama.ConsumerMessage) error
+}
+
+func (a *recordingAggregator) Handle(message interface{}) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	m := message.(*sarama.ConsumerMessage)
+	if a.handleErr != nil {
+		if err := a.handleErr(m); err != nil {
+			return err
+		}
+	}
+	a.handled = append(a.handled, m)
+	return nil
+}
+
+func newControlTestConsumer(t *testing.T, partitions []int32, aggregator *recordingAggregator, limitTimestamp time.Time, maxRecords int) (*reportreader.KafkaConsumer, chan *sarama.ConsumerMessage) {
+	testMockConsumer := NewMockConsumer()
+	messageChan := make(chan *sarama.ConsumerMessage, 10)
+	testMockConsumer.partitionConsumer = mockPartitionConsumer{messageChan: messageChan}
+
+	offsets := map[int32]int64{}
+	limitReached := map[int32]bool{}
+	for _, partition := range partitions {
+		offsets[partition] = 0
+		limitReached[partition] = false
+	}
+
+	sut, err := reportreader.NewMockKafkaConsumer(reportreader.MockConfiguration{
+		Topic:          "test_topic",
+		GroupID:        "test_group",
+		MaxRecords:     maxRecords,
+		LimitTimestamp: limitTimestamp,
+		Aggregator:     aggregator,
+		OffsetManager: &mockOffsetManager{
+			partitionOffsetManager: &mockPartitionOffsetManager{},
+		},
+		Consumer: &testMockConsumer,
+		PartitionTracker: reportreader.NewMockPartitionTracker(
+			map[string]map[int32]int64{"test_topic": offsets},
+			map[string]map[int32]bool{"test_topic": limitReached},
+		),
+	})
+	assert.NoError(t, err)
+	testMockConsumer.partitions = partitions
+	return sut, messageChan
+}
+
+func controlTestMessage(offset int64, timestamp time.Time, key, value string) *sarama.ConsumerMessage {
+	message := &sarama.ConsumerMessage{
+		Timestamp: timestamp,
+		Value:     []byte(fmt.Sprintf(`{"path": "test/path%d.gz"}`, offset)),
+		Topic:     "test_topic",
+		Offset:    offset,
+	}
+	if key != "" {
+		message.Headers = []*sarama.RecordHeader{{Key: []byte(key), Value: []byte(value)}}
+	}
+	return message
+}
+
+func TestControlMessages(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	limitTimestamp := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	aggregator := &recordingAggregator{}
+	sut, messageChan := newControlTestConsumer(t, []int32{0}, aggregator, limitTimestamp, 10)
+
+	messageChan <- controlTestMessage(1, limitTimestamp, "skip", "true")
+	// the invalid control header is ignored, so the message is aggregated
+	messageChan <- controlTestMessage(2, limitTimestamp, "stop", "invalid")
+	// the message after the limit is consumed once the limit is moved
+	messageChan <- controlTestMessage(3, limitTimestamp, "reprocess-until", limitTimestamp.Add(2*time.Hour).Format(time.RFC3339))
+	messageChan <- controlTestMessage(4, limitTimestamp.Add(time.Hour), "", "")
+	messageChan <- controlTestMessage(5, limitTimestamp, "flush", "true")
+	messageChan <- controlTestMessage(6, limitTimestamp, "", "")
+
+	assert.NoError(t, sut.ConsumePartition(0))
+
+	assert.Len(t, aggregator.handled, 2)
+	assert.Equal(t, int64(2), aggregator.handled[0].Offset)
+	assert.Equal(t, int64(4), aggregator.handled[1].Offset)
+	// the control messages advance the offset, the one after the flush isn't consumed
+	assert.Equal(t, int64(5), sut.Offsets()["test_topic"][0])
+	assert.Len(t, messageChan, 1)
+	assert.True(t, sut.FlushRequested())
+	assert.Equal(t,
+		map[string]float64{
+			metrics.ControlSkip: 1, metrics.ControlInvalid: 1,
+			metrics.ControlReprocessUntil: 1, metrics.ControlFlush: 1,
+		},
+		metrics.CounterValues(metrics.ControlMessages, "action"))
+
+	// once the results are written, the consumer is resumed after the flush
+	sut.Resume()
+	assert.False(t, sut.FlushRequested())
+	messageChan <- controlTestMessage(7, limitTimestamp.Add(3*time.Hour), "", "")
+	assert.NoError(t, sut.ConsumePartition(0))
+	assert.Len(t, aggregator.handled, 3)
+	assert.Equal(t, int64(6), sut.Offsets()["test_topic"][0])
+}
+
+// TestControlMessagesNotCounted checks that the control messages don't count
+// against the max_consumed_records limit
+func TestControlMessagesNotCounted(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	limitTimestamp := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	aggregator := &recordingAggregator{}
+	sut, messageChan := newControlTestConsumer(t, []int32{0}, aggregator, limitTimestamp, 2)
+
+	messageChan <- controlTestMessage(1, limitTimestamp, "skip", "true")
+	messageChan <- controlTestMessage(2, limitTimestamp, "skip", "true")
+	messageChan <- controlTestMessage(3, limitTimestamp, "", "")
+	messageChan <- controlTestMessage(4, limitTimestamp, "", "")
+	messageChan <- controlTestMessage(5, limitTimestamp, "", "")
+
+	assert.NoError(t, sut.ConsumePartition(0))
+
+	assert.Len(t, aggregator.handled, 2)
+	assert.Equal(t, int64(4), sut.Offsets()["test_topic"][0])
+}
+
+// TestClaimChecksNotDeduplicated checks that the claim checks, which don't
+// have a path, are all handed to the aggregator
+func TestClaimChecksNotDeduplicated(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	limitTimestamp := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	aggregator := &recordingAggregator{}
+	sut, messageChan := newControlTestConsumer(t, []int32{0}, aggregator, limitTimestamp, 10)
+
+	for offset := int64(1); offset <= 3; offset++ {
+		message := controlTestMessage(offset, limitTimestamp, "", "")
+		message.Value = []byte(fmt.Sprintf(`{"claim_check": {"url": "s3://reports/report%d.json"}}`, offset))
+		messageChan <- message
+	}
+	// the message after the limit finishes the partition
+	messageChan <- controlTestMessage(4, limitTimestamp.Add(time.Hour), "", "")
+
+	assert.NoError(t, sut.ConsumePartition(0))
+
+	assert.Len(t, aggregator.handled, 3)
+	assert.Equal(t, float64(0), testutil.ToFloat64(
+		metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonDuplicate))))
+}
+
+// TestStopDrainsAllPartitions checks that a stop message received by one
+// partition stops the partitions waiting for messages too
+func TestStopDrainsAllPartitions(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	limitTimestamp := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	aggregator := &recordingAggregator{}
+	sut, messageChan := newControlTestConsumer(t, []int32{0, 1}, aggregator, limitTimestamp, 10)
+
+	messageChan <- controlTestMessage(1, limitTimestamp, "stop", "true")
+
+	ctx := sut.Start()
+	assert.NoError(t, waitForContext(ctx, 2*time.Second), "expected all the partitions to stop")
+	assert.Empty(t, aggregator.handled)
+	assert.Equal(t, float64(1), metrics.CounterValues(metrics.ControlMessages, "action")[metrics.ControlStop])
+	assert.False(t, sut.FlushRequested())
+}
+
+// TestErrorDrainsAllPartitions checks that a partition that fails stops the
+// other ones before the consumer finishes, so the results aren't written while
+// they are consuming
+func TestErrorDrainsAllPartitions(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	limitTimestamp := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	aggregator := &recordingAggregator{handleErr: func(*sarama.ConsumerMessage) error {
+		return &reportaggregators.FetchError{URL: "s3://bucket/report.json", Err: errors.New("unreachable")}
+	}}
+	sut, messageChan := newControlTestConsumer(t, []int32{0, 1}, aggregator, limitTimestamp, 10)
+
+	messageChan <- controlTestMessage(1, limitTimestamp, "", "")
+
+	ctx := sut.Start()
+	assert.NoError(t, waitForContext(ctx, 2*time.Second), "expected all the partitions to stop")
+	assert.True(t, sut.StopRequested())
+	assert.Empty(t, aggregator.handled)
+	assert.Equal(t, int64(0), sut.Offsets()["test_topic"][0])
+}
+
 func waitForContext(ctx context.Context, timeout time.Duration) error {
 	select {
 	case <-time.After(timeout):
@@ -262,3 +525,117 @@ func fillMessageChan(messageChan chan *sarama.ConsumerMessage, topic string, par
 		}
 	}
 }
+
+func TestRecordMessageMetrics(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+
+	pConsumer := mockPartitionConsumer{highWaterMarkOffset: 10}
+	labels := metrics.WithPartitionLabels("test_topic", 3)
+	producedAt := time.Now().Add(-time.Hour)
+
+	reportreader.RecordMessageMetrics(pConsumer, &sarama.ConsumerMessage{
+		Topic:     "test_topic",
+		Partition: 3,
+		Offset:    5,
+		Timestamp: producedAt,
+	})
+	// an older message doesn't move the newest timestamp back
+	reportreader.RecordMessageMetrics(pConsumer, &sarama.ConsumerMessage{
+		Topic:     "test_topic",
+		Partition: 3,
+		Offset:    6,
+		Timestamp: producedAt.Add(-time.Hour),
+	})
+
+	assert.Equal(t, float64(10), testutil.ToFloat64(metrics.PartitionHighWaterMark.With(labels)))
+	assert.Equal(t, float64(3), testutil.ToFloat64(metrics.PartitionLag.With(labels)))
+	assert.Equal(t, float64(producedAt.Unix()), testutil.ToFloat64(metrics.PartitionNewestMessageTimestamp.With(labels)))
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.MessageAge))
+}
+
+// prefixDecoder decodes the messages starting with "encoded:" and fails to
+// fetch the schema of the ones starting with "unavailable:"
+type prefixDecoder struct{}
+
+func (prefixDecoder) Decode(value []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(value, []byte("encoded:")):
+		return bytes.TrimPrefix(value, []byte("encoded:")), nil
+	case bytes.HasPrefix(value, []byte("unavailable:")):
+		return nil, &decoder.SchemaError{ID: 1, Err: errors.New("registry unavailable")}
+	default:
+		return nil, errors.New("invalid message")
+	}
+}
+
+func TestDecodeMessages(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	limitTimestamp := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	aggregator := &recordingAggregator{}
+
+	testMockConsumer := NewMockConsumer()
+	messageChan := make(chan *sarama.ConsumerMessage, 10)
+	testMockConsumer.partitionConsumer = mockPartitionConsumer{messageChan: messageChan}
+	sut, err := reportreader.NewMockKafkaConsumer(reportreader.MockConfiguration{
+		Topic:          "test_topic",
+		GroupID:        "test_group",
+		MaxRecords:     10,
+		LimitTimestamp: limitTimestamp,
+		Aggregator:     aggregator,
+		OffsetManager: &mockOffsetManager{
+			partitionOffsetManager: &mockPartitionOffsetManager{},
+		},
+		Consumer: &testMockConsumer,
+		PartitionTracker: reportreader.NewMockPartitionTracker(
+			map[string]map[int32]int64{"test_topic": {0: 0}},
+			map[string]map[int32]bool{"test_topic": {0: false}},
+		),
+		Decoder: prefixDecoder{},
+	})
+	assert.NoError(t, err)
+	testMockConsumer.partitions = []int32{0}
+
+	messages := []string{`{"path": "test/path1.gz"}`, `encoded:{"path": "test/path2.gz"}`, `unavailable:`, `encoded:{"path": "test/path4.gz"}`}
+	for i, value := range messages {
+		message := controlTestMessage(int64(i+1), limitTimestamp, "", "")
+		message.Value = []byte(value)
+		messageChan <- message
+	}
+
+	var schemaErr *decoder.SchemaError
+	assert.ErrorAs(t, sut.ConsumePartition(0), &schemaErr)
+
+	// the undecodable message is skipped, the consumer stops at the one whose
+	// schema can't be fetched
+	assert.Len(t, aggregator.handled, 1)
+	assert.Equal(t, `{"path": "test/path2.gz"}`, string(aggregator.handled[0].Value))
+	assert.Equal(t, int64(2), sut.Offsets()["test_topic"][0])
+	assert.Equal(t, float64(1), metrics.CounterValues(metrics.MessagesRejected, "reason")[metrics.ReasonUndecodable])
+}
+
+// TestRetryableHandleError checks that the partition is stopped, without
+// skipping the message, when it can be handled later
+func TestRetryableHandleError(t *testing.T) {
+	assert.NoError(t, metrics.InitMetrics("testEnv"))
+	limitTimestamp := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	aggregator := &recordingAggregator{handleErr: func(m *sarama.ConsumerMessage) error {
+		switch m.Offset {
+		case 2:
+			return errors.New("invalid message")
+		case 4:
+			return &reportaggregators.FetchError{URL: "s3://bucket/report.json", Err: errors.New("unreachable")}
+		}
+		return nil
+	}}
+	sut, messageChan := newControlTestConsumer(t, []int32{0}, aggregator, limitTimestamp, 10)
+	for offset := int64(1); offset <= 5; offset++ {
+		messageChan <- controlTestMessage(offset, limitTimestamp, "", "")
+	}
+
+	var fetchErr *reportaggregators.FetchError
+	assert.ErrorAs(t, sut.ConsumePartition(0), &fetchErr)
+
+	assert.Len(t, aggregator.handled, 2)
+	assert.Equal(t, int64(3), sut.Offsets()["test_topic"][0])
+	assert.Len(t, messageChan, 1)
+}
@@ -19,6 +19,8 @@ import (
 	"time"
 
 	"github.com/RedHatInsights/parquet-factory/dataaggregator"
+	"github.com/RedHatInsights/parquet-factory/decoder"
+	"github.com/RedHatInsights/parquet-factory/retry"
 	"github.com/RedHatInsights/parquet-factory/utils"
 
 	"github.com/IBM/sarama"
@@ -33,6 +35,8 @@ type MockConfiguration struct {
 	OffsetManager    sarama.OffsetManager
 	Consumer         sarama.Consumer
 	PartitionTracker *PartitionTracker
+	RetryPolicy      retry.Policy
+	Decoder          decoder.Decoder
 }
 
 // NewMockKafkaConsumer returns a KafkaConsumer with a stub sarama.OffsetManager,
@@ -53,6 +57,9 @@ func NewMockKafkaConsumer(config MockConfiguration) (*KafkaConsumer, error) {
 			mutex:            sync.RWMutex{},
 		},
 		processedMessages: utils.NewArchivePathSet(),
+		retryPolicy:       config.RetryPolicy,
+		decoder:           config.Decoder,
+		stopping:          make(chan struct{}),
 	}
 
 	err := consumer.getInitialOffsetTracker()
@@ -66,3 +73,22 @@ func NewMockPartitionTracker(offsets map[string]map[int32]int64, limitReached ma
 		limitReached: limitReached,
 	}
 }
+
+// RecordMessageMetrics exports recordMessageMetrics for testing
+var RecordMessageMetrics = recordMessageMetrics
+
+// ConsumePartition consumes the given partition until it finishes
+func (c *KafkaConsumer) ConsumePartition(partition int32) error {
+	c.wg.Add(1)
+	return c.consumePartition(partition)
+}
+
+// StopRequested exports stopRequested for testing
+func (c *KafkaConsumer) StopRequested() bool {
+	return c.stopRequested()
+}
+
+// RequestStop exports requestStop for testing
+func (c *KafkaConsumer) RequestStop() {
+	c.requestStop()
+}
@@ -15,28 +15,117 @@
 package reportreader
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/IBM/sarama"
+
+	"github.com/RedHatInsights/parquet-factory/metrics"
+)
+
+// Keys of the headers of the control messages
+const (
+	stopHeader           = "stop"
+	flushHeader          = "flush"
+	skipHeader           = "skip"
+	reprocessUntilHeader = "reprocess-until"
 )
 
-var stopHeader = sarama.RecordHeader{
-	Key:   []byte("stop"),
-	Value: []byte("true"),
+// controlMessage stores the actions requested by the headers of a message
+type controlMessage struct {
+	// stop drains all the partitions, so the run writes the files and
+	// commits the offsets
+	stop bool
+	// flush drains all the partitions too, but the consumer is started
+	// again once the files are written and the offsets committed
+	flush bool
+	// skip drops the message, advancing the offset
+	skip bool
+	// reprocessUntil is the new limit timestamp, if it isn't zero
+	reprocessUntil time.Time
 }
 
-// checkHeaders returns true if stopHeader is in the message
-func checkHeaders(m *sarama.ConsumerMessage) bool {
-	return isHeaderInSlice(m.Headers, stopHeader)
+// isControl returns true if the message requests any action
+func (control controlMessage) isControl() bool {
+	return control.stop || control.flush || control.skip || !control.reprocessUntil.IsZero()
 }
 
-func isHeaderInSlice(slice []*sarama.RecordHeader, val sarama.RecordHeader) bool {
-	for _, item := range slice {
-		if bytes.Equal(item.Key, val.Key) && bytes.Equal(item.Value, val.Value) {
-			return true
+// finishes returns true if the partitions must stop consuming
+func (control controlMessage) finishes() bool {
+	return control.stop || control.flush
+}
+
+// actions returns the metric labels of the requested actions
+func (control controlMessage) actions() []string {
+	actions := []string{}
+	if !control.reprocessUntil.IsZero() {
+		actions = append(actions, metrics.ControlReprocessUntil)
+	}
+	if control.skip {
+		actions = append(actions, metrics.ControlSkip)
+	}
+	if control.flush {
+		actions = append(actions, metrics.ControlFlush)
+	}
+	if control.stop {
+		actions = append(actions, metrics.ControlStop)
+	}
+	return actions
+}
+
+// parseControlHeaders returns the actions requested by the headers of the
+// message. The stop, flush and skip headers are booleans and the reprocess-until
+// header is a RFC 3339 timestamp or a Unix time in seconds. The invalid headers
+// are ignored, and an error describing them is returned along with the actions
+// of the valid ones.
+func parseControlHeaders(m *sarama.ConsumerMessage) (controlMessage, error) {
+	control := controlMessage{}
+	errs := []error{}
+
+	for _, header := range m.Headers {
+		if header == nil {
+			continue
+		}
+		var err error
+		switch string(header.Key) {
+		case stopHeader:
+			control.stop, err = parseFlag(header.Value, control.stop)
+		case flushHeader:
+			control.flush, err = parseFlag(header.Value, control.flush)
+		case skipHeader:
+			control.skip, err = parseFlag(header.Value, control.skip)
+		case reprocessUntilHeader:
+			var timestamp time.Time
+			if timestamp, err = parseTimestamp(string(header.Value)); err == nil {
+				control.reprocessUntil = timestamp
+			}
 		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s header: %w", header.Key, err))
+		}
+	}
+
+	return control, errors.Join(errs...)
+}
+
+// parseFlag parses the value of a boolean header, keeping the current value
+// if it's invalid
+func parseFlag(value []byte, current bool) (bool, error) {
+	flag, err := strconv.ParseBool(string(value))
+	if err != nil {
+		return current, err
+	}
+	return flag, nil
+}
+
+// parseTimestamp parses a RFC 3339 timestamp or a Unix time in seconds
+func parseTimestamp(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
 	}
-	return false
+	return time.Parse(time.RFC3339, value)
 }
 
 func headersToStrings(slice []*sarama.RecordHeader) map[string]string {
@@ -16,40 +16,93 @@ package reportreader
 
 import (
 	"testing"
+	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestCheckHeaders(t *testing.T) {
-	var (
-		aHeader = sarama.RecordHeader{
-			Key:   []byte("a"),
-			Value: []byte("header"),
-		}
-		newStopHeader = sarama.RecordHeader{
-			Key:   []byte("stop"),
-			Value: []byte("true"),
-		}
-		normalMsg = sarama.ConsumerMessage{
-			Headers: []*sarama.RecordHeader{
-				&aHeader,
-			},
-		}
-		stopMsg = sarama.ConsumerMessage{
-			Headers: []*sarama.RecordHeader{
-				&newStopHeader,
-			},
-		}
-	)
+func TestParseControlHeaders(t *testing.T) {
+	header := func(key, value string) *sarama.RecordHeader {
+		return &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)}
+	}
+
 	t.Run("a normal header", func(t *testing.T) {
-		ans := checkHeaders(&normalMsg)
-		assert.False(t, ans)
+		control, err := parseControlHeaders(&sarama.ConsumerMessage{
+			Headers: []*sarama.RecordHeader{header("a", "header")},
+		})
+		assert.NoError(t, err)
+		assert.False(t, control.isControl())
 	})
 
 	t.Run("a stop header", func(t *testing.T) {
-		ans := checkHeaders(&stopMsg)
-		assert.True(t, ans)
+		control, err := parseControlHeaders(&sarama.ConsumerMessage{
+			Headers: []*sarama.RecordHeader{header("stop", "true")},
+		})
+		assert.NoError(t, err)
+		assert.True(t, control.isControl())
+		assert.True(t, control.finishes())
+		assert.Equal(t, []string{"stop"}, control.actions())
+	})
+
+	t.Run("a false stop header", func(t *testing.T) {
+		control, err := parseControlHeaders(&sarama.ConsumerMessage{
+			Headers: []*sarama.RecordHeader{header("stop", "false")},
+		})
+		assert.NoError(t, err)
+		assert.False(t, control.isControl())
+	})
+
+	t.Run("several headers", func(t *testing.T) {
+		control, err := parseControlHeaders(&sarama.ConsumerMessage{
+			Headers: []*sarama.RecordHeader{
+				header("stop", "1"),
+				header("skip", "true"),
+				header("reprocess-until", "2022-01-01T10:00:00Z"),
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, control.finishes())
+		assert.Equal(t, time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC), control.reprocessUntil)
+		assert.Equal(t, []string{"reprocess_until", "skip", "stop"}, control.actions())
+	})
+
+	t.Run("a Unix timestamp", func(t *testing.T) {
+		control, err := parseControlHeaders(&sarama.ConsumerMessage{
+			Headers: []*sarama.RecordHeader{header("reprocess-until", "1641031200")},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC), control.reprocessUntil)
+		assert.False(t, control.finishes())
+	})
+
+	t.Run("a flush header", func(t *testing.T) {
+		control, err := parseControlHeaders(&sarama.ConsumerMessage{
+			Headers: []*sarama.RecordHeader{header("flush", "true")},
+		})
+		assert.NoError(t, err)
+		assert.True(t, control.isControl())
+		assert.True(t, control.finishes())
+		assert.Equal(t, []string{"flush"}, control.actions())
+	})
+
+	for _, invalid := range []*sarama.RecordHeader{
+		header("stop", "maybe"),
+		header("flush", "maybe"),
+		header("skip", "maybe"),
+		header("reprocess-until", "yesterday"),
+	} {
+		control, err := parseControlHeaders(&sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{invalid}})
+		assert.ErrorContains(t, err, string(invalid.Key))
+		assert.False(t, control.isControl(), string(invalid.Key))
+	}
+
+	t.Run("an invalid header along with valid ones", func(t *testing.T) {
+		control, err := parseControlHeaders(&sarama.ConsumerMessage{
+			Headers: []*sarama.RecordHeader{header("skip", "true"), header("stop", "maybe")},
+		})
+		assert.Error(t, err)
+		assert.Equal(t, []string{"skip"}, control.actions())
 	})
 }
 
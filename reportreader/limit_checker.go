@@ -29,10 +29,18 @@ type limitChecker struct {
 }
 
 func (lc *limitChecker) CheckMessage(m *sarama.ConsumerMessage) bool {
-	if m.Timestamp.After(lc.limitTimestamp) {
-		return false
-	}
-	return lc.CanConsumeMore()
+	lc.mutex.RLock()
+	defer lc.mutex.RUnlock()
+
+	return !m.Timestamp.After(lc.limitTimestamp) && lc.consumedMessages < lc.maxRecords
+}
+
+// SetLimitTimestamp changes the timestamp of the newest message consumed
+func (lc *limitChecker) SetLimitTimestamp(limitTimestamp time.Time) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	lc.limitTimestamp = limitTimestamp
 }
 
 func (lc *limitChecker) MessageProcessed() {
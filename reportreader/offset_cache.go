@@ -156,3 +156,18 @@ func (pt *PartitionTracker) GetPartitionsForTopic(topic string) []int32 {
 
 	return []int32{}
 }
+
+// Offsets returns a copy of the offsets cached for every topic and partition
+func (pt *PartitionTracker) Offsets() map[string]map[int32]int64 {
+	pt.offsetMutex.RLock()
+	defer pt.offsetMutex.RUnlock()
+
+	offsets := make(map[string]map[int32]int64, len(pt.offsets))
+	for topic, partitions := range pt.offsets {
+		offsets[topic] = make(map[int32]int64, len(partitions))
+		for partition, offset := range partitions {
+			offsets[topic][partition] = offset
+		}
+	}
+	return offsets
+}
@@ -183,3 +183,20 @@ func TestPartitionTrackerGetPartitionsForTopic(t *testing.T) {
 	partitions = sut.GetPartitionsForTopic(topicName)
 	assert.Equal(t, []int32{0}, partitions)
 }
+
+func TestPartitionTrackerOffsets(t *testing.T) {
+	sut := reportreader.NewPartitionTracker()
+	assert.Empty(t, sut.Offsets())
+
+	assert.NoError(t, sut.RecordOffset(&sarama.ConsumerMessage{Topic: topicName, Partition: 0, Offset: 10}))
+	assert.NoError(t, sut.RecordOffset(&sarama.ConsumerMessage{Topic: topicName, Partition: 1, Offset: 20}))
+
+	offsets := sut.Offsets()
+	assert.Equal(t, map[string]map[int32]int64{topicName: {0: 10, 1: 20}}, offsets)
+
+	// the returned offsets are a copy
+	offsets[topicName][0] = 100
+	offset, err := sut.GetOffset(topicName, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), offset)
+}
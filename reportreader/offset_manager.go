@@ -41,6 +41,7 @@ func (c *KafkaConsumer) OffsetCommit() error {
 
 			partManager.MarkOffset(offset, "")
 			metrics.OffsetMarked.Inc()
+			metrics.PartitionCommittedOffset.With(metrics.WithPartitionLabels(topic, partition)).Set(float64(offset))
 			log.Debug().
 				Str(topicTag, topic).
 				Int32(partitionTag, partition).
@@ -18,17 +18,25 @@ import (
 	"context"
 	"crypto/sha512"
 	"errors"
+	"fmt"
+	"math"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/RedHatInsights/parquet-factory/dataaggregator"
 
 	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/rs/zerolog/log"
 
 	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/decoder"
 	"github.com/RedHatInsights/parquet-factory/metrics"
+	"github.com/RedHatInsights/parquet-factory/retry"
+	"github.com/RedHatInsights/parquet-factory/tracing"
 	"github.com/RedHatInsights/parquet-factory/utils"
 
 	tlsutils "github.com/RedHatInsights/insights-operator-utils/tls"
@@ -45,6 +53,7 @@ const (
 type KafkaConsumer struct {
 	Topic             string
 	GroupID           string
+	client            sarama.Client
 	consumer          sarama.Consumer      // Defer close it
 	offsetManager     sarama.OffsetManager // Defer close it
 	wg                sync.WaitGroup
@@ -53,6 +62,16 @@ type KafkaConsumer struct {
 	limits            limitChecker
 	consumerTimeout   time.Duration
 	processedMessages *utils.ArchivePathSet
+	retryPolicy       retry.Policy
+	// decoder converts the messages into JSON
+	decoder decoder.Decoder
+	// stopping is closed when a control message stops all the partitions
+	stopping chan struct{}
+	stopOnce sync.Once
+	// stopped and flushed are set by the stop and flush control messages, so
+	// the consumer is only started again after a flush
+	stopped atomic.Bool
+	flushed atomic.Bool
 }
 
 // New constructs a new implementation of a KafkaConsumer
@@ -115,9 +134,16 @@ func New(config conf.KafkaConfig, aggregator dataaggregator.DataAggregator) (*Ka
 
 	log.Debug().Int("Shift", conf.GetConfiguration().TimeShift).Msg("Kafka consumer with timeshift")
 
+	retryPolicy := retry.NewPolicy(conf.GetRetryConfiguration(), config.MaxRetries)
+	messageDecoder, err := decoder.New(config.Decoder, retryPolicy)
+	if err != nil {
+		return nil, err
+	}
+
 	consumer := &KafkaConsumer{
 		Topic:            config.Topic,
 		GroupID:          config.GroupID,
+		client:           client,
 		consumer:         c,
 		offsetManager:    offsetManager,
 		wg:               sync.WaitGroup{},
@@ -133,6 +159,9 @@ func New(config conf.KafkaConfig, aggregator dataaggregator.DataAggregator) (*Ka
 		},
 		consumerTimeout:   time.Duration(config.ConsumerTimeout) * time.Second,
 		processedMessages: utils.NewArchivePathSet(),
+		retryPolicy:       retryPolicy,
+		decoder:           messageDecoder,
+		stopping:          make(chan struct{}),
 	}
 
 	err = consumer.getInitialOffsetTracker()
@@ -157,7 +186,10 @@ func (c *KafkaConsumer) Start() context.Context {
 			go func(partition int32) {
 				if err := c.consumePartition(partition); err != nil {
 					log.Error().Err(err).Msgf("error consuming partition %d", partition)
-					cancel()
+					// the other partitions are drained like after a stop
+					// message, so the results are only written once all of
+					// them finished
+					c.stopOnError()
 				}
 			}(partition)
 		}
@@ -175,14 +207,32 @@ func (c *KafkaConsumer) Start() context.Context {
 }
 
 //gocyclo:ignore
-func (c *KafkaConsumer) consumePartition(p int32) error {
+func (c *KafkaConsumer) consumePartition(p int32) (err error) {
 	defer c.wg.Done()
+
+	_, span := tracing.StartSpan("consume_partition",
+		tracing.TopicKey.String(c.Topic), tracing.PartitionKey.Int64(int64(p)))
+	if offset, offsetErr := c.partitionTracker.GetOffset(c.Topic, p); offsetErr == nil {
+		span.SetAttributes(tracing.StartOffsetKey.Int64(offset))
+	}
+	defer func() {
+		if offset, offsetErr := c.partitionTracker.GetOffset(c.Topic, p); offsetErr == nil {
+			span.SetAttributes(tracing.OffsetKey.Int64(offset))
+		}
+		tracing.EndSpan(span, err)
+	}()
+
+	restarts := 0
 	for {
 		// Check if we've already reached the limit before starting to consume
 		if !c.limits.CanConsumeMore() {
 			log.Info().Msg("Limit reached before consuming any messages. Exiting consumer.")
 			return nil
 		}
+		if c.stopRequested() {
+			log.Info().Str(topicTag, c.Topic).Int32(partitionTag, p).Msg("Stop requested before consuming. Exiting consumer.")
+			return nil
+		}
 
 		// Get the offset from the offset tracker for the current partition
 		offset, err := c.partitionTracker.GetOffset(c.Topic, p)
@@ -191,16 +241,46 @@ func (c *KafkaConsumer) consumePartition(p int32) error {
 			return err
 		}
 
-		pConsumer, err := c.initPartitionConsumer(p, offset)
+		var pConsumer sarama.PartitionConsumer
+		err = c.retryPolicy.Do(context.Background(), "consume_partition", func() (err error) {
+			pConsumer, err = c.initPartitionConsumer(p, offset)
+			return err
+		})
 		if err != nil {
 			log.Warn().Err(err).Str(topicTag, c.Topic).Int32(partitionTag, p).Msg("Cannot consume topic/partition")
 			return err
 		}
 
-		for m := range pConsumer.Messages() {
+		consumed := false
+		for {
+			m, ok := c.nextMessage(pConsumer)
+			if !ok {
+				break
+			}
+			consumed = true
+			recordMessageMetrics(pConsumer, m)
+
 			// check it's offset is lower than the marked offset
 			if c.checkOffset(m) {
 				consumerLog(log.Warn(), m, "This offset is lower than the stored one")
+				metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonOffsetBehind)).Inc()
+				continue
+			}
+
+			// the control messages are handled before the limits, so they
+			// can change the limit timestamp
+			control, err := parseControlHeaders(m)
+			if err != nil {
+				consumerLog(log.Warn().Err(err), m, "Ignoring the invalid control headers")
+				metrics.ControlMessages.With(metrics.WithActionLabel(metrics.ControlInvalid)).Inc()
+			}
+			if control.isControl() {
+				if err := c.handleControl(m, control); err != nil {
+					return err
+				}
+				if control.finishes() {
+					return nil
+				}
 				continue
 			}
 
@@ -210,25 +290,44 @@ func (c *KafkaConsumer) consumePartition(p int32) error {
 				return nil
 			}
 
-			if checkHeaders(m) {
-				consumerLog(log.Info(), m, "I've been asked to aggregate all messages.FINISH")
-				return c.markMessage(m)
-			}
-
-			// check if message has been already processed in current run
-			path, err := utils.GetPathFromRawMsg(m.Value)
-			if err != nil {
-				log.Error().Err(err).Msg("can't retrieve path from kafka message, skipping")
+			// the message is read as JSON from now on
+			if err := c.decodeMessage(m); err != nil {
+				var schemaErr *decoder.SchemaError
+				if errors.As(err, &schemaErr) {
+					// the message may be decoded later, don't skip it
+					consumerLog(log.Error().Err(err), m, "Unable to fetch the schema of the message")
+					return err
+				}
+				consumerLog(log.Error().Err(err), m, "Unable to decode the message, skipping")
+				metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonUndecodable)).Inc()
 				continue
 			}
-			if !c.processedMessages.Add(path) {
-				log.Warn().Msg("factory was about to duplicate a row, skipping")
-				continue
+
+			// check if message has been already processed in current run. The
+			// claim checks are checked by the aggregator once their report
+			// is fetched, as they don't have a path.
+			if !isClaimCheck(m.Value) {
+				path, err := utils.GetPathFromRawMsg(m.Value)
+				if err != nil {
+					log.Error().Err(err).Msg("can't retrieve path from kafka message, skipping")
+					metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonMissingPath)).Inc()
+					continue
+				}
+				if !c.processedMessages.Add(path) {
+					log.Warn().Msg("factory was about to duplicate a row, skipping")
+					metrics.MessagesRejected.With(metrics.WithReasonLabel(metrics.ReasonDuplicate)).Inc()
+					continue
+				}
 			}
 
 			// Process message
 			consumerLog(log.Info(), m, "message processed")
-			if err := c.Aggregator.Handle(m.Value); err != nil {
+			if err := c.Aggregator.Handle(m); err != nil {
+				if retry.IsRetryable(err) {
+					// the message may be handled later, don't skip it
+					consumerLog(log.Error().Err(err), m, "Unable to handle the message yet")
+					return err
+				}
 				log.Error().Err(err).Msg("Unable to dispatch event")
 				continue
 			}
@@ -238,6 +337,131 @@ func (c *KafkaConsumer) consumePartition(p int32) error {
 		}
 
 		pConsumer.AsyncClose()
+
+		if c.stopRequested() {
+			log.Info().Str(topicTag, c.Topic).Int32(partitionTag, p).Msg("Stop requested by a control message. FINISH")
+			return nil
+		}
+
+		// the partition consumer stopped before reaching any limit, restart it.
+		// Only the restarts without consuming any message in between are
+		// delayed, and they fail the partition once there are more than the
+		// maximum number of retries in a row, if it is configured.
+		if consumed {
+			restarts = 0
+			log.Warn().Str(topicTag, c.Topic).Int32(partitionTag, p).Msg("The partition consumer stopped, restarting it")
+			continue
+		}
+		restarts++
+		if c.retryPolicy.MaxRetries > 0 && restarts > c.retryPolicy.MaxRetries {
+			err = fmt.Errorf("the partition consumer stopped %d times in a row without consuming any message", restarts)
+			log.Error().Err(err).Str(topicTag, c.Topic).Int32(partitionTag, p).Msg("Giving up consuming topic/partition")
+			return err
+		}
+		backoff := c.retryPolicy.Backoff(restarts)
+		log.Warn().Str(topicTag, c.Topic).Int32(partitionTag, p).Dur("backoff", backoff).
+			Msg("The partition consumer stopped, restarting it")
+		time.Sleep(backoff)
+	}
+}
+
+// nextMessage returns the next message of the partition consumer. It returns
+// false if the partition consumer stopped or if the partitions were asked to
+// stop.
+func (c *KafkaConsumer) nextMessage(pConsumer sarama.PartitionConsumer) (*sarama.ConsumerMessage, bool) {
+	// the stop has priority over the messages already received
+	if c.stopRequested() {
+		return nil, false
+	}
+	select {
+	case <-c.stopping:
+		return nil, false
+	case m, ok := <-pConsumer.Messages():
+		return m, ok
+	}
+}
+
+// decodeMessage replaces the value of the message by its JSON representation
+func (c *KafkaConsumer) decodeMessage(m *sarama.ConsumerMessage) error {
+	if c.decoder == nil {
+		return nil
+	}
+	value, err := c.decoder.Decode(m.Value)
+	if err != nil {
+		return err
+	}
+	m.Value = value
+	return nil
+}
+
+// handleControl applies the actions requested by a control message, which is
+// never aggregated, and records its offset
+func (c *KafkaConsumer) handleControl(m *sarama.ConsumerMessage, control controlMessage) error {
+	for _, action := range control.actions() {
+		metrics.ControlMessages.With(metrics.WithActionLabel(action)).Inc()
+	}
+
+	if !control.reprocessUntil.IsZero() {
+		c.limits.SetLimitTimestamp(control.reprocessUntil)
+		consumerLog(log.Info().Time("limit_timestamp", control.reprocessUntil), m,
+			"Control message: the limit timestamp was changed")
+	}
+	switch {
+	case control.stop:
+		c.stopped.Store(true)
+		consumerLog(log.Info(), m, "Control message: stopping all the partitions. FINISH")
+	case control.flush:
+		c.flushed.Store(true)
+		consumerLog(log.Info(), m, "Control message: stopping all the partitions to write the files and commit the offsets. FINISH")
+	case control.skip:
+		consumerLog(log.Info(), m, "Control message: skipping the message")
+	}
+
+	if err := c.recordOffset(m); err != nil {
+		return err
+	}
+	if control.finishes() {
+		c.requestStop()
+	}
+	return nil
+}
+
+// requestStop makes all the partitions stop consuming
+func (c *KafkaConsumer) requestStop() {
+	c.stopOnce.Do(func() {
+		close(c.stopping)
+	})
+}
+
+// FlushRequested returns true if a flush control message stopped the
+// partitions, and no stop one, so the consumer must be resumed once the
+// results are written and the offsets committed
+func (c *KafkaConsumer) FlushRequested() bool {
+	return c.flushed.Load() && !c.stopped.Load()
+}
+
+// Resume lets the partitions consume again after a flush. It must be called
+// once all the partition consumers finished.
+func (c *KafkaConsumer) Resume() {
+	c.stopping = make(chan struct{})
+	c.stopOnce = sync.Once{}
+	c.flushed.Store(false)
+}
+
+// stopOnError stops all the partitions when one of them fails, ending the run
+// even if a flush was requested
+func (c *KafkaConsumer) stopOnError() {
+	c.stopped.Store(true)
+	c.requestStop()
+}
+
+// stopRequested returns true if the partitions were asked to stop
+func (c *KafkaConsumer) stopRequested() bool {
+	select {
+	case <-c.stopping:
+		return true
+	default:
+		return false
 	}
 }
 
@@ -254,9 +478,42 @@ func (c *KafkaConsumer) checkOffset(m *sarama.ConsumerMessage) bool {
 	return m.Offset <= lastOffsetStored
 }
 
+// recordMessageMetrics updates the partition metrics with a consumed message
+func recordMessageMetrics(pConsumer sarama.PartitionConsumer, m *sarama.ConsumerMessage) {
+	labels := metrics.WithPartitionLabels(m.Topic, m.Partition)
+	highWaterMark := pConsumer.HighWaterMarkOffset()
+	metrics.PartitionHighWaterMark.With(labels).Set(float64(highWaterMark))
+	// the high water mark is the offset of the next message to be produced
+	if lag := highWaterMark - m.Offset - 1; lag >= 0 {
+		metrics.PartitionLag.With(labels).Set(float64(lag))
+	}
+
+	if m.Timestamp.IsZero() {
+		return
+	}
+	newest := metrics.PartitionNewestMessageTimestamp.With(labels)
+	newest.Set(math.Max(newestTimestamp(newest), float64(m.Timestamp.Unix())))
+	metrics.MessageAge.Observe(time.Since(m.Timestamp).Seconds())
+}
+
+// newestTimestamp returns the current value of the newest message timestamp gauge
+func newestTimestamp(gauge prometheus.Gauge) float64 {
+	metric := &dto.Metric{}
+	if err := gauge.Write(metric); err != nil {
+		return 0
+	}
+	return metric.GetGauge().GetValue()
+}
+
 func (c *KafkaConsumer) markMessage(m *sarama.ConsumerMessage) error {
 	// Increase the number of messages processed on this topic
 	c.limits.MessageProcessed()
+	return c.recordOffset(m)
+}
+
+// recordOffset marks the message as consumed, without counting it against the
+// max_consumed_records limit
+func (c *KafkaConsumer) recordOffset(m *sarama.ConsumerMessage) error {
 	consumerLog(log.Debug(), m, "marked processed")
 	metrics.OffsetProcessed.Inc()
 	// Mark offset
@@ -351,6 +608,19 @@ func changeOffsetIfNotNewestOrOldest(offset int64) (newOffset int64) {
 	return
 }
 
+// Offsets returns the last offset processed in every partition
+func (c *KafkaConsumer) Offsets() map[string]map[int32]int64 {
+	return c.partitionTracker.Offsets()
+}
+
+// Ping returns an error if the Kafka brokers can't be reached
+func (c *KafkaConsumer) Ping(_ context.Context) error {
+	if c.client == nil || c.client.Closed() {
+		return errors.New("the Kafka client is not connected")
+	}
+	return c.client.RefreshMetadata(c.Topic)
+}
+
 // Close closes the Kafka consumer and releases all resources
 func (c *KafkaConsumer) Close() error {
 	if c.consumer != nil {
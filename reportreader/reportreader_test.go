@@ -15,6 +15,7 @@
 package reportreader_test
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -244,3 +245,23 @@ func GetHandlersMapTopicDoesNotExists(t testing.TB, mockBroker *sarama.MockBroke
 			SetLeader(topicName+"_non_existent", 0, mockBroker.BrokerID()),
 	}
 }
+
+func TestPing(t *testing.T) {
+	topic := "topic"
+	mockBroker := testhelpers.NewBrokerWithTopic(t, topic)
+	defer mockBroker.Close()
+
+	consumer, err := reportreader.New(conf.KafkaConfig{
+		Addresses: []string{mockBroker.Addr()},
+		Topic:     topic,
+	}, rulereportaggregator.NewRulesReportAggregator())
+	assert.NoError(t, err)
+
+	assert.NoError(t, consumer.Ping(context.Background()))
+	assert.NotNil(t, consumer.Offsets()[topic])
+
+	t.Run("consumer without client", func(t *testing.T) {
+		consumer := &reportreader.KafkaConsumer{Topic: topic}
+		assert.Error(t, consumer.Ping(context.Background()))
+	})
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/IBM/sarama"
 	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/decoder"
 	"github.com/RedHatInsights/parquet-factory/reportaggregators/rulereportaggregator"
 	"github.com/rs/zerolog"
 )
@@ -43,18 +44,37 @@ func consumerLog(event *zerolog.Event, m *sarama.ConsumerMessage, logMsg string)
 
 	switch m.Topic {
 	case config.RulesKafkaConsumer.Topic:
-		var parsed rulereportaggregator.RulesResultsReport
-		if err := json.Unmarshal(m.Value, &parsed); err != nil {
-			event = event.
-				Str(archiveTag, cannotParseMsg).
-				Str(contentTag, string(m.Value))
-		} else {
-			event = event.Str(archiveTag, parsed.Path)
-		}
+		event = archiveLog(event, m.Value, config.RulesKafkaConsumer.Decoder.Format)
 	}
 	event.Msg(logMsg)
 }
 
+// archiveLog adds the path of the archive of the report to the log event. The
+// messages of the topics in other formats than JSON are only parsed once they
+// are decoded, so their binary content is never logged.
+func archiveLog(event *zerolog.Event, value []byte, format string) *zerolog.Event {
+	if format != "" && format != decoder.JSONFormat && !json.Valid(value) {
+		return event
+	}
+
+	var parsed rulereportaggregator.RulesResultsReport
+	if err := json.Unmarshal(value, &parsed); err != nil {
+		return event.
+			Str(archiveTag, cannotParseMsg).
+			Str(contentTag, string(value))
+	}
+	return event.Str(archiveTag, parsed.Path)
+}
+
+// isClaimCheck returns true if the message references a report stored in the
+// bucket instead of including it
+func isClaimCheck(value []byte) bool {
+	var parsed struct {
+		ClaimCheck json.RawMessage `json:"claim_check"`
+	}
+	return json.Unmarshal(value, &parsed) == nil && len(parsed.ClaimCheck) > 0 && string(parsed.ClaimCheck) != "null"
+}
+
 // waitTimeout waits for the waitgroup for the specified max timeout.
 // Returns true if waiting timed out.
 func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
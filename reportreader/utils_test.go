@@ -31,6 +31,7 @@ import (
 	"github.com/tisnik/go-capture"
 
 	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/decoder"
 	"github.com/RedHatInsights/parquet-factory/reportaggregators/rulereportaggregator"
 )
 
@@ -100,6 +101,63 @@ func TestConsumerLog(t *testing.T) {
 	}
 }
 
+func TestArchiveLog(t *testing.T) {
+	binaryValue := []byte{0, 0, 0, 0, 1, 0xff, 0xfe}
+
+	testCases := []struct {
+		name     string
+		value    []byte
+		format   string
+		expected []string
+		excluded []string
+	}{
+		{
+			name:     "JSON message",
+			value:    structToBytes(ruleReport),
+			expected: []string{testPath},
+		},
+		{
+			name:     "invalid JSON message",
+			value:    []byte("not JSON"),
+			format:   decoder.JSONFormat,
+			expected: []string{cannotParseMsg, "not JSON"},
+		},
+		{
+			name:     "Avro message not decoded yet",
+			value:    binaryValue,
+			format:   decoder.AvroFormat,
+			excluded: []string{cannotParseMsg, contentTag},
+		},
+		{
+			name:     "decoded Avro message",
+			value:    structToBytes(ruleReport),
+			format:   decoder.AvroFormat,
+			expected: []string{testPath},
+		},
+		{
+			name:     "Protobuf message not decoded yet",
+			value:    binaryValue,
+			format:   decoder.ProtobufFormat,
+			excluded: []string{cannotParseMsg, contentTag},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			logger := zerolog.New(output)
+			archiveLog(logger.Info(), tc.value, tc.format).Msg(logMessage)
+
+			for _, expected := range tc.expected {
+				assert.Contains(t, output.String(), expected)
+			}
+			for _, excluded := range tc.excluded {
+				assert.NotContains(t, output.String(), excluded)
+			}
+		})
+	}
+}
+
 func TestWaitTimeout(t *testing.T) {
 	t.Run("timed out", func(t *testing.T) {
 		wg := sync.WaitGroup{}
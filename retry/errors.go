@@ -0,0 +1,93 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/IBM/sarama"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsretry "github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// retryableKafkaErrors are the Kafka errors caused by brokers or partition
+// leaders being temporarily unavailable
+var retryableKafkaErrors = []error{
+	sarama.ErrOutOfBrokers,
+	sarama.ErrNotConnected,
+	sarama.ErrLeaderNotAvailable,
+	sarama.ErrNotLeaderForPartition,
+	sarama.ErrRequestTimedOut,
+	sarama.ErrBrokerNotAvailable,
+	sarama.ErrNetworkException,
+	sarama.ErrNotEnoughReplicas,
+	sarama.ErrNotEnoughReplicasAfterAppend,
+	sarama.ErrOffsetsLoadInProgress,
+	sarama.ErrConsumerCoordinatorNotAvailable,
+	sarama.ErrNotCoordinatorForConsumer,
+}
+
+// awsRetryables classifies the S3 errors the same way the AWS SDK does,
+// including throttling, 5xx responses and connection errors, plus the S3
+// server errors that may be returned without the HTTP response
+var awsRetryables = awsretry.IsErrorRetryables(append([]awsretry.IsErrorRetryable{
+	awsretry.RetryableErrorCode{Codes: map[string]struct{}{
+		"InternalError":      {},
+		"ServiceUnavailable": {},
+		"SlowDown":           {},
+	}},
+}, awsretry.DefaultRetryables...))
+
+// Classified is implemented by the errors that know whether they are
+// worth retrying
+type Classified interface {
+	Retryable() bool
+}
+
+// IsRetryable returns true if the error is likely to be transient: network
+// errors, S3 throttling and server errors, and Kafka brokers or leaders not
+// being available. Cancelled operations and any other error are not retried,
+// unless the error implements Classified.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var classified Classified
+	if errors.As(err, &classified) {
+		return classified.Retryable()
+	}
+
+	for _, kafkaErr := range retryableKafkaErrors {
+		if errors.Is(err, kafkaErr) {
+			return true
+		}
+	}
+
+	switch awsRetryables.IsErrorRetryable(err) {
+	case aws.TrueTernary:
+		return true
+	case aws.FalseTernary:
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,123 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package retry implements the policy used to retry the S3 and Kafka
+// operations that fail because of transient errors, waiting an exponential
+// backoff with jitter between the attempts.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+)
+
+// Default values used when they are not configured
+const (
+	DefaultInitialBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff     = 30 * time.Second
+	DefaultMultiplier     = 2.0
+	DefaultJitter         = 0.2
+)
+
+// Policy defines how many times a failed operation is retried and how long
+// to wait between the attempts
+type Policy struct {
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+	// InitialBackoff is the time waited before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff is the longest time waited between two attempts
+	MaxBackoff time.Duration
+	// Multiplier increases the backoff after every retry
+	Multiplier float64
+	// Jitter is the fraction of the backoff randomly added or subtracted
+	Jitter float64
+	// Retryable returns true for the errors worth retrying. IsRetryable is
+	// used if it isn't set.
+	Retryable func(error) bool
+}
+
+// NewPolicy returns the policy retrying an operation the given number of
+// times with the configured backoff
+func NewPolicy(config conf.RetryConfig, maxRetries int) Policy {
+	policy := Policy{
+		MaxRetries:     max(maxRetries, 0),
+		InitialBackoff: time.Duration(config.InitialBackoff) * time.Millisecond,
+		MaxBackoff:     time.Duration(config.MaxBackoff) * time.Millisecond,
+		Multiplier:     config.Multiplier,
+		Jitter:         config.Jitter,
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultInitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultMaxBackoff
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = DefaultMultiplier
+	}
+	if policy.Jitter <= 0 || policy.Jitter >= 1 {
+		policy.Jitter = DefaultJitter
+	}
+	return policy
+}
+
+// Backoff returns the time to wait before the given retry, starting from 1
+func (policy Policy) Backoff(retry int) time.Duration {
+	backoff := float64(policy.InitialBackoff) * math.Pow(policy.Multiplier, float64(retry-1))
+	if policy.MaxBackoff > 0 {
+		backoff = math.Min(backoff, float64(policy.MaxBackoff))
+	}
+	if policy.Jitter > 0 {
+		backoff *= 1 + policy.Jitter*(2*rand.Float64()-1) // #nosec G404 -- not used for security
+	}
+	return time.Duration(backoff)
+}
+
+// Do runs the operation until it succeeds, it fails with an error that isn't
+// retryable or the retries are exhausted. The error of the last attempt is
+// returned.
+func (policy Policy) Do(ctx context.Context, operation string, fn func() error) error {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+
+	for retry := 1; ; retry++ {
+		err := fn()
+		if err == nil || retry > policy.MaxRetries || !retryable(err) {
+			return err
+		}
+
+		backoff := policy.Backoff(retry)
+		log.Warn().Err(err).Str("operation", operation).Int("retry", retry).
+			Int("max_retries", policy.MaxRetries).Dur("backoff", backoff).
+			Msg("Operation failed, retrying")
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
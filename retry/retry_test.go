@@ -0,0 +1,156 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/retry"
+)
+
+var errTransient = &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+
+func fastPolicy(maxRetries int) retry.Policy {
+	return retry.Policy{MaxRetries: maxRetries, InitialBackoff: time.Microsecond, Multiplier: 2}
+}
+
+func TestNewPolicy(t *testing.T) {
+	policy := retry.NewPolicy(conf.RetryConfig{}, -1)
+	assert.Equal(t, 0, policy.MaxRetries)
+	assert.Equal(t, retry.DefaultInitialBackoff, policy.InitialBackoff)
+	assert.Equal(t, retry.DefaultMaxBackoff, policy.MaxBackoff)
+	assert.Equal(t, retry.DefaultMultiplier, policy.Multiplier)
+	assert.Equal(t, retry.DefaultJitter, policy.Jitter)
+
+	policy = retry.NewPolicy(conf.RetryConfig{InitialBackoff: 10, MaxBackoff: 100, Multiplier: 3, Jitter: 0.5}, 4)
+	assert.Equal(t, 4, policy.MaxRetries)
+	assert.Equal(t, 10*time.Millisecond, policy.InitialBackoff)
+	assert.Equal(t, 100*time.Millisecond, policy.MaxBackoff)
+	assert.Equal(t, 3.0, policy.Multiplier)
+	assert.Equal(t, 0.5, policy.Jitter)
+}
+
+func TestBackoff(t *testing.T) {
+	policy := retry.Policy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 4*time.Second, policy.Backoff(3))
+	assert.Equal(t, 5*time.Second, policy.Backoff(10))
+
+	policy.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		backoff := policy.Backoff(2)
+		assert.GreaterOrEqual(t, backoff, 1600*time.Millisecond)
+		assert.LessOrEqual(t, backoff, 2400*time.Millisecond)
+	}
+}
+
+func TestDo(t *testing.T) {
+	t.Run("succeeds after transient errors", func(t *testing.T) {
+		attempts := 0
+		err := fastPolicy(3).Do(context.Background(), "test", func() error {
+			attempts++
+			if attempts < 3 {
+				return errTransient
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("gives up after the maximum retries", func(t *testing.T) {
+		attempts := 0
+		err := fastPolicy(2).Do(context.Background(), "test", func() error {
+			attempts++
+			return errTransient
+		})
+		assert.ErrorIs(t, err, errTransient)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("doesn't retry permanent errors", func(t *testing.T) {
+		attempts := 0
+		err := fastPolicy(2).Do(context.Background(), "test", func() error {
+			attempts++
+			return errors.New("permanent")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("stops when the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		policy := retry.Policy{MaxRetries: 5, InitialBackoff: time.Hour, Multiplier: 2}
+		attempts := 0
+		err := policy.Do(ctx, "test", func() error {
+			attempts++
+			cancel()
+			return errTransient
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("custom classification", func(t *testing.T) {
+		policy := fastPolicy(1)
+		policy.Retryable = func(error) bool { return true }
+		attempts := 0
+		_ = policy.Do(context.Background(), "test", func() error {
+			attempts++
+			return errors.New("permanent")
+		})
+		assert.Equal(t, 2, attempts)
+	})
+}
+
+// classifiedError knows whether it's worth retrying
+type classifiedError bool
+
+func (err classifiedError) Error() string   { return "classified" }
+func (err classifiedError) Retryable() bool { return bool(err) }
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{errors.New("unknown"), false},
+		{context.Canceled, false},
+		{errTransient, true},
+		{fmt.Errorf("wrapped: %w", errTransient), true},
+		{sarama.ErrLeaderNotAvailable, true},
+		{sarama.ErrOutOfBrokers, true},
+		{sarama.ErrUnknownTopicOrPartition, false},
+		{&smithy.GenericAPIError{Code: "SlowDown"}, true},
+		{&smithy.GenericAPIError{Code: "InternalError"}, true},
+		{&smithy.GenericAPIError{Code: "AccessDenied"}, false},
+		{classifiedError(true), true},
+		{fmt.Errorf("wrapped: %w", classifiedError(false)), false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.retryable, retry.IsRetryable(tc.err), "%v", tc.err)
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package runreport records what happened during a run of the service, so it
+// can be stored next to the generated tables as an audit record.
+package runreport
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+const (
+	// Folder is the folder, relative to the configured prefix, where the
+	// run reports are stored
+	Folder = "_runs"
+
+	timestampLayout = "20060102T150405Z"
+)
+
+// BuildInfo identifies the build of the service that performed the run
+type BuildInfo struct {
+	Version string `json:"version"`
+	Time    string `json:"time"`
+	Branch  string `json:"branch"`
+	Commit  string `json:"commit"`
+}
+
+// PartitionOffsets stores the offsets of a partition when the run started
+// and when it finished
+type PartitionOffsets struct {
+	Topic       string `json:"topic"`
+	Partition   int32  `json:"partition"`
+	StartOffset int64  `json:"start_offset"`
+	EndOffset   int64  `json:"end_offset"`
+}
+
+// MessageCounts stores the number of messages read during the run
+type MessageCounts struct {
+	Consumed  int64            `json:"consumed"`
+	Processed int64            `json:"processed"`
+	Rejected  map[string]int64 `json:"rejected"`
+	// Control is the number of control messages by action
+	Control map[string]int64 `json:"control,omitempty"`
+}
+
+// File is a parquet file written during the run
+type File struct {
+	Table string    `json:"table"`
+	Hour  time.Time `json:"hour"`
+	Key   string    `json:"key"`
+	Rows  int64     `json:"rows"`
+}
+
+// Report is the audit record of a run
+type Report struct {
+	RunID           string             `json:"run_id"`
+	Build           BuildInfo          `json:"build"`
+	ConfigHash      string             `json:"config_hash"`
+	StartedAt       time.Time          `json:"started_at"`
+	FinishedAt      time.Time          `json:"finished_at"`
+	DurationSeconds float64            `json:"duration_seconds"`
+	PhaseDurations  map[string]float64 `json:"phase_durations_seconds"`
+	ExitCode        int                `json:"exit_code"`
+	Partitions      []PartitionOffsets `json:"partitions"`
+	Messages        MessageCounts      `json:"messages"`
+	Files           []File             `json:"files"`
+	UndeletedFiles  []string           `json:"undeleted_files"`
+}
+
+// Key returns the key of the report in the bucket, under the given prefix
+func (report *Report) Key(prefix string) string {
+	name := report.StartedAt.UTC().Format(timestampLayout) + "-" + report.RunID + ".json"
+	return path.Join(prefix, Folder, name)
+}
+
+// ObjectWriter stores an object in the bucket
+type ObjectWriter interface {
+	WriteObject(context.Context, string, []byte, s3writer.ObjectOptions) error
+}
+
+// Write stores the report in the bucket under the given prefix
+func (report *Report) Write(ctx context.Context, writer ObjectWriter, prefix string) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to encode the run report")
+		return err
+	}
+
+	key := report.Key(prefix)
+	options := s3writer.ObjectOptions{Tags: map[string]string{s3writer.RunIDTag: report.RunID}}
+	if err := writer.WriteObject(ctx, key, content, options); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Unable to write the run report")
+		return err
+	}
+	log.Info().Str("key", key).Msg("Run report written")
+	return nil
+}
+
+// Recorder collects the information of a run while it is running
+type Recorder struct {
+	mutex   sync.Mutex
+	report  Report
+	offsets map[string]map[int32]*PartitionOffsets
+}
+
+// NewRecorder starts recording a new run
+func NewRecorder(runID string, build BuildInfo, configHash string, startedAt time.Time) *Recorder {
+	return &Recorder{
+		report: Report{
+			RunID:          runID,
+			Build:          build,
+			ConfigHash:     configHash,
+			StartedAt:      startedAt,
+			Files:          []File{},
+			UndeletedFiles: []string{},
+		},
+		offsets: map[string]map[int32]*PartitionOffsets{},
+	}
+}
+
+// RunID returns the identifier of the recorded run
+func (recorder *Recorder) RunID() string {
+	return recorder.report.RunID
+}
+
+// RecordStartOffsets stores the offsets of every partition before consuming
+func (recorder *Recorder) RecordStartOffsets(offsets map[string]map[int32]int64) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			partitionOffsets := recorder.partitionOffsets(topic, partition)
+			partitionOffsets.StartOffset = offset
+			partitionOffsets.EndOffset = offset
+		}
+	}
+}
+
+// RecordEndOffsets stores the offsets of every partition after consuming
+func (recorder *Recorder) RecordEndOffsets(offsets map[string]map[int32]int64) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			recorder.partitionOffsets(topic, partition).EndOffset = offset
+		}
+	}
+}
+
+// partitionOffsets returns the offsets of the given partition, adding them if
+// they weren't tracked yet. The caller must hold the mutex.
+func (recorder *Recorder) partitionOffsets(topic string, partition int32) *PartitionOffsets {
+	partitions, ok := recorder.offsets[topic]
+	if !ok {
+		partitions = map[int32]*PartitionOffsets{}
+		recorder.offsets[topic] = partitions
+	}
+	offsets, ok := partitions[partition]
+	if !ok {
+		offsets = &PartitionOffsets{Topic: topic, Partition: partition}
+		partitions[partition] = offsets
+	}
+	return offsets
+}
+
+// RecordFile stores a parquet file written during the run
+func (recorder *Recorder) RecordFile(table string, hour time.Time, key string, rows int64) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.report.Files = append(recorder.report.Files, File{
+		Table: table,
+		Hour:  hour.UTC(),
+		Key:   key,
+		Rows:  rows,
+	})
+}
+
+// RemoveFiles removes the files rolled back after a failure during the run.
+// The ones that couldn't be deleted are recorded as undeleted files instead.
+func (recorder *Recorder) RemoveFiles(keys []string) {
+	removed := map[string]bool{}
+	for _, key := range keys {
+		removed[key] = true
+	}
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	kept := []File{}
+	for _, file := range recorder.report.Files {
+		if !removed[file.Key] {
+			kept = append(kept, file)
+		}
+	}
+	recorder.report.Files = kept
+}
+
+// RecordUndeletedFiles stores the keys of the files that couldn't be deleted
+// after a failure during the run
+func (recorder *Recorder) RecordUndeletedFiles(keys []string) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.report.UndeletedFiles = append(recorder.report.UndeletedFiles, keys...)
+}
+
+// Finish completes the recorded information and returns the report of the run
+func (recorder *Recorder) Finish(
+	exitCode int, finishedAt time.Time, messages MessageCounts, phaseDurations map[string]float64,
+) Report {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	report := recorder.report
+	report.ExitCode = exitCode
+	report.FinishedAt = finishedAt
+	report.DurationSeconds = finishedAt.Sub(report.StartedAt).Seconds()
+	report.Messages = messages
+	report.PhaseDurations = phaseDurations
+
+	report.Partitions = []PartitionOffsets{}
+	for _, partitions := range recorder.offsets {
+		for _, offsets := range partitions {
+			report.Partitions = append(report.Partitions, *offsets)
+		}
+	}
+	sort.Slice(report.Partitions, func(i, j int) bool {
+		if report.Partitions[i].Topic != report.Partitions[j].Topic {
+			return report.Partitions[i].Topic < report.Partitions[j].Topic
+		}
+		return report.Partitions[i].Partition < report.Partitions[j].Partition
+	})
+	report.Files = append([]File{}, recorder.report.Files...)
+	report.UndeletedFiles = append([]string{}, recorder.report.UndeletedFiles...)
+	return report
+}
+
+var (
+	currentMutex sync.RWMutex
+	current      *Recorder
+)
+
+// Start begins recording a new run, which becomes the current one
+func Start(runID string, build BuildInfo, configHash string) *Recorder {
+	recorder := NewRecorder(runID, build, configHash, time.Now().UTC())
+
+	currentMutex.Lock()
+	defer currentMutex.Unlock()
+	current = recorder
+	return recorder
+}
+
+// Current returns the recorder of the current run, nil if no run started
+func Current() *Recorder {
+	currentMutex.RLock()
+	defer currentMutex.RUnlock()
+	return current
+}
+
+// CurrentRunID returns the identifier of the current run, or an empty string
+// if no run started
+func CurrentRunID() string {
+	if recorder := Current(); recorder != nil {
+		return recorder.RunID()
+	}
+	return ""
+}
+
+// RecordFile stores a parquet file written during the current run, if any
+func RecordFile(table string, hour time.Time, key string, rows int64) {
+	if recorder := Current(); recorder != nil {
+		recorder.RecordFile(table, hour, key, rows)
+	}
+}
+
+// RemoveFiles removes the files rolled back during the current run, if any
+func RemoveFiles(keys []string) {
+	if recorder := Current(); recorder != nil {
+		recorder.RemoveFiles(keys)
+	}
+}
+
+// RecordUndeletedFiles stores the keys of the files that couldn't be deleted
+// during the current run, if any
+func RecordUndeletedFiles(keys []string) {
+	if recorder := Current(); recorder != nil {
+		recorder.RecordUndeletedFiles(keys)
+	}
+}
+
+// NewRunID returns a random identifier for a run
+func NewRunID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		log.Error().Err(err).Msg("Unable to generate a random run ID")
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// ConfigHash returns a hash identifying the given configuration
+func ConfigHash(config interface{}) string {
+	content, err := json.Marshal(config)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to encode the configuration")
+		return ""
+	}
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,131 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runreport_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/runreport"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+var (
+	startedAt = time.Date(2026, time.March, 4, 5, 6, 7, 0, time.UTC)
+	testBuild = runreport.BuildInfo{Version: "1.0", Commit: "abc"}
+)
+
+type memoryWriter struct {
+	objects map[string][]byte
+	options map[string]s3writer.ObjectOptions
+	err     error
+}
+
+func newMemoryWriter() *memoryWriter {
+	return &memoryWriter{objects: map[string][]byte{}, options: map[string]s3writer.ObjectOptions{}}
+}
+
+func (w *memoryWriter) WriteObject(_ context.Context, key string, content []byte, options s3writer.ObjectOptions) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.objects[key] = content
+	w.options[key] = options
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := runreport.NewRecorder("run1", testBuild, "hash", startedAt)
+	recorder.RecordStartOffsets(map[string]map[int32]int64{"topic": {1: 10, 0: 5}})
+	recorder.RecordFile("rule_hits", startedAt.Truncate(time.Hour), "prefix/rule_hits/0.parquet", 3)
+	recorder.RecordEndOffsets(map[string]map[int32]int64{"topic": {0: 8}})
+	recorder.RecordFile("archives", startedAt.Truncate(time.Hour), "prefix/archives/0.parquet", 1)
+	recorder.RemoveFiles([]string{"prefix/archives/0.parquet"})
+	recorder.RecordUndeletedFiles([]string{"prefix/archives/0.parquet"})
+
+	report := recorder.Finish(2, startedAt.Add(time.Minute),
+		runreport.MessageCounts{Consumed: 3, Processed: 3, Rejected: map[string]int64{"duplicate": 1}},
+		map[string]float64{"consume": 40})
+
+	assert.Equal(t, "run1", report.RunID)
+	assert.Equal(t, testBuild, report.Build)
+	assert.Equal(t, "hash", report.ConfigHash)
+	assert.Equal(t, 2, report.ExitCode)
+	assert.Equal(t, float64(60), report.DurationSeconds)
+	assert.Equal(t, map[string]float64{"consume": 40}, report.PhaseDurations)
+	assert.Equal(t, []runreport.PartitionOffsets{
+		{Topic: "topic", Partition: 0, StartOffset: 5, EndOffset: 8},
+		{Topic: "topic", Partition: 1, StartOffset: 10, EndOffset: 10},
+	}, report.Partitions)
+	assert.Equal(t, []runreport.File{{
+		Table: "rule_hits",
+		Hour:  startedAt.Truncate(time.Hour),
+		Key:   "prefix/rule_hits/0.parquet",
+		Rows:  3,
+	}}, report.Files)
+	assert.Equal(t, []string{"prefix/archives/0.parquet"}, report.UndeletedFiles)
+	assert.Equal(t, int64(1), report.Messages.Rejected["duplicate"])
+}
+
+func TestReportWrite(t *testing.T) {
+	report := runreport.NewRecorder("run1", testBuild, "hash", startedAt).
+		Finish(0, startedAt, runreport.MessageCounts{}, nil)
+	key := "prefix/_runs/20260304T050607Z-run1.json"
+	assert.Equal(t, key, report.Key("prefix"))
+
+	t.Run("written", func(t *testing.T) {
+		writer := newMemoryWriter()
+		assert.NoError(t, report.Write(context.Background(), writer, "prefix"))
+
+		var stored runreport.Report
+		assert.NoError(t, json.Unmarshal(writer.objects[key], &stored))
+		assert.Equal(t, "run1", stored.RunID)
+		assert.Equal(t, []runreport.File{}, stored.Files)
+		assert.Equal(t, s3writer.ObjectOptions{Tags: map[string]string{"run_id": "run1"}}, writer.options[key])
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		writer := &memoryWriter{err: errors.New("test error")}
+		assert.Error(t, report.Write(context.Background(), writer, "prefix"))
+	})
+}
+
+func TestCurrentRecorder(t *testing.T) {
+	recorder := runreport.Start("run2", testBuild, "hash")
+	assert.Equal(t, recorder, runreport.Current())
+	assert.Equal(t, "run2", runreport.CurrentRunID())
+
+	runreport.RecordFile("archives", startedAt, "key", 1)
+	report := recorder.Finish(0, time.Now(), runreport.MessageCounts{}, nil)
+	assert.Len(t, report.Files, 1)
+}
+
+func TestConfigHash(t *testing.T) {
+	type config struct{ Bucket string }
+
+	assert.Equal(t, runreport.ConfigHash(config{"a"}), runreport.ConfigHash(config{"a"}))
+	assert.NotEqual(t, runreport.ConfigHash(config{"a"}), runreport.ConfigHash(config{"b"}))
+	assert.Len(t, runreport.ConfigHash(config{"a"}), 64)
+}
+
+func TestNewRunID(t *testing.T) {
+	assert.Len(t, runreport.NewRunID(), 16)
+	assert.NotEqual(t, runreport.NewRunID(), runreport.NewRunID())
+}
@@ -0,0 +1,181 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+)
+
+// Sources of the credentials used to access S3
+const (
+	// StaticCredentials uses the access key and the secret key of the
+	// configuration
+	StaticCredentials = "static"
+	// DefaultCredentials uses the default credential chain of the AWS SDK:
+	// environment variables, shared files, web identity, container and
+	// instance roles
+	DefaultCredentials = "default"
+	// WebIdentityCredentials assumes a role with the token stored in a file,
+	// like the ones projected by IRSA
+	WebIdentityCredentials = "web_identity"
+	// AssumeRoleCredentials assumes a role with the static credentials, or
+	// the default chain if there are none
+	AssumeRoleCredentials = "assume_role"
+	// FileCredentials reads a profile of a shared credentials file
+	FileCredentials = "file"
+)
+
+// defaultRoleSessionName identifies the sessions of the assumed roles if no
+// other name is configured
+const defaultRoleSessionName = "parquet-factory"
+
+// defaultProfile is the profile read from the credentials file if no other
+// one is configured
+const defaultProfile = "default"
+
+// fileCredentialsRefresh is how long the credentials read from a file are
+// used before reading it again, so the rotated credentials are picked up
+const fileCredentialsRefresh = 5 * time.Minute
+
+// loadAWSConfig returns the AWS configuration using the credentials of the
+// configured source. The credentials are cached and retrieved again when
+// they expire, so they are refreshed during long runs.
+func loadAWSConfig(
+	ctx context.Context, s3Config conf.S3Config, optFns ...func(*config.LoadOptions) error,
+) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, append(optFns, config.WithRegion(s3Config.Region))...)
+	if err != nil {
+		return cfg, err
+	}
+
+	provider, err := credentialsProvider(cfg, s3Config)
+	if err != nil || provider == nil {
+		return cfg, err
+	}
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+	return cfg, nil
+}
+
+// credentialsProvider returns the provider of the configured source, or nil
+// if the default chain must be used
+func credentialsProvider(cfg aws.Config, s3Config conf.S3Config) (aws.CredentialsProvider, error) {
+	credentialsConfig := s3Config.Credentials
+	sessionName := credentialsConfig.RoleSessionName
+	if sessionName == "" {
+		sessionName = defaultRoleSessionName
+	}
+
+	switch credentialsConfig.Source {
+	case "", StaticCredentials:
+		return credentials.NewStaticCredentialsProvider(s3Config.AccessKey, s3Config.SecretKey, ""), nil
+
+	case DefaultCredentials:
+		return nil, nil
+
+	case WebIdentityCredentials:
+		if credentialsConfig.RoleARN == "" || credentialsConfig.WebIdentityTokenFile == "" {
+			return nil, errors.New("the web identity credentials need a role ARN and a token file")
+		}
+		return stscreds.NewWebIdentityRoleProvider(
+			stsClient(cfg, credentialsConfig),
+			credentialsConfig.RoleARN,
+			stscreds.IdentityTokenFile(credentialsConfig.WebIdentityTokenFile),
+			func(options *stscreds.WebIdentityRoleOptions) {
+				options.RoleSessionName = sessionName
+			},
+		), nil
+
+	case AssumeRoleCredentials:
+		if credentialsConfig.RoleARN == "" {
+			return nil, errors.New("the assume role credentials need a role ARN")
+		}
+		if s3Config.AccessKey != "" {
+			cfg.Credentials = aws.NewCredentialsCache(
+				credentials.NewStaticCredentialsProvider(s3Config.AccessKey, s3Config.SecretKey, ""))
+		}
+		return stscreds.NewAssumeRoleProvider(
+			stsClient(cfg, credentialsConfig),
+			credentialsConfig.RoleARN,
+			func(options *stscreds.AssumeRoleOptions) {
+				options.RoleSessionName = sessionName
+				if credentialsConfig.ExternalID != "" {
+					options.ExternalID = aws.String(credentialsConfig.ExternalID)
+				}
+			},
+		), nil
+
+	case FileCredentials:
+		if credentialsConfig.File == "" {
+			return nil, errors.New("the file credentials need the path of the credentials file")
+		}
+		profile := credentialsConfig.Profile
+		if profile == "" {
+			profile = defaultProfile
+		}
+		return &fileCredentialsProvider{path: credentialsConfig.File, profile: profile}, nil
+	}
+
+	return nil, fmt.Errorf("unknown credentials source %q", credentialsConfig.Source)
+}
+
+// stsClient returns the client used to assume the roles
+func stsClient(cfg aws.Config, credentialsConfig conf.CredentialsConfig) *sts.Client {
+	return sts.NewFromConfig(cfg, func(options *sts.Options) {
+		if credentialsConfig.STSEndpoint != "" {
+			options.BaseEndpoint = aws.String(credentialsConfig.STSEndpoint)
+		}
+	})
+}
+
+// fileCredentialsProvider reads the credentials of a profile from a shared
+// credentials file. They expire after fileCredentialsRefresh, so the file is
+// read again during long runs.
+type fileCredentialsProvider struct {
+	path    string
+	profile string
+}
+
+// Retrieve reads the credentials from the file
+func (provider *fileCredentialsProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	sharedConfig, err := config.LoadSharedConfigProfile(ctx, provider.profile,
+		func(options *config.LoadSharedConfigOptions) {
+			options.CredentialsFiles = []string{provider.path}
+			options.ConfigFiles = []string{}
+		})
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	creds := sharedConfig.Credentials
+	if !creds.HasKeys() {
+		return aws.Credentials{}, fmt.Errorf(
+			"there are no credentials in the %s profile of %s", provider.profile, provider.path)
+	}
+	creds.Source = "CredentialsFile"
+	creds.CanExpire = true
+	creds.Expires = time.Now().Add(fileCredentialsRefresh)
+	return creds, nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// stsResponse is the response of the STS server to the AssumeRole and
+// AssumeRoleWithWebIdentity actions
+const stsResponse = `<%[1]sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <%[1]sResult>
+    <Credentials>
+      <AccessKeyId>roleAccessKey</AccessKeyId>
+      <SecretAccessKey>roleSecretKey</SecretAccessKey>
+      <SessionToken>roleToken</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </%[1]sResult>
+</%[1]sResponse>`
+
+// newSTSServer returns a fake STS server storing the forms of the requests
+func newSTSServer(t *testing.T) (*httptest.Server, *[]url.Values) {
+	forms := []url.Values{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		forms = append(forms, r.PostForm)
+		w.Header().Set("Content-Type", "text/xml")
+		_, err := fmt.Fprintf(w, stsResponse, r.PostForm.Get("Action"))
+		assert.NoError(t, err)
+	}))
+	t.Cleanup(server.Close)
+	return server, &forms
+}
+
+func retrieveCredentials(t *testing.T, s3Conf conf.S3Config) (aws.Credentials, error) {
+	s3Writer, err := s3writer.New(s3Conf)
+	if !assert.NoError(t, err) {
+		return aws.Credentials{}, err
+	}
+	client, ok := s3Writer.S3Client.(*s3.Client)
+	assert.True(t, ok)
+	return client.Options().Credentials.Retrieve(context.Background())
+}
+
+func TestCredentialsSources(t *testing.T) {
+	t.Run("static credentials by default", func(t *testing.T) {
+		creds, err := retrieveCredentials(t, s3TestConf)
+		assert.NoError(t, err)
+		assert.Equal(t, "testAccessKey", creds.AccessKeyID)
+		assert.Equal(t, "testSecretKey", creds.SecretAccessKey)
+	})
+
+	t.Run("default chain", func(t *testing.T) {
+		t.Setenv("AWS_ACCESS_KEY_ID", "envAccessKey")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "envSecretKey")
+
+		s3Conf := s3TestConf
+		s3Conf.Credentials = conf.CredentialsConfig{Source: s3writer.DefaultCredentials}
+		creds, err := retrieveCredentials(t, s3Conf)
+		assert.NoError(t, err)
+		assert.Equal(t, "envAccessKey", creds.AccessKeyID)
+	})
+
+	t.Run("web identity", func(t *testing.T) {
+		server, forms := newSTSServer(t)
+		tokenFile := filepath.Join(t.TempDir(), "token")
+		assert.NoError(t, os.WriteFile(tokenFile, []byte("web-token"), 0o600))
+
+		s3Conf := s3TestConf
+		s3Conf.Credentials = conf.CredentialsConfig{
+			Source:               s3writer.WebIdentityCredentials,
+			RoleARN:              "arn:aws:iam::123456789012:role/writer",
+			WebIdentityTokenFile: tokenFile,
+			STSEndpoint:          server.URL,
+		}
+		creds, err := retrieveCredentials(t, s3Conf)
+		assert.NoError(t, err)
+		assert.Equal(t, "roleAccessKey", creds.AccessKeyID)
+		assert.Equal(t, "roleToken", creds.SessionToken)
+		assert.True(t, creds.CanExpire)
+		assert.Len(t, *forms, 1)
+		assert.Equal(t, "web-token", (*forms)[0].Get("WebIdentityToken"))
+		assert.Equal(t, "parquet-factory", (*forms)[0].Get("RoleSessionName"))
+	})
+
+	t.Run("assume role", func(t *testing.T) {
+		server, forms := newSTSServer(t)
+
+		s3Conf := s3TestConf
+		s3Conf.Credentials = conf.CredentialsConfig{
+			Source:          s3writer.AssumeRoleCredentials,
+			RoleARN:         "arn:aws:iam::123456789012:role/writer",
+			RoleSessionName: "my-session",
+			ExternalID:      "my-id",
+			STSEndpoint:     server.URL,
+		}
+		creds, err := retrieveCredentials(t, s3Conf)
+		assert.NoError(t, err)
+		assert.Equal(t, "roleAccessKey", creds.AccessKeyID)
+		assert.Len(t, *forms, 1)
+		assert.Equal(t, "AssumeRole", (*forms)[0].Get("Action"))
+		assert.Equal(t, "my-session", (*forms)[0].Get("RoleSessionName"))
+		assert.Equal(t, "my-id", (*forms)[0].Get("ExternalId"))
+	})
+
+	t.Run("credentials file", func(t *testing.T) {
+		credentialsFile := filepath.Join(t.TempDir(), "credentials")
+		writeCredentials := func(accessKey string) {
+			content := fmt.Sprintf("[writer]\naws_access_key_id = %s\naws_secret_access_key = fileSecretKey\n", accessKey)
+			assert.NoError(t, os.WriteFile(credentialsFile, []byte(content), 0o600))
+		}
+		writeCredentials("fileAccessKey")
+
+		s3Conf := s3TestConf
+		s3Conf.Credentials = conf.CredentialsConfig{
+			Source:  s3writer.FileCredentials,
+			File:    credentialsFile,
+			Profile: "writer",
+		}
+		s3Writer, err := s3writer.New(s3Conf)
+		assert.NoError(t, err)
+		provider := s3Writer.S3Client.(*s3.Client).Options().Credentials
+
+		creds, err := provider.Retrieve(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "fileAccessKey", creds.AccessKeyID)
+		assert.True(t, creds.CanExpire)
+
+		// the rotated credentials are read once the previous ones expire
+		writeCredentials("rotatedAccessKey")
+		provider.(*aws.CredentialsCache).Invalidate()
+		creds, err = provider.Retrieve(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "rotatedAccessKey", creds.AccessKeyID)
+	})
+
+	t.Run("missing profile", func(t *testing.T) {
+		credentialsFile := filepath.Join(t.TempDir(), "credentials")
+		assert.NoError(t, os.WriteFile(credentialsFile, []byte("[other]\n"), 0o600))
+
+		s3Conf := s3TestConf
+		s3Conf.Credentials = conf.CredentialsConfig{Source: s3writer.FileCredentials, File: credentialsFile}
+		_, err := retrieveCredentials(t, s3Conf)
+		assert.Error(t, err)
+	})
+}
+
+func TestInvalidCredentialsSources(t *testing.T) {
+	for name, credentials := range map[string]conf.CredentialsConfig{
+		"unknown source":              {Source: "unknown"},
+		"web identity without role":   {Source: s3writer.WebIdentityCredentials, WebIdentityTokenFile: "token"},
+		"web identity without token":  {Source: s3writer.WebIdentityCredentials, RoleARN: "role"},
+		"assume role without role":    {Source: s3writer.AssumeRoleCredentials},
+		"credentials file without it": {Source: s3writer.FileCredentials},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s3Conf := s3TestConf
+			s3Conf.Credentials = credentials
+			_, err := s3writer.New(s3Conf)
+			assert.Error(t, err)
+		})
+	}
+}
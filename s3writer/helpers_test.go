@@ -15,11 +15,15 @@
 package s3writer_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	s3mocks "github.com/RedHatInsights/insights-operator-utils/s3/mocks"
 	"github.com/RedHatInsights/parquet-factory/s3writer"
@@ -33,11 +37,21 @@ type mockS3ClientAdapter struct {
 
 // Implement missing methods from S3ClientAPI with stubs
 func (m *mockS3ClientAdapter) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
-	return nil, fmt.Errorf("HeadObject not implemented in mock")
+	if _, ok := m.Contents[aws.ToString(params.Key)]; !ok {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadObjectOutput{}, nil
 }
 
 func (m *mockS3ClientAdapter) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
-	return nil, fmt.Errorf("GetObject not implemented in mock")
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	content, ok := m.Contents[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(content))}, nil
 }
 
 func (m *mockS3ClientAdapter) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
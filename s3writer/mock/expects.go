@@ -36,11 +36,13 @@ func PrepareMocks(t *testing.T, expectedRows RowsPerFileExpectation) (*MockS3Par
 
 	anyMatcher := gomock.Any()
 
+	expectMockWriter.Prefix().AnyTimes()
+	expectMockWriter.CheckSchema(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).AnyTimes()
+	expectMockWriter.WriteObject(anyMatcher, anyMatcher, anyMatcher, anyMatcher).Return(nil).AnyTimes()
+
 	for _, numRows := range expectedRows {
-		expectMockWriter.Prefix()
-		expectMockWriter.GetLastIndexForParquet(anyMatcher, anyMatcher).Return(map[string]int{})
-		expectMockWriter.Prefix()
-		expectMockWriter.NewFile(anyMatcher, anyMatcher, anyMatcher).
+		expectMockWriter.GetLastIndexForParquet(anyMatcher, anyMatcher, anyMatcher).Return(map[string]int{}, nil)
+		expectMockWriter.NewFile(anyMatcher, anyMatcher, anyMatcher, anyMatcher).
 			Return(mockFile, nil)
 		for row := uint(0); row < numRows; row++ {
 			expectMockFile.AddRow(anyMatcher).Return(nil)
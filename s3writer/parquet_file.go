@@ -16,10 +16,17 @@ package s3writer
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"strconv"
 
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/rs/zerolog/log"
 	sourceS3 "github.com/xitongsys/parquet-go-source/s3v2"
 	"github.com/xitongsys/parquet-go/parquet"
 	"github.com/xitongsys/parquet-go/source"
@@ -37,58 +44,169 @@ const (
 
 // S3File handle parquet file
 type S3File struct {
-	file   source.ParquetFile
-	writer *writer.ParquetWriter
+	ctx      context.Context
+	s3Writer *S3Writer
+	key      string
+	table    string
+	file     *countingFile
+	writer   *writer.ParquetWriter
+	// rows is the number of rows added to the file
+	rows int64
+}
+
+// countingFile counts the bytes written into a parquet file and computes
+// their CRC32 checksum
+type countingFile struct {
+	source.ParquetFile
+	written  int64
+	checksum hash.Hash32
+}
+
+func (file *countingFile) Write(p []byte) (int, error) {
+	n, err := file.ParquetFile.Write(p)
+	file.written += int64(n)
+	file.checksum.Write(p[:n])
+	return n, err
+}
+
+// Checksum returns the base64 encoded CRC32 checksum of the bytes written,
+// as it is sent in the S3 checksum headers
+func (file *countingFile) Checksum() string {
+	return base64.StdEncoding.EncodeToString(file.checksum.Sum(nil))
 }
 
 // AddRow add row to current parquet file
 func (file *S3File) AddRow(row interface{}) error {
-	return file.writer.Write(row)
+	if err := file.writer.Write(row); err != nil {
+		return err
+	}
+	file.rows++
+	return nil
 }
 
-// CloseFile close file
+// CloseFile close file. Once the upload finishes, the stored object is
+// verified as configured in the writer, returning a VerificationError if it
+// doesn't match the content written into the file.
 func (file *S3File) CloseFile() error {
 	if err := file.writer.WriteStop(); err != nil {
-		return err
+		return conditionalPutError(err)
 	}
 	err := file.file.Close()
 	if err != nil {
-		return err
+		return conditionalPutError(err)
 	}
 
-	return nil
+	return file.s3Writer.verify(file.ctx, file.key, file.table, file.file, file.rows)
+}
+
+// Size returns the number of bytes written into the file
+func (file *S3File) Size() int64 {
+	return file.file.written
 }
 
-// NewFile create new parquet file instance
-func (s3Writer *S3Writer) NewFile(ctx context.Context, path string, schema interface{}) (S3ParquetFile, error) {
-	pfw, err := newS3FileWriterWithS3Writer(ctx, s3Writer, path)
+// NewFile create new parquet file instance, uploaded with the options of the
+// table it belongs to. ErrObjectExists is returned if there is already an
+// object stored in the path, unless overwriting it is allowed by the options
+// or the configuration of the writer. The upload is conditional in that case,
+// so the file closing fails with ErrObjectExists if another writer stores an
+// object in the path in the meantime.
+func (s3Writer *S3Writer) NewFile(
+	ctx context.Context, path string, schema interface{}, options FileOptions,
+) (S3ParquetFile, error) {
+	ifNotExists := !options.Overwrite && !s3Writer.allowOverwrite
+	if ifNotExists {
+		exists, err := s3Writer.objectExists(ctx, path, options.Table)
+		if err != nil {
+			log.Error().Err(err).Str("key", path).Msg("Unable to check if the file already exists")
+			return nil, err
+		}
+		if exists {
+			log.Error().Str("key", path).Msg("Refusing to overwrite an existing file")
+			return nil, ErrObjectExists
+		}
+	}
+
+	s3File, err := newS3FileWriterWithS3Writer(ctx, s3Writer, path, options.ObjectOptions, ifNotExists)
 	if err != nil {
 		return nil, err
 	}
-	pw, err := writer.NewParquetWriter(pfw, schema, 4)
+	pfw := &countingFile{ParquetFile: s3File, checksum: crc32.NewIEEE()}
+	pw, err := newParquetWriter(pfw, schema)
 	if err != nil {
 		return nil, err
 	}
-	pw.RowGroupSize = 128 * 1024 * 1024 //128M
-	pw.CompressionType = parquet.CompressionCodec_SNAPPY
 
 	file := &S3File{
-		file:   pfw,
-		writer: pw,
+		ctx:      ctx,
+		s3Writer: s3Writer,
+		key:      path,
+		table:    options.Table,
+		file:     pfw,
+		writer:   pw,
 	}
 
 	return file, nil
 }
 
-func newS3FileWriterWithS3Writer(ctx context.Context, s3Writer *S3Writer, path string) (source.ParquetFile, error) {
+// newParquetWriter returns a writer of parquet files with the given schema
+// into the given file
+func newParquetWriter(file source.ParquetFile, schema interface{}) (*writer.ParquetWriter, error) {
+	pw, err := writer.NewParquetWriter(file, schema, 4)
+	if err != nil {
+		return nil, err
+	}
+	pw.RowGroupSize = 128 * 1024 * 1024 //128M
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	if versioned, ok := schema.(VersionedSchema); ok {
+		version := strconv.Itoa(versioned.SchemaVersion())
+		pw.Footer.KeyValueMetadata = append(pw.Footer.KeyValueMetadata, &parquet.KeyValue{
+			Key:   SchemaVersionKey,
+			Value: &version,
+		})
+	}
+	return pw, nil
+}
+
+// objectExists returns true if there is an object of the given table stored
+// with the given key
+func (s3Writer *S3Writer) objectExists(ctx context.Context, key, table string) (bool, error) {
+	_, err := s3Writer.readClient(table).HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s3Writer.Bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return true, nil
+	}
+
+	var notFound *types.NotFound
+	var apiErr smithy.APIError
+	if errors.As(err, &notFound) || (errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound") {
+		return false, nil
+	}
+	return false, err
+}
+
+func newS3FileWriterWithS3Writer(
+	ctx context.Context, s3Writer *S3Writer, path string, options ObjectOptions, ifNotExists bool,
+) (source.ParquetFile, error) {
 	// s3v2 package signature: NewS3FileWriterWithClient(ctx, client, bucket, key, uploaderOptions, putObjectOptions)
-	// The ACL is set via putObjectOptions function
+	// The ACL, the upload options and the checksum algorithm are set via putObjectOptions function.
+	// The CRC32 checksum of the content is computed by the SDK while it is
+	// uploaded and sent along with it, so S3 rejects the content corrupted on
+	// the way.
 	putObjectOptions := func(input *s3.PutObjectInput) {
 		if ACL != "" {
 			input.ACL = types.ObjectCannedACL(ACL)
 		}
+		s3Writer.uploadOptions(options.Table).applyToPut(input, options.Tags)
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+		// the object is only created if there isn't one already, checked
+		// when the upload completes
+		if ifNotExists {
+			input.IfNoneMatch = aws.String("*")
+		}
 	}
-	uploaderOptions := []func(*manager.Uploader){} //nolint:staticcheck
 	return sourceS3.NewS3FileWriterWithClient(
-		ctx, s3Writer.S3Client, s3Writer.Bucket, path, uploaderOptions, putObjectOptions)
+		ctx, s3Writer.S3Client, s3Writer.Bucket, path, s3Writer.uploaderOptions(), putObjectOptions)
 }
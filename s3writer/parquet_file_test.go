@@ -21,6 +21,8 @@ import (
 
 	s3mocks "github.com/RedHatInsights/insights-operator-utils/s3/mocks"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/s3writer"
 )
 
 type testTableSchema struct {
@@ -37,22 +39,65 @@ func TestNewFile(t *testing.T) {
 	mockClient := s3mocks.MockS3Client{}
 	s3Writer := newMockS3Writer(t, &mockClient)
 	t.Run("shouldn't return an error if the schema is valid", func(t *testing.T) {
-		_, err := s3Writer.NewFile(context.TODO(), "my_file", &testTableSchema{})
+		_, err := s3Writer.NewFile(context.TODO(), "my_file", &testTableSchema{}, s3writer.FileOptions{})
 		assert.NoError(t, err)
 	})
 
 	t.Run("should return an error if the schema is not a pointer", func(t *testing.T) {
 		mockClient.Err = errors.New("an error")
-		_, err := s3Writer.NewFile(context.TODO(), "my_file", testTableSchema{})
+		_, err := s3Writer.NewFile(context.TODO(), "my_file", testTableSchema{}, s3writer.FileOptions{})
 		assert.Error(t, err)
 	})
 }
 
+func TestNewFileOverwrite(t *testing.T) {
+	mockClient := s3mocks.MockS3Client{Contents: s3mocks.MockContents{"my_file": []byte("content")}}
+	s3Writer := newMockS3Writer(t, &mockClient)
+
+	t.Run("refuses to overwrite an existing file", func(t *testing.T) {
+		_, err := s3Writer.NewFile(context.TODO(), "my_file", &testTableSchema{}, s3writer.FileOptions{})
+		assert.ErrorIs(t, err, s3writer.ErrObjectExists)
+	})
+
+	t.Run("overwrites an existing file if allowed", func(t *testing.T) {
+		_, err := s3Writer.NewFile(context.TODO(), "my_file", &testTableSchema{}, s3writer.FileOptions{Overwrite: true})
+		assert.NoError(t, err)
+	})
+
+	t.Run("creates a file that doesn't exist", func(t *testing.T) {
+		_, err := s3Writer.NewFile(context.TODO(), "other_file", &testTableSchema{}, s3writer.FileOptions{})
+		assert.NoError(t, err)
+	})
+}
+
+// TestNewFileConcurrentWriter checks that a file stored by another writer
+// after the existence check isn't overwritten
+func TestNewFileConcurrentWriter(t *testing.T) {
+	for _, overwrite := range []bool{false, true} {
+		client := newMemoryClient()
+		s3Writer := s3writer.S3Writer{S3Client: client, Bucket: "test_bucket"}
+
+		file, err := s3Writer.NewFile(context.Background(), "my_file", &testTableSchema{}, s3writer.FileOptions{Overwrite: overwrite})
+		assert.NoError(t, err)
+		client.objects["my_file"] = []byte("content")
+		assert.NoError(t, file.AddRow(testRow))
+
+		err = file.CloseFile()
+		if overwrite {
+			assert.NoError(t, err)
+			assert.Nil(t, client.inputs[0].IfNoneMatch)
+		} else {
+			assert.ErrorIs(t, err, s3writer.ErrObjectExists)
+			assert.Equal(t, []byte("content"), client.objects["my_file"])
+		}
+	}
+}
+
 func TestAddRow(t *testing.T) {
 	mockClient := s3mocks.MockS3Client{}
 	s3Writer := newMockS3Writer(t, &mockClient)
 
-	s3file, err := s3Writer.NewFile(context.TODO(), "my_file", &testTableSchema{})
+	s3file, err := s3Writer.NewFile(context.TODO(), "my_file", &testTableSchema{}, s3writer.FileOptions{})
 	assert.NoError(t, err)
 	err = s3file.AddRow(testRow)
 	assert.NoError(t, err)
@@ -62,7 +107,7 @@ func TestCloseFile(t *testing.T) {
 	mockClient := s3mocks.MockS3Client{}
 	s3Writer := newMockS3Writer(t, &mockClient)
 
-	s3file, err := s3Writer.NewFile(context.TODO(), "my_file", &testTableSchema{})
+	s3file, err := s3Writer.NewFile(context.TODO(), "my_file", &testTableSchema{}, s3writer.FileOptions{})
 	assert.NoError(t, err)
 	err = s3file.AddRow(testRow)
 	assert.NoError(t, err)
@@ -16,29 +16,42 @@ package s3writer
 
 import (
 	"context"
-	"path"
-	"strconv"
-	"strings"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/RedHatInsights/parquet-factory/utils"
+
 	s3utils "github.com/RedHatInsights/insights-operator-utils/s3"
 )
 
-// GetLastIndexForParquet a map with the last used index for the objects in a given filepath
-func (s3Writer *S3Writer) GetLastIndexForParquet(ctx context.Context, folder string) map[string]int {
-	retval := map[string]int{}
-
-	output, err := listBucket(ctx, s3Writer, folder)
-
+// GetLastIndexForParquet a map with the last used index for the objects in a given filepath.
+// Only the objects following the given partitioning layout are taken into account.
+// An error is returned if the objects can't be listed, as the indexes already
+// used in the folder are unknown.
+func (s3Writer *S3Writer) GetLastIndexForParquet(
+	ctx context.Context, layout *utils.PartitionLayout, folder string,
+) (map[string]int, error) {
+	var output []string
+	err := s3Writer.RetryPolicy.Do(ctx, "list_objects", func() (err error) {
+		output, err = listBucket(ctx, s3Writer, folder)
+		return err
+	})
 	if err != nil {
-		log.Error().Err(err).Msgf("Unable to retrieve the indexes from S3 bucket")
-		return retval
+		log.Error().Err(err).Str("folder", folder).Msg("Unable to retrieve the indexes from S3 bucket")
+		return nil, err
 	}
 
-	for _, f := range output {
+	return lastIndexes(layout, output), nil
+}
+
+// lastIndexes returns the last index used by the given keys following the
+// partitioning layout
+func lastIndexes(layout *utils.PartitionLayout, keys []string) map[string]int {
+	retval := map[string]int{}
+
+	for _, f := range keys {
 		log.Debug().Msgf("Filepath: %s", f)
-		tablename, index, err := getKeyAndIndex(f)
+		tablename, index, err := getKeyAndIndex(layout, f)
 		if err != nil {
 			log.Warn().Msgf("Warning: ignoring %s\n", f)
 		} else {
@@ -65,15 +78,6 @@ func listBucket(ctx context.Context, s3Writer *S3Writer, folder string) ([]strin
 	)
 }
 
-func getKeyAndIndex(filepath string) (string, int, error) {
-	filename := path.Base(filepath)
-	ext := path.Ext(filename)
-	filename = filename[0 : len(filename)-len(ext)]
-	comps := strings.Split(filename, "-")
-
-	index, err := strconv.Atoi(comps[len(comps)-1])
-	if err == nil {
-		return comps[0], index, nil
-	}
-	return "", -1, err
+func getKeyAndIndex(layout *utils.PartitionLayout, filepath string) (string, int, error) {
+	return layout.ParseParquetFilepath(filepath)
 }
@@ -19,9 +19,17 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/RedHatInsights/parquet-factory/retry"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+	"github.com/RedHatInsights/parquet-factory/utils"
+
 	s3mocks "github.com/RedHatInsights/insights-operator-utils/s3/mocks"
 )
 
@@ -51,6 +59,10 @@ func TestDeleteFiles(t *testing.T) {
 		err := sut.DeleteFiles([]string{"file_1"})
 
 		assert.Error(t, err, "DeleteFiles should return an error if something happens with S3")
+
+		var deleteErr *s3writer.DeleteError
+		assert.ErrorAs(t, err, &deleteErr)
+		assert.Equal(t, []string{"file_1"}, deleteErr.Keys)
 	})
 
 	t.Run("check that delete one file out of two works fine", func(t *testing.T) {
@@ -71,42 +83,157 @@ func TestDeleteFiles(t *testing.T) {
 	})
 }
 
+// partialDeleteClient fails to delete the objects with the given keys the
+// given number of times
+type partialDeleteClient struct {
+	*mockS3ClientAdapter
+	failing map[string]int
+}
+
+func (client *partialDeleteClient) DeleteObjects(
+	ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options),
+) (*s3.DeleteObjectsOutput, error) {
+	output := &s3.DeleteObjectsOutput{}
+	for _, object := range params.Delete.Objects {
+		if key := aws.ToString(object.Key); client.failing[key] > 0 {
+			client.failing[key]--
+			output.Errors = append(output.Errors, types.Error{Key: object.Key, Code: aws.String("AccessDenied")})
+		}
+	}
+	return output, nil
+}
+
+func TestDeleteFilesPartialFailure(t *testing.T) {
+	sut := s3writer.S3Writer{
+		S3Client: &partialDeleteClient{
+			mockS3ClientAdapter: &mockS3ClientAdapter{MockS3Client: &s3mocks.MockS3Client{}},
+			failing:             map[string]int{"file_2": 3},
+		},
+		Bucket:      "test_bucket",
+		RetryPolicy: retry.Policy{MaxRetries: 1, InitialBackoff: time.Millisecond, Multiplier: 2},
+	}
+
+	err := sut.DeleteFiles([]string{"file_1", "file_2", "file_3"})
+
+	var deleteErr *s3writer.DeleteError
+	assert.ErrorAs(t, err, &deleteErr)
+	assert.Equal(t, []string{"file_2"}, deleteErr.Keys)
+}
+
+func TestDeleteFilesRetries(t *testing.T) {
+	client := &partialDeleteClient{
+		mockS3ClientAdapter: &mockS3ClientAdapter{MockS3Client: &s3mocks.MockS3Client{}},
+		failing:             map[string]int{"file_1": 1, "file_2": 2},
+	}
+	sut := s3writer.S3Writer{
+		S3Client:    client,
+		Bucket:      "test_bucket",
+		RetryPolicy: retry.Policy{MaxRetries: 2, InitialBackoff: time.Millisecond, Multiplier: 2},
+	}
+
+	assert.NoError(t, sut.DeleteFiles([]string{"file_1", "file_2", "file_3"}))
+	assert.Equal(t, map[string]int{"file_1": 0, "file_2": 0}, client.failing)
+}
+
 func TestGetLastIndexForParquet(t *testing.T) {
 	mockClient := s3mocks.MockS3Client{}
 	sut := newMockS3Writer(t, &mockClient)
+	layout := utils.DefaultPartitionLayout()
+	folder := "test/cluster_info/hourly/date=2022-01-01/hour=01/"
 
 	t.Run("an empty content should return an empty map", func(t *testing.T) {
-		res := sut.GetLastIndexForParquet(context.TODO(), "test/path")
+		res, err := sut.GetLastIndexForParquet(context.TODO(), layout, folder)
+		assert.NoError(t, err)
 		assert.Equal(t, map[string]int{}, res)
 	})
 
-	t.Run("return an empty map if there is an error listing the files", func(t *testing.T) {
+	t.Run("return an error if the files can't be listed", func(t *testing.T) {
 		mockClient.Err = errors.New("an error")
 		mockClient.Contents = s3mocks.MockContents{
-			"test/path/cluster_info-0.parquet": mockFileContent,
-			"test/path/cluster_info-1.parquet": mockFileContent}
-		res := sut.GetLastIndexForParquet(context.TODO(), "test/path")
-		assert.Equal(t, map[string]int{}, res)
+			folder + "cluster_info-0.parquet": mockFileContent,
+			folder + "cluster_info-1.parquet": mockFileContent}
+		res, err := sut.GetLastIndexForParquet(context.TODO(), layout, folder)
+		assert.Error(t, err)
+		assert.Nil(t, res)
 	})
 
 	t.Run("an empty content should return an empty map", func(t *testing.T) {
 		mockClient.Contents = s3mocks.MockContents{
-			"test/path/cluster_info-0.parquet": mockFileContent,
-			"test/path/cluster_info-1.parquet": mockFileContent}
+			folder + "cluster_info-0.parquet": mockFileContent,
+			folder + "cluster_info-1.parquet": mockFileContent}
 		mockClient.Err = nil
 
-		res := sut.GetLastIndexForParquet(context.TODO(), "test/path")
+		res, err := sut.GetLastIndexForParquet(context.TODO(), layout, folder)
+		assert.NoError(t, err)
 		assert.Equal(t, 1, res["cluster_info"])
 	})
 
 	t.Run("files with invalid format should be ignored", func(t *testing.T) {
 		mockClient.Contents = s3mocks.MockContents{
-			"test/path/cluster_info-0.parquet":             mockFileContent,
-			"test/path/cluster_info-1.parquet":             mockFileContent,
-			"test/path/cluster_info-invalid_index.parquet": mockFileContent}
+			folder + "cluster_info-0.parquet":             mockFileContent,
+			folder + "cluster_info-1.parquet":             mockFileContent,
+			folder + "cluster_info-invalid_index.parquet": mockFileContent}
 		mockClient.Err = nil
 
-		res := sut.GetLastIndexForParquet(context.TODO(), "test/path")
+		res, err := sut.GetLastIndexForParquet(context.TODO(), layout, folder)
+		assert.NoError(t, err)
 		assert.Equal(t, 1, res["cluster_info"])
 	})
+
+	t.Run("files not following the partitioning layout should be ignored", func(t *testing.T) {
+		mockClient.Contents = s3mocks.MockContents{
+			folder + "cluster_info-0.parquet":        mockFileContent,
+			folder + "nested/cluster_info-5.parquet": mockFileContent}
+		mockClient.Err = nil
+
+		res, err := sut.GetLastIndexForParquet(context.TODO(), layout, folder)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, res["cluster_info"])
+	})
+
+	t.Run("table names with dashes are not ignored", func(t *testing.T) {
+		dashedFolder := "test/cluster-info/hourly/date=2022-01-01/hour=01/"
+		mockClient.Contents = s3mocks.MockContents{
+			dashedFolder + "cluster-info-0.parquet": mockFileContent,
+			dashedFolder + "cluster-info-4.parquet": mockFileContent}
+		mockClient.Err = nil
+
+		res, err := sut.GetLastIndexForParquet(context.TODO(), layout, dashedFolder)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"cluster-info": 4}, res)
+	})
+
+	t.Run("files with unique names are ignored", func(t *testing.T) {
+		mockClient.Contents = s3mocks.MockContents{
+			folder + "cluster_info-2.parquet":                        mockFileContent,
+			folder + "cluster_info-offsets-0123456789012345.parquet": mockFileContent}
+		mockClient.Err = nil
+
+		res, err := sut.GetLastIndexForParquet(context.TODO(), layout, folder)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, res["cluster_info"])
+	})
+
+	t.Run("a custom partitioning layout is used to parse the keys", func(t *testing.T) {
+		customLayout, err := utils.NewPartitionLayout("{prefix}/{table}/year={year}/month={month}/day={day}/hour={hour}")
+		assert.NoError(t, err)
+		customFolder := "test/cluster_info/year=2022/month=01/day=01/hour=01/"
+		mockClient.Contents = s3mocks.MockContents{
+			customFolder + "cluster_info-0.parquet": mockFileContent,
+			customFolder + "cluster_info-3.parquet": mockFileContent}
+		mockClient.Err = nil
+
+		res, err := sut.GetLastIndexForParquet(context.TODO(), customLayout, customFolder)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, res["cluster_info"])
+	})
+}
+
+func TestPing(t *testing.T) {
+	mockClient := s3mocks.MockS3Client{}
+	sut := newMockS3Writer(t, &mockClient)
+	assert.NoError(t, sut.Ping(context.Background()))
+
+	mockClient.Err = errors.New("an error")
+	assert.Error(t, sut.Ping(context.Background()))
 }
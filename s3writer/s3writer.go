@@ -15,22 +15,62 @@
 package s3writer
 
 import (
+	"bytes"
 	"context"
-	"strings"
+	"errors"
+	"fmt"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 
 	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/retry"
 
 	s3utils "github.com/RedHatInsights/insights-operator-utils/s3"
 )
 
+// Backend is the name of the S3 backend in the configuration, used by default
+const Backend = "s3"
+
 // Number of files to list in each batch iteration
 const listMaxKey = 1000
 
+// Number of files to delete in each request
+const deleteMaxKeys = 1000
+
+// ErrObjectExists is returned when an object can't be created because there
+// is already another one stored with the same key
+var ErrObjectExists = errors.New("the object already exists")
+
+// DeleteError is returned when some of the files couldn't be deleted
+type DeleteError struct {
+	// Keys of the files that are still stored
+	Keys []string
+	// Err is the error of the failed request, if the whole request failed
+	Err error
+}
+
+func (deleteErr *DeleteError) Error() string {
+	if deleteErr.Err != nil {
+		return fmt.Sprintf("unable to delete %d files: %v", len(deleteErr.Keys), deleteErr.Err)
+	}
+	return fmt.Sprintf("unable to delete %d files", len(deleteErr.Keys))
+}
+
+func (deleteErr *DeleteError) Unwrap() error {
+	return deleteErr.Err
+}
+
+// Retryable returns true if the files may be deleted trying again: the
+// request failed because of a transient error, or only some of the files
+// failed
+func (deleteErr *DeleteError) Retryable() bool {
+	return deleteErr.Err == nil || retry.IsRetryable(deleteErr.Err)
+}
+
 // S3ClientAPI defines the minimal interface needed for S3 operations
 // This allows using both real s3.Client and mock implementations in tests
 type S3ClientAPI interface {
@@ -48,17 +88,135 @@ type S3ClientAPI interface {
 
 // S3Writer handle writing tables to bucket
 type S3Writer struct {
-	S3Client S3ClientAPI // AWS SDK v2 client (or mock for testing)
-	Bucket   string
-	prefix   string
+	S3Client    S3ClientAPI // AWS SDK v2 client (or mock for testing)
+	Bucket      string
+	RetryPolicy retry.Policy // used to retry the listings and deletions
+	// VerifyUploads is the way the parquet files are verified once they are
+	// uploaded: VerifyNone, VerifyHead or VerifyFooter. They aren't verified
+	// if it is empty.
+	VerifyUploads string
+	prefix        string
+	// allowOverwrite lets new parquet files replace the existing ones
+	allowOverwrite bool
+	// upload are the default upload options, replaced by the ones in
+	// tableUploads for the objects of each table
+	upload       uploadOptions
+	tableUploads map[string]uploadOptions
+	// partSize and uploadConcurrency configure the multipart uploads of the
+	// parquet files. The uploader defaults are used if they are 0.
+	partSize          int64
+	uploadConcurrency int
 }
 
-// DeleteFiles removes files from S3 bucket
+// DeleteFiles removes files from S3 bucket. The files that can't be removed
+// are retried following the retry policy of the writer. If any of them is
+// still stored after the last attempt, a DeleteError with their keys is
+// returned.
 func (s3Writer *S3Writer) DeleteFiles(filepaths []string) error {
-	if len(filepaths) == 0 {
-		return nil
+	return deleteWithRetries(s3Writer.RetryPolicy, filepaths, s3Writer.deleteFiles)
+}
+
+// deleteWithRetries removes the given files, trying again to remove the ones
+// left by every failed attempt following the retry policy
+func deleteWithRetries(policy retry.Policy, filepaths []string, deleteFiles func([]string) error) error {
+	pending := filepaths
+	return policy.Do(context.Background(), "delete_files", func() error {
+		err := deleteFiles(pending)
+		var deleteErr *DeleteError
+		if errors.As(err, &deleteErr) {
+			pending = deleteErr.Keys
+		}
+		return err
+	})
+}
+
+// deleteFiles removes the given files in batches, returning a DeleteError
+// with the keys of the ones that couldn't be removed
+func (s3Writer *S3Writer) deleteFiles(filepaths []string) error {
+	undeleted := []string{}
+	var requestErr error
+
+	for start := 0; start < len(filepaths); start += deleteMaxKeys {
+		batch := filepaths[start:min(start+deleteMaxKeys, len(filepaths))]
+		objects := make([]types.ObjectIdentifier, 0, len(batch))
+		for _, key := range batch {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		output, err := s3Writer.S3Client.DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+			Bucket: aws.String(s3Writer.Bucket),
+			Delete: &types.Delete{Objects: objects},
+		})
+		if err != nil {
+			undeleted = append(undeleted, batch...)
+			if requestErr == nil {
+				requestErr = err
+			}
+			continue
+		}
+		for _, deleteErr := range output.Errors {
+			undeleted = append(undeleted, aws.ToString(deleteErr.Key))
+		}
 	}
-	return s3utils.DeleteObjects(context.Background(), s3Writer.S3Client, s3Writer.Bucket, filepaths)
+
+	if len(undeleted) > 0 {
+		return &DeleteError{Keys: undeleted, Err: requestErr}
+	}
+	return nil
+}
+
+// WriteObject stores the given content in the bucket under the given key,
+// replacing it if it already exists
+func (s3Writer *S3Writer) WriteObject(ctx context.Context, key string, content []byte, options ObjectOptions) error {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s3Writer.Bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(content),
+	}
+	s3Writer.uploadOptions(options.Table).applyToPut(input, options.Tags)
+
+	_, err := s3Writer.S3Client.PutObject(ctx, input)
+	return err
+}
+
+// CreateObject stores the given content in the bucket under the given key
+// only if there is no object stored there yet. ErrObjectExists is returned
+// otherwise.
+func (s3Writer *S3Writer) CreateObject(ctx context.Context, key string, content []byte, options ObjectOptions) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s3Writer.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(content),
+		IfNoneMatch: aws.String("*"),
+	}
+	s3Writer.uploadOptions(options.Table).applyToPut(input, options.Tags)
+
+	_, err := s3Writer.S3Client.PutObject(ctx, input)
+	return conditionalPutError(err)
+}
+
+// conditionalPutError returns ErrObjectExists if the error is caused by a
+// conditional upload finding an object already stored, or the error otherwise
+func conditionalPutError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return ErrObjectExists
+		}
+	}
+	return err
+}
+
+// ListObjects returns the keys of all the objects stored under the given prefix
+func (s3Writer *S3Writer) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	return listBucket(ctx, s3Writer, prefix)
+}
+
+// Ping returns an error if the bucket can't be reached
+func (s3Writer *S3Writer) Ping(ctx context.Context) error {
+	_, _, err := s3utils.ListNObjectsInBucket(ctx, s3Writer.S3Client, s3Writer.Bucket, s3Writer.prefix, "", "", 1)
+	return err
 }
 
 // Prefix returns the default prefix for files in this writer
@@ -70,38 +228,57 @@ func (s3Writer *S3Writer) Prefix() string {
 func New(s3Config conf.S3Config) (*S3Writer, error) {
 	ctx := context.Background()
 
+	verifyUploads, err := verifyMode(s3Config.VerifyUploads)
+	if err != nil {
+		return &S3Writer{}, err
+	}
+	upload, err := newUploadOptions(s3Config.Upload)
+	if err != nil {
+		return &S3Writer{}, fmt.Errorf("invalid upload options: %w", err)
+	}
+	tableUploads, err := newTableUploadOptions(s3Config.TableUploads)
+	if err != nil {
+		return &S3Writer{}, err
+	}
+
+	pathStyle, err := usePathStyle(s3Config.Addressing)
+	if err != nil {
+		return &S3Writer{}, err
+	}
+	if err := checkMultipart(s3Config); err != nil {
+		return &S3Writer{}, err
+	}
+	client, err := httpClient(s3Config)
+	if err != nil {
+		return &S3Writer{}, err
+	}
+
 	// Create AWS SDK v2 client
-	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithRegion(s3Config.Region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-			s3Config.AccessKey,
-			s3Config.SecretKey,
-			"",
-		)),
-	)
+	cfg, err := loadAWSConfig(ctx, s3Config, config.WithHTTPClient(client))
 	if err != nil {
 		return &S3Writer{}, err
 	}
 
 	s3Client := s3.NewFromConfig(cfg, func(o *s3.Options) {
 		if s3Config.Endpoint != "" {
-			endpoint := s3Config.Endpoint
 			// AWS SDK v2 requires a full URI with scheme
-			if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
-				if s3Config.UseSSL {
-					endpoint = "https://" + endpoint
-				} else {
-					endpoint = "http://" + endpoint
-				}
-			}
-			o.BaseEndpoint = aws.String(endpoint)
+			o.BaseEndpoint = aws.String(EndpointURL(s3Config))
 		}
-		o.UsePathStyle = true
+		o.UsePathStyle = pathStyle
 	})
 
 	return &S3Writer{
-		S3Client: s3Client,
-		Bucket:   s3Config.Bucket,
-		prefix:   s3Config.FilePathPrefix,
+		S3Client:      s3Client,
+		Bucket:        s3Config.Bucket,
+		RetryPolicy:   retry.NewPolicy(conf.GetRetryConfiguration(), s3Config.MaxRetries),
+		VerifyUploads: verifyUploads,
+		prefix:        s3Config.FilePathPrefix,
+
+		allowOverwrite: s3Config.AllowOverwrite,
+		upload:         upload,
+		tableUploads:   tableUploads,
+
+		partSize:          int64(s3Config.PartSize) * mebibyte,
+		uploadConcurrency: s3Config.UploadConcurrency,
 	}, nil
 }
@@ -15,9 +15,14 @@
 package s3writer_test
 
 import (
+	"context"
+	"errors"
 	"os"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/RedHatInsights/parquet-factory/conf"
@@ -41,6 +46,13 @@ func TestNew(t *testing.T) {
 		assert.NotNil(t, value)
 	})
 
+	t.Run("unknown upload verification", func(t *testing.T) {
+		s3Conf := s3TestConf
+		s3Conf.VerifyUploads = "unknown"
+		_, err := s3writer.New(s3Conf)
+		assert.Error(t, err)
+	})
+
 	t.Run("invalid configuration", func(t *testing.T) {
 		err := os.Setenv("AWS_STS_REGIONAL_ENDPOINTS", "invalid-value")
 		assert.NoError(t, err)
@@ -54,3 +66,54 @@ func TestNew(t *testing.T) {
 		assert.NotNil(t, value)
 	})
 }
+
+// putObjectClient stores the objects written with PutObject
+type putObjectClient struct {
+	mockS3ClientAdapter
+	inputs []*s3.PutObjectInput
+	err    error
+}
+
+func (client *putObjectClient) PutObject(
+	_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options),
+) (*s3.PutObjectOutput, error) {
+	client.inputs = append(client.inputs, params)
+	return &s3.PutObjectOutput{}, client.err
+}
+
+func TestWriteObject(t *testing.T) {
+	client := &putObjectClient{}
+	sut := s3writer.S3Writer{S3Client: client, Bucket: "test_bucket"}
+
+	assert.NoError(t, sut.WriteObject(context.Background(), "key", []byte("content"), s3writer.ObjectOptions{}))
+	assert.Len(t, client.inputs, 1)
+	assert.Equal(t, "key", aws.ToString(client.inputs[0].Key))
+	assert.Nil(t, client.inputs[0].IfNoneMatch)
+}
+
+func TestCreateObject(t *testing.T) {
+	t.Run("object created", func(t *testing.T) {
+		client := &putObjectClient{}
+		sut := s3writer.S3Writer{S3Client: client, Bucket: "test_bucket"}
+
+		assert.NoError(t, sut.CreateObject(context.Background(), "key", []byte("content"), s3writer.ObjectOptions{}))
+		assert.Equal(t, "*", aws.ToString(client.inputs[0].IfNoneMatch))
+	})
+
+	t.Run("object already exists", func(t *testing.T) {
+		client := &putObjectClient{err: &smithy.GenericAPIError{Code: "PreconditionFailed"}}
+		sut := s3writer.S3Writer{S3Client: client, Bucket: "test_bucket"}
+
+		err := sut.CreateObject(context.Background(), "key", []byte("content"), s3writer.ObjectOptions{})
+		assert.ErrorIs(t, err, s3writer.ErrObjectExists)
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		client := &putObjectClient{err: errors.New("an error")}
+		sut := s3writer.S3Writer{S3Client: client, Bucket: "test_bucket"}
+
+		err := sut.CreateObject(context.Background(), "key", []byte("content"), s3writer.ObjectOptions{})
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, s3writer.ErrObjectExists)
+	})
+}
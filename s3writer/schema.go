@@ -0,0 +1,374 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/rs/zerolog/log"
+	sourceS3 "github.com/xitongsys/parquet-go-source/s3v2"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/schema"
+)
+
+// SchemaVersionKey is the key of the parquet file metadata that stores the
+// version of the schema the file was written with
+const SchemaVersionKey = "parquet_factory.schema_version"
+
+// UnknownSchemaVersion is used for the files written without a schema version
+const UnknownSchemaVersion = -1
+
+// VersionedSchema is implemented by the table rows whose schema is versioned.
+// Its version is stored in the metadata of every file written with it.
+type VersionedSchema interface {
+	SchemaVersion() int
+}
+
+// SchemaDescriptorFilename is the name of the descriptor stored under the
+// prefix of every table. It stores the schema of the files written in the
+// last run, so the latest file doesn't need to be looked for to know it.
+const SchemaDescriptorFilename = "_schema.json"
+
+// Column describes a column of a parquet file
+type Column struct {
+	Type        string `json:"type"`
+	LogicalType string `json:"logical_type,omitempty"`
+	Repetition  string `json:"repetition"`
+}
+
+// FileSchema describes the schema a parquet file was written with
+type FileSchema struct {
+	Version int               `json:"version"`
+	Columns map[string]Column `json:"columns"`
+	// ColumnNames stores the names of the columns in the order they are
+	// stored in the file
+	ColumnNames []string `json:"column_names"`
+}
+
+// schemaDescriptor is the part of the table descriptor storing the schema of
+// the files
+type schemaDescriptor struct {
+	ParquetSchema *FileSchema `json:"parquet_schema"`
+}
+
+// parseSchemaDescriptor returns the schema stored in the content of a table
+// descriptor, or nil if it was written without it
+func parseSchemaDescriptor(key string, content []byte) (*FileSchema, error) {
+	descriptor := schemaDescriptor{}
+	if err := json.Unmarshal(content, &descriptor); err != nil {
+		return nil, fmt.Errorf("unable to read the schema stored in %s: %w", key, err)
+	}
+	return descriptor.ParquetSchema, nil
+}
+
+// SchemaFromStruct returns the schema of the files written using the given
+// parquet tagged struct
+func SchemaFromStruct(obj interface{}) (*FileSchema, error) {
+	handler, err := schema.NewSchemaHandlerFromStruct(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	fileSchema := schemaFromHandler(handler)
+	if versioned, ok := obj.(VersionedSchema); ok {
+		fileSchema.Version = versioned.SchemaVersion()
+	}
+	return fileSchema, nil
+}
+
+// schemaFromFooter returns the schema stored in the footer of a parquet file
+func schemaFromFooter(footer *parquet.FileMetaData) *FileSchema {
+	fileSchema := schemaFromHandler(schema.NewSchemaHandlerFromSchemaList(footer.Schema))
+
+	for _, keyValue := range footer.KeyValueMetadata {
+		if keyValue.Key != SchemaVersionKey || keyValue.Value == nil {
+			continue
+		}
+		if version, err := strconv.Atoi(*keyValue.Value); err == nil {
+			fileSchema.Version = version
+		}
+	}
+	return fileSchema
+}
+
+func schemaFromHandler(handler *schema.SchemaHandler) *FileSchema {
+	fileSchema := &FileSchema{
+		Version: UnknownSchemaVersion,
+		Columns: map[string]Column{},
+	}
+
+	for i, element := range handler.SchemaElements {
+		if element.GetNumChildren() != 0 {
+			continue
+		}
+
+		exPath := common.StrToPath(handler.InPathToExPath[handler.IndexMap[int32(i)]])
+		column := Column{
+			Type:       element.GetType().String(),
+			Repetition: element.GetRepetitionType().String(),
+		}
+		if element.IsSetLogicalType() {
+			column.LogicalType = logicalTypeName(element.GetLogicalType())
+		} else if element.IsSetConvertedType() {
+			column.LogicalType = element.GetConvertedType().String()
+		}
+		// the first element of the path is the root of the schema
+		name := strings.Join(exPath[1:], ".")
+		fileSchema.Columns[name] = column
+		fileSchema.ColumnNames = append(fileSchema.ColumnNames, name)
+	}
+	return fileSchema
+}
+
+// logicalTypeName returns a short description of the given logical type,
+// like TIMESTAMP(MILLIS) or INTEGER(32,true)
+func logicalTypeName(logicalType *parquet.LogicalType) string {
+	switch {
+	case logicalType.IsSetSTRING():
+		return "STRING"
+	case logicalType.IsSetDATE():
+		return "DATE"
+	case logicalType.IsSetTIMESTAMP():
+		return fmt.Sprintf("TIMESTAMP(%s)", timeUnitName(logicalType.TIMESTAMP.GetUnit()))
+	case logicalType.IsSetTIME():
+		return fmt.Sprintf("TIME(%s)", timeUnitName(logicalType.TIME.GetUnit()))
+	case logicalType.IsSetINTEGER():
+		return fmt.Sprintf("INTEGER(%d,%t)", logicalType.INTEGER.GetBitWidth(), logicalType.INTEGER.GetIsSigned())
+	case logicalType.IsSetDECIMAL():
+		return fmt.Sprintf("DECIMAL(%d,%d)", logicalType.DECIMAL.GetPrecision(), logicalType.DECIMAL.GetScale())
+	case logicalType.IsSetJSON():
+		return "JSON"
+	case logicalType.IsSetBSON():
+		return "BSON"
+	case logicalType.IsSetUUID():
+		return "UUID"
+	case logicalType.IsSetENUM():
+		return "ENUM"
+	case logicalType.IsSetLIST():
+		return "LIST"
+	case logicalType.IsSetMAP():
+		return "MAP"
+	}
+	return logicalType.String()
+}
+
+func timeUnitName(unit *parquet.TimeUnit) string {
+	switch {
+	case unit == nil:
+		return ""
+	case unit.IsSetMILLIS():
+		return "MILLIS"
+	case unit.IsSetMICROS():
+		return "MICROS"
+	case unit.IsSetNANOS():
+		return "NANOS"
+	}
+	return unit.String()
+}
+
+// CheckCompatibility returns an error if a file written with the current schema
+// can't be read along with the files written with the previous one. New
+// columns are allowed, but dropping a column or changing its type is not.
+func CheckCompatibility(previous, current *FileSchema) error {
+	problems := []string{}
+
+	for name, previousColumn := range previous.Columns {
+		currentColumn, ok := current.Columns[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("column %s was dropped", name))
+			continue
+		}
+		if currentColumn != previousColumn {
+			problems = append(problems, fmt.Sprintf("column %s changed from %+v to %+v", name, previousColumn, currentColumn))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf(
+		"schema version %d is not compatible with version %d: %s",
+		current.Version, previous.Version, strings.Join(problems, ", "))
+}
+
+// LatestSchema returns the schema of the files written under the given
+// prefix in the last run, stored in the descriptor of the table, or nil if
+// there is no file there. The most recently written parquet file is read
+// instead if the descriptor doesn't store the schema. The options identify
+// the table the objects belong to, needed to read them if they are encrypted
+// with a SSE-C key.
+func (s3Writer *S3Writer) LatestSchema(ctx context.Context, prefix string, options ObjectOptions) (*FileSchema, error) {
+	fileSchema, err := s3Writer.descriptorSchema(ctx, prefix, options.Table)
+	if err != nil || fileSchema != nil {
+		return fileSchema, err
+	}
+
+	var latestKey string
+	err = s3Writer.RetryPolicy.Do(ctx, "list_objects", func() (err error) {
+		latestKey, err = s3Writer.latestParquetKey(ctx, prefix)
+		return err
+	})
+	if err != nil || latestKey == "" {
+		return nil, err
+	}
+
+	footer, err := s3Writer.readFooter(ctx, latestKey, options.Table)
+	if err != nil {
+		return nil, err
+	}
+	return schemaFromFooter(footer), nil
+}
+
+// descriptorSchema returns the schema stored in the descriptor of the table
+// under the given prefix, or nil if there is no descriptor storing it
+func (s3Writer *S3Writer) descriptorSchema(ctx context.Context, prefix, table string) (*FileSchema, error) {
+	key := prefix + SchemaDescriptorFilename
+	var content []byte
+	err := s3Writer.RetryPolicy.Do(ctx, "read_descriptor", func() error {
+		output, err := s3Writer.readClient(table).GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s3Writer.Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = output.Body.Close()
+		}()
+		content, err = io.ReadAll(output.Body)
+		return err
+	})
+
+	var noSuchKey *types.NoSuchKey
+	var apiErr smithy.APIError
+	if errors.As(err, &noSuchKey) || (errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchKey") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseSchemaDescriptor(key, content)
+}
+
+// readFooter returns the footer of the parquet file of the given table
+// stored with the given key
+func (s3Writer *S3Writer) readFooter(ctx context.Context, key, table string) (*parquet.FileMetaData, error) {
+	file, err := sourceS3.NewS3FileReaderWithClient(ctx, s3Writer.readClient(table), s3Writer.Bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("Unable to close the parquet file")
+		}
+	}()
+
+	parquetReader := &reader.ParquetReader{PFile: file}
+	if err := parquetReader.ReadFooter(); err != nil {
+		return nil, fmt.Errorf("unable to read the footer of %s: %w", key, err)
+	}
+	return parquetReader.Footer, nil
+}
+
+// CheckSchema returns an error if the given parquet tagged struct is not
+// compatible with the schema of the latest file stored under the given prefix
+func (s3Writer *S3Writer) CheckSchema(ctx context.Context, prefix string, obj interface{}, options ObjectOptions) error {
+	return checkSchema(prefix, obj, func() (*FileSchema, error) {
+		return s3Writer.LatestSchema(ctx, prefix, options)
+	})
+}
+
+// checkSchema returns an error if the given parquet tagged struct is not
+// compatible with the schema returned by latest
+func checkSchema(prefix string, obj interface{}, latest func() (*FileSchema, error)) error {
+	current, err := SchemaFromStruct(obj)
+	if err != nil {
+		return err
+	}
+
+	previous, err := latest()
+	if err != nil {
+		log.Error().Err(err).Str("prefix", prefix).Msg("Unable to retrieve the schema of the latest file")
+		return err
+	}
+	if previous == nil {
+		return nil
+	}
+
+	return CheckCompatibility(previous, current)
+}
+
+// latestParquetKey returns the key of the parquet file modified most recently
+// under the given prefix, or an empty string if there is no file there
+func (s3Writer *S3Writer) latestParquetKey(ctx context.Context, prefix string) (string, error) {
+	var (
+		latestKey      string
+		latestModified time.Time
+		lastKey        string
+	)
+
+	for {
+		output, err := s3Writer.S3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:     aws.String(s3Writer.Bucket),
+			Prefix:     aws.String(prefix),
+			MaxKeys:    aws.Int32(listMaxKey),
+			StartAfter: aws.String(lastKey),
+			Delimiter:  aws.String(""),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		for _, object := range output.Contents {
+			key := aws.ToString(object.Key)
+			lastKey = key
+			modified := aws.ToTime(object.LastModified)
+			if isLatestParquet(prefix, key, modified, latestKey, latestModified) {
+				latestKey = key
+				latestModified = modified
+			}
+		}
+
+		if !aws.ToBool(output.IsTruncated) || len(output.Contents) == 0 {
+			return latestKey, nil
+		}
+	}
+}
+
+// isLatestParquet returns true if the given object under the prefix is a
+// parquet file modified after the latest one found so far. The greatest key
+// is taken if both were modified at the same time.
+func isLatestParquet(prefix, key string, modified time.Time, latestKey string, latestModified time.Time) bool {
+	if !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, ".parquet") {
+		return false
+	}
+	return latestKey == "" || modified.After(latestModified) ||
+		(modified.Equal(latestModified) && key > latestKey)
+}
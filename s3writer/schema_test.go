@@ -0,0 +1,159 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	s3mocks "github.com/RedHatInsights/insights-operator-utils/s3/mocks"
+	"github.com/RedHatInsights/parquet-factory/retry"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+type versionedTestTableSchema struct {
+	ID          string `parquet:"name=id, type=BYTE_ARRAY, encoding=PLAIN_DICTIONARY"`
+	CollectedAt int64  `parquet:"name=collected_at, type=INT64, logicaltype=TIMESTAMP, logicaltype.isadjustedtoutc=true, logicaltype.unit=MILLIS"`
+	Count       int32  `parquet:"name=count, type=INT32"`
+}
+
+func (versionedTestTableSchema) SchemaVersion() int {
+	return 2
+}
+
+type changedTestTableSchema struct {
+	ID          int64 `parquet:"name=id, type=INT64"`
+	CollectedAt int64 `parquet:"name=collected_at, type=INT64, logicaltype=TIMESTAMP, logicaltype.isadjustedtoutc=true, logicaltype.unit=MILLIS"`
+}
+
+func TestSchemaFromStruct(t *testing.T) {
+	t.Run("schema without version", func(t *testing.T) {
+		fileSchema, err := s3writer.SchemaFromStruct(&testTableSchema{})
+		assert.NoError(t, err)
+		assert.Equal(t, s3writer.UnknownSchemaVersion, fileSchema.Version)
+		assert.Len(t, fileSchema.Columns, 2)
+		assert.Equal(t, "BYTE_ARRAY", fileSchema.Columns["id"].Type)
+		assert.Equal(t, "INT64", fileSchema.Columns["collected_at"].Type)
+	})
+
+	t.Run("versioned schema", func(t *testing.T) {
+		fileSchema, err := s3writer.SchemaFromStruct(&versionedTestTableSchema{})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, fileSchema.Version)
+		assert.Len(t, fileSchema.Columns, 3)
+	})
+
+	t.Run("invalid schema", func(t *testing.T) {
+		_, err := s3writer.SchemaFromStruct(testTableSchema{})
+		assert.Error(t, err)
+	})
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	previous, err := s3writer.SchemaFromStruct(&testTableSchema{})
+	assert.NoError(t, err)
+
+	t.Run("same schema", func(t *testing.T) {
+		assert.NoError(t, s3writer.CheckCompatibility(previous, previous))
+	})
+
+	t.Run("additive change", func(t *testing.T) {
+		current, err := s3writer.SchemaFromStruct(&versionedTestTableSchema{})
+		assert.NoError(t, err)
+		assert.NoError(t, s3writer.CheckCompatibility(previous, current))
+	})
+
+	t.Run("dropped column", func(t *testing.T) {
+		current, err := s3writer.SchemaFromStruct(&versionedTestTableSchema{})
+		assert.NoError(t, err)
+		err = s3writer.CheckCompatibility(current, previous)
+		assert.ErrorContains(t, err, "column count was dropped")
+	})
+
+	t.Run("type change", func(t *testing.T) {
+		current, err := s3writer.SchemaFromStruct(&changedTestTableSchema{})
+		assert.NoError(t, err)
+		err = s3writer.CheckCompatibility(previous, current)
+		assert.ErrorContains(t, err, "column id changed")
+	})
+}
+
+func TestCheckSchema(t *testing.T) {
+	mockClient := s3mocks.MockS3Client{}
+	sut := newMockS3Writer(t, &mockClient)
+
+	t.Run("no previous files", func(t *testing.T) {
+		err := sut.CheckSchema(context.Background(), "prefix/table/", &testTableSchema{}, s3writer.ObjectOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("unable to list the previous files", func(t *testing.T) {
+		mockClient.Err = errors.New("an error")
+		defer func() { mockClient.Err = nil }()
+
+		err := sut.CheckSchema(context.Background(), "prefix/table/", &testTableSchema{}, s3writer.ObjectOptions{})
+		assert.Error(t, err)
+	})
+}
+
+func TestLatestSchemaDescriptor(t *testing.T) {
+	current, err := s3writer.SchemaFromStruct(&testTableSchema{})
+	assert.NoError(t, err)
+	descriptor, err := json.Marshal(map[string]interface{}{"name": "table", "parquet_schema": current})
+	assert.NoError(t, err)
+
+	t.Run("reads the schema stored in the descriptor", func(t *testing.T) {
+		client := newMemoryClient()
+		client.objects["prefix/table/_schema.json"] = descriptor
+		sut := s3writer.S3Writer{S3Client: client, Bucket: "test_bucket"}
+
+		schema, err := sut.LatestSchema(context.Background(), "prefix/table/", s3writer.ObjectOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, current, schema)
+		// the files aren't listed
+		assert.Equal(t, 0, client.lists)
+	})
+
+	t.Run("reads the latest file without the schema in the descriptor", func(t *testing.T) {
+		client := newMemoryClient()
+		client.objects["prefix/table/_schema.json"] = []byte(`{"name": "table"}`)
+		client.listFailures = 1
+		sut := s3writer.S3Writer{S3Client: client, Bucket: "test_bucket", RetryPolicy: retry.Policy{MaxRetries: 1}}
+
+		file, err := sut.NewFile(context.Background(), "prefix/table/file.parquet", &testTableSchema{}, s3writer.FileOptions{})
+		assert.NoError(t, err)
+		assert.NoError(t, file.AddRow(testRow))
+		assert.NoError(t, file.CloseFile())
+
+		// the failed listing is retried
+		schema, err := sut.LatestSchema(context.Background(), "prefix/table/", s3writer.ObjectOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, current.Columns, schema.Columns)
+		assert.Equal(t, 2, client.lists)
+	})
+
+	t.Run("invalid descriptor", func(t *testing.T) {
+		client := newMemoryClient()
+		client.objects["prefix/table/_schema.json"] = []byte("{")
+		sut := s3writer.S3Writer{S3Client: client, Bucket: "test_bucket"}
+
+		_, err := sut.LatestSchema(context.Background(), "prefix/table/", s3writer.ObjectOptions{})
+		assert.ErrorContains(t, err, "_schema.json")
+	})
+}
@@ -0,0 +1,318 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/retry"
+	"github.com/RedHatInsights/parquet-factory/utils"
+)
+
+// ErrObjectNotFound is returned by the object stores when there is no object
+// stored with the given key
+var ErrObjectNotFound = errors.New("the object doesn't exist")
+
+// ObjectInfo describes an object stored in an ObjectStore
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	// CRC32C is the big-endian CRC32C checksum of the content, or nil if the
+	// store doesn't provide it
+	CRC32C []byte
+}
+
+// StoreUploadOptions defines how an object is uploaded into an ObjectStore
+type StoreUploadOptions struct {
+	// Metadata stored along with the object
+	Metadata map[string]string
+	// IfNotExists makes the upload fail with ErrObjectExists if there is
+	// already an object stored with the same key
+	IfNotExists bool
+}
+
+// ObjectStore is implemented by the object storages other than S3 the
+// parquet files can be written into
+type ObjectStore interface {
+	// List returns the objects stored under the given prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Stat returns the object stored with the given key, or
+	// ErrObjectNotFound if there is none
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Upload stores the content read from the reader under the given key
+	Upload(ctx context.Context, key string, content io.Reader, options StoreUploadOptions) error
+	// ReadRange returns length bytes of the object stored with the given
+	// key, starting at offset
+	ReadRange(ctx context.Context, key string, offset, length int64) ([]byte, error)
+	// Delete removes the objects with the given keys in batches, returning
+	// a DeleteError with the keys of the ones that couldn't be removed. The
+	// objects already missing are considered removed.
+	Delete(ctx context.Context, keys []string) error
+	// Ping returns an error if the bucket can't be reached
+	Ping(ctx context.Context) error
+}
+
+// StoreWriter handle writing tables to the bucket of an ObjectStore
+type StoreWriter struct {
+	Store       ObjectStore
+	RetryPolicy retry.Policy // used to retry the listings and deletions
+	// VerifyUploads is the way the parquet files are verified once they are
+	// uploaded, as in S3Writer
+	VerifyUploads string
+	prefix        string
+	// allowOverwrite lets new parquet files replace the existing ones
+	allowOverwrite bool
+	// tags enables storing the tags of the objects as their metadata,
+	// replaced by tableTags for the objects of each table
+	tags      bool
+	tableTags map[string]bool
+}
+
+// NewStoreWriter creates a StoreWriter writing into the given store. Only
+// the tags are supported from the upload options.
+func NewStoreWriter(store ObjectStore, s3Config conf.S3Config) (*StoreWriter, error) {
+	verifyUploads, err := verifyMode(s3Config.VerifyUploads)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := storeTags(s3Config.Upload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload options: %w", err)
+	}
+	tableTags := make(map[string]bool, len(s3Config.TableUploads))
+	for table, config := range s3Config.TableUploads {
+		if tableTags[table], err = storeTags(config); err != nil {
+			return nil, fmt.Errorf("invalid upload options for table %s: %w", table, err)
+		}
+	}
+
+	return &StoreWriter{
+		Store:         store,
+		RetryPolicy:   retry.NewPolicy(conf.GetRetryConfiguration(), s3Config.MaxRetries),
+		VerifyUploads: verifyUploads,
+		prefix:        s3Config.FilePathPrefix,
+
+		allowOverwrite: s3Config.AllowOverwrite,
+		tags:           tags,
+		tableTags:      tableTags,
+	}, nil
+}
+
+// storeTags returns whether the given upload options enable the tags, or an
+// error if they use an option only supported by S3
+func storeTags(config conf.UploadConfig) (bool, error) {
+	if config.ServerSideEncryption != "" || config.KMSKeyID != "" ||
+		config.SSECustomerKey != "" || config.StorageClass != "" {
+		return false, errors.New("the encryption and the storage class are only supported by S3")
+	}
+	return config.Tags, nil
+}
+
+// metadata returns the metadata an object is uploaded with: its tags, if they
+// are enabled for its table
+func (storeWriter *StoreWriter) metadata(options ObjectOptions) map[string]string {
+	tags, ok := storeWriter.tableTags[options.Table]
+	if !ok {
+		tags = storeWriter.tags
+	}
+	if !tags {
+		return nil
+	}
+	return options.Tags
+}
+
+// Prefix returns the default prefix for files in this writer
+func (storeWriter *StoreWriter) Prefix() string {
+	return storeWriter.prefix
+}
+
+// Ping returns an error if the bucket can't be reached
+func (storeWriter *StoreWriter) Ping(ctx context.Context) error {
+	return storeWriter.Store.Ping(ctx)
+}
+
+// GetLastIndexForParquet a map with the last used index for the objects in a
+// given filepath, as in S3Writer
+func (storeWriter *StoreWriter) GetLastIndexForParquet(
+	ctx context.Context, layout *utils.PartitionLayout, folder string,
+) (map[string]int, error) {
+	var keys []string
+	err := storeWriter.RetryPolicy.Do(ctx, "list_objects", func() (err error) {
+		keys, err = storeWriter.ListObjects(ctx, folder)
+		return err
+	})
+	if err != nil {
+		log.Error().Err(err).Str("folder", folder).Msg("Unable to retrieve the indexes from the bucket")
+		return nil, err
+	}
+
+	return lastIndexes(layout, keys), nil
+}
+
+// ListObjects returns the keys of all the objects stored under the given prefix
+func (storeWriter *StoreWriter) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	objects, err := storeWriter.Store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(objects))
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	return keys, nil
+}
+
+// DeleteFiles removes files from the bucket, retrying the ones that can't be
+// removed as in S3Writer
+func (storeWriter *StoreWriter) DeleteFiles(filepaths []string) error {
+	return deleteWithRetries(storeWriter.RetryPolicy, filepaths, func(keys []string) error {
+		return storeWriter.Store.Delete(context.Background(), keys)
+	})
+}
+
+// WriteObject stores the given content in the bucket under the given key,
+// replacing it if it already exists
+func (storeWriter *StoreWriter) WriteObject(ctx context.Context, key string, content []byte, options ObjectOptions) error {
+	return storeWriter.Store.Upload(ctx, key, bytes.NewReader(content), StoreUploadOptions{
+		Metadata: storeWriter.metadata(options),
+	})
+}
+
+// CreateObject stores the given content in the bucket under the given key
+// only if there is no object stored there yet. ErrObjectExists is returned
+// otherwise.
+func (storeWriter *StoreWriter) CreateObject(ctx context.Context, key string, content []byte, options ObjectOptions) error {
+	return storeWriter.Store.Upload(ctx, key, bytes.NewReader(content), StoreUploadOptions{
+		Metadata:    storeWriter.metadata(options),
+		IfNotExists: true,
+	})
+}
+
+// CheckSchema returns an error if the given parquet tagged struct is not
+// compatible with the schema of the latest file stored under the given prefix
+func (storeWriter *StoreWriter) CheckSchema(ctx context.Context, prefix string, obj interface{}, _ ObjectOptions) error {
+	return checkSchema(prefix, obj, func() (*FileSchema, error) {
+		return storeWriter.LatestSchema(ctx, prefix)
+	})
+}
+
+// LatestSchema returns the schema of the files written under the given
+// prefix in the last run, as in S3Writer, or nil if there is no file there
+func (storeWriter *StoreWriter) LatestSchema(ctx context.Context, prefix string) (*FileSchema, error) {
+	fileSchema, err := storeWriter.descriptorSchema(ctx, prefix)
+	if err != nil || fileSchema != nil {
+		return fileSchema, err
+	}
+
+	var objects []ObjectInfo
+	err = storeWriter.RetryPolicy.Do(ctx, "list_objects", func() (err error) {
+		objects, err = storeWriter.Store.List(ctx, prefix)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var latest ObjectInfo
+	for _, object := range objects {
+		if isLatestParquet(prefix, object.Key, object.LastModified, latest.Key, latest.LastModified) {
+			latest = object
+		}
+	}
+	if latest.Key == "" {
+		return nil, nil
+	}
+
+	footer, err := storeWriter.readFooter(ctx, latest.Key, latest.Size)
+	if err != nil {
+		return nil, err
+	}
+	return schemaFromFooter(footer), nil
+}
+
+// descriptorSchema returns the schema stored in the descriptor of the table
+// under the given prefix, or nil if there is no descriptor storing it
+func (storeWriter *StoreWriter) descriptorSchema(ctx context.Context, prefix string) (*FileSchema, error) {
+	key := prefix + SchemaDescriptorFilename
+	var content []byte
+	err := storeWriter.RetryPolicy.Do(ctx, "read_descriptor", func() error {
+		info, err := storeWriter.Store.Stat(ctx, key)
+		if err != nil {
+			return err
+		}
+		content, err = storeWriter.Store.ReadRange(ctx, key, 0, info.Size)
+		return err
+	})
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseSchemaDescriptor(key, content)
+}
+
+// readFooter returns the footer of the parquet file of the given size stored
+// with the given key
+func (storeWriter *StoreWriter) readFooter(ctx context.Context, key string, size int64) (*parquet.FileMetaData, error) {
+	file := &rangeFile{ctx: ctx, store: storeWriter.Store, key: key, size: size}
+	parquetReader := &reader.ParquetReader{PFile: file}
+	if err := parquetReader.ReadFooter(); err != nil {
+		return nil, fmt.Errorf("unable to read the footer of %s: %w", key, err)
+	}
+	return parquetReader.Footer, nil
+}
+
+// verify returns a VerificationError if the object stored with the given key
+// doesn't match the content written into the file
+func (storeWriter *StoreWriter) verify(ctx context.Context, key string, file *countingFile, rows int64) error {
+	if storeWriter.VerifyUploads == "" || storeWriter.VerifyUploads == VerifyNone {
+		return nil
+	}
+
+	info, err := storeWriter.Store.Stat(ctx, key)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Unable to verify the uploaded file")
+		return err
+	}
+
+	if info.Size != file.written {
+		return verificationFailed(key, fmt.Sprintf("%d bytes stored, %d bytes written", info.Size, file.written))
+	}
+	if written := file.checksum.Sum(nil); info.CRC32C != nil && !bytes.Equal(info.CRC32C, written) {
+		return verificationFailed(key, fmt.Sprintf("checksum %s stored, %s written",
+			base64.StdEncoding.EncodeToString(info.CRC32C), base64.StdEncoding.EncodeToString(written)))
+	}
+
+	if storeWriter.VerifyUploads != VerifyFooter {
+		return nil
+	}
+	return verifyRows(key, rows, func() (*parquet.FileMetaData, error) {
+		return storeWriter.readFooter(ctx, key, info.Size)
+	})
+}
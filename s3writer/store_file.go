@@ -0,0 +1,232 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"github.com/rs/zerolog/log"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// minRangeRead is the minimum number of bytes requested every time a stored
+// file is read, so reading its footer doesn't take a request per field
+const minRangeRead = 64 * 1024
+
+// errWriteOnly and errReadOnly are returned by the operations the files
+// can't do
+var (
+	errWriteOnly = errors.New("the file can only be written")
+	errReadOnly  = errors.New("the file can only be read")
+)
+
+// crc32c is the table of the CRC32C checksums computed by the object stores
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// StoreFile handle a parquet file uploaded into an ObjectStore
+type StoreFile struct {
+	ctx         context.Context
+	storeWriter *StoreWriter
+	key         string
+	file        *countingFile
+	upload      *storeUpload
+	writer      *writer.ParquetWriter
+	// rows is the number of rows added to the file
+	rows int64
+}
+
+// AddRow add row to current parquet file
+func (file *StoreFile) AddRow(row interface{}) error {
+	if err := file.writer.Write(row); err != nil {
+		return err
+	}
+	file.rows++
+	return nil
+}
+
+// CloseFile close file, waiting for its upload to finish, and verifies it as
+// configured in the writer
+func (file *StoreFile) CloseFile() error {
+	if err := file.writer.WriteStop(); err != nil {
+		file.upload.abort(err)
+		return err
+	}
+	if err := file.file.Close(); err != nil {
+		return err
+	}
+
+	return file.storeWriter.verify(file.ctx, file.key, file.file, file.rows)
+}
+
+// Size returns the number of bytes written into the file
+func (file *StoreFile) Size() int64 {
+	return file.file.written
+}
+
+// NewFile create new parquet file instance, streamed into the store while
+// the rows are added. ErrObjectExists is returned if there is already an
+// object stored in the path, unless overwriting it is allowed by the options
+// or the configuration of the writer. The upload is conditional in that case,
+// as in S3Writer.
+func (storeWriter *StoreWriter) NewFile(
+	ctx context.Context, path string, schema interface{}, options FileOptions,
+) (S3ParquetFile, error) {
+	ifNotExists := !options.Overwrite && !storeWriter.allowOverwrite
+	if ifNotExists {
+		_, err := storeWriter.Store.Stat(ctx, path)
+		if err == nil {
+			log.Error().Str("key", path).Msg("Refusing to overwrite an existing file")
+			return nil, ErrObjectExists
+		}
+		if !errors.Is(err, ErrObjectNotFound) {
+			log.Error().Err(err).Str("key", path).Msg("Unable to check if the file already exists")
+			return nil, err
+		}
+	}
+
+	upload := startUpload(ctx, storeWriter.Store, path, StoreUploadOptions{
+		Metadata:    storeWriter.metadata(options.ObjectOptions),
+		IfNotExists: ifNotExists,
+	})
+	pfw := &countingFile{ParquetFile: upload, checksum: crc32.New(crc32c)}
+	pw, err := newParquetWriter(pfw, schema)
+	if err != nil {
+		upload.abort(err)
+		return nil, err
+	}
+
+	return &StoreFile{
+		ctx:         ctx,
+		storeWriter: storeWriter,
+		key:         path,
+		file:        pfw,
+		upload:      upload,
+		writer:      pw,
+	}, nil
+}
+
+// storeUpload streams the content written into it to the store, which is
+// uploaded in the background until the file is closed
+type storeUpload struct {
+	pipe *io.PipeWriter
+	done chan error
+}
+
+func startUpload(ctx context.Context, store ObjectStore, key string, options StoreUploadOptions) *storeUpload {
+	pipeReader, pipeWriter := io.Pipe()
+	upload := &storeUpload{pipe: pipeWriter, done: make(chan error, 1)}
+
+	go func() {
+		err := store.Upload(ctx, key, pipeReader, options)
+		// the pending writes fail with the error of the upload
+		pipeReader.CloseWithError(err)
+		upload.done <- err
+	}()
+	return upload
+}
+
+func (upload *storeUpload) Write(p []byte) (int, error) {
+	return upload.pipe.Write(p)
+}
+
+// Close finishes the content of the file, returning the error of its upload
+func (upload *storeUpload) Close() error {
+	if err := upload.pipe.Close(); err != nil {
+		return err
+	}
+	return <-upload.done
+}
+
+// abort stops the upload with the given error, so the file isn't stored
+func (upload *storeUpload) abort(err error) {
+	upload.pipe.CloseWithError(err)
+	<-upload.done
+}
+
+func (upload *storeUpload) Seek(int64, int) (int64, error) { return 0, errWriteOnly }
+
+func (upload *storeUpload) Read([]byte) (int, error) { return 0, errWriteOnly }
+
+func (upload *storeUpload) Open(string) (source.ParquetFile, error) { return nil, errWriteOnly }
+
+func (upload *storeUpload) Create(string) (source.ParquetFile, error) { return nil, errWriteOnly }
+
+// rangeFile reads a stored file of a known size by ranges
+type rangeFile struct {
+	ctx    context.Context
+	store  ObjectStore
+	key    string
+	size   int64
+	offset int64
+	// buffer stores the last range read, starting at bufferOffset
+	buffer       []byte
+	bufferOffset int64
+}
+
+func (file *rangeFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += file.offset
+	case io.SeekEnd:
+		offset += file.size
+	}
+	if offset < 0 || offset > file.size {
+		return 0, errors.New("invalid offset")
+	}
+	file.offset = offset
+	return offset, nil
+}
+
+func (file *rangeFile) Read(p []byte) (int, error) {
+	if file.offset >= file.size {
+		return 0, io.EOF
+	}
+
+	start := file.offset - file.bufferOffset
+	if start < 0 || start >= int64(len(file.buffer)) {
+		// the ranges close to the end start earlier, so the footer and its
+		// length are read at once
+		rangeStart := file.offset
+		if file.size-rangeStart < minRangeRead {
+			rangeStart = max(0, file.size-minRangeRead)
+		}
+		rangeEnd := min(file.size, max(file.offset+int64(len(p)), rangeStart+minRangeRead))
+
+		buffer, err := file.store.ReadRange(file.ctx, file.key, rangeStart, rangeEnd-rangeStart)
+		if err != nil {
+			return 0, err
+		}
+		if int64(len(buffer)) <= file.offset-rangeStart {
+			return 0, io.ErrUnexpectedEOF
+		}
+		file.buffer, file.bufferOffset, start = buffer, rangeStart, file.offset-rangeStart
+	}
+
+	n := copy(p, file.buffer[start:])
+	file.offset += int64(n)
+	return n, nil
+}
+
+func (file *rangeFile) Write([]byte) (int, error) { return 0, errReadOnly }
+
+func (file *rangeFile) Close() error { return nil }
+
+func (file *rangeFile) Open(string) (source.ParquetFile, error) { return nil, errReadOnly }
+
+func (file *rangeFile) Create(string) (source.ParquetFile, error) { return nil, errReadOnly }
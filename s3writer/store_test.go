@@ -0,0 +1,357 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+	"github.com/RedHatInsights/parquet-factory/utils"
+)
+
+type storedObject struct {
+	content  []byte
+	metadata map[string]string
+	modified time.Time
+}
+
+// memoryStore is an ObjectStore keeping the objects in memory. The stored
+// content can be corrupted to check that it is detected, and the deletion
+// of some keys can be made to fail.
+type memoryStore struct {
+	mutex   sync.Mutex
+	objects map[string]storedObject
+	// corrupt modifies the content before storing it
+	corrupt func([]byte) []byte
+	// failedDeletes is the number of times the deletion of every key fails
+	failedDeletes map[string]int
+	// ranges counts the ranges read
+	ranges int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{objects: map[string]storedObject{}, failedDeletes: map[string]int{}}
+}
+
+func (store *memoryStore) info(key string, object storedObject) s3writer.ObjectInfo {
+	checksum := crc32.Checksum(object.content, crc32.MakeTable(crc32.Castagnoli))
+	return s3writer.ObjectInfo{
+		Key:          key,
+		Size:         int64(len(object.content)),
+		LastModified: object.modified,
+		CRC32C:       binary.BigEndian.AppendUint32(nil, checksum),
+	}
+}
+
+func (store *memoryStore) List(_ context.Context, prefix string) ([]s3writer.ObjectInfo, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	objects := []s3writer.ObjectInfo{}
+	for key, object := range store.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, store.info(key, object))
+		}
+	}
+	return objects, nil
+}
+
+func (store *memoryStore) Stat(_ context.Context, key string) (s3writer.ObjectInfo, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	object, ok := store.objects[key]
+	if !ok {
+		return s3writer.ObjectInfo{}, s3writer.ErrObjectNotFound
+	}
+	return store.info(key, object), nil
+}
+
+func (store *memoryStore) Upload(
+	_ context.Context, key string, content io.Reader, options s3writer.StoreUploadOptions,
+) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.objects[key]; ok && options.IfNotExists {
+		return s3writer.ErrObjectExists
+	}
+	if store.corrupt != nil {
+		data = store.corrupt(data)
+	}
+	store.objects[key] = storedObject{content: data, metadata: options.Metadata, modified: time.Now()}
+	return nil
+}
+
+func (store *memoryStore) ReadRange(_ context.Context, key string, offset, length int64) ([]byte, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	object, ok := store.objects[key]
+	if !ok {
+		return nil, s3writer.ErrObjectNotFound
+	}
+	store.ranges++
+	return object.content[offset:min(offset+length, int64(len(object.content)))], nil
+}
+
+func (store *memoryStore) Delete(_ context.Context, keys []string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	undeleted := []string{}
+	for _, key := range keys {
+		if store.failedDeletes[key] > 0 {
+			store.failedDeletes[key]--
+			undeleted = append(undeleted, key)
+			continue
+		}
+		delete(store.objects, key)
+	}
+	if len(undeleted) > 0 {
+		return &s3writer.DeleteError{Keys: undeleted}
+	}
+	return nil
+}
+
+func (store *memoryStore) Ping(context.Context) error {
+	return nil
+}
+
+func newTestStoreWriter(t *testing.T, store s3writer.ObjectStore, s3Config conf.S3Config) *s3writer.StoreWriter {
+	storeWriter, err := s3writer.NewStoreWriter(store, s3Config)
+	assert.NoError(t, err)
+	return storeWriter
+}
+
+func writeStoreFile(storeWriter *s3writer.StoreWriter, key string, options s3writer.FileOptions) error {
+	file, err := storeWriter.NewFile(context.Background(), key, &testTableSchema{}, options)
+	if err != nil {
+		return err
+	}
+	if err := file.AddRow(testRow); err != nil {
+		return err
+	}
+	return file.CloseFile()
+}
+
+func TestNewStoreWriter(t *testing.T) {
+	testCases := map[string]conf.S3Config{
+		"unknown upload verification": {VerifyUploads: "unknown"},
+		"encryption":                  {Upload: conf.UploadConfig{ServerSideEncryption: "AES256"}},
+		"storage class of a table": {TableUploads: map[string]conf.UploadConfig{
+			"archives": {StorageClass: "STANDARD_IA"},
+		}},
+	}
+	for name, s3Config := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := s3writer.NewStoreWriter(newMemoryStore(), s3Config)
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("valid configuration", func(t *testing.T) {
+		storeWriter := newTestStoreWriter(t, newMemoryStore(), conf.S3Config{FilePathPrefix: "fleet_data"})
+		assert.Equal(t, "fleet_data", storeWriter.Prefix())
+		assert.Equal(t, s3writer.VerifyNone, storeWriter.VerifyUploads)
+	})
+}
+
+func TestStoreWriterFiles(t *testing.T) {
+	t.Run("writes and reads back the files", func(t *testing.T) {
+		store := newMemoryStore()
+		storeWriter := newTestStoreWriter(t, store, conf.S3Config{VerifyUploads: s3writer.VerifyFooter})
+		folder := "fleet_data/cluster_info/hourly/date=2022-01-01/hour=01/"
+
+		assert.NoError(t, writeStoreFile(storeWriter, folder+"cluster_info-0.parquet", s3writer.FileOptions{}))
+		assert.NoError(t, writeStoreFile(storeWriter, folder+"cluster_info-3.parquet", s3writer.FileOptions{}))
+
+		keys, err := storeWriter.ListObjects(context.Background(), folder)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{folder + "cluster_info-0.parquet", folder + "cluster_info-3.parquet"}, keys)
+
+		indexes, err := storeWriter.GetLastIndexForParquet(context.Background(), utils.DefaultPartitionLayout(), folder)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"cluster_info": 3}, indexes)
+
+		ranges := store.ranges
+		schema, err := storeWriter.LatestSchema(context.Background(), "fleet_data/cluster_info/")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"id", "collected_at"}, schema.ColumnNames)
+		// the footer is read in a single range
+		assert.Equal(t, 1, store.ranges-ranges)
+
+		assert.NoError(t, storeWriter.CheckSchema(
+			context.Background(), "fleet_data/cluster_info/", &testTableSchema{}, s3writer.ObjectOptions{}))
+		assert.Error(t, storeWriter.CheckSchema(
+			context.Background(), "fleet_data/cluster_info/", &changedTestTableSchema{}, s3writer.ObjectOptions{}))
+	})
+
+	t.Run("reads the schema stored in the descriptor", func(t *testing.T) {
+		store := newMemoryStore()
+		storeWriter := newTestStoreWriter(t, store, conf.S3Config{})
+		changed, err := s3writer.SchemaFromStruct(&changedTestTableSchema{})
+		assert.NoError(t, err)
+		descriptor, err := json.Marshal(map[string]interface{}{"parquet_schema": changed})
+		assert.NoError(t, err)
+		store.objects["fleet_data/_schema.json"] = storedObject{content: descriptor}
+
+		schema, err := storeWriter.LatestSchema(context.Background(), "fleet_data/")
+		assert.NoError(t, err)
+		assert.Equal(t, changed, schema)
+		assert.Error(t, storeWriter.CheckSchema(
+			context.Background(), "fleet_data/", &testTableSchema{}, s3writer.ObjectOptions{}))
+	})
+
+	t.Run("no previous schema", func(t *testing.T) {
+		storeWriter := newTestStoreWriter(t, newMemoryStore(), conf.S3Config{})
+		schema, err := storeWriter.LatestSchema(context.Background(), "fleet_data/")
+		assert.NoError(t, err)
+		assert.Nil(t, schema)
+	})
+
+	t.Run("refuses to overwrite the files", func(t *testing.T) {
+		storeWriter := newTestStoreWriter(t, newMemoryStore(), conf.S3Config{})
+		assert.NoError(t, writeStoreFile(storeWriter, "my_file", s3writer.FileOptions{}))
+		assert.ErrorIs(t, writeStoreFile(storeWriter, "my_file", s3writer.FileOptions{}), s3writer.ErrObjectExists)
+		assert.NoError(t, writeStoreFile(storeWriter, "my_file", s3writer.FileOptions{Overwrite: true}))
+	})
+
+	t.Run("doesn't overwrite a file stored after the existence check", func(t *testing.T) {
+		store := newMemoryStore()
+		storeWriter := newTestStoreWriter(t, store, conf.S3Config{})
+		file, err := storeWriter.NewFile(context.Background(), "my_file", &testTableSchema{}, s3writer.FileOptions{})
+		assert.NoError(t, err)
+
+		store.mutex.Lock()
+		store.objects["my_file"] = storedObject{content: []byte("content")}
+		store.mutex.Unlock()
+		assert.NoError(t, file.AddRow(testRow))
+		assert.ErrorIs(t, file.CloseFile(), s3writer.ErrObjectExists)
+		assert.Equal(t, []byte("content"), store.objects["my_file"].content)
+	})
+
+	t.Run("detects the corrupted uploads", func(t *testing.T) {
+		for verify, reason := range map[string]string{
+			s3writer.VerifyHead:   "checksum",
+			s3writer.VerifyFooter: "checksum",
+			s3writer.VerifyNone:   "",
+		} {
+			store := newMemoryStore()
+			store.corrupt = func(content []byte) []byte {
+				content[len(content)-5] ^= 0xff
+				return content
+			}
+			storeWriter := newTestStoreWriter(t, store, conf.S3Config{VerifyUploads: verify})
+
+			err := writeStoreFile(storeWriter, "my_file", s3writer.FileOptions{})
+			if reason == "" {
+				assert.NoError(t, err)
+				continue
+			}
+			var verifyErr *s3writer.VerificationError
+			assert.ErrorAs(t, err, &verifyErr)
+			assert.Contains(t, verifyErr.Reason, reason)
+		}
+	})
+
+	t.Run("stores the tags as metadata", func(t *testing.T) {
+		store := newMemoryStore()
+		storeWriter := newTestStoreWriter(t, store, conf.S3Config{
+			TableUploads: map[string]conf.UploadConfig{"archives": {Tags: true}},
+		})
+		tags := map[string]string{s3writer.TableTag: "archives"}
+
+		assert.NoError(t, writeStoreFile(storeWriter, "archives_file", s3writer.FileOptions{
+			ObjectOptions: s3writer.ObjectOptions{Table: "archives", Tags: tags},
+		}))
+		assert.NoError(t, storeWriter.WriteObject(context.Background(), "rule_hits_object", []byte("{}"),
+			s3writer.ObjectOptions{Table: "rule_hits", Tags: tags}))
+		assert.Equal(t, tags, store.objects["archives_file"].metadata)
+		assert.Nil(t, store.objects["rule_hits_object"].metadata)
+	})
+}
+
+func TestStoreWriterObjects(t *testing.T) {
+	store := newMemoryStore()
+	storeWriter := newTestStoreWriter(t, store, conf.S3Config{})
+	ctx := context.Background()
+
+	assert.NoError(t, storeWriter.CreateObject(ctx, "log/0.json", []byte("first"), s3writer.ObjectOptions{}))
+	assert.ErrorIs(t, storeWriter.CreateObject(ctx, "log/0.json", []byte("second"), s3writer.ObjectOptions{}),
+		s3writer.ErrObjectExists)
+	assert.NoError(t, storeWriter.WriteObject(ctx, "log/0.json", []byte("third"), s3writer.ObjectOptions{}))
+	assert.Equal(t, "third", string(store.objects["log/0.json"].content))
+}
+
+func TestStoreWriterDeleteFiles(t *testing.T) {
+	t.Run("retries the files that can't be deleted", func(t *testing.T) {
+		store := newMemoryStore()
+		storeWriter := newTestStoreWriter(t, store, conf.S3Config{MaxRetries: 1})
+		storeWriter.RetryPolicy.InitialBackoff = time.Microsecond
+		for _, key := range []string{"file_1", "file_2"} {
+			assert.NoError(t, storeWriter.WriteObject(context.Background(), key, []byte{}, s3writer.ObjectOptions{}))
+		}
+		store.failedDeletes["file_2"] = 1
+
+		assert.NoError(t, storeWriter.DeleteFiles([]string{"file_1", "file_2"}))
+		assert.Empty(t, store.objects)
+	})
+
+	t.Run("returns the files that are still stored", func(t *testing.T) {
+		store := newMemoryStore()
+		storeWriter := newTestStoreWriter(t, store, conf.S3Config{})
+		store.failedDeletes["file_2"] = 1
+
+		err := storeWriter.DeleteFiles([]string{"file_1", "file_2"})
+		var deleteErr *s3writer.DeleteError
+		assert.ErrorAs(t, err, &deleteErr)
+		assert.Equal(t, []string{"file_2"}, deleteErr.Keys)
+	})
+}
+
+func TestStoreWriterFailedUpload(t *testing.T) {
+	store := &failingStore{memoryStore: newMemoryStore(), err: errors.New("upload failed")}
+	storeWriter := newTestStoreWriter(t, store, conf.S3Config{})
+
+	assert.ErrorIs(t, writeStoreFile(storeWriter, "my_file", s3writer.FileOptions{}), store.err)
+	assert.Empty(t, store.objects)
+}
+
+// failingStore fails the uploads before reading their whole content
+type failingStore struct {
+	*memoryStore
+	err error
+}
+
+func (store *failingStore) Upload(context.Context, string, io.Reader, s3writer.StoreUploadOptions) error {
+	return store.err
+}
@@ -0,0 +1,174 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+)
+
+// Ways of addressing the bucket in the requests
+const (
+	// PathAddressing puts the bucket in the path: https://endpoint/bucket/key
+	PathAddressing = "path"
+	// VirtualHostedAddressing puts the bucket in the host name:
+	// https://bucket.endpoint/key
+	VirtualHostedAddressing = "virtual"
+)
+
+// mebibyte is the unit of the multipart part size
+const mebibyte = 1024 * 1024
+
+// usePathStyle returns true if the bucket must be addressed in the path,
+// which is the default, or an error if the addressing is unknown
+func usePathStyle(addressing string) (bool, error) {
+	switch addressing {
+	case "", PathAddressing:
+		return true, nil
+	case VirtualHostedAddressing:
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown addressing %q, it must be %q or %q",
+		addressing, PathAddressing, VirtualHostedAddressing)
+}
+
+// httpClient returns the HTTP client used for the S3 requests, trusting the
+// configured CA bundle and going through the configured proxy. The proxy of
+// the HTTP_PROXY and HTTPS_PROXY environment variables is used otherwise.
+func httpClient(s3Config conf.S3Config) (*awshttp.BuildableClient, error) {
+	tlsConfig, err := newTLSConfig(s3Config)
+	if err != nil {
+		return nil, err
+	}
+
+	var proxyURL *url.URL
+	if s3Config.ProxyURL != "" {
+		proxyURL, err = url.Parse(s3Config.ProxyURL)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", s3Config.ProxyURL)
+		}
+	}
+
+	client := awshttp.NewBuildableClient().WithTransportOptions(func(transport *http.Transport) {
+		if tlsConfig != nil {
+			transport.TLSClientConfig = tlsConfig
+		}
+		if proxyURL != nil {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	})
+	if s3Config.RequestTimeout > 0 {
+		client = client.WithTimeout(time.Duration(s3Config.RequestTimeout) * time.Second)
+	}
+	return client, nil
+}
+
+// EndpointURL returns the configured endpoint with its scheme, which is
+// https if SSL is enabled and it doesn't have one
+func EndpointURL(s3Config conf.S3Config) string {
+	endpoint := s3Config.Endpoint
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		return endpoint
+	}
+	if s3Config.UseSSL {
+		return "https://" + endpoint
+	}
+	return "http://" + endpoint
+}
+
+// NewHTTPClient returns the HTTP client used for the requests to the object
+// storages other than S3, with the same transport settings as the S3 client
+func NewHTTPClient(s3Config conf.S3Config) (*http.Client, error) {
+	client, err := httpClient(s3Config)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: client.GetTransport(), Timeout: client.GetTimeout()}, nil
+}
+
+// newTLSConfig returns the TLS configuration trusting the system CAs and the
+// ones of the CA bundle, and presenting the client certificate, or nil if
+// none of them is configured
+func newTLSConfig(s3Config conf.S3Config) (*tls.Config, error) {
+	if s3Config.CABundle == "" && s3Config.ClientCert == "" && s3Config.ClientKey == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if s3Config.CABundle != "" {
+		bundle, err := os.ReadFile(s3Config.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("there are no certificates in the CA bundle %s", s3Config.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if s3Config.ClientCert != "" || s3Config.ClientKey != "" {
+		if s3Config.ClientCert == "" || s3Config.ClientKey == "" {
+			return nil, errors.New("the client certificate needs both the certificate and the key")
+		}
+		certificate, err := tls.LoadX509KeyPair(s3Config.ClientCert, s3Config.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// checkMultipart returns an error if the multipart upload settings are not valid
+func checkMultipart(s3Config conf.S3Config) error {
+	if s3Config.PartSize != 0 && int64(s3Config.PartSize)*mebibyte < manager.MinUploadPartSize {
+		return fmt.Errorf("the part size must be at least %d MiB", manager.MinUploadPartSize/mebibyte)
+	}
+	if s3Config.UploadConcurrency < 0 {
+		return errors.New("the upload concurrency can't be negative")
+	}
+	return nil
+}
+
+// uploaderOptions returns the options of the uploader of the parquet files,
+// which sends the files bigger than a part in a multipart upload
+func (s3Writer *S3Writer) uploaderOptions() []func(*manager.Uploader) { //nolint:staticcheck
+	return []func(*manager.Uploader){ //nolint:staticcheck
+		func(uploader *manager.Uploader) { //nolint:staticcheck
+			if s3Writer.partSize > 0 {
+				uploader.PartSize = s3Writer.partSize
+			}
+			if s3Writer.uploadConcurrency > 0 {
+				uploader.Concurrency = s3Writer.uploadConcurrency
+			}
+		},
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer_test
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+const emptyListing = `<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>testBucket</Name>
+  <IsTruncated>false</IsTruncated>
+  <KeyCount>0</KeyCount>
+</ListBucketResult>`
+
+// requestRecorder answers every request with an empty listing, recording
+// the host and the path they were sent to
+type requestRecorder struct {
+	hosts []string
+	paths []string
+}
+
+func (recorder *requestRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	recorder.hosts = append(recorder.hosts, r.Host)
+	recorder.paths = append(recorder.paths, r.URL.Path)
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write([]byte(emptyListing))
+}
+
+func TestCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(&requestRecorder{})
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(bundle, certificate, 0o600))
+
+	s3Conf := s3TestConf
+	s3Conf.Endpoint = server.URL
+
+	t.Run("untrusted server", func(t *testing.T) {
+		s3Writer, err := s3writer.New(s3Conf)
+		assert.NoError(t, err)
+		assert.Error(t, s3Writer.Ping(context.Background()))
+	})
+
+	t.Run("server trusted by the CA bundle", func(t *testing.T) {
+		s3Conf.CABundle = bundle
+		s3Writer, err := s3writer.New(s3Conf)
+		assert.NoError(t, err)
+		assert.NoError(t, s3Writer.Ping(context.Background()))
+	})
+}
+
+func TestProxyAndAddressing(t *testing.T) {
+	recorder := &requestRecorder{}
+	proxy := httptest.NewServer(recorder)
+	defer proxy.Close()
+
+	s3Conf := s3TestConf
+	s3Conf.Endpoint = "http://s3.example.test"
+	s3Conf.Bucket = "test-bucket"
+	s3Conf.ProxyURL = proxy.URL
+
+	for addressing, expected := range map[string][2]string{
+		"":                               {"s3.example.test", "/test-bucket"},
+		s3writer.PathAddressing:          {"s3.example.test", "/test-bucket"},
+		s3writer.VirtualHostedAddressing: {"test-bucket.s3.example.test", "/"},
+	} {
+		t.Run("addressing "+addressing, func(t *testing.T) {
+			s3Conf.Addressing = addressing
+			s3Writer, err := s3writer.New(s3Conf)
+			assert.NoError(t, err)
+
+			assert.NoError(t, s3Writer.Ping(context.Background()))
+			assert.Equal(t, expected[0], recorder.hosts[len(recorder.hosts)-1])
+			assert.Equal(t, expected[1], recorder.paths[len(recorder.paths)-1])
+		})
+	}
+}
+
+func TestInvalidTransportSettings(t *testing.T) {
+	invalidBundle := filepath.Join(t.TempDir(), "invalid.pem")
+	assert.NoError(t, os.WriteFile(invalidBundle, []byte("not a certificate"), 0o600))
+
+	for name, update := range map[string]func(*conf.S3Config){
+		"unknown addressing":      func(c *conf.S3Config) { c.Addressing = "unknown" },
+		"missing CA bundle":       func(c *conf.S3Config) { c.CABundle = "missing.pem" },
+		"invalid CA bundle":       func(c *conf.S3Config) { c.CABundle = invalidBundle },
+		"client cert without key": func(c *conf.S3Config) { c.ClientCert = "../testdata/cert.pem" },
+		"invalid client cert":     func(c *conf.S3Config) { c.ClientCert, c.ClientKey = invalidBundle, invalidBundle },
+		"invalid proxy":           func(c *conf.S3Config) { c.ProxyURL = "proxy" },
+		"small part size":         func(c *conf.S3Config) { c.PartSize = 4 },
+		"negative concurrency":    func(c *conf.S3Config) { c.UploadConcurrency = -1 },
+	} {
+		t.Run(name, func(t *testing.T) {
+			s3Conf := s3TestConf
+			update(&s3Conf)
+			_, err := s3writer.New(s3Conf)
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("valid settings", func(t *testing.T) {
+		s3Conf := s3TestConf
+		s3Conf.CABundle = "../testdata/cert.pem"
+		s3Conf.ProxyURL = "http://proxy:3128"
+		s3Conf.RequestTimeout = 30
+		s3Conf.PartSize = 16
+		s3Conf.UploadConcurrency = 2
+		_, err := s3writer.New(s3Conf)
+		assert.NoError(t, err)
+	})
+}
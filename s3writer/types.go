@@ -14,18 +14,46 @@
 
 package s3writer
 
-import "context"
+import (
+	"context"
+
+	"github.com/RedHatInsights/parquet-factory/utils"
+)
 
 // S3ParquetWriter interface for writing parquet files into S3
 type S3ParquetWriter interface {
 	Prefix() string
-	GetLastIndexForParquet(context.Context, string) map[string]int
-	NewFile(context.Context, string, interface{}) (S3ParquetFile, error)
+	GetLastIndexForParquet(context.Context, *utils.PartitionLayout, string) (map[string]int, error)
+	NewFile(context.Context, string, interface{}, FileOptions) (S3ParquetFile, error)
 	DeleteFiles([]string) error
+	CheckSchema(context.Context, string, interface{}, ObjectOptions) error
+	WriteObject(context.Context, string, []byte, ObjectOptions) error
+	CreateObject(context.Context, string, []byte, ObjectOptions) error
+	ListObjects(context.Context, string) ([]string, error)
+}
+
+// ObjectOptions identifies what an object belongs to, so it is uploaded with
+// the options configured for it
+type ObjectOptions struct {
+	// Table the object belongs to. The default upload options are used if it
+	// is empty or there are no options configured for the table.
+	Table string
+	// Tags describing the object. They are only stored if the upload options
+	// enable the tags.
+	Tags map[string]string
+}
+
+// FileOptions defines how a new parquet file is stored
+type FileOptions struct {
+	ObjectOptions
+	// Overwrite allows replacing an object already stored with the same key.
+	// The file is refused with ErrObjectExists otherwise.
+	Overwrite bool
 }
 
 // S3ParquetFile interface for interacting with parquet files into S3
 type S3ParquetFile interface {
 	AddRow(interface{}) error
 	CloseFile() error
+	Size() int64
 }
@@ -0,0 +1,175 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer
+
+import (
+	"context"
+	"crypto/md5" // #nosec G501 -- the S3 API requires the MD5 digest of the SSE-C key
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+)
+
+// Keys of the tags describing the uploaded objects
+const (
+	TableTag = "table"
+	HourTag  = "hour"
+	RunIDTag = "run_id"
+)
+
+// sseCustomerAlgorithm is the only algorithm supported by SSE-C
+const sseCustomerAlgorithm = "AES256"
+
+// sseCustomerKeySize is the size in bytes of the SSE-C keys
+const sseCustomerKeySize = 32
+
+// uploadOptions are the options the objects are uploaded with
+type uploadOptions struct {
+	serverSideEncryption types.ServerSideEncryption
+	kmsKeyID             string
+	sseCustomerKey       string
+	sseCustomerKeyMD5    string
+	storageClass         types.StorageClass
+	tags                 bool
+}
+
+// newUploadOptions returns the upload options of the given configuration, or
+// an error if they are not valid. The storage class isn't checked, as Ceph
+// allows defining custom ones.
+func newUploadOptions(config conf.UploadConfig) (uploadOptions, error) {
+	options := uploadOptions{
+		serverSideEncryption: types.ServerSideEncryption(config.ServerSideEncryption),
+		kmsKeyID:             config.KMSKeyID,
+		storageClass:         types.StorageClass(config.StorageClass),
+		tags:                 config.Tags,
+	}
+
+	if options.serverSideEncryption != "" &&
+		!slices.Contains(options.serverSideEncryption.Values(), options.serverSideEncryption) {
+		return options, fmt.Errorf("unknown server side encryption %q", config.ServerSideEncryption)
+	}
+	if options.kmsKeyID != "" && !strings.HasPrefix(config.ServerSideEncryption, "aws:kms") {
+		return options, errors.New("a KMS key can only be used with the aws:kms server side encryption")
+	}
+
+	if config.SSECustomerKey != "" {
+		if options.serverSideEncryption != "" {
+			return options, errors.New("the server side encryption can't be used along with a SSE-C key")
+		}
+		key, err := base64.StdEncoding.DecodeString(config.SSECustomerKey)
+		if err != nil || len(key) != sseCustomerKeySize {
+			return options, errors.New("the SSE-C key must be a base64 encoded 256-bit key")
+		}
+		digest := md5.Sum(key) // #nosec G401 -- the S3 API requires the MD5 digest of the SSE-C key
+		options.sseCustomerKey = config.SSECustomerKey
+		options.sseCustomerKeyMD5 = base64.StdEncoding.EncodeToString(digest[:])
+	}
+	return options, nil
+}
+
+// newTableUploadOptions returns the upload options of every configured table
+func newTableUploadOptions(configs map[string]conf.UploadConfig) (map[string]uploadOptions, error) {
+	tableOptions := map[string]uploadOptions{}
+	for table, config := range configs {
+		options, err := newUploadOptions(config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upload options of the %s table: %w", table, err)
+		}
+		tableOptions[table] = options
+	}
+	return tableOptions, nil
+}
+
+// applyToPut sets the options and the given tags in a PutObject request. The
+// uploader copies them to the multipart upload requests.
+func (options uploadOptions) applyToPut(input *s3.PutObjectInput, tags map[string]string) {
+	input.ServerSideEncryption = options.serverSideEncryption
+	if options.kmsKeyID != "" {
+		input.SSEKMSKeyId = aws.String(options.kmsKeyID)
+	}
+	if options.sseCustomerKey != "" {
+		input.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+		input.SSECustomerKey = aws.String(options.sseCustomerKey)
+		input.SSECustomerKeyMD5 = aws.String(options.sseCustomerKeyMD5)
+	}
+	input.StorageClass = options.storageClass
+	if options.tags && len(tags) > 0 {
+		input.Tagging = aws.String(encodeTags(tags))
+	}
+}
+
+// encodeTags returns the given tags encoded as URL query parameters, as
+// expected by the S3 API
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for key, value := range tags {
+		values.Set(key, value)
+	}
+	return values.Encode()
+}
+
+// uploadOptions returns the options the objects of the given table are
+// uploaded with
+func (s3Writer *S3Writer) uploadOptions(table string) uploadOptions {
+	if options, ok := s3Writer.tableUploads[table]; ok {
+		return options
+	}
+	return s3Writer.upload
+}
+
+// readClient returns the client used to read the objects of the given table.
+// The objects encrypted with a SSE-C key can only be read sending the key.
+func (s3Writer *S3Writer) readClient(table string) S3ClientAPI {
+	options := s3Writer.uploadOptions(table)
+	if options.sseCustomerKey == "" {
+		return s3Writer.S3Client
+	}
+	return sseCustomerClient{S3ClientAPI: s3Writer.S3Client, options: options}
+}
+
+// sseCustomerClient sends the SSE-C key along with every read request
+type sseCustomerClient struct {
+	S3ClientAPI
+	options uploadOptions
+}
+
+func (client sseCustomerClient) HeadObject(
+	ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options),
+) (*s3.HeadObjectOutput, error) {
+	input := *params
+	input.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+	input.SSECustomerKey = aws.String(client.options.sseCustomerKey)
+	input.SSECustomerKeyMD5 = aws.String(client.options.sseCustomerKeyMD5)
+	return client.S3ClientAPI.HeadObject(ctx, &input, optFns...)
+}
+
+func (client sseCustomerClient) GetObject(
+	ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options),
+) (*s3.GetObjectOutput, error) {
+	input := *params
+	input.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+	input.SSECustomerKey = aws.String(client.options.sseCustomerKey)
+	input.SSECustomerKeyMD5 = aws.String(client.options.sseCustomerKeyMD5)
+	return client.S3ClientAPI.GetObject(ctx, &input, optFns...)
+}
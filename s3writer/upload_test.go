@@ -0,0 +1,151 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// base64 encoded 256-bit key
+const testSSECustomerKey = "MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE="
+
+func newUploadTestWriter(t *testing.T, client s3writer.S3ClientAPI) *s3writer.S3Writer {
+	s3Conf := s3TestConf
+	s3Conf.Upload = conf.UploadConfig{
+		ServerSideEncryption: "aws:kms",
+		KMSKeyID:             "test_key",
+	}
+	s3Conf.TableUploads = map[string]conf.UploadConfig{
+		"archives":  {StorageClass: "STANDARD_IA", Tags: true},
+		"rule_hits": {SSECustomerKey: testSSECustomerKey},
+	}
+
+	s3Writer, err := s3writer.New(s3Conf)
+	assert.NoError(t, err)
+	s3Writer.S3Client = client
+	s3Writer.VerifyUploads = s3writer.VerifyFooter
+	return s3Writer
+}
+
+func TestNewInvalidUploadOptions(t *testing.T) {
+	for name, config := range map[string]conf.UploadConfig{
+		"unknown encryption":      {ServerSideEncryption: "unknown"},
+		"KMS key without KMS":     {ServerSideEncryption: "AES256", KMSKeyID: "test_key"},
+		"invalid SSE-C key":       {SSECustomerKey: "not a key"},
+		"short SSE-C key":         {SSECustomerKey: "MDEyMzQ1Njc4OQ=="},
+		"SSE-C along another SSE": {ServerSideEncryption: "AES256", SSECustomerKey: testSSECustomerKey},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s3Conf := s3TestConf
+			s3Conf.Upload = config
+			_, err := s3writer.New(s3Conf)
+			assert.Error(t, err)
+
+			s3Conf = s3TestConf
+			s3Conf.TableUploads = map[string]conf.UploadConfig{"rule_hits": config}
+			_, err = s3writer.New(s3Conf)
+			assert.ErrorContains(t, err, "rule_hits")
+		})
+	}
+}
+
+func TestWriteObjectUploadOptions(t *testing.T) {
+	client := &putObjectClient{}
+	sut := newUploadTestWriter(t, client)
+	tags := map[string]string{s3writer.TableTag: "archives", s3writer.RunIDTag: "run1"}
+
+	t.Run("default options", func(t *testing.T) {
+		assert.NoError(t, sut.WriteObject(context.Background(), "key", []byte("content"), s3writer.ObjectOptions{Tags: tags}))
+		input := client.inputs[len(client.inputs)-1]
+		assert.Equal(t, types.ServerSideEncryptionAwsKms, input.ServerSideEncryption)
+		assert.Equal(t, "test_key", aws.ToString(input.SSEKMSKeyId))
+		assert.Empty(t, input.StorageClass)
+		assert.Nil(t, input.Tagging)
+	})
+
+	t.Run("table options", func(t *testing.T) {
+		options := s3writer.ObjectOptions{Table: "archives", Tags: tags}
+		assert.NoError(t, sut.CreateObject(context.Background(), "key", []byte("content"), options))
+		input := client.inputs[len(client.inputs)-1]
+		assert.Empty(t, input.ServerSideEncryption)
+		assert.Equal(t, types.StorageClassStandardIa, input.StorageClass)
+		assert.Equal(t, "run_id=run1&table=archives", aws.ToString(input.Tagging))
+		assert.Equal(t, "*", aws.ToString(input.IfNoneMatch))
+	})
+
+	t.Run("SSE-C key", func(t *testing.T) {
+		options := s3writer.ObjectOptions{Table: "rule_hits"}
+		assert.NoError(t, sut.WriteObject(context.Background(), "key", []byte("content"), options))
+		input := client.inputs[len(client.inputs)-1]
+		assert.Equal(t, "AES256", aws.ToString(input.SSECustomerAlgorithm))
+		assert.Equal(t, testSSECustomerKey, aws.ToString(input.SSECustomerKey))
+		assert.Equal(t, "KYvwGXoFFJ42a2u2GDWhwQ==", aws.ToString(input.SSECustomerKeyMD5))
+	})
+}
+
+func TestNewFileUploadOptions(t *testing.T) {
+	writeFile := func(sut *s3writer.S3Writer, options s3writer.FileOptions) error {
+		file, err := sut.NewFile(context.Background(), "my_file", &testTableSchema{}, options)
+		if err != nil {
+			return err
+		}
+		assert.NoError(t, file.AddRow(testRow))
+		return file.CloseFile()
+	}
+
+	t.Run("storage class and tags", func(t *testing.T) {
+		client := newMemoryClient()
+		sut := newUploadTestWriter(t, client)
+
+		options := s3writer.FileOptions{ObjectOptions: s3writer.ObjectOptions{
+			Table: "archives",
+			Tags:  map[string]string{s3writer.HourTag: "2021-01-20T03:00:00Z"},
+		}}
+		assert.NoError(t, writeFile(sut, options))
+		assert.Len(t, client.inputs, 1)
+		assert.Equal(t, types.StorageClassStandardIa, client.inputs[0].StorageClass)
+		assert.Equal(t, "hour=2021-01-20T03%3A00%3A00Z", aws.ToString(client.inputs[0].Tagging))
+		assert.Equal(t, types.ChecksumAlgorithmCrc32, client.inputs[0].ChecksumAlgorithm)
+	})
+
+	t.Run("files encrypted with a SSE-C key are verified with the key", func(t *testing.T) {
+		client := newMemoryClient()
+		sut := newUploadTestWriter(t, client)
+
+		options := s3writer.FileOptions{ObjectOptions: s3writer.ObjectOptions{Table: "rule_hits"}}
+		assert.NoError(t, writeFile(sut, options))
+		assert.Equal(t, testSSECustomerKey, aws.ToString(client.inputs[0].SSECustomerKey))
+
+		// the existing file can't be replaced, which is only known reading it with the key
+		assert.ErrorIs(t, writeFile(sut, options), s3writer.ErrObjectExists)
+
+		client.objects["my_file.parquet"] = client.objects["my_file"]
+		client.sseKeys["my_file.parquet"] = client.sseKeys["my_file"]
+		schema, err := sut.LatestSchema(context.Background(), "", s3writer.ObjectOptions{Table: "rule_hits"})
+		assert.NoError(t, err)
+		assert.Len(t, schema.Columns, 2)
+
+		_, err = sut.LatestSchema(context.Background(), "", s3writer.ObjectOptions{Table: "archives"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,130 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/rs/zerolog/log"
+	"github.com/xitongsys/parquet-go/parquet"
+
+	"github.com/RedHatInsights/parquet-factory/retry"
+)
+
+// Ways of verifying the parquet files once they are uploaded
+const (
+	// VerifyNone doesn't verify the uploaded files
+	VerifyNone = "none"
+	// VerifyHead compares the size and the checksum of the stored object
+	// with the content written into the file
+	VerifyHead = "head"
+	// VerifyFooter also reads the footer of the stored file back and
+	// compares its number of rows with the rows added to the file
+	VerifyFooter = "footer"
+)
+
+// VerificationError is returned when an uploaded file doesn't match the
+// content written into it
+type VerificationError struct {
+	Key    string
+	Reason string
+}
+
+func (verifyErr *VerificationError) Error() string {
+	return fmt.Sprintf("the uploaded file %s is corrupted: %s", verifyErr.Key, verifyErr.Reason)
+}
+
+// Retryable returns true, as uploading the file again may store it correctly
+func (verifyErr *VerificationError) Retryable() bool {
+	return true
+}
+
+// verifyMode returns the given way of verifying the uploads, VerifyNone by
+// default, or an error if it is unknown
+func verifyMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return VerifyNone, nil
+	case VerifyNone, VerifyHead, VerifyFooter:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown upload verification %q, it must be %q, %q or %q",
+		mode, VerifyNone, VerifyHead, VerifyFooter)
+}
+
+// verify returns a VerificationError if the object of the given table stored
+// with the given key doesn't match the content written into the file
+func (s3Writer *S3Writer) verify(ctx context.Context, key, table string, file *countingFile, rows int64) error {
+	if s3Writer.VerifyUploads == "" || s3Writer.VerifyUploads == VerifyNone {
+		return nil
+	}
+
+	output, err := s3Writer.readClient(table).HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(s3Writer.Bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Unable to verify the uploaded file")
+		return err
+	}
+
+	if size := aws.ToInt64(output.ContentLength); size != file.written {
+		return verificationFailed(key, fmt.Sprintf("%d bytes stored, %d bytes written", size, file.written))
+	}
+	// the multipart uploads may store a checksum of the checksums of their
+	// parts instead of the checksum of the whole content, which can't be
+	// compared
+	stored := aws.ToString(output.ChecksumCRC32)
+	if stored != "" && output.ChecksumType != types.ChecksumTypeComposite && !strings.Contains(stored, "-") {
+		if written := file.Checksum(); stored != written {
+			return verificationFailed(key, fmt.Sprintf("checksum %s stored, %s written", stored, written))
+		}
+	}
+
+	if s3Writer.VerifyUploads != VerifyFooter {
+		return nil
+	}
+	return verifyRows(key, rows, func() (*parquet.FileMetaData, error) {
+		return s3Writer.readFooter(ctx, key, table)
+	})
+}
+
+// verifyRows returns a VerificationError if the footer of the stored file
+// can't be read or its number of rows doesn't match the rows written
+func verifyRows(key string, rows int64, readFooter func() (*parquet.FileMetaData, error)) error {
+	footer, err := readFooter()
+	if err != nil {
+		if retry.IsRetryable(err) {
+			log.Error().Err(err).Str("key", key).Msg("Unable to verify the uploaded file")
+			return err
+		}
+		return verificationFailed(key, err.Error())
+	}
+	if footer.NumRows != rows {
+		return verificationFailed(key, fmt.Sprintf("%d rows stored, %d rows written", footer.NumRows, rows))
+	}
+	return nil
+}
+
+func verificationFailed(key, reason string) error {
+	log.Error().Str("key", key).Str("reason", reason).Msg("The uploaded file doesn't match its content")
+	return &VerificationError{Key: key, Reason: reason}
+}
@@ -0,0 +1,213 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3writer_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// memoryClient stores the uploaded objects in memory. The stored content can
+// be corrupted to check that it is detected. The objects encrypted with a
+// SSE-C key can only be read sending the same key.
+type memoryClient struct {
+	mockS3ClientAdapter
+	objects map[string][]byte
+	sseKeys map[string]string
+	// corrupt modifies the content before storing it
+	corrupt func([]byte) []byte
+	// noChecksums simulates a server that doesn't return the checksums
+	noChecksums bool
+	inputs      []*s3.PutObjectInput
+	// listFailures is the number of listings that fail before succeeding
+	listFailures int
+	// lists counts the listings
+	lists int
+}
+
+func newMemoryClient() *memoryClient {
+	return &memoryClient{objects: map[string][]byte{}, sseKeys: map[string]string{}}
+}
+
+func (client *memoryClient) PutObject(
+	_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options),
+) (*s3.PutObjectOutput, error) {
+	content, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := client.objects[aws.ToString(params.Key)]; ok && aws.ToString(params.IfNoneMatch) == "*" {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}
+	}
+	if client.corrupt != nil {
+		content = client.corrupt(content)
+	}
+	client.objects[aws.ToString(params.Key)] = content
+	client.sseKeys[aws.ToString(params.Key)] = aws.ToString(params.SSECustomerKey)
+	client.inputs = append(client.inputs, params)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (client *memoryClient) HeadObject(
+	_ context.Context, params *s3.HeadObjectInput, _ ...func(*s3.Options),
+) (*s3.HeadObjectOutput, error) {
+	content, ok := client.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NotFound{}
+	}
+	if client.sseKeys[aws.ToString(params.Key)] != aws.ToString(params.SSECustomerKey) {
+		return nil, errors.New("wrong SSE-C key")
+	}
+
+	output := &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(content)))}
+	if params.ChecksumMode == types.ChecksumModeEnabled && !client.noChecksums {
+		checksum := binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(content))
+		output.ChecksumCRC32 = aws.String(base64.StdEncoding.EncodeToString(checksum))
+		output.ChecksumType = types.ChecksumTypeFullObject
+	}
+	return output, nil
+}
+
+func (client *memoryClient) ListObjectsV2(
+	_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options),
+) (*s3.ListObjectsV2Output, error) {
+	client.lists++
+	if client.listFailures > 0 {
+		client.listFailures--
+		return nil, &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	}
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(false)}
+	for key := range client.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > aws.ToString(params.StartAfter) {
+			output.Contents = append(output.Contents, types.Object{Key: aws.String(key), LastModified: aws.Time(time.Now())})
+		}
+	}
+	return output, nil
+}
+
+func (client *memoryClient) GetObject(
+	_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options),
+) (*s3.GetObjectOutput, error) {
+	content, ok := client.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	if client.sseKeys[aws.ToString(params.Key)] != aws.ToString(params.SSECustomerKey) {
+		return nil, errors.New("wrong SSE-C key")
+	}
+
+	if params.Range == nil {
+		return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(content))}, nil
+	}
+	var begin, end int
+	if _, err := fmt.Sscanf(aws.ToString(params.Range), "bytes=%d-%d", &begin, &end); err != nil {
+		return nil, err
+	}
+	end = min(end, len(content)-1)
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(content[begin : end+1])),
+		ContentLength: aws.Int64(int64(end + 1 - begin)),
+	}, nil
+}
+
+func writeTestFile(t *testing.T, client *memoryClient, verify string) error {
+	s3Writer := s3writer.S3Writer{S3Client: client, Bucket: "test_bucket", VerifyUploads: verify}
+
+	file, err := s3Writer.NewFile(context.Background(), "my_file", &testTableSchema{}, s3writer.FileOptions{})
+	if !assert.NoError(t, err) {
+		return err
+	}
+	assert.NoError(t, file.AddRow(testRow))
+	return file.CloseFile()
+}
+
+func TestCloseFileVerification(t *testing.T) {
+	// the length of the footer is stored right before the last 4 bytes
+	corruptFooterLength := func(content []byte) []byte {
+		content[len(content)-5] ^= 0xff
+		return content
+	}
+
+	t.Run("sends the checksum of the content", func(t *testing.T) {
+		client := newMemoryClient()
+		assert.NoError(t, writeTestFile(t, client, s3writer.VerifyHead))
+		assert.Len(t, client.inputs, 1)
+		assert.Equal(t, types.ChecksumAlgorithmCrc32, client.inputs[0].ChecksumAlgorithm)
+	})
+
+	for _, verify := range []string{"", s3writer.VerifyNone, s3writer.VerifyHead, s3writer.VerifyFooter} {
+		t.Run("valid upload verified by "+verify, func(t *testing.T) {
+			assert.NoError(t, writeTestFile(t, newMemoryClient(), verify))
+		})
+	}
+
+	t.Run("corrupted uploads aren't verified by none", func(t *testing.T) {
+		client := newMemoryClient()
+		client.corrupt = corruptFooterLength
+		assert.NoError(t, writeTestFile(t, client, s3writer.VerifyNone))
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		client := newMemoryClient()
+		client.corrupt = corruptFooterLength
+
+		err := writeTestFile(t, client, s3writer.VerifyHead)
+		var verifyErr *s3writer.VerificationError
+		assert.ErrorAs(t, err, &verifyErr)
+		assert.Equal(t, "my_file", verifyErr.Key)
+		assert.Contains(t, verifyErr.Reason, "checksum")
+		assert.True(t, verifyErr.Retryable())
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		client := newMemoryClient()
+		client.corrupt = func(content []byte) []byte { return content[:len(content)/2] }
+
+		err := writeTestFile(t, client, s3writer.VerifyHead)
+		var verifyErr *s3writer.VerificationError
+		assert.ErrorAs(t, err, &verifyErr)
+		assert.Contains(t, verifyErr.Reason, "bytes stored")
+	})
+
+	t.Run("corrupted footer without checksums", func(t *testing.T) {
+		for verify, detected := range map[string]bool{s3writer.VerifyHead: false, s3writer.VerifyFooter: true} {
+			client := newMemoryClient()
+			client.corrupt = corruptFooterLength
+			client.noChecksums = true
+
+			err := writeTestFile(t, client, verify)
+			var verifyErr *s3writer.VerificationError
+			assert.Equal(t, detected, errors.As(err, &verifyErr), verify)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testhelpers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/RedHatInsights/parquet-factory/s3writer"
+)
+
+// ObjectStore is an in-memory S3 client that only reads objects. Any other
+// request panics.
+type ObjectStore struct {
+	s3writer.S3ClientAPI
+	// Objects stores the content of the objects by bucket and key
+	Objects map[string]map[string][]byte
+	// Err is returned by every read, if it is set
+	Err error
+	// Wait blocks every read until it is closed, if it is set
+	Wait chan struct{}
+
+	mutex     sync.Mutex
+	gets      int
+	active    int
+	maxActive int
+}
+
+// NewObjectStore returns an ObjectStore with the given objects in the bucket
+func NewObjectStore(bucket string, objects map[string][]byte) *ObjectStore {
+	return &ObjectStore{Objects: map[string]map[string][]byte{bucket: objects}}
+}
+
+// GetObject returns the content of the object, or NoSuchKey if it isn't stored
+func (store *ObjectStore) GetObject(
+	ctx context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options),
+) (*s3.GetObjectOutput, error) {
+	store.mutex.Lock()
+	store.gets++
+	store.active++
+	store.maxActive = max(store.maxActive, store.active)
+	store.mutex.Unlock()
+
+	defer func() {
+		store.mutex.Lock()
+		store.active--
+		store.mutex.Unlock()
+	}()
+
+	if store.Wait != nil {
+		select {
+		case <-store.Wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if store.Err != nil {
+		return nil, store.Err
+	}
+
+	content, ok := store.Objects[aws.ToString(params.Bucket)][aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(content)),
+		ContentLength: aws.Int64(int64(len(content))),
+	}, nil
+}
+
+// Gets returns the number of objects read
+func (store *ObjectStore) Gets() int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.gets
+}
+
+// MaxConcurrentGets returns the maximum number of objects read at the same time
+func (store *ObjectStore) MaxConcurrentGets() int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.maxActive
+}
@@ -0,0 +1,162 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing configures the OpenTelemetry tracer used to instrument a
+// run of the service. Every run is represented by a root span, and the
+// partition consumers, the generated tables and the uploaded files are
+// traced as its children.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+)
+
+const (
+	// OTLPExporter sends the spans to an OTLP collector using HTTP
+	OTLPExporter = "otlp"
+	// StdoutExporter prints the spans in the standard output
+	StdoutExporter = "stdout"
+
+	tracerName  = "github.com/RedHatInsights/parquet-factory"
+	serviceName = "parquet-factory"
+	runSpanName = "run"
+)
+
+// Attributes carried by the spans
+const (
+	TopicKey       = attribute.Key("topic")
+	PartitionKey   = attribute.Key("partition")
+	OffsetKey      = attribute.Key("offset")
+	StartOffsetKey = attribute.Key("start_offset")
+	TableKey       = attribute.Key("table")
+	HourKey        = attribute.Key("hour")
+	FileKey        = attribute.Key("file")
+	RowsKey        = attribute.Key("rows")
+	ExitCodeKey    = attribute.Key("exit_code")
+)
+
+// ShutdownFunc flushes the pending spans and releases the exporter
+type ShutdownFunc func(context.Context) error
+
+var (
+	runMutex   sync.RWMutex
+	runContext = context.Background()
+)
+
+// Init configures the global tracer provider with the configured exporter.
+// If tracing is disabled the default no-op provider is kept.
+func Init(config conf.TracingConfig) (ShutdownFunc, error) {
+	noop := func(context.Context) error { return nil }
+	if !config.Enabled {
+		return noop, nil
+	}
+
+	exporter, err := newExporter(config)
+	if err != nil {
+		log.Error().Err(err).Str("exporter", config.Exporter).Msg("Unable to create the tracing exporter")
+		return noop, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	log.Info().Str("exporter", config.Exporter).Msg("Tracing enabled")
+
+	return provider.Shutdown, nil
+}
+
+func newExporter(config conf.TracingConfig) (sdktrace.SpanExporter, error) {
+	switch config.Exporter {
+	case OTLPExporter, "":
+		options := []otlptracehttp.Option{}
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(context.Background(), options...)
+	case StdoutExporter:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", config.Exporter)
+	}
+}
+
+// Tracer returns the tracer used to instrument the service
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// StartRun starts the root span of a run. The returned context is also kept
+// so the spans started from RunContext become its children.
+func StartRun(ctx context.Context) (context.Context, trace.Span) {
+	ctx, span := Tracer().Start(ctx, runSpanName)
+
+	runMutex.Lock()
+	defer runMutex.Unlock()
+	runContext = ctx
+	return ctx, span
+}
+
+// RunContext returns the context of the current run
+func RunContext() context.Context {
+	runMutex.RLock()
+	defer runMutex.RUnlock()
+	return runContext
+}
+
+// StartSpan starts a child span of the current run
+func StartSpan(name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return StartChildSpan(RunContext(), name, attributes...)
+}
+
+// StartChildSpan starts a child span of the span stored in the given context
+func StartChildSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// EndSpan records the error, if any, and ends the span
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Hour returns the attribute used to identify the hour of a partition
+func Hour(hour time.Time) attribute.KeyValue {
+	return HourKey.String(hour.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,88 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/RedHatInsights/parquet-factory/conf"
+	"github.com/RedHatInsights/parquet-factory/tracing"
+)
+
+func TestInit(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		shutdown, err := tracing.Init(conf.TracingConfig{Exporter: "unknown"})
+		assert.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("stdout exporter", func(t *testing.T) {
+		shutdown, err := tracing.Init(conf.TracingConfig{Enabled: true, Exporter: tracing.StdoutExporter})
+		assert.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("otlp exporter", func(t *testing.T) {
+		shutdown, err := tracing.Init(conf.TracingConfig{
+			Enabled:  true,
+			Exporter: tracing.OTLPExporter,
+			Endpoint: "localhost:4318",
+			Insecure: true,
+		})
+		assert.NoError(t, err)
+		// nothing was traced, so nothing is sent to the collector
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("unknown exporter", func(t *testing.T) {
+		_, err := tracing.Init(conf.TracingConfig{Enabled: true, Exporter: "unknown"})
+		assert.Error(t, err)
+	})
+}
+
+func TestRunSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, run := tracing.StartRun(context.Background())
+	ctx, table := tracing.StartSpan("write_table", tracing.TableKey.String("rule_hits"))
+	_, file := tracing.StartChildSpan(ctx, "upload_file",
+		tracing.Hour(time.Date(2026, time.January, 2, 3, 0, 0, 0, time.UTC)))
+	tracing.EndSpan(file, errors.New("upload failed"))
+	tracing.EndSpan(table, nil)
+	tracing.EndSpan(run, nil)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+	fileSpan, tableSpan, runSpan := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "run", runSpan.Name())
+	assert.Equal(t, runSpan.SpanContext().SpanID(), tableSpan.Parent().SpanID())
+	assert.Equal(t, tableSpan.SpanContext().SpanID(), fileSpan.Parent().SpanID())
+	assert.Contains(t, tableSpan.Attributes(), tracing.TableKey.String("rule_hits"))
+	assert.Contains(t, fileSpan.Attributes(), tracing.HourKey.String("2026-01-02T03:00:00Z"))
+
+	assert.Equal(t, codes.Error, fileSpan.Status().Code)
+	assert.Equal(t, codes.Unset, tableSpan.Status().Code)
+}
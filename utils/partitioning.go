@@ -0,0 +1,283 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPartitionTemplate is the partitioning layout used when a table
+	// doesn't define its own one:
+	// prefix/table_name/hourly/date=YYYY-MM-DD/hour=HH
+	DefaultPartitionTemplate = "{prefix}/{table}/hourly/date={year}-{month}-{day}/hour={hour}"
+
+	// parquetFilenameWithIndexTemplate is the name of the parquet files
+	// inside a partition: table_name-index.parquet
+	parquetFilenameWithIndexTemplate = "%v-%d.parquet"
+
+	// parquetFilenameTemplate is used for files without index, like table_name.parquet
+	parquetFilenameTemplate = "%v.parquet"
+
+	// parquetFilenameWithIDTemplate is used for files named by an identifier
+	// instead of an index: table_name-id.parquet
+	parquetFilenameWithIDTemplate = "%v-%v.parquet"
+
+	// IndexFileNaming names the files in a partition using the next index to the
+	// last one already stored there
+	IndexFileNaming = "index"
+
+	// UniqueFileNaming names the files in a partition using an identifier of the
+	// messages they were generated from, so no listing is needed
+	UniqueFileNaming = "unique"
+
+	// FilesTableFormat stores the tables as plain parquet files, visible to
+	// the readers as soon as they are uploaded
+	FilesTableFormat = "files"
+
+	// DeltaTableFormat commits the files generated for a table in every run
+	// to a Delta Lake transaction log stored under the table prefix
+	DeltaTableFormat = "delta"
+
+	// UnknownOrgID replaces the empty organizations in the partitions, so
+	// every folder of the template has a value
+	UnknownOrgID = "unknown"
+)
+
+// placeholders supported in the partitioning templates and the regular
+// expression that matches the values they are replaced with
+var placeholders = map[string]string{
+	"{prefix}": `.*`,
+	"{table}":  `[^/]+`,
+	"{year}":   `[0-9]{4}`,
+	"{month}":  `[0-9]{2}`,
+	"{day}":    `[0-9]{2}`,
+	"{hour}":   `[0-9]{2}`,
+	"{date}":   `[0-9]{4}-[0-9]{2}-[0-9]{2}`,
+	"{org_id}": `[^/]+`,
+}
+
+var placeholderRe = regexp.MustCompile(`\{[^{}]*\}`)
+
+// Partition identifies the values used to fill the placeholders of a
+// partitioning template for a group of rows
+type Partition struct {
+	Hour  time.Time
+	OrgID string
+}
+
+// PartitionKey is a partition column of a table, defined by one of the
+// folders of a partitioning template
+type PartitionKey struct {
+	Name string
+	// Value is the part of the folder holding the value of the key,
+	// like {year}-{month}-{day}
+	Value string
+}
+
+// PartitionLayout generates and parses the object keys of the parquet files
+// of a table following a partitioning template
+type PartitionLayout struct {
+	template string
+	usesOrg  bool
+	fileRe   *regexp.Regexp
+}
+
+// NewPartitionLayout validates the given template and returns a PartitionLayout
+// for it. An empty template means DefaultPartitionTemplate.
+func NewPartitionLayout(template string) (*PartitionLayout, error) {
+	template = strings.TrimSuffix(template, "/")
+	if template == "" {
+		template = DefaultPartitionTemplate
+	}
+
+	if !strings.Contains(template, "{table}") {
+		return nil, fmt.Errorf("partitioning template %q doesn't contain the {table} placeholder", template)
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	last := 0
+	for _, loc := range placeholderRe.FindAllStringIndex(template, -1) {
+		name := template[loc[0]:loc[1]]
+		valueExpr, ok := placeholders[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown placeholder %s in partitioning template %q", name, template)
+		}
+		expr.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		expr.WriteString(valueExpr)
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(template[last:]))
+	expr.WriteString(`/([^/]+)-([0-9]+)\.parquet$`)
+
+	fileRe, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &PartitionLayout{
+		template: template,
+		usesOrg:  strings.Contains(template, "{org_id}"),
+		fileRe:   fileRe,
+	}, nil
+}
+
+// DefaultPartitionLayout returns the layout for DefaultPartitionTemplate
+func DefaultPartitionLayout() *PartitionLayout {
+	layout, err := NewPartitionLayout(DefaultPartitionTemplate)
+	if err != nil {
+		panic(err)
+	}
+	return layout
+}
+
+// Template returns the partitioning template used by this layout
+func (layout *PartitionLayout) Template() string {
+	return layout.template
+}
+
+// PartitionFor returns the partition a row collected at the given time for the
+// given organization belongs to. Values not used by the template are discarded,
+// so rows are only split by the placeholders in it. The rows without an
+// organization are stored under UnknownOrgID.
+func (layout *PartitionLayout) PartitionFor(collectedAt time.Time, orgID string) Partition {
+	partition := Partition{Hour: GetHourOnly(collectedAt)}
+	if layout.usesOrg {
+		partition.OrgID = orgID
+		if orgID == "" {
+			partition.OrgID = UnknownOrgID
+		}
+	}
+	return partition
+}
+
+// TablePrefix returns the prefix shared by all the partitions of the table
+func (layout *PartitionLayout) TablePrefix(prefix, table string) string {
+	rendered := strings.NewReplacer("{prefix}", prefix, "{table}", table).Replace(layout.template)
+	if loc := placeholderRe.FindStringIndex(rendered); loc != nil {
+		// keep only the folders before the first partition value
+		return rendered[:strings.LastIndex(rendered[:loc[0]], "/")+1]
+	}
+	return rendered + "/"
+}
+
+// PartitionKeys returns the partition columns defined by the folders of the
+// template below the table prefix. The returned flag is false if any of those
+// folders doesn't follow the Hive key=value convention, so the partitions
+// can't be discovered automatically by the query engines.
+func (layout *PartitionLayout) PartitionKeys() ([]PartitionKey, bool) {
+	keys := []PartitionKey{}
+	hiveCompatible := true
+	started := false
+
+	for _, folder := range strings.Split(layout.template, "/") {
+		names := []string{}
+		usesTablePrefix := false
+		for _, name := range placeholderRe.FindAllString(folder, -1) {
+			if name == "{prefix}" || name == "{table}" {
+				usesTablePrefix = true
+				continue
+			}
+			names = append(names, strings.Trim(name, "{}"))
+		}
+
+		if len(names) == 0 {
+			// folders after the first partition one must hold a value
+			hiveCompatible = hiveCompatible && !started
+			continue
+		}
+		started = true
+		if usesTablePrefix {
+			hiveCompatible = false
+		}
+
+		if key, value, ok := strings.Cut(folder, "="); ok && !placeholderRe.MatchString(key) {
+			keys = append(keys, PartitionKey{Name: key, Value: value})
+			continue
+		}
+		hiveCompatible = false
+		keys = append(keys, PartitionKey{Name: strings.Join(names, "_"), Value: folder})
+	}
+	return keys, hiveCompatible
+}
+
+// PartitionValues returns the value of every partition key for the given
+// partition
+func (layout *PartitionLayout) PartitionValues(partition Partition) map[string]string {
+	replacer := partitionReplacer(partition, "", "")
+	keys, _ := layout.PartitionKeys()
+
+	values := map[string]string{}
+	for _, key := range keys {
+		values[key.Name] = replacer.Replace(key.Value)
+	}
+	return values
+}
+
+// HourPrefix generates the full prefix of the partition without the postfix
+// filename to be passed to GetLastIndexForParquet
+func (layout *PartitionLayout) HourPrefix(partition Partition, prefix, table string) string {
+	return partitionReplacer(partition, prefix, table).Replace(layout.template) + "/"
+}
+
+func partitionReplacer(partition Partition, prefix, table string) *strings.Replacer {
+	ts := partition.Hour
+	return strings.NewReplacer(
+		"{prefix}", prefix,
+		"{table}", table,
+		"{year}", fmt.Sprintf("%d", ts.Year()),
+		"{month}", fmt.Sprintf("%02d", ts.Month()),
+		"{day}", fmt.Sprintf("%02d", ts.Day()),
+		"{hour}", fmt.Sprintf("%02d", ts.Hour()),
+		"{date}", fmt.Sprintf("%d-%02d-%02d", ts.Year(), ts.Month(), ts.Day()),
+		"{org_id}", partition.OrgID,
+	)
+}
+
+// ParquetFilepath generates the full key of a parquet file inside the partition.
+// To generate filepath without index postfix, pass index = -1
+func (layout *PartitionLayout) ParquetFilepath(partition Partition, prefix, table string, index int) string {
+	if index == -1 {
+		return layout.HourPrefix(partition, prefix, table) + fmt.Sprintf(parquetFilenameTemplate, table)
+	}
+	return layout.HourPrefix(partition, prefix, table) + fmt.Sprintf(parquetFilenameWithIndexTemplate, table, index)
+}
+
+// UniqueParquetFilepath generates the full key of a parquet file inside the
+// partition identified by the given ID instead of an index
+func (layout *PartitionLayout) UniqueParquetFilepath(partition Partition, prefix, table, id string) string {
+	return layout.HourPrefix(partition, prefix, table) + fmt.Sprintf(parquetFilenameWithIDTemplate, table, id)
+}
+
+// ParseParquetFilepath extracts the table name and the index from the key of a
+// parquet file generated by this layout. An error is returned for any key that
+// doesn't follow the layout.
+func (layout *PartitionLayout) ParseParquetFilepath(filepath string) (string, int, error) {
+	match := layout.fileRe.FindStringSubmatch(filepath)
+	if match == nil {
+		return "", -1, fmt.Errorf("%s doesn't match the partitioning template %q", path.Base(filepath), layout.template)
+	}
+	index, err := strconv.Atoi(match[2])
+	if err != nil {
+		return "", -1, err
+	}
+	return match[1], index, nil
+}
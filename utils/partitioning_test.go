@@ -0,0 +1,228 @@
+// Copyright 2026 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RedHatInsights/parquet-factory/utils"
+)
+
+var partitionTimestamp = time.Date(2022, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+func TestNewPartitionLayout(t *testing.T) {
+	t.Run("empty template uses the default one", func(t *testing.T) {
+		layout, err := utils.NewPartitionLayout("")
+		assert.NoError(t, err)
+		assert.Equal(t, utils.DefaultPartitionTemplate, layout.Template())
+	})
+
+	t.Run("trailing slash is ignored", func(t *testing.T) {
+		layout, err := utils.NewPartitionLayout("{prefix}/{table}/{date}/")
+		assert.NoError(t, err)
+		assert.Equal(t, "{prefix}/{table}/{date}", layout.Template())
+	})
+
+	t.Run("unknown placeholder", func(t *testing.T) {
+		_, err := utils.NewPartitionLayout("{prefix}/{table}/minute={minute}")
+		assert.Error(t, err)
+	})
+
+	t.Run("missing table placeholder", func(t *testing.T) {
+		_, err := utils.NewPartitionLayout("{prefix}/date={date}")
+		assert.Error(t, err)
+	})
+}
+
+func TestPartitionLayoutPaths(t *testing.T) {
+	testCases := []struct {
+		name       string
+		template   string
+		orgID      string
+		wantPrefix string
+	}{
+		{
+			name:       "default layout",
+			template:   utils.DefaultPartitionTemplate,
+			orgID:      "1234",
+			wantPrefix: "prefix/rule_hits/hourly/date=2022-01-02/hour=03/",
+		},
+		{
+			name:       "hive partitions",
+			template:   "{prefix}/{table}/year={year}/month={month}/day={day}/hour={hour}",
+			orgID:      "1234",
+			wantPrefix: "prefix/rule_hits/year=2022/month=01/day=02/hour=03/",
+		},
+		{
+			name:       "partitioned by organization",
+			template:   "{prefix}/{table}/org_id={org_id}/date={date}/hour={hour}",
+			orgID:      "1234",
+			wantPrefix: "prefix/rule_hits/org_id=1234/date=2022-01-02/hour=03/",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			layout, err := utils.NewPartitionLayout(tc.template)
+			assert.NoError(t, err)
+
+			partition := layout.PartitionFor(partitionTimestamp, tc.orgID)
+			assert.Equal(t, tc.wantPrefix, layout.HourPrefix(partition, "prefix", "rule_hits"))
+
+			filepath := layout.ParquetFilepath(partition, "prefix", "rule_hits", 7)
+			assert.Equal(t, tc.wantPrefix+"rule_hits-7.parquet", filepath)
+			assert.Equal(t, tc.wantPrefix+"rule_hits.parquet",
+				layout.ParquetFilepath(partition, "prefix", "rule_hits", -1))
+
+			assert.Equal(t, tc.wantPrefix+"rule_hits-offsets-abc.parquet",
+				layout.UniqueParquetFilepath(partition, "prefix", "rule_hits", "offsets-abc"))
+
+			table, index, err := layout.ParseParquetFilepath(filepath)
+			assert.NoError(t, err)
+			assert.Equal(t, "rule_hits", table)
+			assert.Equal(t, 7, index)
+		})
+	}
+}
+
+func TestPartitionFor(t *testing.T) {
+	t.Run("organization is ignored if not in the template", func(t *testing.T) {
+		layout := utils.DefaultPartitionLayout()
+		partition := layout.PartitionFor(partitionTimestamp, "1234")
+		assert.Equal(t, utils.Partition{Hour: utils.GetHourOnly(partitionTimestamp)}, partition)
+	})
+
+	t.Run("organization is kept if used in the template", func(t *testing.T) {
+		layout, err := utils.NewPartitionLayout("{prefix}/{table}/{org_id}/{date}")
+		assert.NoError(t, err)
+		partition := layout.PartitionFor(partitionTimestamp, "1234")
+		assert.Equal(t, utils.Partition{Hour: utils.GetHourOnly(partitionTimestamp), OrgID: "1234"}, partition)
+	})
+
+	t.Run("empty organization", func(t *testing.T) {
+		layout, err := utils.NewPartitionLayout("{prefix}/{table}/org_id={org_id}/{date}")
+		assert.NoError(t, err)
+		partition := layout.PartitionFor(partitionTimestamp, "")
+		assert.Equal(t, utils.UnknownOrgID, partition.OrgID)
+
+		// the key of the files can be parsed to find the next index
+		key := layout.ParquetFilepath(partition, "fleet_data", "rule_hits", 3)
+		assert.Contains(t, key, "/org_id=unknown/")
+		table, index, err := layout.ParseParquetFilepath(key)
+		assert.NoError(t, err)
+		assert.Equal(t, "rule_hits", table)
+		assert.Equal(t, 3, index)
+	})
+}
+
+func TestParseParquetFilepath(t *testing.T) {
+	layout := utils.DefaultPartitionLayout()
+
+	invalidPaths := []string{
+		"prefix/rule_hits/hourly/date=2022-01-02/hour=03/rule_hits-invalid.parquet",
+		"prefix/rule_hits/hourly/date=2022-01-02/hour=03/rule_hits.parquet",
+		"prefix/rule_hits/hourly/date=2022-01-02/hour=03/nested/rule_hits-1.parquet",
+		"prefix/rule_hits/year=2022/month=01/day=02/hour=03/rule_hits-1.parquet",
+	}
+	for _, invalidPath := range invalidPaths {
+		_, _, err := layout.ParseParquetFilepath(invalidPath)
+		assert.Error(t, err, invalidPath)
+	}
+}
+
+func TestTablePrefix(t *testing.T) {
+	testCases := map[string]string{
+		utils.DefaultPartitionTemplate:                             "prefix/rule_hits/hourly/",
+		"{prefix}/{table}/org_id={org_id}/date={date}/hour={hour}": "prefix/rule_hits/",
+		"{prefix}/{table}/year={year}/month={month}/day={day}":     "prefix/rule_hits/",
+		"{prefix}/{table}": "prefix/rule_hits/",
+		"{prefix}/tables/{table}-{year}/month={month}": "prefix/tables/",
+	}
+
+	for template, want := range testCases {
+		layout, err := utils.NewPartitionLayout(template)
+		assert.NoError(t, err)
+		assert.Equal(t, want, layout.TablePrefix("prefix", "rule_hits"), template)
+	}
+}
+
+func TestPartitionKeys(t *testing.T) {
+	testCases := []struct {
+		template       string
+		wantKeys       []utils.PartitionKey
+		hiveCompatible bool
+	}{
+		{
+			template: utils.DefaultPartitionTemplate,
+			wantKeys: []utils.PartitionKey{
+				{Name: "date", Value: "{year}-{month}-{day}"},
+				{Name: "hour", Value: "{hour}"},
+			},
+			hiveCompatible: true,
+		},
+		{
+			template: "{prefix}/{table}/org_id={org_id}/date={date}",
+			wantKeys: []utils.PartitionKey{
+				{Name: "org_id", Value: "{org_id}"},
+				{Name: "date", Value: "{date}"},
+			},
+			hiveCompatible: true,
+		},
+		{
+			template: "{prefix}/{table}/{year}-{month}/hour={hour}",
+			wantKeys: []utils.PartitionKey{
+				{Name: "year_month", Value: "{year}-{month}"},
+				{Name: "hour", Value: "{hour}"},
+			},
+			hiveCompatible: false,
+		},
+		{
+			template: "{prefix}/{table}/date={date}/hourly/hour={hour}",
+			wantKeys: []utils.PartitionKey{
+				{Name: "date", Value: "{date}"},
+				{Name: "hour", Value: "{hour}"},
+			},
+			hiveCompatible: false,
+		},
+		{
+			template:       "{prefix}/{table}",
+			wantKeys:       []utils.PartitionKey{},
+			hiveCompatible: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		layout, err := utils.NewPartitionLayout(tc.template)
+		assert.NoError(t, err)
+		keys, hiveCompatible := layout.PartitionKeys()
+		assert.Equal(t, tc.wantKeys, keys, tc.template)
+		assert.Equal(t, tc.hiveCompatible, hiveCompatible, tc.template)
+	}
+}
+
+func TestPartitionValues(t *testing.T) {
+	layout, err := utils.NewPartitionLayout("{prefix}/{table}/org_id={org_id}/date={year}-{month}-{day}/{hour}")
+	assert.NoError(t, err)
+
+	partition := layout.PartitionFor(partitionTimestamp, "1234")
+	assert.Equal(t, map[string]string{
+		"org_id": "1234",
+		"date":   "2022-01-02",
+		"hour":   "03",
+	}, layout.PartitionValues(partition))
+}
@@ -16,26 +16,12 @@ package utils
 
 import (
 	"encoding/json"
-	"fmt"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
-const (
-	// parquetFilepathWithIndexTemplate is a template for generating filepaths of parquet files
-	// prefix/table_name/hourly/date=YYYY-MM-DD/hour=HH/filename-index.parquet
-	parquetFilepathWithIndexTemplate = "%v/%v/hourly/date=%d-%02d-%02d/hour=%02d/%v-%d.parquet"
-
-	// for files without index, like file_without_index.parquet
-	// prefix/table_name/hourly/date=YYYY-MM-DD/hour=HH/filename.parquet
-	parquetFilepathTemplate = "%v/%v/hourly/date=%d-%02d-%02d/hour=%02d/%v.parquet"
-
-	// for passing to GetLastIndexForParquet
-	hourPrefixTemplate = "%v/%v/hourly/date=%d-%02d-%02d/hour=%02d/"
-)
-
 // minimal struct to parse only the archive path into json
 type archivePath struct {
 	Path string `json:"path"`
@@ -135,31 +121,17 @@ func GetHourOnly(t time.Time) time.Time {
 	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
 }
 
-// GenerateParquetFilepath generates a full filepath for the file uploaded to Ceph/S3.
+// GenerateParquetFilepath generates a full filepath for the file uploaded to Ceph/S3
+// using the default partitioning layout.
 // To generate filepath without index postfix, pass index = -1
 func GenerateParquetFilepath(timestamp time.Time, prefix, filename string, index int) string {
-	var formatted string
-
-	if index != -1 {
-		formatted = fmt.Sprintf(parquetFilepathWithIndexTemplate,
-			prefix, filename, timestamp.Year(), timestamp.Month(), timestamp.Day(),
-			timestamp.Hour(), filename, index,
-		)
-	} else {
-		formatted = fmt.Sprintf(parquetFilepathTemplate,
-			prefix, filename, timestamp.Year(), timestamp.Month(), timestamp.Day(),
-			timestamp.Hour(), filename,
-		)
-	}
-	return formatted
+	return DefaultPartitionLayout().ParquetFilepath(Partition{Hour: timestamp}, prefix, filename, index)
 }
 
 // GenerateHourPrefix generates the full prefix for the current timestamp (hour) without the postfix
-// filename to be passed to GetLastIndexForParquet
+// filename to be passed to GetLastIndexForParquet, using the default partitioning layout
 func GenerateHourPrefix(timestamp time.Time, prefix, filename string) string {
-	return fmt.Sprintf(hourPrefixTemplate,
-		prefix, filename, timestamp.Year(), timestamp.Month(), timestamp.Day(), timestamp.Hour(),
-	)
+	return DefaultPartitionLayout().HourPrefix(Partition{Hour: timestamp}, prefix, filename)
 }
 
 // GetPathFromRawMsg given a message return its "path" key